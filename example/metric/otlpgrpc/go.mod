@@ -39,4 +39,6 @@ replace github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/clou
 
 replace github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/resourcemapping => ../../../internal/resourcemapping
 
+replace github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/descriptorcache => ../../../internal/descriptorcache
+
 replace github.com/GoogleCloudPlatform/opentelemetry-operations-go/detectors/gcp => ../../../detectors/gcp
@@ -22,9 +22,11 @@ import (
 	"strings"
 	"time"
 
-	"go.opencensus.io/plugin/ocgrpc"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/metric"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/impersonate"
 	"google.golang.org/api/option"
@@ -79,6 +81,8 @@ type TraceConfig struct {
 	AttributeMappings []AttributeMapping `mapstructure:"attribute_mappings"`
 
 	ClientConfig ClientConfig `mapstructure:",squash"`
+	// WALConfig holds configuration settings for the write ahead log.
+	WALConfig *WALConfig `mapstructure:"experimental_wal_config"`
 }
 
 // AttributeMapping maps from an OpenTelemetry key to a Google Cloud Trace key.
@@ -119,6 +123,22 @@ type MetricConfig struct {
 	// which asynchronously calls CreateMetricDescriptor. Default is 10.
 	CreateMetricDescriptorBufferSize int  `mapstructure:"create_metric_descriptor_buffer_size"`
 	SkipCreateMetricDescriptor       bool `mapstructure:"skip_create_descriptor"`
+	// DescriptorReconciliation enables comparing the metric descriptors
+	// which already exist with the descriptors of the metrics written, to
+	// detect conflicting labels, kinds and value types. Optional.
+	DescriptorReconciliation *DescriptorReconciliationConfig `mapstructure:"experimental_descriptor_reconciliation"`
+	// MetricDescriptorCache configures saving the metric descriptors created
+	// to disk, so that they are not created again after restarts. Optional.
+	MetricDescriptorCache *MetricDescriptorCacheConfig `mapstructure:"experimental_metric_descriptor_cache"`
+	// MaxConcurrentRequests is the maximum number of CreateTimeSeries
+	// requests sent concurrently by the exporter. Requests share the
+	// connections of the client's gRPC pool (see GRPCPoolSize). Default is 1,
+	// which sends requests sequentially.
+	MaxConcurrentRequests int `mapstructure:"experimental_max_concurrent_requests"`
+	// MaxConcurrentRequestsPerProject is the maximum number of
+	// CreateTimeSeries requests sent concurrently to each destination
+	// project. Default is MaxConcurrentRequests.
+	MaxConcurrentRequestsPerProject int `mapstructure:"experimental_max_concurrent_requests_per_project"`
 	// CreateServiceTimeSeries, if true, this will send all timeseries using `CreateServiceTimeSeries`.
 	// Implicitly, this sets `SkipMetricDescriptor` to true.
 	CreateServiceTimeSeries bool `mapstructure:"create_service_timeseries"`
@@ -136,6 +156,48 @@ type MetricConfig struct {
 	// It is enabled by default. Since it caches starting points, it may result in
 	// increased memory usage.
 	CumulativeNormalization bool `mapstructure:"cumulative_normalization"`
+	// CumulativeNormalizationState configures saving the points cached by
+	// CumulativeNormalization to disk, so that they are preserved across
+	// restarts. Optional.
+	CumulativeNormalizationState *NormalizationStateConfig `mapstructure:"experimental_cumulative_normalization_state"`
+	// CumulativeNormalizationCache limits the memory used by the points
+	// cached for CumulativeNormalization.
+	CumulativeNormalizationCache NormalizationCacheConfig `mapstructure:"experimental_cumulative_normalization_cache"`
+	// LabelLimitPolicy determines how metric labels which exceed Cloud
+	// Monitoring's limits on the length of label keys and values are handled:
+	// "truncate" (default) truncates them, and "drop" drops them. Labels
+	// beyond the maximum number of labels per metric are dropped with either
+	// policy.
+	LabelLimitPolicy string `mapstructure:"experimental_label_limit_policy"`
+	// Aggregations remove labels from metrics, and re-aggregate the points
+	// of series which become the same series, to reduce the number of time
+	// series written. The first aggregation whose MetricRegex matches a
+	// metric's name applies. Optional.
+	Aggregations []AggregationConfig `mapstructure:"experimental_aggregations"`
+	// Rules include or exclude metrics by name, and override how the metrics
+	// they include are written. The first rule whose MetricRegex matches a
+	// metric's name applies. Metrics which match no rule are written
+	// unchanged. Optional.
+	Rules []MetricRuleConfig `mapstructure:"experimental_rules"`
+	// ExponentialHistogramMaxBuckets is the maximum number of buckets of the
+	// distributions exponential histograms are mapped to, including the
+	// underflow and overflow buckets. Histograms with more buckets are
+	// downscaled by merging adjacent buckets. Default is 200, the maximum
+	// accepted by Cloud Monitoring.
+	ExponentialHistogramMaxBuckets int `mapstructure:"experimental_exponential_histogram_max_buckets"`
+	// WriteThrottle limits how often points are written for each series.
+	// Cloud Monitoring rejects points written more often than once every 5
+	// seconds for the same series. Optional.
+	WriteThrottle *WriteThrottleConfig `mapstructure:"experimental_write_throttle"`
+	// DeltaToCumulative enables accumulating delta sums and histograms into
+	// cumulative points, instead of sending each delta as a cumulative point
+	// with its own start time. Optional.
+	DeltaToCumulative *DeltaToCumulativeConfig `mapstructure:"experimental_delta_to_cumulative"`
+	// ExemplarTraceProjectAttribute is the filtered attribute of exemplars
+	// which holds the project of the trace the exemplar was recorded in, e.g.
+	// "gcp.project.id". Exemplars without it link to traces in the project
+	// the metric is written to. Optional.
+	ExemplarTraceProjectAttribute string `mapstructure:"experimental_exemplar_trace_project_attribute"`
 	// EnableSumOfSquaredDeviation enables calculation of an estimated sum of squared
 	// deviation.  It isn't correct, so we don't send it by default, and don't expose
 	// it to users. For some uses, it is expected, however.
@@ -151,6 +213,128 @@ type WALConfig struct {
 	Directory string `mapstructure:"directory"`
 	// MaxBackoff sets the length of time to exponentially re-try failed exports.
 	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	// MaxSizeBytes bounds the size of the WAL on disk. When the WAL grows
+	// beyond this size, the oldest entries are dropped. For metrics, the
+	// limit is shared by the WALs of all destination projects. Default is 0,
+	// which means unlimited.
+	MaxSizeBytes int64 `mapstructure:"max_size_bytes"`
+	// MaxAge is the maximum age of data in the WAL. Requests which are older
+	// than MaxAge are dropped instead of being exported. Default is 0, which
+	// means unlimited.
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// DeadLetter enables writing requests which permanently fail to export,
+	// or which exceed MaxBackoff, to a separate dead-letter WAL in the
+	// "dead_letter" subdirectory of Directory, instead of dropping them.
+	DeadLetter bool `mapstructure:"dead_letter"`
+}
+
+// NormalizationCacheConfig defines the limits of the cache of points used for
+// cumulative normalization.
+type NormalizationCacheConfig struct {
+	// MaxPoints is the maximum number of points in each of the caches used
+	// for normalization: the first points of series, and their previous
+	// points. When exceeded, the least recently used points are evicted, and
+	// the next point of an evicted series is treated as its first point.
+	// Default is 0, which means unlimited.
+	MaxPoints int `mapstructure:"max_points"`
+	// GCInterval is how often series which were not used since the previous
+	// interval are removed from the cache. Default is 20 minutes.
+	GCInterval time.Duration `mapstructure:"gc_interval"`
+}
+
+// DeltaToCumulativeConfig defines configuration for accumulating delta points
+// into cumulative points.
+type DeltaToCumulativeConfig struct {
+	// MaxSeries is the maximum number of series to accumulate. When exceeded,
+	// the least recently used series are evicted, and start a new cumulative
+	// series on their next point. Default is 0, which means unlimited.
+	MaxSeries int `mapstructure:"max_series"`
+	// GCInterval is how often series which were not updated since the
+	// previous interval are removed. Default is 20 minutes.
+	GCInterval time.Duration `mapstructure:"gc_interval"`
+}
+
+// AggregationConfig defines labels to remove from metrics before they are
+// sent.
+type AggregationConfig struct {
+	// MetricRegex matches the names of the metrics to aggregate.
+	MetricRegex string `mapstructure:"metric_regex"`
+	// GaugeAggregation determines how the points of gauges are combined:
+	// "last" (default), "min", "max", or "mean". The mean of int gauges is
+	// rounded.
+	GaugeAggregation string `mapstructure:"gauge_aggregation"`
+	// DropLabels are the attributes to remove from the points of matching
+	// metrics.
+	DropLabels []string `mapstructure:"drop_labels"`
+}
+
+// DescriptorReconciliationConfig defines configuration for reconciling
+// existing metric descriptors with the descriptors of the metrics written.
+type DescriptorReconciliationConfig struct {
+	// UpdateLabels enables adding the labels of the metrics written which
+	// are missing from existing metric descriptors. Descriptors with
+	// conflicting kinds or value types are never updated.
+	UpdateLabels bool `mapstructure:"update_labels"`
+}
+
+// MetricDescriptorCacheConfig defines configuration for persisting the
+// metric descriptors created by the exporter.
+type MetricDescriptorCacheConfig struct {
+	// Directory is the location to store the metric descriptor cache.
+	Directory string `mapstructure:"directory"`
+	// TTL is how long descriptors are cached after they are created. Once
+	// it expires, they are created again. Default is 24 hours.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// MetricRuleConfig defines whether the metrics matching MetricRegex are
+// written, and overrides the type, descriptor and kind of the metrics which
+// are.
+type MetricRuleConfig struct {
+	// MetricRegex matches the names of the metrics the rule applies to.
+	MetricRegex string `mapstructure:"metric_regex"`
+	// Action determines whether matching metrics are written: "include"
+	// (default) or "exclude". Overrides can only be set on include rules.
+	Action string `mapstructure:"action"`
+	// MetricType replaces the metric type (i.e. name) written to GCM,
+	// including the domain, e.g. "custom.googleapis.com/my_metric". It may
+	// reference capture groups of MetricRegex, e.g. "$1". The prefix and
+	// GetMetricName are not applied to it.
+	MetricType string `mapstructure:"metric_type"`
+	// Unit overrides the unit of the time series and metric descriptor.
+	Unit string `mapstructure:"unit"`
+	// Description overrides the description of the metric descriptor.
+	Description string `mapstructure:"description"`
+	// DisplayName overrides the display name of the metric descriptor.
+	DisplayName string `mapstructure:"display_name"`
+	// MetricKind pins the kind of the metric: "gauge" writes all points as
+	// gauges, and "cumulative" writes non-monotonic sums as cumulatives
+	// instead of gauges. "cumulative" has no effect on other metrics, which
+	// can't be checked when the config is validated since the rule matches
+	// metrics by name.
+	MetricKind string `mapstructure:"metric_kind"`
+}
+
+// WriteThrottleConfig defines configuration for limiting how often points are
+// written for each series.
+type WriteThrottleConfig struct {
+	// Policy determines which points are written when points of a series
+	// arrive faster than MinInterval: "coalesce" (default) keeps the latest
+	// point, and "drop" keeps the earliest point.
+	Policy string `mapstructure:"policy"`
+	// MinInterval is the minimum interval between the end times of points
+	// written for a series. Default is 5 seconds.
+	MinInterval time.Duration `mapstructure:"min_interval"`
+}
+
+// NormalizationStateConfig defines configuration for persisting the state of
+// cumulative normalization.
+type NormalizationStateConfig struct {
+	// Directory is the location to store the normalization state.
+	Directory string `mapstructure:"directory"`
+	// FlushInterval is how often the state is saved. It is also saved on
+	// shutdown. Default is 1 minute.
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
 }
 
 // ImpersonateConfig defines configuration for service account impersonation.
@@ -188,6 +372,18 @@ type LogConfig struct {
 	// ErrorReportingType enables automatically parsing error logs to a json payload containing the
 	// type value for GCP Error Reporting. See https://cloud.google.com/error-reporting/docs/formatting-error-messages#log-text.
 	ErrorReportingType bool `mapstructure:"error_reporting_type"`
+	// ParseSpecialFields enables lifting the special fields of structured log payloads, such as
+	// severity and logging.googleapis.com/trace, out of map bodies into the corresponding
+	// LogEntry fields, as done by the Cloud Logging agents.
+	// See https://cloud.google.com/logging/docs/structured-logging#special-payload-fields.
+	ParseSpecialFields bool `mapstructure:"experimental_parse_special_fields"`
+	// HTTPRequestFromSemconv enables building the HttpRequest of log entries from the current
+	// and legacy HTTP semantic convention attributes (e.g. http.request.method or http.method),
+	// when the gcp.http_request attribute is absent. The attributes used are not added to the
+	// entry labels.
+	HTTPRequestFromSemconv bool `mapstructure:"experimental_http_request_from_semconv"`
+	// WALConfig holds configuration settings for the write ahead log.
+	WALConfig *WALConfig `mapstructure:"experimental_wal_config"`
 }
 
 // Known metric domains. Note: This is now configurable for advanced usages.
@@ -247,16 +443,142 @@ func ValidateConfig(cfg Config) error {
 	if len(cfg.TraceConfig.ClientConfig.Compression) > 0 {
 		return fmt.Errorf("traces.compression invalid: compression is only available for logs and metrics")
 	}
+	if err := validateWALConfig("metric", cfg.MetricConfig.WALConfig); err != nil {
+		return err
+	}
+	if err := validateWALConfig("log", cfg.LogConfig.WALConfig); err != nil {
+		return err
+	}
+	if err := validateWALConfig("trace", cfg.TraceConfig.WALConfig); err != nil {
+		return err
+	}
+	switch cfg.MetricConfig.LabelLimitPolicy {
+	case "", LabelLimitPolicyTruncate, LabelLimitPolicyDrop:
+	default:
+		return fmt.Errorf("unknown metric.experimental_label_limit_policy '%s', allowed values: '%s', '%s'", cfg.MetricConfig.LabelLimitPolicy, LabelLimitPolicyTruncate, LabelLimitPolicyDrop)
+	}
+	for _, aggregation := range cfg.MetricConfig.Aggregations {
+		if _, err := regexp.Compile(aggregation.MetricRegex); err != nil {
+			return fmt.Errorf("unable to parse metric.experimental_aggregations metric_regex: %s", err.Error())
+		}
+		switch aggregation.GaugeAggregation {
+		case "", GaugeAggregationLast, GaugeAggregationMin, GaugeAggregationMax, GaugeAggregationMean:
+		default:
+			return fmt.Errorf("unknown metric.experimental_aggregations gauge_aggregation '%s', allowed values: '%s', '%s', '%s', '%s'", aggregation.GaugeAggregation, GaugeAggregationLast, GaugeAggregationMin, GaugeAggregationMax, GaugeAggregationMean)
+		}
+	}
+	for _, rule := range cfg.MetricConfig.Rules {
+		if err := validateMetricRule(rule); err != nil {
+			return err
+		}
+	}
+	if cfg.MetricConfig.ExponentialHistogramMaxBuckets < 0 {
+		return fmt.Errorf("metric.experimental_exponential_histogram_max_buckets invalid: must not be negative")
+	}
+	if cfg.MetricConfig.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("metric.experimental_max_concurrent_requests invalid: must not be negative")
+	}
+	if cfg.MetricConfig.MaxConcurrentRequestsPerProject < 0 {
+		return fmt.Errorf("metric.experimental_max_concurrent_requests_per_project invalid: must not be negative")
+	}
+	if throttle := cfg.MetricConfig.WriteThrottle; throttle != nil {
+		switch throttle.Policy {
+		case "", WriteThrottlePolicyCoalesce, WriteThrottlePolicyDrop:
+		default:
+			return fmt.Errorf("unknown metric.experimental_write_throttle.policy '%s', allowed values: '%s', '%s'", throttle.Policy, WriteThrottlePolicyCoalesce, WriteThrottlePolicyDrop)
+		}
+		if throttle.MinInterval < 0 {
+			return fmt.Errorf("metric.experimental_write_throttle.min_interval invalid: must not be negative")
+		}
+	}
+	if cfg.MetricConfig.CumulativeNormalizationCache.MaxPoints < 0 {
+		return fmt.Errorf("metric.experimental_cumulative_normalization_cache.max_points invalid: must not be negative")
+	}
+	if cfg.MetricConfig.CumulativeNormalizationCache.GCInterval < 0 {
+		return fmt.Errorf("metric.experimental_cumulative_normalization_cache.gc_interval invalid: must not be negative")
+	}
+	if deltaCfg := cfg.MetricConfig.DeltaToCumulative; deltaCfg != nil && (deltaCfg.MaxSeries < 0 || deltaCfg.GCInterval < 0) {
+		return fmt.Errorf("metric.experimental_delta_to_cumulative invalid: max_series and gc_interval must not be negative")
+	}
+	if mdCache := cfg.MetricConfig.MetricDescriptorCache; mdCache != nil {
+		if mdCache.Directory == "" {
+			return fmt.Errorf("metric.experimental_metric_descriptor_cache.directory invalid: must be set")
+		}
+		if mdCache.TTL < 0 {
+			return fmt.Errorf("metric.experimental_metric_descriptor_cache.ttl invalid: must not be negative")
+		}
+	}
+	if state := cfg.MetricConfig.CumulativeNormalizationState; state != nil {
+		if state.Directory == "" {
+			return fmt.Errorf("metric.experimental_cumulative_normalization_state.directory invalid: must be set")
+		}
+		if state.FlushInterval < 0 {
+			return fmt.Errorf("metric.experimental_cumulative_normalization_state.flush_interval invalid: must not be negative")
+		}
+	}
 
 	return nil
 }
 
+func validateWALConfig(signal string, cfg *WALConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.MaxSizeBytes < 0 {
+		return fmt.Errorf("%s.experimental_wal_config.max_size_bytes invalid: must not be negative", signal)
+	}
+	if cfg.MaxAge < 0 {
+		return fmt.Errorf("%s.experimental_wal_config.max_age invalid: must not be negative", signal)
+	}
+	return nil
+}
+
+func validateMetricRule(rule MetricRuleConfig) error {
+	if rule.MetricRegex == "" {
+		return fmt.Errorf("metric.experimental_rules metric_regex invalid: must not be empty")
+	}
+	if _, err := regexp.Compile(rule.MetricRegex); err != nil {
+		return fmt.Errorf("unable to parse metric.experimental_rules metric_regex: %s", err.Error())
+	}
+	switch rule.Action {
+	case "", MetricRuleActionInclude:
+	case MetricRuleActionExclude:
+		if rule.MetricType != "" || rule.Unit != "" || rule.Description != "" || rule.DisplayName != "" || rule.MetricKind != "" {
+			return fmt.Errorf("metric.experimental_rules invalid: rules with action '%s' must not override metric_type, unit, description, display_name or metric_kind", MetricRuleActionExclude)
+		}
+	default:
+		return fmt.Errorf("unknown metric.experimental_rules action '%s', allowed values: '%s', '%s'", rule.Action, MetricRuleActionInclude, MetricRuleActionExclude)
+	}
+	if rule.MetricType != "" {
+		domain, name, found := strings.Cut(rule.MetricType, "/")
+		if !found || domain == "" || name == "" {
+			return fmt.Errorf("metric.experimental_rules metric_type invalid: %q must include a domain and a name, e.g. 'custom.googleapis.com/my_metric'", rule.MetricType)
+		}
+	}
+	switch rule.MetricKind {
+	case "", MetricKindGauge, MetricKindCumulative:
+	default:
+		return fmt.Errorf("unknown metric.experimental_rules metric_kind '%s', allowed values: '%s', '%s'", rule.MetricKind, MetricKindGauge, MetricKindCumulative)
+	}
+	return nil
+}
+
 func setVersionInUserAgent(cfg *Config, version string) {
 	cfg.UserAgent = strings.ReplaceAll(cfg.UserAgent, "{{version}}", version)
 }
 
-func generateClientOptions(ctx context.Context, clientCfg *ClientConfig, cfg *Config, scopes []string) ([]option.ClientOption, error) {
-	var copts []option.ClientOption
+func generateClientOptions(ctx context.Context, clientCfg *ClientConfig, cfg *Config, scopes []string, meterProvider metric.MeterProvider) ([]option.ClientOption, error) {
+	// The gRPC client metrics are recorded with the exporter's meter provider,
+	// instead of the OpenCensus instrumentation of the client libraries. The
+	// exporter's own requests are not traced.
+	statsHandler := grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+		otelgrpc.WithMeterProvider(meterProvider),
+		otelgrpc.WithTracerProvider(tracenoop.NewTracerProvider()),
+	))
+	copts := []option.ClientOption{
+		option.WithTelemetryDisabled(),
+		option.WithGRPCDialOption(statsHandler),
+	}
 	// option.WithUserAgent is used by the Trace exporter, but not the Metric exporter (see comment below)
 	if cfg.UserAgent != "" {
 		copts = append(copts, option.WithUserAgent(cfg.UserAgent))
@@ -266,7 +588,7 @@ func generateClientOptions(ctx context.Context, clientCfg *ClientConfig, cfg *Co
 			// option.WithGRPCConn option takes precedent over all other supplied options so the
 			// following user agent will be used by both exporters if we reach this branch
 			dialOpts := []grpc.DialOption{
-				grpc.WithStatsHandler(&ocgrpc.ClientHandler{}),
+				statsHandler,
 				grpc.WithTransportCredentials(insecure.NewCredentials()),
 			}
 			if cfg.UserAgent != "" {
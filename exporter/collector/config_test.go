@@ -14,7 +14,10 @@
 
 package collector
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestValidateConfig(t *testing.T) {
 	for _, tc := range []struct {
@@ -75,6 +78,206 @@ func TestValidateConfig(t *testing.T) {
 			},
 			expectedErr: true,
 		},
+		{
+			desc: "Unknown label limit policy",
+			input: Config{
+				MetricConfig: MetricConfig{
+					LabelLimitPolicy: "ignore",
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Invalid aggregation metric regex",
+			input: Config{
+				MetricConfig: MetricConfig{
+					Aggregations: []AggregationConfig{{MetricRegex: "(abc"}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Unknown gauge aggregation",
+			input: Config{
+				MetricConfig: MetricConfig{
+					Aggregations: []AggregationConfig{{MetricRegex: "foo", GaugeAggregation: "median"}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Valid metric rules",
+			input: Config{
+				MetricConfig: MetricConfig{
+					Rules: []MetricRuleConfig{
+						{MetricRegex: "^app\\.(.*)$", MetricType: "custom.googleapis.com/$1", MetricKind: MetricKindGauge},
+						{MetricRegex: ".*", Action: MetricRuleActionExclude},
+					},
+				},
+			},
+		},
+		{
+			desc: "Metric rule without regex",
+			input: Config{
+				MetricConfig: MetricConfig{
+					Rules: []MetricRuleConfig{{Unit: "By"}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Invalid metric rule regex",
+			input: Config{
+				MetricConfig: MetricConfig{
+					Rules: []MetricRuleConfig{{MetricRegex: "[a-z"}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Unknown metric rule action",
+			input: Config{
+				MetricConfig: MetricConfig{
+					Rules: []MetricRuleConfig{{MetricRegex: "foo", Action: "drop"}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Exclude metric rule with overrides",
+			input: Config{
+				MetricConfig: MetricConfig{
+					Rules: []MetricRuleConfig{{MetricRegex: "foo", Action: MetricRuleActionExclude, Unit: "By"}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Metric rule type without domain",
+			input: Config{
+				MetricConfig: MetricConfig{
+					Rules: []MetricRuleConfig{{MetricRegex: "foo", MetricType: "bar"}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Unknown metric rule kind",
+			input: Config{
+				MetricConfig: MetricConfig{
+					Rules: []MetricRuleConfig{{MetricRegex: "foo", MetricKind: "delta"}},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Negative exponential histogram max buckets",
+			input: Config{
+				MetricConfig: MetricConfig{
+					ExponentialHistogramMaxBuckets: -1,
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Negative max concurrent requests",
+			input: Config{
+				MetricConfig: MetricConfig{
+					MaxConcurrentRequests: -1,
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Negative max concurrent requests per project",
+			input: Config{
+				MetricConfig: MetricConfig{
+					MaxConcurrentRequestsPerProject: -1,
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Unknown write throttle policy",
+			input: Config{
+				MetricConfig: MetricConfig{
+					WriteThrottle: &WriteThrottleConfig{Policy: "ignore"},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Negative write throttle interval",
+			input: Config{
+				MetricConfig: MetricConfig{
+					WriteThrottle: &WriteThrottleConfig{MinInterval: -time.Second},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Negative WAL max size",
+			input: Config{
+				MetricConfig: MetricConfig{
+					WALConfig: &WALConfig{MaxSizeBytes: -1},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Negative WAL max age",
+			input: Config{
+				LogConfig: LogConfig{
+					WALConfig: &WALConfig{MaxAge: -time.Second},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Negative normalization cache max series",
+			input: Config{
+				MetricConfig: MetricConfig{
+					CumulativeNormalizationCache: NormalizationCacheConfig{MaxPoints: -1},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Negative delta to cumulative max series",
+			input: Config{
+				MetricConfig: MetricConfig{
+					DeltaToCumulative: &DeltaToCumulativeConfig{MaxSeries: -1},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Normalization state without directory",
+			input: Config{
+				MetricConfig: MetricConfig{
+					CumulativeNormalizationState: &NormalizationStateConfig{},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Metric descriptor cache without directory",
+			input: Config{
+				MetricConfig: MetricConfig{
+					MetricDescriptorCache: &MetricDescriptorCacheConfig{TTL: time.Hour},
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "Negative metric descriptor cache TTL",
+			input: Config{
+				MetricConfig: MetricConfig{
+					MetricDescriptorCache: &MetricDescriptorCacheConfig{Directory: "/tmp", TTL: -time.Hour},
+				},
+			},
+			expectedErr: true,
+		},
 	} {
 		t.Run(tc.desc, func(t *testing.T) {
 			err := ValidateConfig(tc.input)
@@ -89,7 +89,7 @@ func (fr fixtureRecorder) recordTraces(ctx context.Context, t *FakeTesting, star
 
 		func() {
 			traces := test.LoadOTLPTracesInput(t, startTime, endTime)
-			testServerExporter := integrationtest.NewTraceTestExporter(ctx, t, testServer, test.CreateTraceConfig())
+			testServerExporter := integrationtest.NewTraceTestExporter(ctx, t, testServer, test.CreateTraceConfig(), nil)
 
 			require.NoError(t, testServerExporter.PushTraces(ctx, traces), "failed to export logs to local test server")
 			require.NoError(t, testServerExporter.Shutdown(ctx))
@@ -121,7 +121,7 @@ func (fr fixtureRecorder) recordLogs(ctx context.Context, t *FakeTesting, timest
 
 		func() {
 			logs := test.LoadOTLPLogsInput(t, timestamp)
-			testServerExporter := integrationtest.NewLogTestExporter(ctx, t, testServer, test.CreateLogConfig(), test.ConfigureLogsExporter)
+			testServerExporter := integrationtest.NewLogTestExporter(ctx, t, testServer, test.CreateLogConfig(), test.ConfigureLogsExporter, nil)
 
 			require.NoError(t, testServerExporter.PushLogs(ctx, logs), "failed to export logs to local test server")
 			require.NoError(t, testServerExporter.Shutdown(ctx))
@@ -153,11 +153,11 @@ func (fr fixtureRecorder) recordMetrics(ctx context.Context, t *FakeTesting, sta
 
 		func() {
 			metrics := test.LoadOTLPMetricsInput(t, startTime, endTime)
-			testServerExporter := integrationtest.NewMetricTestExporter(ctx, t, testServer, test.CreateCollectorMetricConfig())
-			inMemoryOCExporter, err := integrationtest.NewInMemoryOCViewExporter()
+			inMemoryOTelExporter, err := integrationtest.NewInMemoryOTelExporter()
 			require.NoError(t, err)
 			//nolint:errcheck
-			defer inMemoryOCExporter.Shutdown(ctx)
+			defer inMemoryOTelExporter.Shutdown(ctx)
+			testServerExporter := integrationtest.NewMetricTestExporter(ctx, t, testServer, test.CreateCollectorMetricConfig(), inMemoryOTelExporter.MeterProvider())
 
 			err = testServerExporter.PushMetrics(ctx, metrics)
 			if !test.ExpectErr {
@@ -167,7 +167,7 @@ func (fr fixtureRecorder) recordMetrics(ctx context.Context, t *FakeTesting, sta
 			}
 			require.NoError(t, testServerExporter.Shutdown(ctx))
 
-			selfObsMetrics, err := inMemoryOCExporter.Proto(ctx)
+			selfObsMetrics, err := inMemoryOTelExporter.Proto(ctx)
 			require.NoError(t, err)
 			fixture := &protos.MetricExpectFixture{
 				CreateMetricDescriptorRequests:  testServer.CreateMetricDescriptorRequests(),
@@ -0,0 +1,276 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Script to inspect, truncate, and replay the metrics write ahead log
+// (e.g. gcp_metrics_wal) written by the exporter. The collector must not be
+// running while the WAL is inspected.
+//
+// Usage:
+//
+//	go run cmd/walinspect/main.go -wal <directory>/gcp_metrics_wal <command>
+//
+// Commands:
+//
+//	info                 print the first and last index, entry count, and size on disk
+//	list                 print the index, size, and destination of each entry
+//	dump                 print entries as CreateTimeSeriesRequest JSON
+//	truncate-front N     remove all entries before index N
+//	truncate-back N      remove all entries after index N
+//	replay               send entries to -endpoint. Use "-endpoint cloudmock" to
+//	                     replay to an in-process mock server and print what it received
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/tidwall/wal"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/cloudmock"
+)
+
+var (
+	walPath  = flag.String("wal", "", "path of the WAL to inspect, e.g. <directory>/gcp_metrics_wal")
+	first    = flag.Uint64("first", 0, "first index to dump or replay (default: first index of the WAL)")
+	last     = flag.Uint64("last", 0, "last index to dump or replay (default: last index of the WAL)")
+	endpoint = flag.String("endpoint", "cloudmock", "endpoint to replay entries to, or \"cloudmock\" for an in-process mock server")
+	useTLS   = flag.Bool("tls", true, "use TLS and application default credentials when replaying to -endpoint")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -wal <path> [flags] info|list|dump|truncate-front N|truncate-back N|replay\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *walPath == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(context.Background(), flag.Arg(0), flag.Args()[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, command string, args []string) error {
+	// Don't create a new WAL if the path is wrong.
+	if _, err := os.Stat(*walPath); err != nil {
+		return err
+	}
+	// The exporter writes the WAL in JSON format.
+	w, err := wal.Open(*walPath, &wal.Options{LogFormat: wal.JSON})
+	if err != nil {
+		return fmt.Errorf("failed to open WAL: %w", err)
+	}
+	defer w.Close()
+
+	switch command {
+	case "info":
+		return info(w)
+	case "list":
+		return forEachEntry(w, func(index uint64, req *monitoringpb.CreateTimeSeriesRequest, size int) error {
+			if req == nil {
+				fmt.Printf("%d\t(empty)\n", index)
+				return nil
+			}
+			fmt.Printf("%d\t%d bytes\t%s\t%d time series\n", index, size, req.Name, len(req.TimeSeries))
+			return nil
+		})
+	case "dump":
+		return forEachEntry(w, func(index uint64, req *monitoringpb.CreateTimeSeriesRequest, _ int) error {
+			if req == nil {
+				return nil
+			}
+			b, err := protojson.MarshalOptions{Multiline: true}.Marshal(req)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("# index %d\n%s\n", index, b)
+			return nil
+		})
+	case "truncate-front", "truncate-back":
+		if len(args) != 1 {
+			return fmt.Errorf("%s requires an index", command)
+		}
+		index, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid index %q: %w", args[0], err)
+		}
+		if command == "truncate-front" {
+			err = w.TruncateFront(index)
+		} else {
+			err = w.TruncateBack(index)
+		}
+		if err != nil {
+			return err
+		}
+		return info(w)
+	case "replay":
+		return replay(ctx, w)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func info(w *wal.Log) error {
+	firstIndex, err := w.FirstIndex()
+	if err != nil {
+		return err
+	}
+	lastIndex, err := w.LastIndex()
+	if err != nil {
+		return err
+	}
+	var size int64
+	err = filepath.Walk(*walPath, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	entries := uint64(0)
+	if firstIndex != 0 {
+		entries = lastIndex - firstIndex + 1
+	}
+	fmt.Printf("path:        %s\n", *walPath)
+	fmt.Printf("first index: %d\n", firstIndex)
+	fmt.Printf("last index:  %d\n", lastIndex)
+	fmt.Printf("entries:     %d\n", entries)
+	fmt.Printf("size:        %d bytes\n", size)
+	return nil
+}
+
+// forEachEntry calls f for each entry between -first and -last. Empty
+// entries, which the exporter uses to mark the end of the WAL, are passed as
+// a nil request.
+func forEachEntry(w *wal.Log, f func(index uint64, req *monitoringpb.CreateTimeSeriesRequest, size int) error) error {
+	firstIndex, err := w.FirstIndex()
+	if err != nil {
+		return err
+	}
+	lastIndex, err := w.LastIndex()
+	if err != nil {
+		return err
+	}
+	if *first > firstIndex {
+		firstIndex = *first
+	}
+	if *last != 0 && *last < lastIndex {
+		lastIndex = *last
+	}
+	if firstIndex == 0 {
+		return nil
+	}
+	for index := firstIndex; index <= lastIndex; index++ {
+		bytes, err := w.Read(index)
+		if errors.Is(err, wal.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read index %d: %w", index, err)
+		}
+		var req *monitoringpb.CreateTimeSeriesRequest
+		if len(bytes) > 0 {
+			req = new(monitoringpb.CreateTimeSeriesRequest)
+			if err := proto.Unmarshal(bytes, req); err != nil {
+				return fmt.Errorf("failed to decode index %d: %w", index, err)
+			}
+		}
+		if err := f(index, req, len(bytes)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replay sends each entry to the endpoint with CreateTimeSeries. Replaying
+// does not remove entries from the WAL.
+func replay(ctx context.Context, w *wal.Log) error {
+	var clientOpts []option.ClientOption
+	var testServer *cloudmock.MetricsTestServer
+	if *endpoint == "cloudmock" {
+		var err error
+		testServer, err = cloudmock.NewMetricTestServer()
+		if err != nil {
+			return err
+		}
+		//nolint:errcheck
+		go testServer.Serve()
+		defer testServer.Shutdown()
+		conn, err := grpc.Dial(testServer.Endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		clientOpts = append(clientOpts, option.WithGRPCConn(conn))
+	} else {
+		clientOpts = append(clientOpts, option.WithEndpoint(*endpoint))
+		if !*useTLS {
+			clientOpts = append(clientOpts,
+				option.WithoutAuthentication(),
+				option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+		}
+	}
+	client, err := monitoring.NewMetricClient(ctx, clientOpts...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var errs []error
+	err = forEachEntry(w, func(index uint64, req *monitoringpb.CreateTimeSeriesRequest, _ int) error {
+		if req == nil {
+			return nil
+		}
+		if err := client.CreateTimeSeries(ctx, req); err != nil {
+			log.Printf("index %d: %v", index, err)
+			errs = append(errs, fmt.Errorf("index %d: %w", index, err))
+			return nil
+		}
+		log.Printf("index %d: replayed %d time series to %s", index, len(req.TimeSeries), req.Name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if testServer != nil {
+		for _, req := range testServer.CreateTimeSeriesRequests() {
+			b, err := protojson.MarshalOptions{Multiline: true}.Marshal(req)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", b)
+		}
+	}
+	return errors.Join(errs...)
+}
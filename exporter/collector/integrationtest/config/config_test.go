@@ -17,6 +17,7 @@ package config
 import (
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -74,6 +75,19 @@ func TestLoadConfig(t *testing.T) {
 					CreateMetricDescriptorBufferSize: 10,
 					ServiceResourceLabels:            true,
 					CumulativeNormalization:          true,
+					MaxConcurrentRequests:            4,
+					MaxConcurrentRequestsPerProject:  2,
+					CumulativeNormalizationCache: collector.NormalizationCacheConfig{
+						MaxPoints:  100,
+						GCInterval: time.Minute,
+					},
+					LabelLimitPolicy: collector.LabelLimitPolicyDrop,
+					Rules: []collector.MetricRuleConfig{{
+						MetricRegex: "^foo",
+						Action:      collector.MetricRuleActionExclude,
+					}},
+					ExponentialHistogramMaxBuckets: 50,
+					ExemplarTraceProjectAttribute:  "gcp.project_id",
 				},
 				LogConfig: collector.LogConfig{
 					ClientConfig: collector.ClientConfig{
@@ -15,8 +15,10 @@
 package integrationtest
 
 import (
+	"strings"
 	"testing"
 
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/protobuf/proto"
@@ -43,6 +45,37 @@ func DiffMetricProtos(t testing.TB, x, y *protos.MetricExpectFixture) string {
 	return cmp.Diff(x, y, cmpOptions...)
 }
 
+// WithoutWALSelfObservability returns a copy of the fixture without the write
+// ahead log self-observability metrics, which are only present when the WAL
+// is enabled. It is used to compare WAL test cases with their non-WAL equivalent.
+func WithoutWALSelfObservability(fixture *protos.MetricExpectFixture) *protos.MetricExpectFixture {
+	fixture = proto.Clone(fixture).(*protos.MetricExpectFixture)
+	selfObs := fixture.GetSelfObservabilityMetrics()
+	if selfObs == nil {
+		return fixture
+	}
+	isWALMetric := func(metricType string) bool {
+		return strings.Contains(metricType, "googlecloudmonitoring/wal_")
+	}
+	var mds []*monitoringpb.CreateMetricDescriptorRequest
+	for _, md := range selfObs.CreateMetricDescriptorRequests {
+		if !isWALMetric(md.GetMetricDescriptor().GetType()) {
+			mds = append(mds, md)
+		}
+	}
+	selfObs.CreateMetricDescriptorRequests = mds
+	for _, req := range selfObs.CreateTimeSeriesRequests {
+		var tss []*monitoringpb.TimeSeries
+		for _, ts := range req.TimeSeries {
+			if !isWALMetric(ts.GetMetric().GetType()) {
+				tss = append(tss, ts)
+			}
+		}
+		req.TimeSeries = tss
+	}
+	return fixture
+}
+
 // Diff uses cmp.Diff(), protocmp, and some custom options to compare two protobuf messages.
 func DiffLogProtos(t testing.TB, x, y *protos.LogExpectFixture) string {
 	x = proto.Clone(x).(*protos.LogExpectFixture)
@@ -16,15 +16,15 @@ package integrationtest
 
 import (
 	"context"
+	"errors"
 	"testing"
-	"time"
 
-	"contrib.go.opencensus.io/exporter/stackdriver"
 	"github.com/stretchr/testify/require"
-	"go.opencensus.io/metric/metricexport"
-	"go.opencensus.io/plugin/ocgrpc"
-	"go.opencensus.io/stats/view"
 	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
 	"go.uber.org/zap"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
@@ -33,40 +33,31 @@ import (
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector"
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/integrationtest/protos"
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/logsutil"
+	mexporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/metric"
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/cloudmock"
 )
 
-// OC stats/metrics exporter used to capture self observability metrics.
-type InMemoryOCExporter struct {
-	testServer          *cloudmock.MetricsTestServer
-	reader              *metricexport.Reader
-	stackdriverExporter *stackdriver.Exporter
+// OTel metrics exporter used to capture self observability metrics.
+type InMemoryOTelExporter struct {
+	testServer    *cloudmock.MetricsTestServer
+	reader        *sdkmetric.ManualReader
+	meterProvider *sdkmetric.MeterProvider
+	exporter      sdkmetric.Exporter
 }
 
-func getViews() []*view.View {
-	views := []*view.View{}
-	views = append(views, collector.MetricViews()...)
-	views = append(views, ocgrpc.DefaultClientViews...)
-	return views
+// MeterProvider returns the meter provider the exporter under test should
+// record its self observability metrics with.
+func (i *InMemoryOTelExporter) MeterProvider() metric.MeterProvider {
+	return i.meterProvider
 }
 
-func (i *InMemoryOCExporter) Proto(ctx context.Context) (*protos.SelfObservabilityMetric, error) {
-	// Hack to flush stats, see https://tinyurl.com/5hfcxzk2
-	view.SetReportingPeriod(time.Minute)
-	i.reader.ReadAndExport(i.stackdriverExporter)
-	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*500)
-	defer cancel()
-
-	done := make(chan struct{}, 1)
-	go func() {
-		i.stackdriverExporter.Flush()
-		close(done)
-	}()
-
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-done:
+func (i *InMemoryOTelExporter) Proto(ctx context.Context) (*protos.SelfObservabilityMetric, error) {
+	var rm metricdata.ResourceMetrics
+	if err := i.reader.Collect(ctx, &rm); err != nil {
+		return nil, err
+	}
+	if err := i.exporter.Export(ctx, &rm); err != nil {
+		return nil, err
 	}
 
 	return &protos.SelfObservabilityMetric{
@@ -76,27 +67,16 @@ func (i *InMemoryOCExporter) Proto(ctx context.Context) (*protos.SelfObservabili
 		nil
 }
 
-// Shutdown unregisters the global OpenCensus views to reset state for the next test.
-func (i *InMemoryOCExporter) Shutdown(ctx context.Context) error {
-	i.stackdriverExporter.StopMetricsExporter()
-	err := i.stackdriverExporter.Close()
+// Shutdown shuts down the meter provider and the test server.
+func (i *InMemoryOTelExporter) Shutdown(ctx context.Context) error {
+	err := errors.Join(i.meterProvider.Shutdown(ctx), i.exporter.Shutdown(ctx))
 	i.testServer.Shutdown()
-
-	view.Unregister(getViews()...)
 	return err
 }
 
-// NewInMemoryOCViewExporter creates a new in memory OC exporter for testing. Be sure to defer
+// NewInMemoryOTelExporter creates a new in memory OTel exporter for testing. Be sure to defer
 // a call to Shutdown().
-func NewInMemoryOCViewExporter() (*InMemoryOCExporter, error) {
-	// Reset our views in case any tests ran before this
-	views := getViews()
-	view.Unregister(views...)
-	err := view.Register(views...)
-	if err != nil {
-		return nil, err
-	}
-
+func NewInMemoryOTelExporter() (*InMemoryOTelExporter, error) {
 	testServer, err := cloudmock.NewMetricTestServer()
 	if err != nil {
 		return nil, err
@@ -107,22 +87,23 @@ func NewInMemoryOCViewExporter() (*InMemoryOCExporter, error) {
 	if err != nil {
 		return nil, err
 	}
-	clientOpts := []option.ClientOption{option.WithGRPCConn(conn)}
-
-	stackdriverExporter, err := stackdriver.NewExporter(stackdriver.Options{
-		DefaultMonitoringLabels: &stackdriver.Labels{},
-		ProjectID:               "myproject",
-		MonitoringClientOptions: clientOpts,
-		TraceClientOptions:      clientOpts,
-	})
+
+	exporter, err := mexporter.New(
+		mexporter.WithProjectID("myproject"),
+		mexporter.WithMonitoringClientOptions(option.WithGRPCConn(conn)),
+	)
 	if err != nil {
 		return nil, err
 	}
-
-	return &InMemoryOCExporter{
-			testServer:          testServer,
-			stackdriverExporter: stackdriverExporter,
-			reader:              metricexport.NewReader(),
+	reader := sdkmetric.NewManualReader()
+
+	return &InMemoryOTelExporter{
+			testServer: testServer,
+			reader:     reader,
+			// Use an empty resource, so the self observability metrics don't
+			// depend on the process running the tests.
+			meterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(resource.Empty())),
+			exporter:      exporter,
 		},
 		nil
 }
@@ -132,6 +113,7 @@ func NewTraceTestExporter(
 	t testing.TB,
 	s *cloudmock.TracesTestServer,
 	cfg collector.Config,
+	meterProvider metric.MeterProvider,
 ) *collector.TraceExporter {
 	cfg.TraceConfig.ClientConfig.Endpoint = s.Endpoint
 	cfg.TraceConfig.ClientConfig.UseInsecure = true
@@ -142,6 +124,7 @@ func NewTraceTestExporter(
 		cfg,
 		"latest",
 		collector.DefaultTimeout,
+		collector.WithMeterProvider(meterProvider),
 	)
 	require.NoError(t, err)
 	err = exporter.Start(ctx, componenttest.NewNopHost())
@@ -157,6 +140,7 @@ func NewMetricTestExporter(
 	t testing.TB,
 	m *cloudmock.MetricsTestServer,
 	cfg collector.Config,
+	meterProvider metric.MeterProvider,
 ) *collector.MetricsExporter {
 	cfg.MetricConfig.ClientConfig.Endpoint = m.Endpoint
 	cfg.MetricConfig.ClientConfig.UseInsecure = true
@@ -167,6 +151,7 @@ func NewMetricTestExporter(
 		zap.NewNop(),
 		"latest",
 		collector.DefaultTimeout,
+		collector.WithMeterProvider(meterProvider),
 	)
 	require.NoError(t, err)
 	err = exporter.Start(ctx, componenttest.NewNopHost())
@@ -181,6 +166,7 @@ func NewLogTestExporter(
 	l *cloudmock.LogsTestServer,
 	cfg collector.Config,
 	extraConfig *logsutil.ExporterConfig,
+	meterProvider metric.MeterProvider,
 ) *collector.LogsExporter {
 	cfg.LogConfig.ClientConfig.Endpoint = l.Endpoint
 	cfg.LogConfig.ClientConfig.UseInsecure = true
@@ -194,6 +180,7 @@ func NewLogTestExporter(
 		cfg,
 		logger,
 		"latest",
+		collector.WithMeterProvider(meterProvider),
 	)
 	require.NoError(t, err)
 
@@ -46,6 +46,22 @@ var LogsTestCases = []TestCase{
 			cfg.LogConfig.ErrorReportingType = true
 		},
 	},
+	{
+		Name:                 "Logs with special fields in a json payload",
+		OTLPInputFixturePath: "testdata/fixtures/logs/logs_special_fields.json",
+		ExpectFixturePath:    "testdata/fixtures/logs/logs_special_fields_expected.json",
+		ConfigureCollector: func(cfg *collector.Config) {
+			cfg.LogConfig.ParseSpecialFields = true
+		},
+	},
+	{
+		Name:                 "Logs with HTTP semantic convention attributes",
+		OTLPInputFixturePath: "testdata/fixtures/logs/logs_http_semconv.json",
+		ExpectFixturePath:    "testdata/fixtures/logs/logs_http_semconv_expected.json",
+		ConfigureCollector: func(cfg *collector.Config) {
+			cfg.LogConfig.HTTPRequestFromSemconv = true
+		},
+	},
 	{
 		Name:                 "Multi-project logs",
 		OTLPInputFixturePath: "testdata/fixtures/logs/logs_multi_project.json",
@@ -42,7 +42,7 @@ func TestTraces(t *testing.T) {
 			require.NoError(t, err)
 			go testServer.Serve()
 			defer testServer.Shutdown()
-			testServerExporter := NewTraceTestExporter(ctx, t, testServer, test.CreateTraceConfig())
+			testServerExporter := NewTraceTestExporter(ctx, t, testServer, test.CreateTraceConfig(), nil)
 
 			err = testServerExporter.PushTraces(ctx, traces)
 			if !test.ExpectErr {
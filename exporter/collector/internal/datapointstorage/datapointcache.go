@@ -15,6 +15,7 @@
 package datapointstorage
 
 import (
+	"container/list"
 	"fmt"
 	"sort"
 	"strings"
@@ -27,9 +28,70 @@ import (
 	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
 )
 
-const gcInterval = 20 * time.Minute
+const (
+	defaultGCInterval = 20 * time.Minute
+
+	// EvictionReasonMaxPoints is the reason for points evicted because the
+	// cache holds more than Config.MaxPoints points.
+	EvictionReasonMaxPoints = "max_points"
+	// EvictionReasonGC is the reason for points removed because they were
+	// not used since the previous garbage collection.
+	EvictionReasonGC = "gc"
+)
+
+// Config configures the limits of a Cache.
+type Config struct {
+	// OnEvict is called with the name of the cache, the number of points
+	// removed from the cache, and the reason they were removed. Optional.
+	OnEvict func(name string, n int, reason string)
+	// ObserveSize is called once, when the cache is created, with the name of
+	// the cache and a function returning the number of points in the cache,
+	// so that the size can be reported when it is observed. Optional.
+	ObserveSize func(name string, size func() int)
+	// Name identifies the cache in OnEvict and ObserveSize.
+	Name string
+	// MaxPoints is the maximum number of points in the cache. Each identifier
+	// holds one point, but a series may be stored in several caches, e.g. by
+	// the normalizer. When it is exceeded, the least recently used points are
+	// evicted. 0 means unlimited.
+	MaxPoints int
+	// GCInterval is how often points which have not been used since the
+	// previous garbage collection are removed, so unused points are kept for
+	// between one and two intervals. Defaults to 20 minutes.
+	GCInterval time.Duration
+}
+
+type pointKind int
+
+const (
+	numberKind pointKind = iota
+	summaryKind
+	histogramKind
+	exponentialHistogramKind
+)
+
+// lruKey identifies a point in one of the caches.
+type lruKey struct {
+	id   string
+	kind pointKind
+}
+
+// lruEntry is an element of the LRU order. used identifies the point which
+// was set for the key, so that evicting it doesn't remove a point set again
+// concurrently.
+type lruEntry struct {
+	key  lruKey
+	used *atomic.Bool
+}
 
 type Cache struct {
+	cfg Config
+	// lru orders the points in all caches from most to least recently used.
+	// It is only maintained when cfg.MaxPoints is set.
+	lru                       *list.List
+	lruElements               map[lruKey]*list.Element
+	lruLock                   sync.Mutex
+	size                      atomic.Int64
 	numberCache               map[string]usedNumberPoint
 	summaryCache              map[string]usedSummaryPoint
 	histogramCache            map[string]usedHistogramPoint
@@ -61,15 +123,25 @@ type usedExponentialHistogramPoint struct {
 }
 
 // NewCache instantiates a cache and starts background processes.
-func NewCache(shutdown <-chan struct{}) *Cache {
+func NewCache(shutdown <-chan struct{}, cfg Config) *Cache {
 	c := &Cache{
+		cfg:                       cfg,
+		lru:                       list.New(),
+		lruElements:               make(map[lruKey]*list.Element),
 		numberCache:               make(map[string]usedNumberPoint),
 		summaryCache:              make(map[string]usedSummaryPoint),
 		histogramCache:            make(map[string]usedHistogramPoint),
 		exponentialHistogramCache: make(map[string]usedExponentialHistogramPoint),
 	}
+	interval := cfg.GCInterval
+	if interval <= 0 {
+		interval = defaultGCInterval
+	}
+	if cfg.ObserveSize != nil {
+		cfg.ObserveSize(cfg.Name, c.Len)
+	}
 	go func() {
-		ticker := time.NewTicker(gcInterval)
+		ticker := time.NewTicker(interval)
 		//nolint:revive
 		for c.gc(shutdown, ticker.C) {
 		}
@@ -81,76 +153,112 @@ func NewCache(shutdown <-chan struct{}) *Cache {
 // or not it was found.
 func (c *Cache) GetNumberDataPoint(identifier string) (pmetric.NumberDataPoint, bool) {
 	c.numberLock.RLock()
-	defer c.numberLock.RUnlock()
 	point, found := c.numberCache[identifier]
 	if found {
 		point.used.Store(true)
 	}
+	c.numberLock.RUnlock()
+	if found {
+		c.touch(lruEntry{lruKey{identifier, numberKind}, point.used}, false)
+	}
 	return point.point, found
 }
 
 // SetNumberDataPoint assigns the point to the identifier in the cache.
 func (c *Cache) SetNumberDataPoint(identifier string, point pmetric.NumberDataPoint) {
 	c.numberLock.Lock()
-	defer c.numberLock.Unlock()
-	c.numberCache[identifier] = usedNumberPoint{point, atomic.NewBool(true)}
+	_, exists := c.numberCache[identifier]
+	used := atomic.NewBool(true)
+	c.numberCache[identifier] = usedNumberPoint{point, used}
+	c.numberLock.Unlock()
+	if !exists {
+		c.size.Inc()
+	}
+	c.touch(lruEntry{lruKey{identifier, numberKind}, used}, true)
 }
 
 // GetSummaryDataPoint retrieves the point associated with the identifier, and whether
 // or not it was found.
 func (c *Cache) GetSummaryDataPoint(identifier string) (pmetric.SummaryDataPoint, bool) {
 	c.summaryLock.RLock()
-	defer c.summaryLock.RUnlock()
 	point, found := c.summaryCache[identifier]
 	if found {
 		point.used.Store(true)
 	}
+	c.summaryLock.RUnlock()
+	if found {
+		c.touch(lruEntry{lruKey{identifier, summaryKind}, point.used}, false)
+	}
 	return point.point, found
 }
 
 // SetSummaryDataPoint assigns the point to the identifier in the cache.
 func (c *Cache) SetSummaryDataPoint(identifier string, point pmetric.SummaryDataPoint) {
 	c.summaryLock.Lock()
-	defer c.summaryLock.Unlock()
-	c.summaryCache[identifier] = usedSummaryPoint{point, atomic.NewBool(true)}
+	_, exists := c.summaryCache[identifier]
+	used := atomic.NewBool(true)
+	c.summaryCache[identifier] = usedSummaryPoint{point, used}
+	c.summaryLock.Unlock()
+	if !exists {
+		c.size.Inc()
+	}
+	c.touch(lruEntry{lruKey{identifier, summaryKind}, used}, true)
 }
 
 // GetHistogramDataPoint retrieves the point associated with the identifier, and whether
 // or not it was found.
 func (c *Cache) GetHistogramDataPoint(identifier string) (pmetric.HistogramDataPoint, bool) {
 	c.histogramLock.RLock()
-	defer c.histogramLock.RUnlock()
 	point, found := c.histogramCache[identifier]
 	if found {
 		point.used.Store(true)
 	}
+	c.histogramLock.RUnlock()
+	if found {
+		c.touch(lruEntry{lruKey{identifier, histogramKind}, point.used}, false)
+	}
 	return point.point, found
 }
 
 // SetHistogramDataPoint assigns the point to the identifier in the cache.
 func (c *Cache) SetHistogramDataPoint(identifier string, point pmetric.HistogramDataPoint) {
 	c.histogramLock.Lock()
-	defer c.histogramLock.Unlock()
-	c.histogramCache[identifier] = usedHistogramPoint{point, atomic.NewBool(true)}
+	_, exists := c.histogramCache[identifier]
+	used := atomic.NewBool(true)
+	c.histogramCache[identifier] = usedHistogramPoint{point, used}
+	c.histogramLock.Unlock()
+	if !exists {
+		c.size.Inc()
+	}
+	c.touch(lruEntry{lruKey{identifier, histogramKind}, used}, true)
 }
 
 // GetExponentialHistogramDataPoint retrieves the point associated with the identifier, and whether
 // or not it was found.
 func (c *Cache) GetExponentialHistogramDataPoint(identifier string) (pmetric.ExponentialHistogramDataPoint, bool) {
 	c.exponentialHistogramLock.RLock()
-	defer c.exponentialHistogramLock.RUnlock()
 	point, found := c.exponentialHistogramCache[identifier]
 	if found {
 		point.used.Store(true)
 	}
+	c.exponentialHistogramLock.RUnlock()
+	if found {
+		c.touch(lruEntry{lruKey{identifier, exponentialHistogramKind}, point.used}, false)
+	}
 	return point.point, found
 }
 
 // SetExponentialHistogramDataPoint assigns the point to the identifier in the cache.
 func (c *Cache) SetExponentialHistogramDataPoint(identifier string, point pmetric.ExponentialHistogramDataPoint) {
 	c.exponentialHistogramLock.Lock()
-	defer c.exponentialHistogramLock.Unlock()
-	c.exponentialHistogramCache[identifier] = usedExponentialHistogramPoint{point, atomic.NewBool(true)}
+	_, exists := c.exponentialHistogramCache[identifier]
+	used := atomic.NewBool(true)
+	c.exponentialHistogramCache[identifier] = usedExponentialHistogramPoint{point, used}
+	c.exponentialHistogramLock.Unlock()
+	if !exists {
+		c.size.Inc()
+	}
+	c.touch(lruEntry{lruKey{identifier, exponentialHistogramKind}, used}, true)
 }
 
 // gc garbage collects the cache after the ticker ticks.
@@ -159,6 +267,13 @@ func (c *Cache) gc(shutdown <-chan struct{}, tickerCh <-chan time.Time) bool {
 	case <-shutdown:
 		return false
 	case <-tickerCh:
+		removed := 0
+		defer func() {
+			if removed > 0 {
+				c.evicted(removed, EvictionReasonGC)
+				c.size.Sub(int64(removed))
+			}
+		}()
 		// garbage collect the numberCache
 		c.numberLock.Lock()
 		for id, point := range c.numberCache {
@@ -168,6 +283,8 @@ func (c *Cache) gc(shutdown <-chan struct{}, tickerCh <-chan time.Time) bool {
 			} else {
 				// for points that have not been used, delete points
 				delete(c.numberCache, id)
+				c.forget(lruKey{id, numberKind})
+				removed++
 			}
 		}
 		c.numberLock.Unlock()
@@ -180,6 +297,8 @@ func (c *Cache) gc(shutdown <-chan struct{}, tickerCh <-chan time.Time) bool {
 			} else {
 				// for points that have not been used, delete points
 				delete(c.summaryCache, id)
+				c.forget(lruKey{id, summaryKind})
+				removed++
 			}
 		}
 		c.summaryLock.Unlock()
@@ -192,6 +311,8 @@ func (c *Cache) gc(shutdown <-chan struct{}, tickerCh <-chan time.Time) bool {
 			} else {
 				// for points that have not been used, delete points
 				delete(c.histogramCache, id)
+				c.forget(lruKey{id, histogramKind})
+				removed++
 			}
 		}
 		c.histogramLock.Unlock()
@@ -204,6 +325,8 @@ func (c *Cache) gc(shutdown <-chan struct{}, tickerCh <-chan time.Time) bool {
 			} else {
 				// for points that have not been used, delete points
 				delete(c.exponentialHistogramCache, id)
+				c.forget(lruKey{id, exponentialHistogramKind})
+				removed++
 			}
 		}
 		c.exponentialHistogramLock.Unlock()
@@ -211,6 +334,107 @@ func (c *Cache) gc(shutdown <-chan struct{}, tickerCh <-chan time.Time) bool {
 	return true
 }
 
+// Len returns the number of points in the cache.
+func (c *Cache) Len() int {
+	return int(c.size.Load())
+}
+
+func (c *Cache) evicted(n int, reason string) {
+	if c.cfg.OnEvict != nil {
+		c.cfg.OnEvict(c.cfg.Name, n, reason)
+	}
+}
+
+// touch marks the point as the most recently used, and evicts the least
+// recently used points if the cache holds more than MaxPoints points. Points
+// which are not in the LRU order, because they were evicted concurrently, are
+// only added if insert is true. It must not be called while holding the lock
+// of one of the caches.
+func (c *Cache) touch(entry lruEntry, insert bool) {
+	if c.cfg.MaxPoints <= 0 {
+		return
+	}
+	var victims []lruEntry
+	c.lruLock.Lock()
+	if elem, ok := c.lruElements[entry.key]; ok {
+		if insert {
+			elem.Value = entry
+		}
+		c.lru.MoveToFront(elem)
+	} else if insert {
+		c.lruElements[entry.key] = c.lru.PushFront(entry)
+	}
+	for c.lru.Len() > c.cfg.MaxPoints {
+		victim := c.lru.Remove(c.lru.Back()).(lruEntry)
+		delete(c.lruElements, victim.key)
+		victims = append(victims, victim)
+	}
+	c.lruLock.Unlock()
+
+	removed := 0
+	for _, victim := range victims {
+		if c.remove(victim) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		c.evicted(removed, EvictionReasonMaxPoints)
+		c.size.Sub(int64(removed))
+	}
+}
+
+// forget removes the point from the LRU order. The caller may hold the lock
+// of the cache the point is stored in.
+func (c *Cache) forget(key lruKey) {
+	if c.cfg.MaxPoints <= 0 {
+		return
+	}
+	c.lruLock.Lock()
+	defer c.lruLock.Unlock()
+	if elem, ok := c.lruElements[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.lruElements, key)
+	}
+}
+
+// remove deletes an evicted point from its cache, and returns true if it was
+// present. The point is kept if it was set again since it was evicted.
+func (c *Cache) remove(entry lruEntry) bool {
+	var found bool
+	id := entry.key.id
+	switch entry.key.kind {
+	case numberKind:
+		c.numberLock.Lock()
+		if point, ok := c.numberCache[id]; ok && point.used == entry.used {
+			delete(c.numberCache, id)
+			found = true
+		}
+		c.numberLock.Unlock()
+	case summaryKind:
+		c.summaryLock.Lock()
+		if point, ok := c.summaryCache[id]; ok && point.used == entry.used {
+			delete(c.summaryCache, id)
+			found = true
+		}
+		c.summaryLock.Unlock()
+	case histogramKind:
+		c.histogramLock.Lock()
+		if point, ok := c.histogramCache[id]; ok && point.used == entry.used {
+			delete(c.histogramCache, id)
+			found = true
+		}
+		c.histogramLock.Unlock()
+	case exponentialHistogramKind:
+		c.exponentialHistogramLock.Lock()
+		if point, ok := c.exponentialHistogramCache[id]; ok && point.used == entry.used {
+			delete(c.exponentialHistogramCache, id)
+			found = true
+		}
+		c.exponentialHistogramLock.Unlock()
+	}
+	return found
+}
+
 // Identifier returns the unique string identifier for a metric.
 func Identifier(resource *monitoredrespb.MonitoredResource, extraLabels map[string]string, metric pmetric.Metric, attributes pcommon.Map) string {
 	var b strings.Builder
@@ -236,3 +460,63 @@ func Identifier(resource *monitoredrespb.MonitoredResource, extraLabels map[stri
 	}
 	return b.String()
 }
+
+// Snapshot appends all points in the cache to sm. Each point is stored in its
+// own metric, named by the point's identifier.
+func (c *Cache) Snapshot(sm pmetric.ScopeMetrics) {
+	c.numberLock.RLock()
+	for id, point := range c.numberCache {
+		m := sm.Metrics().AppendEmpty()
+		m.SetName(id)
+		point.point.CopyTo(m.SetEmptySum().DataPoints().AppendEmpty())
+	}
+	c.numberLock.RUnlock()
+	c.summaryLock.RLock()
+	for id, point := range c.summaryCache {
+		m := sm.Metrics().AppendEmpty()
+		m.SetName(id)
+		point.point.CopyTo(m.SetEmptySummary().DataPoints().AppendEmpty())
+	}
+	c.summaryLock.RUnlock()
+	c.histogramLock.RLock()
+	for id, point := range c.histogramCache {
+		m := sm.Metrics().AppendEmpty()
+		m.SetName(id)
+		point.point.CopyTo(m.SetEmptyHistogram().DataPoints().AppendEmpty())
+	}
+	c.histogramLock.RUnlock()
+	c.exponentialHistogramLock.RLock()
+	for id, point := range c.exponentialHistogramCache {
+		m := sm.Metrics().AppendEmpty()
+		m.SetName(id)
+		point.point.CopyTo(m.SetEmptyExponentialHistogram().DataPoints().AppendEmpty())
+	}
+	c.exponentialHistogramLock.RUnlock()
+}
+
+// Restore sets the points from a snapshot created by Snapshot in the cache.
+// Restored points are marked as used, so they are kept until at least the
+// next garbage collection.
+func (c *Cache) Restore(sm pmetric.ScopeMetrics) {
+	for i := 0; i < sm.Metrics().Len(); i++ {
+		m := sm.Metrics().At(i)
+		switch m.Type() {
+		case pmetric.MetricTypeSum:
+			if m.Sum().DataPoints().Len() > 0 {
+				c.SetNumberDataPoint(m.Name(), m.Sum().DataPoints().At(0))
+			}
+		case pmetric.MetricTypeSummary:
+			if m.Summary().DataPoints().Len() > 0 {
+				c.SetSummaryDataPoint(m.Name(), m.Summary().DataPoints().At(0))
+			}
+		case pmetric.MetricTypeHistogram:
+			if m.Histogram().DataPoints().Len() > 0 {
+				c.SetHistogramDataPoint(m.Name(), m.Histogram().DataPoints().At(0))
+			}
+		case pmetric.MetricTypeExponentialHistogram:
+			if m.ExponentialHistogram().DataPoints().Len() > 0 {
+				c.SetExponentialHistogramDataPoint(m.Name(), m.ExponentialHistogram().DataPoints().At(0))
+			}
+		}
+	}
+}
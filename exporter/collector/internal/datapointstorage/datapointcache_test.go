@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
@@ -126,6 +127,122 @@ func TestGetPreventsGC(t *testing.T) {
 	assert.True(t, found)
 }
 
+func TestMaxPoints(t *testing.T) {
+	shutdown := make(chan struct{})
+	defer close(shutdown)
+	evicted := make(map[string]int)
+	var size func() int
+	c := NewCache(shutdown, Config{
+		Name:      "test",
+		MaxPoints: 2,
+		OnEvict: func(_ string, n int, reason string) {
+			evicted[reason] += n
+		},
+		ObserveSize: func(name string, f func() int) {
+			assert.Equal(t, "test", name)
+			size = f
+		},
+	})
+	require.NotNil(t, size)
+	c.SetNumberDataPoint("foo", pmetric.NewNumberDataPoint())
+	c.SetHistogramDataPoint("bar", pmetric.NewHistogramDataPoint())
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, 2, size())
+	// using foo makes bar the least recently used series.
+	_, found := c.GetNumberDataPoint("foo")
+	assert.True(t, found)
+
+	c.SetSummaryDataPoint("baz", pmetric.NewSummaryDataPoint())
+	_, found = c.GetHistogramDataPoint("bar")
+	assert.False(t, found, "expected the least recently used series to be evicted")
+	_, found = c.GetNumberDataPoint("foo")
+	assert.True(t, found)
+	_, found = c.GetSummaryDataPoint("baz")
+	assert.True(t, found)
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, 2, size())
+	assert.Equal(t, map[string]int{EvictionReasonMaxPoints: 1}, evicted)
+}
+
+func TestEvictionKeepsPointSetAgain(t *testing.T) {
+	shutdown := make(chan struct{})
+	defer close(shutdown)
+	c := NewCache(shutdown, Config{MaxPoints: 1})
+	c.SetNumberDataPoint("foo", pmetric.NewNumberDataPoint())
+	victim := c.lru.Back().Value.(lruEntry)
+
+	// foo is set again after it was evicted from the LRU order, but before
+	// it was removed from the cache.
+	c.SetNumberDataPoint("foo", pmetric.NewNumberDataPoint())
+	assert.False(t, c.remove(victim))
+	_, found := c.GetNumberDataPoint("foo")
+	assert.True(t, found)
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, 1, c.lru.Len())
+}
+
+func TestGCReportsEvictions(t *testing.T) {
+	shutdown := make(chan struct{})
+	defer close(shutdown)
+	evicted := make(map[string]int)
+	c := NewCache(shutdown, Config{
+		MaxPoints: 10,
+		OnEvict: func(_ string, n int, reason string) {
+			evicted[reason] += n
+		},
+	})
+	fakeTicker := make(chan time.Time, 1)
+	c.SetNumberDataPoint("foo", pmetric.NewNumberDataPoint())
+	c.SetExponentialHistogramDataPoint("bar", pmetric.NewExponentialHistogramDataPoint())
+
+	// the first tick marks the points as unused, and the second removes them.
+	fakeTicker <- time.Now()
+	assert.True(t, c.gc(shutdown, fakeTicker))
+	fakeTicker <- time.Now()
+	assert.True(t, c.gc(shutdown, fakeTicker))
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, map[string]int{EvictionReasonGC: 2}, evicted)
+	// removed points are no longer tracked for LRU eviction.
+	assert.Equal(t, 0, c.lru.Len())
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	shutdown := make(chan struct{})
+	defer close(shutdown)
+	c := NewCache(shutdown, Config{})
+	numberPoint := pmetric.NewNumberDataPoint()
+	numberPoint.SetIntValue(12)
+	c.SetNumberDataPoint("number", numberPoint)
+	summaryPoint := pmetric.NewSummaryDataPoint()
+	summaryPoint.SetCount(3)
+	c.SetSummaryDataPoint("summary", summaryPoint)
+	histogramPoint := pmetric.NewHistogramDataPoint()
+	histogramPoint.SetSum(4.5)
+	c.SetHistogramDataPoint("histogram", histogramPoint)
+	expHistogramPoint := pmetric.NewExponentialHistogramDataPoint()
+	expHistogramPoint.SetScale(3)
+	c.SetExponentialHistogramDataPoint("exponential histogram", expHistogramPoint)
+
+	sm := pmetric.NewScopeMetrics()
+	c.Snapshot(sm)
+	assert.Equal(t, 4, sm.Metrics().Len())
+
+	restored := NewCache(shutdown, Config{})
+	restored.Restore(sm)
+	point, found := restored.GetNumberDataPoint("number")
+	assert.True(t, found)
+	assert.Equal(t, numberPoint, point)
+	summary, found := restored.GetSummaryDataPoint("summary")
+	assert.True(t, found)
+	assert.Equal(t, summaryPoint, summary)
+	histogram, found := restored.GetHistogramDataPoint("histogram")
+	assert.True(t, found)
+	assert.Equal(t, histogramPoint, histogram)
+	expHistogram, found := restored.GetExponentialHistogramDataPoint("exponential histogram")
+	assert.True(t, found)
+	assert.Equal(t, expHistogramPoint, expHistogram)
+}
+
 func TestConcurrentNumber(t *testing.T) {
 	c := Cache{
 		numberCache:               make(map[string]usedNumberPoint),
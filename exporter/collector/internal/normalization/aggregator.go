@@ -0,0 +1,331 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package normalization
+
+import (
+	"math"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.uber.org/zap"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/datapointstorage"
+)
+
+const (
+	// aggregationSourceCacheName is the name of the cache of the previous
+	// cumulative point of each source series.
+	aggregationSourceCacheName = "aggregation_source"
+	// aggregationCacheName is the name of the cache of aggregated points.
+	aggregationCacheName = "aggregation"
+)
+
+// Aggregator combines the points of several source series into a point of a
+// single aggregated series, e.g. when labels are removed from the points.
+//
+//	(a) Delta points are added together.
+//	(b) For cumulative points, the increase of each source series since its
+//	    previous point is added to the previous point of the aggregated series,
+//	    so the aggregated series stays cumulative when source series reset,
+//	    start, or stop. Source series which started before the aggregated
+//	    series only contribute their increase after the aggregated series
+//	    started.
+//	(c) Histograms with different bucket boundaries can't be added, so points
+//	    which don't match the boundaries of the aggregated series start a new
+//	    aggregated series.
+type Aggregator struct {
+	sources    *datapointstorage.Cache
+	aggregates *datapointstorage.Cache
+	log        *zap.Logger
+}
+
+// NewAggregator returns an Aggregator whose caches are configured by cacheCfg.
+func NewAggregator(shutdown <-chan struct{}, logger *zap.Logger, cacheCfg datapointstorage.Config) *Aggregator {
+	sourceCfg := cacheCfg
+	sourceCfg.Name = aggregationSourceCacheName
+	cacheCfg.Name = aggregationCacheName
+	return &Aggregator{
+		sources:    datapointstorage.NewCache(shutdown, sourceCfg),
+		aggregates: datapointstorage.NewCache(shutdown, cacheCfg),
+		log:        logger,
+	}
+}
+
+// isNew returns true if all of a source point's value was recorded after the
+// aggregated series started, and should be added to the aggregated series.
+func isNew(point, aggregate pcommon.Timestamp) bool {
+	return point != 0 && !point.AsTime().Before(aggregate.AsTime())
+}
+
+// isStale returns true if a point isn't newer than the previous point of its
+// source series.
+func isStale(point, source pcommon.Timestamp) bool {
+	return !point.AsTime().After(source.AsTime())
+}
+
+// AggregateNumberDataPoints aggregates sum points of the source series
+// sourceIDs into a point of the series identifier. Decreasing values of
+// monotonic cumulative sums are treated as resets. It returns the aggregated
+// point, and true if the point should be kept.
+func (a *Aggregator) AggregateNumberDataPoints(points []pmetric.NumberDataPoint, sourceIDs []string, identifier string, cumulative, monotonic bool) (pmetric.NumberDataPoint, bool) {
+	if !cumulative {
+		return sumNumberDataPoints(points), true
+	}
+	previous, found := a.aggregates.GetNumberDataPoint(identifier)
+	if !found {
+		newPoint := sumNumberDataPoints(points)
+		for i, point := range points {
+			a.sources.SetNumberDataPoint(sourceIDs[i], point)
+		}
+		a.aggregates.SetNumberDataPoint(identifier, newPoint)
+		return newPoint, true
+	}
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewNumberDataPoint()
+	previous.CopyTo(newPoint)
+	for i, point := range points {
+		source, hasSource := a.sources.GetNumberDataPoint(sourceIDs[i])
+		if hasSource && isStale(point.Timestamp(), source.Timestamp()) {
+			continue
+		}
+		a.sources.SetNumberDataPoint(sourceIDs[i], point)
+		reset := hasSource && (point.StartTimestamp() != source.StartTimestamp() || (monotonic && lessThanNumberDataPoint(point, source)))
+		switch {
+		case hasSource && !reset:
+			addNumberDataPoint(newPoint, subtractNumberDataPoint(point, source))
+		case reset || isNew(point.StartTimestamp(), previous.StartTimestamp()):
+			addNumberDataPoint(newPoint, point)
+		}
+		if point.Timestamp() > newPoint.Timestamp() {
+			newPoint.SetTimestamp(point.Timestamp())
+		}
+	}
+	a.aggregates.SetNumberDataPoint(identifier, newPoint)
+	// Points must be newer than the previous point of the series to be
+	// written. The value is kept, and written with the next point.
+	return newPoint, newPoint.Timestamp() > previous.Timestamp()
+}
+
+// sumNumberDataPoints returns the sum of the points, which starts at the
+// earliest start time, and ends at the latest end time of the points.
+func sumNumberDataPoints(points []pmetric.NumberDataPoint) pmetric.NumberDataPoint {
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewNumberDataPoint()
+	points[0].CopyTo(newPoint)
+	for _, point := range points[1:] {
+		addNumberDataPoint(newPoint, point)
+		mergeTimestamps(newPoint, point)
+	}
+	return newPoint
+}
+
+// addNumberDataPoint adds the value of b to a.
+func addNumberDataPoint(a, b pmetric.NumberDataPoint) {
+	switch {
+	case a.ValueType() == pmetric.NumberDataPointValueTypeInt && b.ValueType() == pmetric.NumberDataPointValueTypeInt:
+		a.SetIntValue(a.IntValue() + b.IntValue())
+	case a.ValueType() == pmetric.NumberDataPointValueTypeInt:
+		a.SetDoubleValue(float64(a.IntValue()) + b.DoubleValue())
+	case b.ValueType() == pmetric.NumberDataPointValueTypeInt:
+		a.SetDoubleValue(a.DoubleValue() + float64(b.IntValue()))
+	default:
+		a.SetDoubleValue(a.DoubleValue() + b.DoubleValue())
+	}
+}
+
+// timestamped is implemented by all data points.
+type timestamped interface {
+	StartTimestamp() pcommon.Timestamp
+	SetStartTimestamp(pcommon.Timestamp)
+	Timestamp() pcommon.Timestamp
+	SetTimestamp(pcommon.Timestamp)
+}
+
+// mergeTimestamps extends the interval of a to include the interval of b.
+func mergeTimestamps(a, b timestamped) {
+	if b.StartTimestamp() != 0 && (a.StartTimestamp() == 0 || b.StartTimestamp() < a.StartTimestamp()) {
+		a.SetStartTimestamp(b.StartTimestamp())
+	}
+	if b.Timestamp() > a.Timestamp() {
+		a.SetTimestamp(b.Timestamp())
+	}
+}
+
+// AggregateHistogramDataPoints aggregates histogram points of the source
+// series sourceIDs into a point of the series identifier. It returns the
+// aggregated point, and true if the point should be kept.
+func (a *Aggregator) AggregateHistogramDataPoints(points []pmetric.HistogramDataPoint, sourceIDs []string, identifier string, cumulative bool) (pmetric.HistogramDataPoint, bool) {
+	if !cumulative {
+		return a.sumHistogramDataPoints(points), true
+	}
+	previous, found := a.aggregates.GetHistogramDataPoint(identifier)
+	if found {
+		for _, point := range points {
+			if !bucketBoundariesEqual(point.ExplicitBounds(), previous.ExplicitBounds()) {
+				// The bucket boundaries changed, so start a new aggregated series.
+				found = false
+				break
+			}
+		}
+	}
+	if !found {
+		newPoint := a.sumHistogramDataPoints(points)
+		for i, point := range points {
+			a.sources.SetHistogramDataPoint(sourceIDs[i], point)
+		}
+		a.aggregates.SetHistogramDataPoint(identifier, newPoint)
+		return newPoint, true
+	}
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewHistogramDataPoint()
+	previous.CopyTo(newPoint)
+	for i, point := range points {
+		source, hasSource := a.sources.GetHistogramDataPoint(sourceIDs[i])
+		if hasSource && isStale(point.Timestamp(), source.Timestamp()) {
+			continue
+		}
+		a.sources.SetHistogramDataPoint(sourceIDs[i], point)
+		reset := hasSource && (point.StartTimestamp() != source.StartTimestamp() ||
+			!bucketBoundariesEqual(point.ExplicitBounds(), source.ExplicitBounds()) ||
+			lessThanHistogramDataPoint(point, source))
+		switch {
+		case hasSource && !reset:
+			addHistogramDataPoint(newPoint, subtractHistogramDataPoint(point, source))
+		case reset || isNew(point.StartTimestamp(), previous.StartTimestamp()):
+			addHistogramDataPoint(newPoint, point)
+		}
+		if point.Timestamp() > newPoint.Timestamp() {
+			newPoint.SetTimestamp(point.Timestamp())
+		}
+	}
+	a.aggregates.SetHistogramDataPoint(identifier, newPoint)
+	return newPoint, newPoint.Timestamp() > previous.Timestamp()
+}
+
+// sumHistogramDataPoints returns the sum of the points which have the bucket
+// boundaries of the first point. Other points are dropped.
+func (a *Aggregator) sumHistogramDataPoints(points []pmetric.HistogramDataPoint) pmetric.HistogramDataPoint {
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewHistogramDataPoint()
+	points[0].CopyTo(newPoint)
+	for _, point := range points[1:] {
+		if !bucketBoundariesEqual(point.ExplicitBounds(), newPoint.ExplicitBounds()) {
+			a.log.Debug(
+				"histogram point has different bucket boundaries than the points it is aggregated with, will not be emitted",
+				zap.String("timestamp", point.Timestamp().String()),
+			)
+			continue
+		}
+		addHistogramDataPoint(newPoint, point)
+		mergeTimestamps(newPoint, point)
+	}
+	return newPoint
+}
+
+// addHistogramDataPoint adds b to a. Both must have the same bucket boundaries.
+func addHistogramDataPoint(a, b pmetric.HistogramDataPoint) {
+	a.SetCount(a.Count() + b.Count())
+	a.SetSum(a.Sum() + b.Sum())
+	if a.HasMin() && b.HasMin() {
+		a.SetMin(math.Min(a.Min(), b.Min()))
+	}
+	if a.HasMax() && b.HasMax() {
+		a.SetMax(math.Max(a.Max(), b.Max()))
+	}
+	if a.BucketCounts().Len() == b.BucketCounts().Len() {
+		buckets := make([]uint64, a.BucketCounts().Len())
+		for i := range buckets {
+			buckets[i] = a.BucketCounts().At(i) + b.BucketCounts().At(i)
+		}
+		a.BucketCounts().FromRaw(buckets)
+	}
+}
+
+// AggregateExponentialHistogramDataPoints aggregates exponential histogram
+// points of the source series sourceIDs into a point of the series
+// identifier. Points are added at the lowest scale of the points. It returns
+// the aggregated point, and true if the point should be kept.
+func (a *Aggregator) AggregateExponentialHistogramDataPoints(points []pmetric.ExponentialHistogramDataPoint, sourceIDs []string, identifier string, cumulative bool) (pmetric.ExponentialHistogramDataPoint, bool) {
+	if !cumulative {
+		return sumExponentialHistogramDataPoints(points), true
+	}
+	previous, found := a.aggregates.GetExponentialHistogramDataPoint(identifier)
+	if !found {
+		newPoint := sumExponentialHistogramDataPoints(points)
+		for i, point := range points {
+			a.sources.SetExponentialHistogramDataPoint(sourceIDs[i], point)
+		}
+		a.aggregates.SetExponentialHistogramDataPoint(identifier, newPoint)
+		return newPoint, true
+	}
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewExponentialHistogramDataPoint()
+	previous.CopyTo(newPoint)
+	for i, point := range points {
+		source, hasSource := a.sources.GetExponentialHistogramDataPoint(sourceIDs[i])
+		if hasSource && isStale(point.Timestamp(), source.Timestamp()) {
+			continue
+		}
+		a.sources.SetExponentialHistogramDataPoint(sourceIDs[i], point)
+		reset := hasSource && (point.StartTimestamp() != source.StartTimestamp() || lessThanExponentialHistogramDataPoint(point, source))
+		switch {
+		case hasSource && !reset:
+			scale := min(point.Scale(), source.Scale())
+			newPoint = addExponentialHistogramDataPoint(newPoint, subtractExponentialHistogramDataPoint(
+				DownscaleExponentialHistogramDataPoint(point, scale),
+				DownscaleExponentialHistogramDataPoint(source, scale),
+			))
+		case reset || isNew(point.StartTimestamp(), previous.StartTimestamp()):
+			newPoint = addExponentialHistogramDataPoint(newPoint, point)
+		}
+		if point.Timestamp() > newPoint.Timestamp() {
+			newPoint.SetTimestamp(point.Timestamp())
+		}
+	}
+	a.aggregates.SetExponentialHistogramDataPoint(identifier, newPoint)
+	return newPoint, newPoint.Timestamp() > previous.Timestamp()
+}
+
+// sumExponentialHistogramDataPoints returns the sum of the points.
+func sumExponentialHistogramDataPoints(points []pmetric.ExponentialHistogramDataPoint) pmetric.ExponentialHistogramDataPoint {
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewExponentialHistogramDataPoint()
+	points[0].CopyTo(newPoint)
+	for _, point := range points[1:] {
+		newPoint = addExponentialHistogramDataPoint(newPoint, point)
+		mergeTimestamps(newPoint, point)
+	}
+	return newPoint
+}
+
+// addExponentialHistogramDataPoint returns a copy of a with b added to it, at
+// the lower scale of a and b.
+func addExponentialHistogramDataPoint(a, b pmetric.ExponentialHistogramDataPoint) pmetric.ExponentialHistogramDataPoint {
+	scale := min(a.Scale(), b.Scale())
+	newPoint := DownscaleExponentialHistogramDataPoint(a, scale)
+	b = DownscaleExponentialHistogramDataPoint(b, scale)
+	newPoint.SetCount(newPoint.Count() + b.Count())
+	newPoint.SetSum(newPoint.Sum() + b.Sum())
+	newPoint.SetZeroCount(newPoint.ZeroCount() + b.ZeroCount())
+	if newPoint.HasMin() && b.HasMin() {
+		newPoint.SetMin(math.Min(newPoint.Min(), b.Min()))
+	}
+	if newPoint.HasMax() && b.HasMax() {
+		newPoint.SetMax(math.Max(newPoint.Max(), b.Max()))
+	}
+	addExponentialBuckets(newPoint.Positive(), b.Positive())
+	addExponentialBuckets(newPoint.Negative(), b.Negative())
+	return newPoint
+}
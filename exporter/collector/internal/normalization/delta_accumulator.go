@@ -0,0 +1,251 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package normalization
+
+import (
+	"math"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.uber.org/zap"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/datapointstorage"
+)
+
+// deltaCacheName is the name of the cache of accumulated points.
+const deltaCacheName = "delta"
+
+// DeltaAccumulator converts delta points to cumulative points.
+type DeltaAccumulator interface {
+	// AccumulateExponentialHistogramDataPoint adds a delta exponential histogram to its series.
+	// It returns the cumulative point, and true if the point should be kept.
+	AccumulateExponentialHistogramDataPoint(point pmetric.ExponentialHistogramDataPoint, identifier string) (pmetric.ExponentialHistogramDataPoint, bool)
+	// AccumulateHistogramDataPoint adds a delta histogram to its series.
+	// It returns the cumulative point, and true if the point should be kept.
+	AccumulateHistogramDataPoint(point pmetric.HistogramDataPoint, identifier string) (pmetric.HistogramDataPoint, bool)
+	// AccumulateNumberDataPoint adds a delta sum to its series.
+	// It returns the cumulative point, and true if the point should be kept.
+	AccumulateNumberDataPoint(point pmetric.NumberDataPoint, identifier string) (pmetric.NumberDataPoint, bool)
+}
+
+// NewStandardDeltaAccumulator returns a DeltaAccumulator which adds each delta
+// point to the sum of the previous points of its series, and returns the sum
+// as a cumulative point:
+//
+//	(a) The first point of a series starts a cumulative series at the start
+//	    time of the point.
+//	(b) Points which overlap with, or are older than, the points already
+//	    accumulated are dropped, since adding them would count values twice.
+//	(c) Gaps between points are accumulated as if nothing was recorded during
+//	    the gap. Series which are not updated are removed from the cache
+//	    according to cacheCfg, and start a new cumulative series on their next
+//	    point.
+//	(d) Histograms whose bucket boundaries change start a new cumulative series.
+func NewStandardDeltaAccumulator(shutdown <-chan struct{}, logger *zap.Logger, cacheCfg datapointstorage.Config) DeltaAccumulator {
+	cacheCfg.Name = deltaCacheName
+	return &standardDeltaAccumulator{
+		cache: datapointstorage.NewCache(shutdown, cacheCfg),
+		log:   logger,
+	}
+}
+
+type standardDeltaAccumulator struct {
+	cache *datapointstorage.Cache
+	log   *zap.Logger
+}
+
+// startTimestamp returns the start time for the first point of a cumulative
+// series. Points without a valid start time are assumed to start 1 ms
+// before their end time.
+func startTimestamp(start, end pcommon.Timestamp) pcommon.Timestamp {
+	if start == 0 || !start.AsTime().Before(end.AsTime()) {
+		return pcommon.Timestamp(uint64(end) - uint64(time.Millisecond))
+	}
+	return start
+}
+
+// overlaps returns true if a delta point which starts at start, and ends at
+// end, can't be added to a cumulative point which ends at previousEnd.
+func (s *standardDeltaAccumulator) overlaps(start, end, previousEnd pcommon.Timestamp) bool {
+	if start != 0 && !start.AsTime().Before(previousEnd.AsTime()) {
+		return false
+	}
+	if start == 0 && end.AsTime().After(previousEnd.AsTime()) {
+		// Without a start time, assume the point follows the previous point.
+		return false
+	}
+	s.log.Debug(
+		"delta point overlaps with, or is older than, previously accumulated points, will not be emitted",
+		zap.String("previousEnd", previousEnd.String()),
+		zap.String("start", start.String()),
+		zap.String("end", end.String()),
+	)
+	return true
+}
+
+func (s *standardDeltaAccumulator) AccumulateNumberDataPoint(point pmetric.NumberDataPoint, identifier string) (pmetric.NumberDataPoint, bool) {
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewNumberDataPoint()
+	point.CopyTo(newPoint)
+	previous, found := s.cache.GetNumberDataPoint(identifier)
+	if !found {
+		newPoint.SetStartTimestamp(startTimestamp(point.StartTimestamp(), point.Timestamp()))
+		s.cache.SetNumberDataPoint(identifier, newPoint)
+		return newPoint, true
+	}
+	if s.overlaps(point.StartTimestamp(), point.Timestamp(), previous.Timestamp()) {
+		return pmetric.NumberDataPoint{}, false
+	}
+	newPoint.SetStartTimestamp(previous.StartTimestamp())
+	switch point.ValueType() {
+	case pmetric.NumberDataPointValueTypeInt:
+		if previous.ValueType() == pmetric.NumberDataPointValueTypeInt {
+			newPoint.SetIntValue(previous.IntValue() + point.IntValue())
+		} else {
+			newPoint.SetDoubleValue(previous.DoubleValue() + float64(point.IntValue()))
+		}
+	case pmetric.NumberDataPointValueTypeDouble:
+		if previous.ValueType() == pmetric.NumberDataPointValueTypeInt {
+			newPoint.SetDoubleValue(float64(previous.IntValue()) + point.DoubleValue())
+		} else {
+			newPoint.SetDoubleValue(previous.DoubleValue() + point.DoubleValue())
+		}
+	}
+	s.cache.SetNumberDataPoint(identifier, newPoint)
+	return newPoint, true
+}
+
+func (s *standardDeltaAccumulator) AccumulateHistogramDataPoint(point pmetric.HistogramDataPoint, identifier string) (pmetric.HistogramDataPoint, bool) {
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewHistogramDataPoint()
+	point.CopyTo(newPoint)
+	previous, found := s.cache.GetHistogramDataPoint(identifier)
+	if !found || !bucketBoundariesEqual(point.ExplicitBounds(), previous.ExplicitBounds()) {
+		// This is the first point, or the bucket boundaries changed, so
+		// start a new cumulative series.
+		newPoint.SetStartTimestamp(startTimestamp(point.StartTimestamp(), point.Timestamp()))
+		s.cache.SetHistogramDataPoint(identifier, newPoint)
+		return newPoint, true
+	}
+	if s.overlaps(point.StartTimestamp(), point.Timestamp(), previous.Timestamp()) {
+		return pmetric.HistogramDataPoint{}, false
+	}
+	newPoint.SetStartTimestamp(previous.StartTimestamp())
+	newPoint.SetCount(previous.Count() + point.Count())
+	newPoint.SetSum(previous.Sum() + point.Sum())
+	if previous.HasMin() && point.HasMin() {
+		newPoint.SetMin(math.Min(previous.Min(), point.Min()))
+	}
+	if previous.HasMax() && point.HasMax() {
+		newPoint.SetMax(math.Max(previous.Max(), point.Max()))
+	}
+	if previous.BucketCounts().Len() == point.BucketCounts().Len() {
+		buckets := make([]uint64, point.BucketCounts().Len())
+		for i := range buckets {
+			buckets[i] = previous.BucketCounts().At(i) + point.BucketCounts().At(i)
+		}
+		newPoint.BucketCounts().FromRaw(buckets)
+	}
+	s.cache.SetHistogramDataPoint(identifier, newPoint)
+	return newPoint, true
+}
+
+func (s *standardDeltaAccumulator) AccumulateExponentialHistogramDataPoint(point pmetric.ExponentialHistogramDataPoint, identifier string) (pmetric.ExponentialHistogramDataPoint, bool) {
+	previous, found := s.cache.GetExponentialHistogramDataPoint(identifier)
+	if !found {
+		// Make a copy so we don't mutate underlying data
+		newPoint := pmetric.NewExponentialHistogramDataPoint()
+		point.CopyTo(newPoint)
+		newPoint.SetStartTimestamp(startTimestamp(point.StartTimestamp(), point.Timestamp()))
+		s.cache.SetExponentialHistogramDataPoint(identifier, newPoint)
+		return newPoint, true
+	}
+	if s.overlaps(point.StartTimestamp(), point.Timestamp(), previous.Timestamp()) {
+		return pmetric.ExponentialHistogramDataPoint{}, false
+	}
+	// Add the points at the lower of the two scales.
+	scale := point.Scale()
+	if previous.Scale() < scale {
+		scale = previous.Scale()
+	}
+	newPoint := DownscaleExponentialHistogramDataPoint(point, scale)
+	previous = DownscaleExponentialHistogramDataPoint(previous, scale)
+	newPoint.SetStartTimestamp(previous.StartTimestamp())
+	newPoint.SetCount(previous.Count() + point.Count())
+	newPoint.SetSum(previous.Sum() + point.Sum())
+	newPoint.SetZeroCount(previous.ZeroCount() + point.ZeroCount())
+	if previous.HasMin() && point.HasMin() {
+		newPoint.SetMin(math.Min(previous.Min(), point.Min()))
+	}
+	if previous.HasMax() && point.HasMax() {
+		newPoint.SetMax(math.Max(previous.Max(), point.Max()))
+	}
+	addExponentialBuckets(newPoint.Positive(), previous.Positive())
+	addExponentialBuckets(newPoint.Negative(), previous.Negative())
+	s.cache.SetExponentialHistogramDataPoint(identifier, newPoint)
+	return newPoint, true
+}
+
+// addExponentialBuckets adds the counts of b to a. Both must have the same scale.
+func addExponentialBuckets(a, b pmetric.ExponentialHistogramDataPointBuckets) {
+	if b.BucketCounts().Len() == 0 {
+		return
+	}
+	if a.BucketCounts().Len() == 0 {
+		b.CopyTo(a)
+		return
+	}
+	first := a.Offset()
+	if b.Offset() < first {
+		first = b.Offset()
+	}
+	last := a.Offset() + int32(a.BucketCounts().Len())
+	if bLast := b.Offset() + int32(b.BucketCounts().Len()); bLast > last {
+		last = bLast
+	}
+	counts := make([]uint64, last-first)
+	for i := 0; i < a.BucketCounts().Len(); i++ {
+		counts[a.Offset()+int32(i)-first] += a.BucketCounts().At(i)
+	}
+	for i := 0; i < b.BucketCounts().Len(); i++ {
+		counts[b.Offset()+int32(i)-first] += b.BucketCounts().At(i)
+	}
+	a.SetOffset(first)
+	a.BucketCounts().FromRaw(counts)
+}
+
+// NewDisabledDeltaAccumulator returns a DeltaAccumulator which returns delta
+// points unchanged, so they are exported as cumulative points with resets.
+func NewDisabledDeltaAccumulator() DeltaAccumulator {
+	return &disabledDeltaAccumulator{}
+}
+
+type disabledDeltaAccumulator struct{}
+
+// AccumulateExponentialHistogramDataPoint returns the point without accumulating.
+func (d *disabledDeltaAccumulator) AccumulateExponentialHistogramDataPoint(point pmetric.ExponentialHistogramDataPoint, _ string) (pmetric.ExponentialHistogramDataPoint, bool) {
+	return point, true
+}
+
+// AccumulateHistogramDataPoint returns the point without accumulating.
+func (d *disabledDeltaAccumulator) AccumulateHistogramDataPoint(point pmetric.HistogramDataPoint, _ string) (pmetric.HistogramDataPoint, bool) {
+	return point, true
+}
+
+// AccumulateNumberDataPoint returns the point without accumulating.
+func (d *disabledDeltaAccumulator) AccumulateNumberDataPoint(point pmetric.NumberDataPoint, _ string) (pmetric.NumberDataPoint, bool) {
+	return point, true
+}
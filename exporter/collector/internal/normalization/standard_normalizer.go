@@ -33,10 +33,16 @@ import (
 // NOT exported. Subsequent points "subtract" the initial point prior to exporting.
 // This normalizer also detects subsequent resets, and produces a new start time for those points.
 // It doesn't modify values after a reset, but does give it a new start time.
-func NewStandardNormalizer(shutdown <-chan struct{}, logger *zap.Logger) Normalizer {
+// The limits of the caches of start and previous points are set by cacheCfg.
+func NewStandardNormalizer(shutdown <-chan struct{}, logger *zap.Logger, cacheCfg datapointstorage.Config) Normalizer {
+	newCache := func(name string) *datapointstorage.Cache {
+		cfg := cacheCfg
+		cfg.Name = name
+		return datapointstorage.NewCache(shutdown, cfg)
+	}
 	return &standardNormalizer{
-		startCache:    datapointstorage.NewCache(shutdown),
-		previousCache: datapointstorage.NewCache(shutdown),
+		startCache:    newCache(startCacheScope),
+		previousCache: newCache(previousCacheScope),
 		log:           logger,
 	}
 }
@@ -47,6 +53,47 @@ type standardNormalizer struct {
 	log           *zap.Logger
 }
 
+const (
+	// names of the caches, also used as scope names to store each cache in
+	// the serialized state.
+	startCacheScope    = "start"
+	previousCacheScope = "previous"
+)
+
+// MarshalState serializes the start and previous points as OTLP metrics.
+func (s *standardNormalizer) MarshalState() ([]byte, error) {
+	state := pmetric.NewMetrics()
+	sms := state.ResourceMetrics().AppendEmpty().ScopeMetrics()
+	start := sms.AppendEmpty()
+	start.Scope().SetName(startCacheScope)
+	s.startCache.Snapshot(start)
+	previous := sms.AppendEmpty()
+	previous.Scope().SetName(previousCacheScope)
+	s.previousCache.Snapshot(previous)
+	return (&pmetric.ProtoMarshaler{}).MarshalMetrics(state)
+}
+
+// UnmarshalState restores start and previous points serialized by MarshalState.
+func (s *standardNormalizer) UnmarshalState(data []byte) error {
+	state, err := (&pmetric.ProtoUnmarshaler{}).UnmarshalMetrics(data)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < state.ResourceMetrics().Len(); i++ {
+		sms := state.ResourceMetrics().At(i).ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			sm := sms.At(j)
+			switch sm.Scope().Name() {
+			case startCacheScope:
+				s.startCache.Restore(sm)
+			case previousCacheScope:
+				s.previousCache.Restore(sm)
+			}
+		}
+	}
+	return nil
+}
+
 func (s *standardNormalizer) NormalizeExponentialHistogramDataPoint(point pmetric.ExponentialHistogramDataPoint, identifier string) (pmetric.ExponentialHistogramDataPoint, bool) {
 	start, hasStart := s.startCache.GetExponentialHistogramDataPoint(identifier)
 	if !hasStart {
@@ -63,14 +110,16 @@ func (s *standardNormalizer) NormalizeExponentialHistogramDataPoint(point pmetri
 		return point, true
 	}
 
-	// TODO(#366): It is possible, but difficult to compare exponential
-	// histograms with different scales. For now, treat a change in
-	// scale as a reset.  Drop this point, and normalize against it for
-	// subsequent points.
-	if point.Scale() != start.Scale() {
-		s.startCache.SetExponentialHistogramDataPoint(identifier, point)
-		s.previousCache.SetExponentialHistogramDataPoint(identifier, point)
-		return pmetric.ExponentialHistogramDataPoint{}, false
+	// SDKs downscale exponential histograms when the range of recorded
+	// values grows. Compare points with different scales at the lower scale,
+	// by merging the buckets of the point with the higher scale.
+	if point.Scale() < start.Scale() {
+		// Store the downscaled start point, since subsequent points will
+		// most likely have the new scale as well.
+		start = DownscaleExponentialHistogramDataPoint(start, point.Scale())
+		s.startCache.SetExponentialHistogramDataPoint(identifier, start)
+	} else if point.Scale() > start.Scale() {
+		point = DownscaleExponentialHistogramDataPoint(point, start.Scale())
 	}
 
 	previous, hasPrevious := s.previousCache.GetExponentialHistogramDataPoint(identifier)
@@ -136,6 +185,41 @@ func subtractExponentialHistogramDataPoint(a, b pmetric.ExponentialHistogramData
 	return newPoint
 }
 
+// DownscaleExponentialHistogramDataPoint returns a copy of the point with its
+// buckets merged to the lower scale. The point is not modified if scale is
+// not lower than the point's scale.
+func DownscaleExponentialHistogramDataPoint(point pmetric.ExponentialHistogramDataPoint, scale int32) pmetric.ExponentialHistogramDataPoint {
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewExponentialHistogramDataPoint()
+	point.CopyTo(newPoint)
+	if scale >= point.Scale() {
+		return newPoint
+	}
+	shift := point.Scale() - scale
+	newPoint.SetScale(scale)
+	downscaleExponentialBuckets(point.Positive(), newPoint.Positive(), shift)
+	downscaleExponentialBuckets(point.Negative(), newPoint.Negative(), shift)
+	return newPoint
+}
+
+// downscaleExponentialBuckets merges the buckets from into to, reducing the
+// scale by shift. Each decrement of the scale merges pairs of adjacent
+// buckets, so bucket index i becomes index i >> shift.
+func downscaleExponentialBuckets(from, to pmetric.ExponentialHistogramDataPointBuckets, shift int32) {
+	// >> rounds towards negative infinity for negative indices, as required.
+	offset := from.Offset() >> shift
+	to.SetOffset(offset)
+	if from.BucketCounts().Len() == 0 {
+		return
+	}
+	last := (from.Offset() + int32(from.BucketCounts().Len()) - 1) >> shift
+	counts := make([]uint64, last-offset+1)
+	for i := 0; i < from.BucketCounts().Len(); i++ {
+		counts[((from.Offset()+int32(i))>>shift)-offset] += from.BucketCounts().At(i)
+	}
+	to.BucketCounts().FromRaw(counts)
+}
+
 // subtractExponentialBuckets returns a - b.
 func subtractExponentialBuckets(a, b pmetric.ExponentialHistogramDataPointBuckets) []uint64 {
 	newBuckets := make([]uint64, a.BucketCounts().Len())
@@ -33,3 +33,13 @@ type Normalizer interface {
 	// It returns the normalized point, and true if the point should be kept.
 	NormalizeSummaryDataPoint(point pmetric.SummaryDataPoint, identifier string) (pmetric.SummaryDataPoint, bool)
 }
+
+// StatefulNormalizer is a Normalizer whose state can be saved and restored,
+// so that it is preserved across restarts.
+type StatefulNormalizer interface {
+	Normalizer
+	// MarshalState serializes the cached points of the normalizer.
+	MarshalState() ([]byte, error)
+	// UnmarshalState restores cached points serialized by MarshalState.
+	UnmarshalState(data []byte) error
+}
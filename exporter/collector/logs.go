@@ -15,17 +15,16 @@
 package collector
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
-	"unicode/utf8"
 
 	loggingv2 "cloud.google.com/go/logging/apiv2"
 	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
@@ -34,24 +33,32 @@ import (
 	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
 	logtypepb "google.golang.org/genproto/googleapis/logging/type"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/plog"
 
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/logsutil"
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/logmapping"
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/resourcemapping"
 )
 
 const (
-	defaultMaxEntrySize   = 256000   // 256 KB
-	defaultMaxRequestSize = 10000000 // 10 MB
+	defaultMaxEntrySize   = logmapping.DefaultMaxEntrySize
+	defaultMaxRequestSize = logmapping.DefaultMaxRequestSize
+
+	// The name of the logs WAL in the user-configured WAL directory.
+	logsWALName = "gcp_logs_wal"
 
 	HTTPRequestAttributeKey    = "gcp.http_request"
 	LogNameAttributeKey        = "gcp.log_name"
@@ -60,70 +67,20 @@ const (
 
 	GCPTypeKey                 = "@type"
 	GCPErrorReportingTypeValue = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
-)
 
-// severityMapping maps the integer severity level values from OTel [0-24]
-// to matching Cloud Logging severity levels.
-var severityMapping = []logtypepb.LogSeverity{
-	logtypepb.LogSeverity_DEFAULT,   // Default, 0
-	logtypepb.LogSeverity_DEBUG,     //
-	logtypepb.LogSeverity_DEBUG,     //
-	logtypepb.LogSeverity_DEBUG,     //
-	logtypepb.LogSeverity_DEBUG,     //
-	logtypepb.LogSeverity_DEBUG,     //
-	logtypepb.LogSeverity_DEBUG,     //
-	logtypepb.LogSeverity_DEBUG,     //
-	logtypepb.LogSeverity_DEBUG,     // 1-8 -> Debug
-	logtypepb.LogSeverity_INFO,      //
-	logtypepb.LogSeverity_INFO,      // 9-10 -> Info
-	logtypepb.LogSeverity_NOTICE,    //
-	logtypepb.LogSeverity_NOTICE,    // 11-12 -> Notice
-	logtypepb.LogSeverity_WARNING,   //
-	logtypepb.LogSeverity_WARNING,   //
-	logtypepb.LogSeverity_WARNING,   //
-	logtypepb.LogSeverity_WARNING,   // 13-16 -> Warning
-	logtypepb.LogSeverity_ERROR,     //
-	logtypepb.LogSeverity_ERROR,     //
-	logtypepb.LogSeverity_ERROR,     //
-	logtypepb.LogSeverity_ERROR,     // 17-20 -> Error
-	logtypepb.LogSeverity_CRITICAL,  //
-	logtypepb.LogSeverity_CRITICAL,  // 21-22 -> Critical
-	logtypepb.LogSeverity_ALERT,     // 23 -> Alert
-	logtypepb.LogSeverity_EMERGENCY, // 24 -> Emergency
-}
-
-// otelSeverityForText maps the generic aliases of SeverityTexts to SeverityNumbers.
-// This can be useful if SeverityText is manually set to one of the values from the data
-// model in a way that doesn't automatically parse the SeverityNumber as well
-// (see https://github.com/GoogleCloudPlatform/opentelemetry-operations-go/issues/442)
-// Otherwise, this is the mapping that is automatically used by the Stanza log severity parser
-// (https://github.com/open-telemetry/opentelemetry-collector-contrib/blob/v0.54.0/pkg/stanza/operator/helper/severity_builder.go#L34-L57)
-var otelSeverityForText = map[string]plog.SeverityNumber{
-	"trace":  plog.SeverityNumberTrace,
-	"trace2": plog.SeverityNumberTrace2,
-	"trace3": plog.SeverityNumberTrace3,
-	"trace4": plog.SeverityNumberTrace4,
-	"debug":  plog.SeverityNumberDebug,
-	"debug2": plog.SeverityNumberDebug2,
-	"debug3": plog.SeverityNumberDebug3,
-	"debug4": plog.SeverityNumberDebug4,
-	"info":   plog.SeverityNumberInfo,
-	"info2":  plog.SeverityNumberInfo2,
-	"info3":  plog.SeverityNumberInfo3,
-	"info4":  plog.SeverityNumberInfo4,
-	"warn":   plog.SeverityNumberWarn,
-	"warn2":  plog.SeverityNumberWarn2,
-	"warn3":  plog.SeverityNumberWarn3,
-	"warn4":  plog.SeverityNumberWarn4,
-	"error":  plog.SeverityNumberError,
-	"error2": plog.SeverityNumberError2,
-	"error3": plog.SeverityNumberError3,
-	"error4": plog.SeverityNumberError4,
-	"fatal":  plog.SeverityNumberFatal,
-	"fatal2": plog.SeverityNumberFatal2,
-	"fatal3": plog.SeverityNumberFatal3,
-	"fatal4": plog.SeverityNumberFatal4,
-}
+	// Special fields of structured log payloads, which are lifted into
+	// LogEntry fields when ParseSpecialFields is enabled.
+	// See https://cloud.google.com/logging/docs/structured-logging#special-payload-fields.
+	severityField       = "severity"
+	httpRequestField    = "httpRequest"
+	traceField          = "logging.googleapis.com/trace"
+	spanIDField         = "logging.googleapis.com/spanId"
+	traceSampledField   = "logging.googleapis.com/trace_sampled"
+	labelsField         = "logging.googleapis.com/labels"
+	sourceLocationField = "logging.googleapis.com/sourceLocation"
+	insertIDField       = "logging.googleapis.com/insertId"
+	operationField      = "logging.googleapis.com/operation"
+)
 
 type attributeProcessingError struct {
 	Err error
@@ -143,10 +100,25 @@ func (e *unsupportedValueTypeError) Error() string {
 }
 
 type LogsExporter struct {
+	// write ahead log handles exporter retries in-order to handle network outages
+	wal           *exporterWAL
 	obs           selfObservability
 	loggingClient *loggingv2.Client
-	cfg           Config
-	mapper        logMapper
+	// shutdownC is a channel for signaling a graceful shutdown
+	shutdownC chan struct{}
+	cfg       Config
+	mapper    logMapper
+	// splits records the chunks of split log records which were written
+	// while others failed, so that they aren't written again on retry.
+	splits *writtenSplits
+	// goroutines tracks the currently running child tasks
+	goroutines sync.WaitGroup
+}
+
+// logRecordIndex identifies the LogRecord a log entry was created from, by its
+// position in the plog.Logs passed to PushLogs.
+type logRecordIndex struct {
+	resourceLogs, scopeLogs, logRecord int
 }
 
 type logMapper struct {
@@ -161,15 +133,20 @@ func NewGoogleCloudLogsExporter(
 	cfg Config,
 	log *zap.Logger,
 	version string,
+	opts ...ExporterOption,
 ) (*LogsExporter, error) {
 	setVersionInUserAgent(&cfg, version)
-	obs := selfObservability{
-		log: log,
+	o := newExporterOptions(log, opts)
+	obs, err := newSelfObservability(o.log, o.meterProvider, logsObservabilityPrefix)
+	if err != nil {
+		return nil, err
 	}
 
 	return &LogsExporter{
-		cfg: cfg,
-		obs: obs,
+		cfg:       cfg,
+		obs:       obs,
+		shutdownC: make(chan struct{}),
+		splits:    newWrittenSplits(),
 		mapper: logMapper{
 			obs:            obs,
 			cfg:            cfg,
@@ -193,7 +170,7 @@ func (l *LogsExporter) ConfigureExporter(config *logsutil.ExporterConfig) {
 }
 
 func (l *LogsExporter) Start(ctx context.Context, _ component.Host) error {
-	clientOpts, err := generateClientOptions(ctx, &l.cfg.LogConfig.ClientConfig, &l.cfg, loggingv2.DefaultAuthScopes())
+	clientOpts, err := generateClientOptions(ctx, &l.cfg.LogConfig.ClientConfig, &l.cfg, loggingv2.DefaultAuthScopes(), l.obs.meterProvider)
 	if err != nil {
 		return err
 	}
@@ -211,26 +188,147 @@ func (l *LogsExporter) Start(ctx context.Context, _ component.Host) error {
 	// We might have modified the config when we generated options above.
 	// Make sure changes to the config are synced to the mapper.
 	l.mapper.cfg = l.cfg
+
+	if l.cfg.LogConfig.WALConfig != nil {
+		_, _, err = l.setupWAL()
+		if err != nil {
+			return err
+		}
+		// start WAL popper routine
+		l.goroutines.Add(1)
+		go l.runWALReadAndExportLoop(ctx)
+	}
 	return nil
 }
 
+// setupWAL creates the WAL.
+// This function is also used to re-sync after writes, so it closes the existing WAL if present.
+// It returns the FirstIndex, LastIndex, and any error.
+func (l *LogsExporter) setupWAL() (uint64, uint64, error) {
+	if l.wal == nil {
+		l.wal = &exporterWAL{}
+	}
+	l.wal.obs = l.obs
+	if l.wal.obs.log == nil {
+		l.wal.obs.log = zap.NewNop()
+	}
+	l.wal.export = l.exportFromWAL
+	l.wal.failed = func(bytes []byte, err error) ([]byte, bool) {
+		req := new(logpb.WriteLogEntriesRequest)
+		if unmarshalErr := proto.Unmarshal(bytes, req); unmarshalErr != nil {
+			return bytes, !isNotRecoverable(err)
+		}
+		failed, retryable := failedLogEntries(req, err)
+		failedBytes, marshalErr := proto.Marshal(failed)
+		if marshalErr != nil {
+			return bytes, retryable
+		}
+		return failedBytes, retryable
+	}
+	l.wal.timestamp = func(bytes []byte) (time.Time, error) {
+		req := new(logpb.WriteLogEntriesRequest)
+		if err := proto.Unmarshal(bytes, req); err != nil {
+			return time.Time{}, err
+		}
+		var newest time.Time
+		for _, entry := range req.Entries {
+			if ts := entry.GetTimestamp(); ts != nil && ts.AsTime().After(newest) {
+				newest = ts.AsTime()
+			}
+		}
+		return newest, nil
+	}
+	return l.wal.setup(l.cfg.LogConfig.WALConfig, logsWALName)
+}
+
+// exportFromWAL sends a serialized WriteLogEntriesRequest read from the WAL.
+func (l *LogsExporter) exportFromWAL(ctx context.Context, bytes []byte) error {
+	req := new(logpb.WriteLogEntriesRequest)
+	if err := proto.Unmarshal(bytes, req); err != nil {
+		return err
+	}
+	// override destination project quota for this write request, if applicable.
+	// Entries are batched by project in PushLogs, so the project of the first
+	// entry's log name applies to the whole request.
+	if l.cfg.DestinationProjectQuota && len(req.Entries) > 0 {
+		if project, ok := projectFromLogName(req.Entries[0].LogName); ok {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{"x-goog-user-project": project}))
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	return l.sendRequest(ctx, req)
+}
+
+// projectFromLogName returns the project ID from a log name of the form
+// projects/[PROJECT_ID]/logs/[LOG_ID].
+func projectFromLogName(logName string) (string, bool) {
+	rest, found := strings.CutPrefix(logName, "projects/")
+	if !found {
+		return "", false
+	}
+	project, _, found := strings.Cut(rest, "/")
+	if !found {
+		return "", false
+	}
+	return project, true
+}
+
+func (l *LogsExporter) runWALReadAndExportLoop(ctx context.Context) {
+	defer l.goroutines.Done()
+	l.wal.runReadAndExportLoop(ctx, l.shutdownC)
+}
+
 func (l *LogsExporter) Shutdown(ctx context.Context) error {
+	close(l.shutdownC)
+	c := make(chan struct{})
+	go func() {
+		// Wait until all goroutines are done
+		l.goroutines.Wait()
+		close(c)
+	}()
+	select {
+	case <-ctx.Done():
+		l.obs.log.Error("Error waiting for async tasks to finish.", zap.Error(ctx.Err()))
+	case <-c:
+	}
+	l.obs.shutdown()
 	if l.loggingClient != nil {
 		return l.loggingClient.Close()
 	}
 	return nil
 }
 
+// PushLogs writes the log records in ld to Cloud Logging, or to the WAL if it
+// is enabled. If some of the entries fail to be written with a retryable
+// error, a consumererror.Logs error containing only the LogRecords of those
+// entries is returned, so that the LogRecords which were written are not
+// retried. When a LogRecord was split into several entries, only the entries
+// which failed are written again when it is retried. Log records which can't
+// be converted to entries, or whose entries fail with a permanent error, are
+// dropped and reported as a permanent error.
 func (l *LogsExporter) PushLogs(ctx context.Context, ld plog.Logs) error {
 	if l.loggingClient == nil {
 		return errors.New("not started")
 	}
-	projectEntries, err := l.mapper.createEntries(ld)
-	if err != nil {
-		return err
+	projectEntries, origins, err := l.mapper.createEntries(ld)
+	// log records which could not be converted to entries can't be retried.
+	permanentErrs := []error{err}
+	if l.wal != nil {
+		l.wal.mutex.Lock()
+		defer l.wal.mutex.Unlock()
+	}
+	var splitKeys map[*logpb.LogEntry]string
+	if l.wal == nil {
+		splitKeys = splitRecordKeys(projectEntries, origins)
+		for project, entries := range projectEntries {
+			projectEntries[project] = l.splits.unwritten(entries, splitKeys)
+		}
 	}
 
 	var errs []error
+	retryRecords := make(map[logRecordIndex]bool)
+	failedEntries := make(map[*logpb.LogEntry]bool)
 	for project, entries := range projectEntries {
 		entry := 0
 		currentBatchSize := 0
@@ -252,30 +350,91 @@ func (l *LogsExporter) PushLogs(ctx context.Context, ld plog.Logs) error {
 				continue
 			}
 
-			// override destination project quota for this write request, if applicable
-			if l.cfg.DestinationProjectQuota {
-				ctx = metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{"x-goog-user-project": strings.TrimPrefix(project, "projects/")}))
-			}
-
 			// if the current entry goes over the request size (or we have gone over every entry, i.e. index=len),
 			// write the list up to but not including the current entry's index
-			_, err := l.writeLogEntries(ctx, entries[:entry])
-			errs = append(errs, err)
+			if l.wal != nil {
+				// push request onto the WAL
+				errs = append(errs, l.wal.writeRequest(ctx, &logpb.WriteLogEntriesRequest{
+					PartialSuccess: true,
+					Entries:        entries[:entry],
+				}))
+			} else {
+				// override destination project quota for this write request, if applicable
+				if l.cfg.DestinationProjectQuota {
+					ctx = metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{"x-goog-user-project": strings.TrimPrefix(project, "projects/")}))
+				}
+				batch := entries[:entry]
+				if err := l.writeLogEntries(ctx, batch); err != nil {
+					for i := range logEntryErrors(len(batch), err) {
+						failedEntries[batch[i]] = true
+					}
+					failed := l.retryableLogRecords(batch, origins, err)
+					if len(failed) == 0 {
+						permanentErrs = append(permanentErrs, err)
+					} else {
+						errs = append(errs, err)
+					}
+					for record := range failed {
+						retryRecords[record] = true
+					}
+				}
+			}
 
 			entries = entries[entry:]
 			entry = 0
 			currentBatchSize = 0
 		}
 	}
+	if l.wal == nil {
+		for _, entries := range projectEntries {
+			l.splits.update(entries, splitKeys, func(entry *logpb.LogEntry) bool {
+				return !failedEntries[entry]
+			}, func(entry *logpb.LogEntry) bool {
+				return retryRecords[origins[entry]]
+			})
+		}
+	}
+	if len(retryRecords) > 0 {
+		return consumererror.NewLogs(errors.Join(append(errs, permanentErrs...)...), logsWithRecords(ld, retryRecords))
+	}
+	if permanentErr := errors.Join(permanentErrs...); permanentErr != nil {
+		errs = append(errs, consumererror.NewPermanent(permanentErr))
+	}
 	return errors.Join(errs...)
 }
 
-func (l logMapper) createEntries(ld plog.Logs) (map[string][]*logpb.LogEntry, error) {
+// logsWithRecords returns a copy of ld containing only the LogRecords in records.
+func logsWithRecords(ld plog.Logs, records map[logRecordIndex]bool) plog.Logs {
+	filtered := plog.NewLogs()
+	ld.CopyTo(filtered)
+	i := 0
+	filtered.ResourceLogs().RemoveIf(func(rl plog.ResourceLogs) bool {
+		j := 0
+		rl.ScopeLogs().RemoveIf(func(sl plog.ScopeLogs) bool {
+			k := 0
+			sl.LogRecords().RemoveIf(func(plog.LogRecord) bool {
+				remove := !records[logRecordIndex{resourceLogs: i, scopeLogs: j, logRecord: k}]
+				k++
+				return remove
+			})
+			j++
+			return sl.LogRecords().Len() == 0
+		})
+		i++
+		return rl.ScopeLogs().Len() == 0
+	})
+	return filtered
+}
+
+// createEntries converts the log records in ld to log entries, keyed by
+// destination project, and returns the LogRecord each entry was created from.
+func (l logMapper) createEntries(ld plog.Logs) (map[string][]*logpb.LogEntry, map[*logpb.LogEntry]logRecordIndex, error) {
 	// if destination_project_quota is enabled, projectMapKey will be the name of the project for each batch of entries
 	// otherwise, we can mix project entries for more efficient batching and store all entries in a single list
 	projectMapKey := ""
 	var errs []error
 	entries := make(map[string][]*logpb.LogEntry)
+	origins := make(map[*logpb.LogEntry]logRecordIndex)
 	for i := 0; i < ld.ResourceLogs().Len(); i++ {
 		rl := ld.ResourceLogs().At(i)
 		mr := l.cfg.LogConfig.MapMonitoredResource(rl.Resource())
@@ -304,6 +463,7 @@ func (l logMapper) createEntries(ld plog.Logs) (map[string][]*logpb.LogEntry, er
 				// metadata in case the payload needs to be split between multiple entries.
 				logName, err := l.getLogName(log)
 				if err != nil {
+					l.obs.recordDroppedLogRecord(projectID)
 					errs = append(errs, err)
 					continue
 				}
@@ -317,9 +477,13 @@ func (l logMapper) createEntries(ld plog.Logs) (map[string][]*logpb.LogEntry, er
 					projectID,
 				)
 				if err != nil {
+					l.obs.recordDroppedLogRecord(projectID)
 					errs = append(errs, err)
 					continue
 				}
+				if len(splitEntries) > 1 {
+					l.obs.recordSplitLogEntries(len(splitEntries), projectID)
+				}
 
 				for _, entry := range splitEntries {
 					if l.cfg.DestinationProjectQuota {
@@ -329,12 +493,13 @@ func (l logMapper) createEntries(ld plog.Logs) (map[string][]*logpb.LogEntry, er
 						entries[projectMapKey] = make([]*logpb.LogEntry, 0)
 					}
 					entries[projectMapKey] = append(entries[projectMapKey], entry)
+					origins[entry] = logRecordIndex{resourceLogs: i, scopeLogs: j, logRecord: k}
 				}
 			}
 		}
 	}
 
-	return entries, errors.Join(errs...)
+	return entries, origins, errors.Join(errs...)
 }
 
 // converts attributes to a map[string]string.
@@ -360,14 +525,137 @@ func mergeLogLabels(instrumentationSource, instrumentationVersion string, resour
 	return mergeLabels(labelsMap, resourceLabels)
 }
 
-func (l *LogsExporter) writeLogEntries(ctx context.Context, batch []*logpb.LogEntry) (*logpb.WriteLogEntriesResponse, error) {
+func (l *LogsExporter) writeLogEntries(ctx context.Context, batch []*logpb.LogEntry) error {
 	request := &logpb.WriteLogEntriesRequest{
 		PartialSuccess: true,
 		Entries:        batch,
 	}
+	return l.sendRequest(ctx, request)
+}
+
+// retryableLogRecords returns the LogRecords of the entries in batch which
+// failed to be written with err, and can be retried. Entries which failed
+// with a permanent error are logged by reason, and dropped.
+func (l *LogsExporter) retryableLogRecords(batch []*logpb.LogEntry, origins map[*logpb.LogEntry]logRecordIndex, err error) map[logRecordIndex]bool {
+	retryable := make(map[logRecordIndex]bool)
+	dropped := make(map[string]int)
+	messages := make(map[string]string)
+	for i, s := range logEntryErrors(len(batch), err) {
+		if isRetryableLogCode(s.Code()) {
+			if origin, ok := origins[batch[i]]; ok {
+				retryable[origin] = true
+			}
+			continue
+		}
+		reason := statusCodeToString(s)
+		dropped[reason]++
+		messages[reason] = s.Message()
+	}
+	for reason, entries := range dropped {
+		l.obs.log.Error("Dropping log entries which could not be written.",
+			zap.String("reason", reason), zap.Int("entries", entries), zap.String("message", messages[reason]))
+	}
+	return retryable
+}
+
+// isRetryableLogCode returns true if log entries which failed to be written
+// with code can be retried. In addition to the codes retried for metrics,
+// Cloud Logging returns Canceled and Aborted for transient failures.
+func isRetryableLogCode(code codes.Code) bool {
+	return isRetryableCode(code) || code == codes.Canceled || code == codes.Aborted
+}
+
+// logEntryErrors returns the status of each entry of a WriteLogEntriesRequest
+// with numEntries entries which failed to be written with err, by index in
+// the request. With partial success, Cloud Logging writes the valid entries,
+// and lists the entries which failed in WriteLogEntriesPartialErrors.
+// Otherwise, all of the entries failed with the status of the request.
+func logEntryErrors(numEntries int, err error) map[int]*status.Status {
+	if err == nil {
+		return nil
+	}
+	s := status.Convert(err)
+	errs := make(map[int]*status.Status)
+	for _, detail := range s.Details() {
+		partialErrors, ok := detail.(*logpb.WriteLogEntriesPartialErrors)
+		if !ok {
+			continue
+		}
+		for i, entryErr := range partialErrors.GetLogEntryErrors() {
+			if i >= 0 && int(i) < numEntries {
+				errs[int(i)] = status.FromProto(entryErr)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	for i := 0; i < numEntries; i++ {
+		errs[i] = s
+	}
+	return errs
+}
+
+// failedLogEntries returns a request containing only the entries of req which
+// failed to be written with err, and whether they can be retried.
+func failedLogEntries(req *logpb.WriteLogEntriesRequest, err error) (*logpb.WriteLogEntriesRequest, bool) {
+	failed := &logpb.WriteLogEntriesRequest{
+		LogName:        req.LogName,
+		Resource:       req.Resource,
+		Labels:         req.Labels,
+		PartialSuccess: req.PartialSuccess,
+		DryRun:         req.DryRun,
+	}
+	retryable := false
+	entryErrs := logEntryErrors(len(req.Entries), err)
+	for i, entry := range req.Entries {
+		s, ok := entryErrs[i]
+		if !ok {
+			continue
+		}
+		failed.Entries = append(failed.Entries, entry)
+		if isRetryableLogCode(s.Code()) {
+			retryable = true
+		}
+	}
+	return failed, retryable
+}
 
-	// TODO(damemi): handle response code
-	return l.loggingClient.WriteLogEntries(ctx, request)
+// sendRequest sends a WriteLogEntriesRequest to Cloud Logging, and records
+// the entries written or failed by project and status, and the size and
+// latency of the request. Requests may mix projects unless destination
+// project quota is enabled. The size and latency of requests with entries in
+// several projects are recorded without a project.
+func (l *LogsExporter) sendRequest(ctx context.Context, req *logpb.WriteLogEntriesRequest) error {
+	start := time.Now()
+	_, err := l.loggingClient.WriteLogEntries(ctx, req)
+	latency := time.Since(start)
+
+	type projectStatus struct {
+		project, status string
+	}
+	var requestProject string
+	var mixedProjects bool
+	entryErrs := logEntryErrors(len(req.Entries), err)
+	entries := make(map[projectStatus]int)
+	for i, entry := range req.Entries {
+		project, _ := projectFromLogName(entry.LogName)
+		if i == 0 {
+			requestProject = project
+		} else if project != requestProject {
+			mixedProjects = true
+		}
+		// entries without an error were written, and have an OK status.
+		entries[projectStatus{project: project, status: statusCodeToString(entryErrs[i])}]++
+	}
+	for ps, n := range entries {
+		l.obs.recordLogEntryCount(ctx, n, ps.project, ps.status)
+	}
+	if mixedProjects {
+		requestProject = ""
+	}
+	l.obs.recordLogRequest(ctx, proto.Size(req), latency, requestProject, statusCodeToString(status.Convert(err)))
+	return err
 }
 
 func (l logMapper) getLogName(log plog.LogRecord) (string, error) {
@@ -452,12 +740,14 @@ func (l logMapper) logToSplitEntries(
 		}
 		entry.HttpRequest = httpRequest
 		delete(attrsMap, HTTPRequestAttributeKey)
+	} else if l.cfg.LogConfig.HTTPRequestFromSemconv {
+		entry.HttpRequest = httpRequestFromSemconv(attrsMap)
 	}
 
-	if logRecord.SeverityNumber() < 0 || int(logRecord.SeverityNumber()) > len(severityMapping)-1 {
+	if _, ok := logmapping.Severity(int(logRecord.SeverityNumber())); !ok {
 		return nil, fmt.Errorf("unknown SeverityNumber %v", logRecord.SeverityNumber())
 	}
-	severityNumber := logRecord.SeverityNumber()
+	severityNumber := int(logRecord.SeverityNumber())
 	// Log severity levels are based on numerical values defined by Otel/GCP, which are informally mapped to generic text values such as "ALERT", "Debug", etc.
 	// In some cases, a SeverityText value can be automatically mapped to a matching SeverityNumber.
 	// If not (for example, when directly setting the SeverityText on a Log entry with the Transform processor), then the
@@ -465,13 +755,13 @@ func (l logMapper) logToSplitEntries(
 	// In this case, we will attempt to map the text ourselves to one of the defined Otel SeverityNumbers.
 	// We do this by checking that the SeverityText is NOT "default" (ie, it exists in our map) and that the SeverityNumber IS "0".
 	// (This also excludes other unknown/custom severity text values, which may have user-defined mappings in the collector)
-	if severityForText, ok := otelSeverityForText[strings.ToLower(logRecord.SeverityText())]; ok && severityNumber == 0 {
+	if severityForText, ok := logmapping.SeverityNumberForText(logRecord.SeverityText()); ok && severityNumber == 0 {
 		severityNumber = severityForText
 	}
-	entry.Severity = severityMapping[severityNumber]
+	entry.Severity, _ = logmapping.Severity(severityNumber)
 
 	// Parse severityNumber > 17 (error) to a GCP Error Reporting entry if enabled
-	if severityNumber >= 17 && l.cfg.LogConfig.ErrorReportingType {
+	if severityNumber >= logmapping.ErrorSeverityNumber && l.cfg.LogConfig.ErrorReportingType {
 		if logRecord.Body().Type() != pcommon.ValueTypeMap {
 			strValue := logRecord.Body().AsString()
 			logRecord.Body().SetEmptyMap()
@@ -494,6 +784,9 @@ func (l logMapper) logToSplitEntries(
 	// Handle map and bytes as JSON-structured logs if they are successfully converted.
 	switch logRecord.Body().Type() {
 	case pcommon.ValueTypeMap:
+		if l.cfg.LogConfig.ParseSpecialFields {
+			l.parseSpecialFields(entry, logRecord.Body().Map(), projectID)
+		}
 		s, err := structpb.NewStruct(logRecord.Body().Map().AsRaw())
 		if err == nil {
 			entry.Payload = &logpb.LogEntry_JsonPayload{JsonPayload: s}
@@ -517,95 +810,16 @@ func (l logMapper) logToSplitEntries(
 		return []*logpb.LogEntry{entry}, nil
 	}
 
-	// Calculate the size of the internal log entry so this overhead can be accounted
-	// for when determining the need to split based on payload size
-	// TODO(damemi): Find an appropriate estimated buffer to account for the LogSplit struct as well
-	overheadBytes := proto.Size(entry)
-	// Split log entries with a string payload into fewer entries
-	splits := int(math.Ceil(float64(len([]byte(logBodyString))) / float64(l.maxEntrySize-overheadBytes)))
-	if splits <= 1 {
-		entry.Payload = &logpb.LogEntry_TextPayload{TextPayload: logBodyString}
-		return []*logpb.LogEntry{entry}, nil
-	}
-	entries := make([]*logpb.LogEntry, splits)
-	// Start by assuming all splits will be even (this may not be the case)
-	startIndex := 0
-	endIndex := int(math.Floor((1.0 / float64(splits)) * float64(len(logBodyString))))
-	for i := 0; i < splits; i++ {
-		newEntry := proto.Clone(entry).(*logpb.LogEntry)
-		currentSplit := logBodyString[startIndex:endIndex]
-
-		// If the current split is larger than the entry size, iterate until it is within the max
-		// (This may happen since not all characters are exactly 1 byte)
-		for len([]byte(currentSplit)) > l.maxEntrySize {
-			endIndex--
-			currentSplit = logBodyString[startIndex:endIndex]
-		}
-		newEntry.Payload = &logpb.LogEntry_TextPayload{TextPayload: currentSplit}
-		newEntry.Split = &logpb.LogSplit{
-			Uid:         fmt.Sprintf("%s-%s", logName, entry.Timestamp.AsTime().String()),
-			Index:       int32(i),
-			TotalSplits: int32(splits),
-		}
-		entries[i] = newEntry
-
-		// Update slice indices to the next chunk
-		startIndex = endIndex
-		endIndex = int(math.Floor((float64(i+2) / float64(splits)) * float64(len(logBodyString))))
-	}
-	return entries, nil
-}
-
-// JSON keys derived from:
-// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#httprequest
-type httpRequestLog struct {
-	RemoteIP                       string `json:"remoteIp"`
-	RequestURL                     string `json:"requestUrl"`
-	Latency                        string `json:"latency"`
-	Referer                        string `json:"referer"`
-	ServerIP                       string `json:"serverIp"`
-	UserAgent                      string `json:"userAgent"`
-	RequestMethod                  string `json:"requestMethod"`
-	Protocol                       string `json:"protocol"`
-	ResponseSize                   int64  `json:"responseSize,string"`
-	RequestSize                    int64  `json:"requestSize,string"`
-	CacheFillBytes                 int64  `json:"cacheFillBytes,string"`
-	Status                         int32  `json:"status,string"`
-	CacheLookup                    bool   `json:"cacheLookup"`
-	CacheHit                       bool   `json:"cacheHit"`
-	CacheValidatedWithOriginServer bool   `json:"cacheValidatedWithOriginServer"`
+	return logmapping.SplitTextPayload(entry, logBodyString, logName, l.maxEntrySize), nil
 }
 
 func (l logMapper) parseHTTPRequest(httpRequestAttr pcommon.Value) (*logtypepb.HttpRequest, error) {
-	var parsedHTTPRequest httpRequestLog
+	var parsedHTTPRequest logmapping.HTTPRequest
 	err := unmarshalAttribute(httpRequestAttr, &parsedHTTPRequest)
 	if err != nil {
 		return nil, &attributeProcessingError{Key: HTTPRequestAttributeKey, Err: err}
 	}
-
-	pb := &logtypepb.HttpRequest{
-		RequestMethod:                  parsedHTTPRequest.RequestMethod,
-		RequestUrl:                     fixUTF8(parsedHTTPRequest.RequestURL),
-		RequestSize:                    parsedHTTPRequest.RequestSize,
-		Status:                         parsedHTTPRequest.Status,
-		ResponseSize:                   parsedHTTPRequest.ResponseSize,
-		UserAgent:                      parsedHTTPRequest.UserAgent,
-		ServerIp:                       parsedHTTPRequest.ServerIP,
-		RemoteIp:                       parsedHTTPRequest.RemoteIP,
-		Referer:                        parsedHTTPRequest.Referer,
-		CacheHit:                       parsedHTTPRequest.CacheHit,
-		CacheValidatedWithOriginServer: parsedHTTPRequest.CacheValidatedWithOriginServer,
-		Protocol:                       "HTTP/1.1",
-		CacheFillBytes:                 parsedHTTPRequest.CacheFillBytes,
-		CacheLookup:                    parsedHTTPRequest.CacheLookup,
-	}
-	if parsedHTTPRequest.Latency != "" {
-		latency, err := time.ParseDuration(parsedHTTPRequest.Latency)
-		if err == nil && latency != 0 {
-			pb.Latency = durationpb.New(latency)
-		}
-	}
-	return pb, nil
+	return parsedHTTPRequest.Proto(), nil
 }
 
 // toProtoStruct converts v, which must marshal into a JSON object,
@@ -629,28 +843,6 @@ func toProtoStruct(v any) (*structpb.Struct, error) {
 	return structpb.NewStruct(m)
 }
 
-// fixUTF8 is a helper that fixes an invalid UTF-8 string by replacing
-// invalid UTF-8 runes with the Unicode replacement character (U+FFFD).
-// See Issue https://github.com/googleapis/google-cloud-go/issues/1383.
-// Coped from https://github.com/googleapis/google-cloud-go/blob/69705144832c715cf23832602ad9338b911dff9a/logging/logging.go#L557
-func fixUTF8(s string) string {
-	if utf8.ValidString(s) {
-		return s
-	}
-
-	// Otherwise time to build the sequence.
-	buf := new(bytes.Buffer)
-	buf.Grow(len(s))
-	for _, r := range s {
-		if utf8.ValidRune(r) {
-			buf.WriteRune(r)
-		} else {
-			buf.WriteRune('\uFFFD')
-		}
-	}
-	return buf.String()
-}
-
 func unmarshalAttribute(v pcommon.Value, out any) error {
 	var valueBytes []byte
 	switch v.Type() {
@@ -666,3 +858,266 @@ func unmarshalAttribute(v pcommon.Value, out any) error {
 	// assertions with it.
 	return json.Unmarshal(valueBytes, out)
 }
+
+// httpRequestSemconvKeys are the HTTP semantic convention attributes which
+// identify a log record as describing an HTTP request. The other attributes
+// used for the HttpRequest, e.g. client.address, aren't specific to HTTP.
+var httpRequestSemconvKeys = []string{
+	"http.request.method",
+	"http.method",
+	"http.response.status_code",
+	"http.status_code",
+	"url.full",
+	"url.path",
+	"url.query",
+	"http.url",
+	"http.target",
+}
+
+// httpRequestFromSemconv builds an HttpRequest from the HTTP semantic
+// convention attributes in attrs, and removes the attributes it used. For each
+// field, the current attribute is preferred over the legacy attributes it
+// replaced. It returns nil, and leaves attrs unchanged, if attrs has none of
+// httpRequestSemconvKeys.
+func httpRequestFromSemconv(attrs map[string]pcommon.Value) *logtypepb.HttpRequest {
+	isHTTPRequest := false
+	for _, k := range httpRequestSemconvKeys {
+		if _, ok := attrs[k]; ok {
+			isHTTPRequest = true
+			break
+		}
+	}
+	if !isHTTPRequest {
+		return nil
+	}
+
+	// get returns the value of the first of keys in attrs, and removes all of
+	// them, since current and legacy attributes may be emitted together.
+	get := func(keys ...string) (pcommon.Value, bool) {
+		var value pcommon.Value
+		ok := false
+		for _, k := range keys {
+			if v, exists := attrs[k]; exists {
+				if !ok {
+					value, ok = v, true
+				}
+				delete(attrs, k)
+			}
+		}
+		return value, ok
+	}
+
+	httpRequest := &logtypepb.HttpRequest{}
+	if v, ok := get("http.request.method", "http.method"); ok {
+		httpRequest.RequestMethod = v.AsString()
+	}
+	fullURL, hasFullURL := get("url.full", "http.url")
+	path, hasPath := get("url.path", "http.target")
+	query, hasQuery := get("url.query")
+	switch {
+	case hasFullURL:
+		httpRequest.RequestUrl = logmapping.FixUTF8(fullURL.AsString())
+	case hasPath:
+		requestURL := path.AsString()
+		if hasQuery && query.AsString() != "" {
+			requestURL += "?" + query.AsString()
+		}
+		httpRequest.RequestUrl = logmapping.FixUTF8(requestURL)
+	}
+	if v, ok := get("http.response.status_code", "http.status_code"); ok {
+		if code, ok := intAttribute(v); ok {
+			httpRequest.Status = int32(code)
+		}
+	}
+	if v, ok := get("user_agent.original", "http.user_agent"); ok {
+		httpRequest.UserAgent = v.AsString()
+	}
+	if v, ok := get("client.address", "http.client_ip", "net.sock.peer.addr", "net.peer.ip"); ok {
+		httpRequest.RemoteIp = v.AsString()
+	}
+	if v, ok := get("network.local.address", "net.sock.host.addr", "net.host.ip"); ok {
+		httpRequest.ServerIp = v.AsString()
+	}
+	if v, ok := get("http.request.header.referer"); ok {
+		if v.Type() == pcommon.ValueTypeSlice {
+			if v.Slice().Len() > 0 {
+				httpRequest.Referer = v.Slice().At(0).AsString()
+			}
+		} else {
+			httpRequest.Referer = v.AsString()
+		}
+	}
+	if v, ok := get("http.request.body.size", "http.request_content_length"); ok {
+		httpRequest.RequestSize, _ = intAttribute(v)
+	}
+	if v, ok := get("http.response.body.size", "http.response_content_length"); ok {
+		httpRequest.ResponseSize, _ = intAttribute(v)
+	}
+	// the current duration attribute is in seconds, and the legacy one in milliseconds.
+	duration, hasDuration := get("http.server.request.duration")
+	legacyDuration, hasLegacyDuration := get("http.server.duration")
+	switch {
+	case hasDuration:
+		if seconds, ok := floatAttribute(duration); ok && seconds > 0 {
+			httpRequest.Latency = durationpb.New(time.Duration(seconds * float64(time.Second)))
+		}
+	case hasLegacyDuration:
+		if millis, ok := floatAttribute(legacyDuration); ok && millis > 0 {
+			httpRequest.Latency = durationpb.New(time.Duration(millis * float64(time.Millisecond)))
+		}
+	}
+	protocolName, hasProtocolName := get("network.protocol.name")
+	if v, ok := get("network.protocol.version", "http.flavor"); ok {
+		name := "HTTP"
+		if hasProtocolName {
+			name = strings.ToUpper(protocolName.AsString())
+		}
+		httpRequest.Protocol = name + "/" + v.AsString()
+	}
+	return httpRequest
+}
+
+// intAttribute returns the value of an integer attribute, which may also be
+// recorded as a double or a string.
+func intAttribute(v pcommon.Value) (int64, bool) {
+	switch v.Type() {
+	case pcommon.ValueTypeInt:
+		return v.Int(), true
+	case pcommon.ValueTypeDouble:
+		return int64(v.Double()), true
+	case pcommon.ValueTypeStr:
+		i, err := strconv.ParseInt(v.Str(), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// floatAttribute returns the value of a numeric attribute, which may also be
+// recorded as a string.
+func floatAttribute(v pcommon.Value) (float64, bool) {
+	switch v.Type() {
+	case pcommon.ValueTypeInt:
+		return float64(v.Int()), true
+	case pcommon.ValueTypeDouble:
+		return v.Double(), true
+	case pcommon.ValueTypeStr:
+		f, err := strconv.ParseFloat(v.Str(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// parseSpecialFields sets the LogEntry fields from the special fields of a
+// structured log body, and removes them from the body. The special fields take
+// precedence over the values set from the log record. Fields which can't be
+// parsed are left in the body.
+func (l logMapper) parseSpecialFields(entry *logpb.LogEntry, body pcommon.Map, projectID string) {
+	body.RemoveIf(func(k string, v pcommon.Value) bool {
+		switch k {
+		case severityField:
+			severity, ok := parseSeverityField(v)
+			if ok {
+				entry.Severity = severity
+			}
+			return ok
+		case httpRequestField:
+			var httpRequest logtypepb.HttpRequest
+			if err := unmarshalSpecialField(v, &httpRequest); err != nil {
+				l.obs.log.Debug("Unable to parse special field", zap.String("field", k), zap.Error(err))
+				return false
+			}
+			entry.HttpRequest = &httpRequest
+			return true
+		case traceField:
+			if v.Type() != pcommon.ValueTypeStr || v.Str() == "" {
+				return false
+			}
+			entry.Trace = v.Str()
+			if !strings.HasPrefix(entry.Trace, "projects/") {
+				entry.Trace = fmt.Sprintf("projects/%s/traces/%s", projectID, entry.Trace)
+			}
+			return true
+		case spanIDField:
+			if v.Type() != pcommon.ValueTypeStr {
+				return false
+			}
+			entry.SpanId = v.Str()
+			return true
+		case traceSampledField:
+			if v.Type() != pcommon.ValueTypeBool {
+				return false
+			}
+			entry.TraceSampled = v.Bool()
+			return true
+		case labelsField:
+			if v.Type() != pcommon.ValueTypeMap {
+				return false
+			}
+			if entry.Labels == nil {
+				entry.Labels = make(map[string]string, v.Map().Len())
+			}
+			v.Map().Range(func(labelKey string, labelValue pcommon.Value) bool {
+				entry.Labels[labelKey] = sanitizeUTF8(labelValue.AsString())
+				return true
+			})
+			return true
+		case sourceLocationField:
+			var sourceLocation logpb.LogEntrySourceLocation
+			if err := unmarshalSpecialField(v, &sourceLocation); err != nil {
+				l.obs.log.Debug("Unable to parse special field", zap.String("field", k), zap.Error(err))
+				return false
+			}
+			entry.SourceLocation = &sourceLocation
+			return true
+		case insertIDField:
+			if v.Type() != pcommon.ValueTypeStr {
+				return false
+			}
+			entry.InsertId = v.Str()
+			return true
+		case operationField:
+			var operation logpb.LogEntryOperation
+			if err := unmarshalSpecialField(v, &operation); err != nil {
+				l.obs.log.Debug("Unable to parse special field", zap.String("field", k), zap.Error(err))
+				return false
+			}
+			entry.Operation = &operation
+			return true
+		}
+		return false
+	})
+}
+
+// parseSeverityField parses a severity special field, which is either the name
+// of a Cloud Logging severity, one of the OTel severity text aliases (e.g.
+// "warn"), or the numeric value of a Cloud Logging severity.
+func parseSeverityField(v pcommon.Value) (logtypepb.LogSeverity, bool) {
+	switch v.Type() {
+	case pcommon.ValueTypeStr:
+		if severity, ok := logtypepb.LogSeverity_value[strings.ToUpper(v.Str())]; ok {
+			return logtypepb.LogSeverity(severity), true
+		}
+		if severityNumber, ok := logmapping.SeverityNumberForText(v.Str()); ok {
+			return logmapping.Severity(severityNumber)
+		}
+	case pcommon.ValueTypeInt:
+		if _, ok := logtypepb.LogSeverity_name[int32(v.Int())]; ok {
+			return logtypepb.LogSeverity(v.Int()), true
+		}
+	case pcommon.ValueTypeDouble:
+		if _, ok := logtypepb.LogSeverity_name[int32(v.Double())]; ok {
+			return logtypepb.LogSeverity(v.Double()), true
+		}
+	}
+	return logtypepb.LogSeverity_DEFAULT, false
+}
+
+// unmarshalSpecialField unmarshals a special field holding the JSON
+// representation of a LogEntry field, e.g. httpRequest. Unknown fields are
+// ignored.
+func unmarshalSpecialField(v pcommon.Value, out proto.Message) error {
+	if v.Type() != pcommon.ValueTypeMap {
+		return &unsupportedValueTypeError{ValueType: v.Type()}
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal([]byte(v.AsString()), out)
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+)
+
+// writtenSplitsTTL is how long the written chunks of a split log record are
+// remembered while the record is retried. It is longer than the default
+// maximum time the collector retries a request.
+const writtenSplitsTTL = 10 * time.Minute
+
+// writtenSplits records the chunks of split log records which were written
+// while other chunks of the same record failed with a retryable error, so that
+// only the failed chunks are written again when the record is retried.
+//
+// Records are identified by the keys returned by splitRecordKeys, and chunks
+// by their index. Records without a timestamp are given a new one when they
+// are retried, so all of their chunks are written again.
+type writtenSplits struct {
+	now func() time.Time
+	// splits holds the written chunks by record key.
+	splits map[string]*writtenSplit
+	mutex  sync.Mutex
+}
+
+type writtenSplit struct {
+	// indices holds the indices of the chunks which were written.
+	indices map[int32]bool
+	// updated is when chunks were last written.
+	updated time.Time
+}
+
+func newWrittenSplits() *writtenSplits {
+	return &writtenSplits{
+		now:    time.Now,
+		splits: make(map[string]*writtenSplit),
+	}
+}
+
+// splitRecordKeys returns the key of the log record each split entry in
+// projectEntries was created from. The split UID is only derived from the log
+// name and timestamp of the record, which records written in the same batch
+// often share, so the key also includes a hash of the record's payload.
+func splitRecordKeys(projectEntries map[string][]*logpb.LogEntry, origins map[*logpb.LogEntry]logRecordIndex) map[*logpb.LogEntry]string {
+	hashes := make(map[logRecordIndex]hash.Hash64)
+	var split []*logpb.LogEntry
+	for _, entries := range projectEntries {
+		// the chunks of a record are in order, so hashing them hashes the
+		// payload of the record.
+		for _, entry := range entries {
+			if entry.GetSplit() == nil {
+				continue
+			}
+			h, ok := hashes[origins[entry]]
+			if !ok {
+				h = fnv.New64a()
+				hashes[origins[entry]] = h
+			}
+			h.Write([]byte(entry.GetTextPayload()))
+			split = append(split, entry)
+		}
+	}
+	keys := make(map[*logpb.LogEntry]string, len(split))
+	for _, entry := range split {
+		keys[entry] = fmt.Sprintf("%s#%x", entry.GetSplit().GetUid(), hashes[origins[entry]].Sum64())
+	}
+	return keys
+}
+
+// unwritten returns entries without the chunks of split log records which
+// were already written. keys holds the record key of each split entry.
+func (w *writtenSplits) unwritten(entries []*logpb.LogEntry, keys map[*logpb.LogEntry]string) []*logpb.LogEntry {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.splits) == 0 {
+		return entries
+	}
+	unwritten := entries[:0:0]
+	for _, entry := range entries {
+		if split, ok := w.splits[keys[entry]]; ok && split.indices[entry.GetSplit().GetIndex()] {
+			continue
+		}
+		unwritten = append(unwritten, entry)
+	}
+	return unwritten
+}
+
+// update records the chunks in entries which were written if their record is
+// retried, and forgets the records which are not retried, since they were
+// either fully written or dropped. Records retried for longer than
+// writtenSplitsTTL are forgotten too. keys holds the record key of each split
+// entry.
+func (w *writtenSplits) update(entries []*logpb.LogEntry, keys map[*logpb.LogEntry]string, written, retried func(*logpb.LogEntry) bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	now := w.now()
+	for _, entry := range entries {
+		key, ok := keys[entry]
+		if !ok {
+			continue
+		}
+		if !retried(entry) {
+			delete(w.splits, key)
+			continue
+		}
+		if !written(entry) {
+			continue
+		}
+		s, ok := w.splits[key]
+		if !ok {
+			s = &writtenSplit{indices: make(map[int32]bool)}
+			w.splits[key] = s
+		}
+		s.indices[entry.GetSplit().GetIndex()] = true
+		s.updated = now
+	}
+	for key, s := range w.splits {
+		if now.Sub(s.updated) >= writtenSplitsTTL {
+			delete(w.splits, key)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrittenSplitsExpire(t *testing.T) {
+	now := time.Now()
+	splits := newWrittenSplits()
+	splits.now = func() time.Time { return now }
+	entries := []*logpb.LogEntry{
+		{Split: &logpb.LogSplit{Uid: "record", Index: 0, TotalSplits: 2}},
+		{Split: &logpb.LogSplit{Uid: "record", Index: 1, TotalSplits: 2}},
+	}
+	keys := map[*logpb.LogEntry]string{entries[0]: "record", entries[1]: "record"}
+	written := func(entry *logpb.LogEntry) bool { return entry.GetSplit().GetIndex() == 0 }
+	retried := func(*logpb.LogEntry) bool { return true }
+
+	splits.update(entries, keys, written, retried)
+	assert.Equal(t, entries[1:], splits.unwritten(entries, keys))
+
+	now = now.Add(writtenSplitsTTL)
+	splits.update(nil, keys, written, retried)
+	assert.Equal(t, entries, splits.unwritten(entries, keys), "written chunks are forgotten after the TTL")
+}
@@ -15,20 +15,35 @@
 package collector
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/logging"
 	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"go.uber.org/zap"
 	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
 	logtypepb "google.golang.org/genproto/googleapis/logging/type"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
@@ -641,6 +656,151 @@ func TestLogMapping(t *testing.T) {
 			},
 			maxEntrySize: defaultMaxEntrySize,
 		},
+		{
+			name: "log body with special fields parsed",
+			mr: func() *monitoredrespb.MonitoredResource {
+				return nil
+			},
+			log: func() plog.LogRecord {
+				log := plog.NewLogRecord()
+				log.SetSeverityNumber(9)
+				body := log.Body().SetEmptyMap()
+				body.PutStr("message", "hello")
+				body.PutStr("severity", "warning")
+				httpRequest := body.PutEmptyMap("httpRequest")
+				httpRequest.PutStr("requestMethod", "GET")
+				httpRequest.PutInt("status", 200)
+				httpRequest.PutStr("responseSize", "123")
+				httpRequest.PutStr("latency", "1.5s")
+				body.PutStr("logging.googleapis.com/trace", "0123456789abcdef0123456789abcdef")
+				body.PutStr("logging.googleapis.com/spanId", "0123456789abcdef")
+				body.PutBool("logging.googleapis.com/trace_sampled", true)
+				body.PutEmptyMap("logging.googleapis.com/labels").PutStr("foo", "bar")
+				sourceLocation := body.PutEmptyMap("logging.googleapis.com/sourceLocation")
+				sourceLocation.PutStr("file", "main.go")
+				sourceLocation.PutStr("line", "42")
+				sourceLocation.PutStr("function", "main")
+				body.PutStr("logging.googleapis.com/insertId", "my-insert-id")
+				operation := body.PutEmptyMap("logging.googleapis.com/operation")
+				operation.PutStr("id", "my-operation")
+				operation.PutStr("producer", "my-producer")
+				operation.PutBool("first", true)
+				return log
+			},
+			expectedEntries: []*logpb.LogEntry{
+				{
+					LogName:   logName,
+					Timestamp: timestamppb.New(testObservedTime),
+					Severity:  logtypepb.LogSeverity_WARNING,
+					HttpRequest: &logtypepb.HttpRequest{
+						RequestMethod: "GET",
+						Status:        200,
+						ResponseSize:  123,
+						Latency:       durationpb.New(1500 * time.Millisecond),
+					},
+					Trace:        "projects/fakeprojectid/traces/0123456789abcdef0123456789abcdef",
+					SpanId:       "0123456789abcdef",
+					TraceSampled: true,
+					Labels:       map[string]string{"foo": "bar"},
+					SourceLocation: &logpb.LogEntrySourceLocation{
+						File:     "main.go",
+						Line:     42,
+						Function: "main",
+					},
+					InsertId: "my-insert-id",
+					Operation: &logpb.LogEntryOperation{
+						Id:       "my-operation",
+						Producer: "my-producer",
+						First:    true,
+					},
+					Payload: &logpb.LogEntry_JsonPayload{JsonPayload: &structpb.Struct{Fields: map[string]*structpb.Value{
+						"message": {Kind: &structpb.Value_StringValue{StringValue: "hello"}},
+					}}},
+				},
+			},
+			maxEntrySize: defaultMaxEntrySize,
+			config: func(cfg *Config) {
+				cfg.LogConfig.ParseSpecialFields = true
+			},
+		},
+		{
+			name: "log body with invalid special fields kept in json payload",
+			mr: func() *monitoredrespb.MonitoredResource {
+				return nil
+			},
+			log: func() plog.LogRecord {
+				log := plog.NewLogRecord()
+				body := log.Body().SetEmptyMap()
+				body.PutStr("severity", "not-a-severity")
+				body.PutStr("httpRequest", "GET /")
+				body.PutStr("logging.googleapis.com/trace", "projects/otherproject/traces/0123456789abcdef0123456789abcdef")
+				return log
+			},
+			expectedEntries: []*logpb.LogEntry{
+				{
+					LogName:   logName,
+					Timestamp: timestamppb.New(testObservedTime),
+					Trace:     "projects/otherproject/traces/0123456789abcdef0123456789abcdef",
+					Payload: &logpb.LogEntry_JsonPayload{JsonPayload: &structpb.Struct{Fields: map[string]*structpb.Value{
+						"severity":    {Kind: &structpb.Value_StringValue{StringValue: "not-a-severity"}},
+						"httpRequest": {Kind: &structpb.Value_StringValue{StringValue: "GET /"}},
+					}}},
+				},
+			},
+			maxEntrySize: defaultMaxEntrySize,
+			config: func(cfg *Config) {
+				cfg.LogConfig.ParseSpecialFields = true
+			},
+		},
+		{
+			name: "log body with special fields not parsed by default",
+			mr: func() *monitoredrespb.MonitoredResource {
+				return nil
+			},
+			log: func() plog.LogRecord {
+				log := plog.NewLogRecord()
+				log.Body().SetEmptyMap().PutInt("severity", 500)
+				return log
+			},
+			expectedEntries: []*logpb.LogEntry{
+				{
+					LogName:   logName,
+					Timestamp: timestamppb.New(testObservedTime),
+					Payload: &logpb.LogEntry_JsonPayload{JsonPayload: &structpb.Struct{Fields: map[string]*structpb.Value{
+						"severity": {Kind: &structpb.Value_NumberValue{NumberValue: 500}},
+					}}},
+				},
+			},
+			maxEntrySize: defaultMaxEntrySize,
+		},
+		{
+			name: "log with http semantic convention attributes",
+			mr: func() *monitoredrespb.MonitoredResource {
+				return nil
+			},
+			log: func() plog.LogRecord {
+				log := plog.NewLogRecord()
+				log.Attributes().PutStr("http.request.method", "POST")
+				log.Attributes().PutStr("url.full", "https://example.com/api?q=1")
+				log.Attributes().PutInt("http.response.status_code", 201)
+				return log
+			},
+			expectedEntries: []*logpb.LogEntry{
+				{
+					LogName:   logName,
+					Timestamp: timestamppb.New(testObservedTime),
+					HttpRequest: &logtypepb.HttpRequest{
+						RequestMethod: "POST",
+						RequestUrl:    "https://example.com/api?q=1",
+						Status:        201,
+					},
+				},
+			},
+			maxEntrySize: defaultMaxEntrySize,
+			config: func(cfg *Config) {
+				cfg.LogConfig.HTTPRequestFromSemconv = true
+			},
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -716,3 +876,603 @@ func TestGetLogName(t *testing.T) {
 		})
 	}
 }
+
+type testLoggingServer struct {
+	logpb.UnimplementedLoggingServiceV2Server
+	reqCh chan *logpb.WriteLogEntriesRequest
+	err   error
+	// failedRequests is the number of requests which fail with err, after
+	// which requests succeed. If it is 0, all requests fail with err.
+	failedRequests int32
+	requests       atomic.Int32
+}
+
+func (ts *testLoggingServer) WriteLogEntries(ctx context.Context, req *logpb.WriteLogEntriesRequest) (*logpb.WriteLogEntriesResponse, error) {
+	go func() { ts.reqCh <- req }()
+	if n := ts.requests.Add(1); ts.failedRequests > 0 && n > ts.failedRequests {
+		return &logpb.WriteLogEntriesResponse{}, nil
+	}
+	return &logpb.WriteLogEntriesResponse{}, ts.err
+}
+
+// newTestLoggingServer starts a fake Cloud Logging server, and returns a
+// config pointing the logs exporter at it.
+func newTestLoggingServer(t *testing.T) (Config, chan *logpb.WriteLogEntriesRequest) {
+	return newTestLoggingServerWithError(t, nil)
+}
+
+// newTestLoggingServerWithError starts a fake Cloud Logging server which
+// fails WriteLogEntries requests with srvErr.
+func newTestLoggingServerWithError(t *testing.T, srvErr error) (Config, chan *logpb.WriteLogEntriesRequest) {
+	srv := grpc.NewServer()
+	reqCh := make(chan *logpb.WriteLogEntriesRequest)
+	logpb.RegisterLoggingServiceV2Server(srv, &testLoggingServer{reqCh: reqCh, err: srvErr})
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	//nolint:errcheck
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	cfg := DefaultConfig()
+	cfg.ProjectID = "fakeprojectid"
+	cfg.LogConfig.DefaultLogName = "default-log"
+	cfg.LogConfig.ClientConfig.Endpoint = lis.Addr().String()
+	cfg.LogConfig.ClientConfig.UseInsecure = true
+	return cfg, reqCh
+}
+
+func receiveWriteLogEntriesRequest(t *testing.T, reqCh chan *logpb.WriteLogEntriesRequest) *logpb.WriteLogEntriesRequest {
+	select {
+	case req := <-reqCh:
+		return req
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timed out waiting for WriteLogEntries request")
+		return nil
+	}
+}
+
+func TestPushLogsOntoWAL(t *testing.T) {
+	ctx := context.Background()
+	cfg, reqCh := newTestLoggingServer(t)
+	cfg.LogConfig.WALConfig = &WALConfig{Directory: t.TempDir()}
+
+	lExp, err := NewGoogleCloudLogsExporter(ctx, cfg, zap.NewNop(), "latest")
+	require.NoError(t, err)
+	require.NoError(t, lExp.Start(ctx, componenttest.NewNopHost()))
+
+	logs := plog.NewLogs()
+	logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("hello")
+	require.NoError(t, lExp.PushLogs(ctx, logs))
+
+	req := receiveWriteLogEntriesRequest(t, reqCh)
+	require.Len(t, req.Entries, 1)
+	assert.Equal(t, "hello", req.Entries[0].GetTextPayload())
+	assert.Equal(t, "projects/fakeprojectid/logs/default-log", req.Entries[0].LogName)
+	assert.True(t, req.PartialSuccess)
+
+	require.NoError(t, lExp.Shutdown(ctx))
+}
+
+func TestLogsWALReplayOnRestart(t *testing.T) {
+	ctx := context.Background()
+	cfg, reqCh := newTestLoggingServer(t)
+	cfg.LogConfig.WALConfig = &WALConfig{Directory: t.TempDir()}
+
+	// Leave a pending request in the WAL, as if the collector had stopped
+	// before it could be exported.
+	prevExp, err := NewGoogleCloudLogsExporter(ctx, cfg, zap.NewNop(), "latest")
+	require.NoError(t, err)
+	_, _, err = prevExp.setupWAL()
+	require.NoError(t, err)
+	require.NoError(t, prevExp.wal.writeRequest(ctx, &logpb.WriteLogEntriesRequest{
+		Entries: []*logpb.LogEntry{{
+			LogName: "projects/fakeprojectid/logs/pending-log",
+			Payload: &logpb.LogEntry_TextPayload{TextPayload: "pending"},
+		}},
+	}))
+	require.NoError(t, prevExp.wal.close())
+
+	lExp, err := NewGoogleCloudLogsExporter(ctx, cfg, zap.NewNop(), "latest")
+	require.NoError(t, err)
+	require.NoError(t, lExp.Start(ctx, componenttest.NewNopHost()))
+
+	req := receiveWriteLogEntriesRequest(t, reqCh)
+	require.Len(t, req.Entries, 1)
+	assert.Equal(t, "pending", req.Entries[0].GetTextPayload())
+
+	require.NoError(t, lExp.Shutdown(ctx))
+}
+
+func TestProjectFromLogName(t *testing.T) {
+	for _, tc := range []struct {
+		logName         string
+		expectedProject string
+		expectedOk      bool
+	}{
+		{logName: "projects/my-project/logs/my-log", expectedProject: "my-project", expectedOk: true},
+		{logName: "projects/my-project/logs/my%2Flog", expectedProject: "my-project", expectedOk: true},
+		{logName: "folders/my-folder/logs/my-log"},
+		{logName: "projects/my-project"},
+		{logName: ""},
+	} {
+		t.Run(tc.logName, func(t *testing.T) {
+			project, ok := projectFromLogName(tc.logName)
+			assert.Equal(t, tc.expectedOk, ok)
+			assert.Equal(t, tc.expectedProject, project)
+		})
+	}
+}
+
+func TestLogsExporterSelfObservability(t *testing.T) {
+	ctx := context.Background()
+	cfg, reqCh := newTestLoggingServer(t)
+	reader := sdkmetric.NewManualReader()
+
+	lExp, err := NewGoogleCloudLogsExporter(ctx, cfg, zap.NewNop(), "latest", WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	require.NoError(t, err)
+	require.NoError(t, lExp.Start(ctx, componenttest.NewNopHost()))
+	defer func() { require.NoError(t, lExp.Shutdown(ctx)) }()
+
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	records.AppendEmpty().Body().SetStr("hello")
+	records.AppendEmpty().Body().SetStr("world")
+	require.NoError(t, lExp.PushLogs(ctx, logs))
+	receiveWriteLogEntriesRequest(t, reqCh)
+
+	entries := collectSelfObservabilityMetric(t, reader, "googlecloudlogging/log_entry_count").(metricdata.Sum[int64])
+	require.Len(t, entries.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(projectKey.String("fakeprojectid"), statusKey.String("OK")), entries.DataPoints[0].Attributes)
+	assert.Equal(t, int64(2), entries.DataPoints[0].Value)
+
+	size := collectSelfObservabilityMetric(t, reader, "googlecloudlogging/request_size").(metricdata.Histogram[int64])
+	require.Len(t, size.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(projectKey.String("fakeprojectid")), size.DataPoints[0].Attributes)
+	assert.Equal(t, uint64(1), size.DataPoints[0].Count)
+	assert.Greater(t, size.DataPoints[0].Sum, int64(0))
+
+	latency := collectSelfObservabilityMetric(t, reader, "googlecloudlogging/request_latency").(metricdata.Histogram[float64])
+	require.Len(t, latency.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(projectKey.String("fakeprojectid"), statusKey.String("OK")), latency.DataPoints[0].Attributes)
+	assert.Equal(t, uint64(1), latency.DataPoints[0].Count)
+}
+
+func TestLogsExporterSelfObservabilityMixedProjects(t *testing.T) {
+	ctx := context.Background()
+	cfg, reqCh := newTestLoggingServer(t)
+	reader := sdkmetric.NewManualReader()
+
+	lExp, err := NewGoogleCloudLogsExporter(ctx, cfg, zap.NewNop(), "latest", WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	require.NoError(t, err)
+	require.NoError(t, lExp.Start(ctx, componenttest.NewNopHost()))
+	defer func() { require.NoError(t, lExp.Shutdown(ctx)) }()
+
+	require.NoError(t, lExp.sendRequest(ctx, &logpb.WriteLogEntriesRequest{
+		Entries: []*logpb.LogEntry{
+			{LogName: "projects/project-a/logs/my-log", Payload: &logpb.LogEntry_TextPayload{TextPayload: "a"}},
+			{LogName: "projects/project-b/logs/my-log", Payload: &logpb.LogEntry_TextPayload{TextPayload: "b"}},
+		},
+	}))
+	receiveWriteLogEntriesRequest(t, reqCh)
+
+	entries := collectSelfObservabilityMetric(t, reader, "googlecloudlogging/log_entry_count").(metricdata.Sum[int64])
+	assert.Len(t, entries.DataPoints, 2, "entries are counted by project")
+
+	size := collectSelfObservabilityMetric(t, reader, "googlecloudlogging/request_size").(metricdata.Histogram[int64])
+	require.Len(t, size.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(), size.DataPoints[0].Attributes)
+
+	latency := collectSelfObservabilityMetric(t, reader, "googlecloudlogging/request_latency").(metricdata.Histogram[float64])
+	require.Len(t, latency.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(statusKey.String("OK")), latency.DataPoints[0].Attributes)
+}
+
+func TestLogMapperSelfObservability(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	obs, err := newSelfObservability(zap.NewNop(), sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), logsObservabilityPrefix)
+	require.NoError(t, err)
+	mapper := newTestLogMapper(200, func(cfg *Config) { cfg.ProjectID = "fakeprojectid" })
+	mapper.obs = obs
+
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	// the body is too large for a single entry, so it is split.
+	records.AppendEmpty().Body().SetStr(strings.Repeat("a", 400))
+	// the log name can't be determined, so the record is dropped.
+	mapper.cfg.LogConfig.DefaultLogName = ""
+	_, _, err = mapper.createEntries(logs)
+	assert.Error(t, err)
+
+	mapper.cfg.LogConfig.DefaultLogName = "default-log"
+	projectEntries, _, err := mapper.createEntries(logs)
+	require.NoError(t, err)
+	require.Greater(t, len(projectEntries[""]), 1)
+
+	dropped := collectSelfObservabilityMetric(t, reader, "googlecloudlogging/log_entry_count").(metricdata.Sum[int64])
+	require.Len(t, dropped.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(projectKey.String("fakeprojectid"), statusKey.String(statusDropped)), dropped.DataPoints[0].Attributes)
+	assert.Equal(t, int64(1), dropped.DataPoints[0].Value)
+
+	split := collectSelfObservabilityMetric(t, reader, "googlecloudlogging/split_log_entry_count").(metricdata.Sum[int64])
+	require.Len(t, split.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(projectKey.String("fakeprojectid")), split.DataPoints[0].Attributes)
+	assert.Equal(t, int64(len(projectEntries[""])), split.DataPoints[0].Value)
+}
+
+func testPartialErrors(t *testing.T, entryCodes map[int32]codes.Code) error {
+	partialErrors := &logpb.WriteLogEntriesPartialErrors{LogEntryErrors: make(map[int32]*statuspb.Status)}
+	for i, code := range entryCodes {
+		partialErrors.LogEntryErrors[i] = status.New(code, code.String()).Proto()
+	}
+	st, err := status.New(codes.InvalidArgument, "some entries failed").WithDetails(partialErrors)
+	require.NoError(t, err)
+	return st.Err()
+}
+
+func TestFailedLogEntries(t *testing.T) {
+	req := &logpb.WriteLogEntriesRequest{
+		PartialSuccess: true,
+		Entries: []*logpb.LogEntry{
+			{Payload: &logpb.LogEntry_TextPayload{TextPayload: "a"}},
+			{Payload: &logpb.LogEntry_TextPayload{TextPayload: "b"}},
+			{Payload: &logpb.LogEntry_TextPayload{TextPayload: "c"}},
+		},
+	}
+	for _, tc := range []struct {
+		err               error
+		name              string
+		expectedPayloads  []string
+		expectedRetryable bool
+	}{
+		{
+			name:              "partial retryable",
+			err:               testPartialErrors(t, map[int32]codes.Code{0: codes.InvalidArgument, 2: codes.Unavailable}),
+			expectedPayloads:  []string{"a", "c"},
+			expectedRetryable: true,
+		},
+		{
+			name:             "partial permanent",
+			err:              testPartialErrors(t, map[int32]codes.Code{1: codes.PermissionDenied}),
+			expectedPayloads: []string{"b"},
+		},
+		{
+			name:             "out of range indices are ignored",
+			err:              testPartialErrors(t, map[int32]codes.Code{1: codes.InvalidArgument, 3: codes.Unavailable}),
+			expectedPayloads: []string{"b"},
+		},
+		{
+			name:              "whole request",
+			err:               status.Error(codes.Unavailable, "unavailable"),
+			expectedPayloads:  []string{"a", "b", "c"},
+			expectedRetryable: true,
+		},
+		{
+			name:              "canceled",
+			err:               status.Error(codes.Canceled, "canceled"),
+			expectedPayloads:  []string{"a", "b", "c"},
+			expectedRetryable: true,
+		},
+		{
+			name:              "aborted",
+			err:               testPartialErrors(t, map[int32]codes.Code{1: codes.Aborted}),
+			expectedPayloads:  []string{"b"},
+			expectedRetryable: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			failed, retryable := failedLogEntries(req, tc.err)
+			assert.Equal(t, tc.expectedRetryable, retryable)
+			assert.True(t, failed.PartialSuccess)
+			var payloads []string
+			for _, entry := range failed.Entries {
+				payloads = append(payloads, entry.GetTextPayload())
+			}
+			assert.Equal(t, tc.expectedPayloads, payloads)
+		})
+	}
+}
+
+func TestPushLogsPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	cfg, reqCh := newTestLoggingServerWithError(t, testPartialErrors(t, map[int32]codes.Code{0: codes.InvalidArgument, 1: codes.Unavailable}))
+	reader := sdkmetric.NewManualReader()
+
+	lExp, err := NewGoogleCloudLogsExporter(ctx, cfg, zap.NewNop(), "latest", WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	require.NoError(t, err)
+	require.NoError(t, lExp.Start(ctx, componenttest.NewNopHost()))
+	defer func() { require.NoError(t, lExp.Shutdown(ctx)) }()
+
+	logs := plog.NewLogs()
+	rl := logs.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("foo", "bar")
+	records := rl.ScopeLogs().AppendEmpty().LogRecords()
+	records.AppendEmpty().Body().SetStr("invalid")
+	records.AppendEmpty().Body().SetStr("unavailable")
+	records.AppendEmpty().Body().SetStr("written")
+	err = lExp.PushLogs(ctx, logs)
+	receiveWriteLogEntriesRequest(t, reqCh)
+
+	// only the log record which failed with a retryable error is retried.
+	require.Error(t, err)
+	assert.False(t, consumererror.IsPermanent(err))
+	var logsErr consumererror.Logs
+	require.ErrorAs(t, err, &logsErr)
+	retry := logsErr.Data()
+	require.Equal(t, 1, retry.LogRecordCount())
+	retryRL := retry.ResourceLogs().At(0)
+	assert.Equal(t, map[string]any{"foo": "bar"}, retryRL.Resource().Attributes().AsRaw())
+	assert.Equal(t, "unavailable", retryRL.ScopeLogs().At(0).LogRecords().At(0).Body().Str())
+
+	entries := collectSelfObservabilityMetric(t, reader, "googlecloudlogging/log_entry_count").(metricdata.Sum[int64])
+	counts := make(map[string]int64)
+	for _, dp := range entries.DataPoints {
+		st, _ := dp.Attributes.Value(statusKey)
+		counts[st.AsString()] = dp.Value
+	}
+	assert.Equal(t, map[string]int64{"OK": 1, "INVALID_ARGUMENT": 1, "UNAVAILABLE": 1}, counts)
+}
+
+func TestPushLogsSplitPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	srv := grpc.NewServer()
+	reqCh := make(chan *logpb.WriteLogEntriesRequest)
+	ts := &testLoggingServer{reqCh: reqCh, err: testPartialErrors(t, map[int32]codes.Code{1: codes.Unavailable}), failedRequests: 1}
+	logpb.RegisterLoggingServiceV2Server(srv, ts)
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	//nolint:errcheck
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cfg := DefaultConfig()
+	cfg.ProjectID = "fakeprojectid"
+	cfg.LogConfig.DefaultLogName = "default-log"
+	cfg.LogConfig.ClientConfig.Endpoint = lis.Addr().String()
+	cfg.LogConfig.ClientConfig.UseInsecure = true
+	lExp, err := NewGoogleCloudLogsExporter(ctx, cfg, zap.NewNop(), "latest")
+	require.NoError(t, err)
+	lExp.mapper.maxEntrySize = 250
+	require.NoError(t, lExp.Start(ctx, componenttest.NewNopHost()))
+	defer func() { require.NoError(t, lExp.Shutdown(ctx)) }()
+
+	logs := plog.NewLogs()
+	record := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	record.SetTimestamp(pcommon.NewTimestampFromTime(start))
+	record.Body().SetStr(strings.Repeat("0123456789", 20))
+	err = lExp.PushLogs(ctx, logs)
+	req := receiveWriteLogEntriesRequest(t, reqCh)
+	require.Len(t, req.Entries, 2)
+
+	var logsErr consumererror.Logs
+	require.ErrorAs(t, err, &logsErr)
+	require.Equal(t, 1, logsErr.Data().LogRecordCount())
+
+	// only the chunk which failed is written when the record is retried.
+	require.NoError(t, lExp.PushLogs(ctx, logsErr.Data()))
+	req = receiveWriteLogEntriesRequest(t, reqCh)
+	require.Len(t, req.Entries, 1)
+	assert.Equal(t, int32(1), req.Entries[0].GetSplit().GetIndex())
+	assert.Empty(t, lExp.splits.splits, "written chunks are forgotten once the record is written")
+}
+
+func TestPushLogsSplitPartialFailureSameUID(t *testing.T) {
+	ctx := context.Background()
+	srv := grpc.NewServer()
+	reqCh := make(chan *logpb.WriteLogEntriesRequest)
+	// the second chunk of the first record and the first chunk of the second
+	// record fail.
+	ts := &testLoggingServer{reqCh: reqCh, err: testPartialErrors(t, map[int32]codes.Code{1: codes.Unavailable, 2: codes.Unavailable}), failedRequests: 1}
+	logpb.RegisterLoggingServiceV2Server(srv, ts)
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	//nolint:errcheck
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cfg := DefaultConfig()
+	cfg.ProjectID = "fakeprojectid"
+	cfg.LogConfig.DefaultLogName = "default-log"
+	cfg.LogConfig.ClientConfig.Endpoint = lis.Addr().String()
+	cfg.LogConfig.ClientConfig.UseInsecure = true
+	lExp, err := NewGoogleCloudLogsExporter(ctx, cfg, zap.NewNop(), "latest")
+	require.NoError(t, err)
+	lExp.mapper.maxEntrySize = 250
+	require.NoError(t, lExp.Start(ctx, componenttest.NewNopHost()))
+	defer func() { require.NoError(t, lExp.Shutdown(ctx)) }()
+
+	// both records have the same log name and timestamp, so their chunks
+	// have the same split UID.
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for _, payload := range []string{"a", "b"} {
+		record := records.AppendEmpty()
+		record.SetTimestamp(pcommon.NewTimestampFromTime(start))
+		record.Body().SetStr(strings.Repeat(payload, 200))
+	}
+	err = lExp.PushLogs(ctx, logs)
+	req := receiveWriteLogEntriesRequest(t, reqCh)
+	require.Len(t, req.Entries, 4)
+	require.Equal(t, req.Entries[0].GetSplit().GetUid(), req.Entries[2].GetSplit().GetUid())
+
+	var logsErr consumererror.Logs
+	require.ErrorAs(t, err, &logsErr)
+	require.Equal(t, 2, logsErr.Data().LogRecordCount())
+
+	// the failed chunk of each record is written when they are retried.
+	require.NoError(t, lExp.PushLogs(ctx, logsErr.Data()))
+	req = receiveWriteLogEntriesRequest(t, reqCh)
+	require.Len(t, req.Entries, 2)
+	assert.Equal(t, int32(1), req.Entries[0].GetSplit().GetIndex())
+	assert.Equal(t, strings.Repeat("a", 100), req.Entries[0].GetTextPayload())
+	assert.Equal(t, int32(0), req.Entries[1].GetSplit().GetIndex())
+	assert.Equal(t, strings.Repeat("b", 100), req.Entries[1].GetTextPayload())
+	assert.Empty(t, lExp.splits.splits)
+}
+
+func TestPushLogsPermanentFailure(t *testing.T) {
+	ctx := context.Background()
+	cfg, reqCh := newTestLoggingServerWithError(t, status.Error(codes.InvalidArgument, "invalid"))
+
+	lExp, err := NewGoogleCloudLogsExporter(ctx, cfg, zap.NewNop(), "latest")
+	require.NoError(t, err)
+	require.NoError(t, lExp.Start(ctx, componenttest.NewNopHost()))
+	defer func() { require.NoError(t, lExp.Shutdown(ctx)) }()
+
+	logs := plog.NewLogs()
+	logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("invalid")
+	err = lExp.PushLogs(ctx, logs)
+	receiveWriteLogEntriesRequest(t, reqCh)
+
+	require.Error(t, err)
+	assert.True(t, consumererror.IsPermanent(err))
+}
+
+func TestParseSeverityField(t *testing.T) {
+	for _, tc := range []struct {
+		value            func() pcommon.Value
+		name             string
+		expectedSeverity logtypepb.LogSeverity
+		expectedOk       bool
+	}{
+		{name: "severity name", value: func() pcommon.Value { return pcommon.NewValueStr("ERROR") }, expectedSeverity: logtypepb.LogSeverity_ERROR, expectedOk: true},
+		{name: "lowercase severity name", value: func() pcommon.Value { return pcommon.NewValueStr("notice") }, expectedSeverity: logtypepb.LogSeverity_NOTICE, expectedOk: true},
+		{name: "otel severity alias", value: func() pcommon.Value { return pcommon.NewValueStr("warn") }, expectedSeverity: logtypepb.LogSeverity_WARNING, expectedOk: true},
+		{name: "severity number", value: func() pcommon.Value { return pcommon.NewValueInt(600) }, expectedSeverity: logtypepb.LogSeverity_CRITICAL, expectedOk: true},
+		{name: "severity double", value: func() pcommon.Value { return pcommon.NewValueDouble(200) }, expectedSeverity: logtypepb.LogSeverity_INFO, expectedOk: true},
+		{name: "unknown severity name", value: func() pcommon.Value { return pcommon.NewValueStr("verbose") }},
+		{name: "unknown severity number", value: func() pcommon.Value { return pcommon.NewValueInt(150) }},
+		{name: "unsupported type", value: func() pcommon.Value { return pcommon.NewValueBool(true) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			severity, ok := parseSeverityField(tc.value())
+			assert.Equal(t, tc.expectedOk, ok)
+			assert.Equal(t, tc.expectedSeverity, severity)
+		})
+	}
+}
+
+func TestHTTPRequestFromSemconv(t *testing.T) {
+	for _, tc := range []struct {
+		attrs               map[string]any
+		expectedHTTPRequest *logtypepb.HttpRequest
+		expectedRemaining   map[string]any
+		name                string
+	}{
+		{
+			name: "current attributes",
+			attrs: map[string]any{
+				"http.request.method":          "GET",
+				"url.full":                     "https://example.com/index.html",
+				"http.response.status_code":    200,
+				"user_agent.original":          "curl/8.0",
+				"client.address":               "10.0.0.1",
+				"network.local.address":        "10.0.0.2",
+				"http.request.header.referer":  []any{"https://example.com/"},
+				"http.request.body.size":       12,
+				"http.response.body.size":      "1024",
+				"http.server.request.duration": 0.25,
+				"http.server.duration":         250,
+				"network.protocol.version":     "2",
+				"service.version":              "1.0",
+			},
+			expectedHTTPRequest: &logtypepb.HttpRequest{
+				RequestMethod: "GET",
+				RequestUrl:    "https://example.com/index.html",
+				Status:        200,
+				UserAgent:     "curl/8.0",
+				RemoteIp:      "10.0.0.1",
+				ServerIp:      "10.0.0.2",
+				Referer:       "https://example.com/",
+				RequestSize:   12,
+				ResponseSize:  1024,
+				Latency:       durationpb.New(250 * time.Millisecond),
+				Protocol:      "HTTP/2",
+			},
+			expectedRemaining: map[string]any{"service.version": "1.0"},
+		},
+		{
+			name: "legacy attributes",
+			attrs: map[string]any{
+				"http.method":                  "PUT",
+				"http.url":                     "https://example.com/upload",
+				"http.status_code":             "500",
+				"http.user_agent":              "curl/7.0",
+				"http.client_ip":               "10.0.0.1",
+				"net.host.ip":                  "10.0.0.2",
+				"http.request_content_length":  2048,
+				"http.response_content_length": 10,
+				"http.server.duration":         1500,
+				"http.flavor":                  "1.1",
+			},
+			expectedHTTPRequest: &logtypepb.HttpRequest{
+				RequestMethod: "PUT",
+				RequestUrl:    "https://example.com/upload",
+				Status:        500,
+				UserAgent:     "curl/7.0",
+				RemoteIp:      "10.0.0.1",
+				ServerIp:      "10.0.0.2",
+				RequestSize:   2048,
+				ResponseSize:  10,
+				Latency:       durationpb.New(1500 * time.Millisecond),
+				Protocol:      "HTTP/1.1",
+			},
+			expectedRemaining: map[string]any{},
+		},
+		{
+			name: "current attributes preferred over legacy attributes",
+			attrs: map[string]any{
+				"http.request.method": "GET",
+				"http.method":         "POST",
+				"url.path":            "/search",
+				"url.query":           "q=otel",
+				"http.target":         "/old",
+			},
+			expectedHTTPRequest: &logtypepb.HttpRequest{
+				RequestMethod: "GET",
+				RequestUrl:    "/search?q=otel",
+			},
+			expectedRemaining: map[string]any{},
+		},
+		{
+			name:              "no http attributes",
+			attrs:             map[string]any{"service.version": "1.0"},
+			expectedRemaining: map[string]any{"service.version": "1.0"},
+		},
+		{
+			name: "no http specific attributes",
+			attrs: map[string]any{
+				"client.address":           "10.0.0.1",
+				"network.protocol.name":    "grpc",
+				"network.protocol.version": "1.0",
+				"user_agent.original":      "grpc-go/1.63.2",
+			},
+			expectedRemaining: map[string]any{
+				"client.address":           "10.0.0.1",
+				"network.protocol.name":    "grpc",
+				"network.protocol.version": "1.0",
+				"user_agent.original":      "grpc-go/1.63.2",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attrs := pcommon.NewMap()
+			require.NoError(t, attrs.FromRaw(tc.attrs))
+			attrsMap := make(map[string]pcommon.Value)
+			attrs.Range(func(k string, v pcommon.Value) bool {
+				attrsMap[k] = v
+				return true
+			})
+
+			httpRequest := httpRequestFromSemconv(attrsMap)
+			if !proto.Equal(tc.expectedHTTPRequest, httpRequest) {
+				assert.Equal(t, tc.expectedHTTPRequest, httpRequest)
+			}
+			remaining := make(map[string]any)
+			for k, v := range attrsMap {
+				remaining[k] = v.AsRaw()
+			}
+			assert.Equal(t, tc.expectedRemaining, remaining)
+		})
+	}
+}
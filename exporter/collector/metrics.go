@@ -24,8 +24,10 @@ import (
 	"fmt"
 	"math"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -40,6 +42,7 @@ import (
 	"google.golang.org/genproto/googleapis/api/label"
 	metricpb "google.golang.org/genproto/googleapis/api/metric"
 	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/encoding/gzip"
@@ -49,36 +52,42 @@ import (
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
-	"go.opencensus.io/plugin/ocgrpc"
-	"go.opencensus.io/stats/view"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 
-	"github.com/fsnotify/fsnotify"
-	"github.com/tidwall/wal"
 	"go.uber.org/zap"
 
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/datapointstorage"
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/normalization"
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/descriptorcache"
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/resourcemapping"
 )
 
-// self-observability reporting meters/tracers/loggers.
-type selfObservability struct {
-	// Logger to use for this exporter.
-	log *zap.Logger
-}
-
 // MetricsExporter is the GCM exporter that uses pdata directly.
 type MetricsExporter struct {
 	// write ahead log handles exporter retries in-order to handle network outages
 	wal *exporterWAL
-	obs selfObservability
+	// walPartitions holds the write ahead logs for destination projects other
+	// than the default project, keyed by project ID.
+	walPartitions map[string]*exporterWAL
+	// walPartitionsMutex guards walPartitions, and the closing of shutdownC so
+	// that no partition reader is started once Shutdown is waiting for them.
+	// It must be acquired before the mutex of any WAL.
+	walPartitionsMutex sync.Mutex
+	// walPartitionIdleTimeout is how long a WAL partition may stay empty
+	// before it is closed and removed. 0 means defaultWALPartitionIdleTimeout.
+	walPartitionIdleTimeout time.Duration
+	// walCtx is the context used by WAL reader goroutines started after Start.
+	walCtx context.Context
+	obs    selfObservability
 	// shutdownC is a channel for signaling a graceful shutdown
 	shutdownC chan struct{}
 	// mdCache tracks the metric descriptors that have already been sent to GCM
 	mdCache map[string]*monitoringpb.CreateMetricDescriptorRequest
+	// descriptorCache persists the metric descriptors created across
+	// restarts. It is nil unless a metric descriptor cache is configured.
+	descriptorCache *descriptorcache.Cache
 	// A channel that receives metric descriptor and sends them to GCM once
 	metricDescriptorC chan *monitoringpb.CreateMetricDescriptorRequest
 	client            monitoringClient
@@ -87,20 +96,21 @@ type MetricsExporter struct {
 	// requestOpts applies options to the context for requests, such as additional headers.
 	requestOpts []func(*context.Context, requestInfo)
 	mapper      metricMapper
-	cfg         Config
+	// labelAggregator removes labels from metrics before they are mapped.
+	// It is nil unless aggregations are configured.
+	labelAggregator *labelAggregator
+	// requestSem limits the number of CreateTimeSeries requests sent
+	// concurrently by PushMetrics.
+	requestSem chan struct{}
+	// throttle limits how often points are written for each series. It is
+	// nil unless a write throttle is configured.
+	throttle *seriesThrottle
+	cfg      Config
 	// goroutines tracks the currently running child tasks
 	goroutines sync.WaitGroup
 	timeout    time.Duration
 }
 
-type exporterWAL struct {
-	*wal.Log
-	// the full path of the WAL (user-configured directory + "gcp_metrics_wal")
-	path       string
-	maxBackoff time.Duration
-	mutex      sync.Mutex
-}
-
 // requestInfo is meant to abstract info from CreateMetricsDescriptorRequests and
 // CreateTimeSeriesRequests that is shared by requestOpts functions.
 type requestInfo struct {
@@ -110,9 +120,11 @@ type requestInfo struct {
 // metricMapper is the part that transforms metrics. Separate from MetricsExporter since it has
 // all pure functions.
 type metricMapper struct {
-	normalizer normalization.Normalizer
-	obs        selfObservability
-	cfg        Config
+	normalizer       normalization.Normalizer
+	deltaAccumulator normalization.DeltaAccumulator
+	rules            *metricRules
+	obs              selfObservability
+	cfg              Config
 }
 
 // Constants we use when translating summary metrics into GCP.
@@ -125,12 +137,22 @@ const (
 	// The number of timeserieses to send to GCM in a single request. This
 	// is a hard limit in the GCM API, so we never want to exceed 200.
 	sendBatchSize = 200
-
-	// The default amount of time to retry a data point on network outage when
-	// WAL is enabled before discarding. Users can override by setting MetricConfig.WALConfig.MaxBackoff.
-	defaultWalMaxBackoff = time.Duration(3600 * time.Second)
+	// The maximum number of buckets in a distribution accepted by the GCM
+	// API, including the underflow and overflow buckets.
+	defaultExponentialHistogramMaxBuckets = 200
+
+	// The name of the metrics WAL in the user-configured WAL directory.
+	metricsWALName = "gcp_metrics_wal"
+	// The prefix of the names of the metrics WALs for destination projects
+	// other than the default project. It is followed by the escaped project ID.
+	metricsWALPartitionPrefix = metricsWALName + "_"
+	// How long a WAL partition may stay empty before it is closed and removed.
+	defaultWALPartitionIdleTimeout = 10 * time.Minute
 )
 
+// errShutdown is returned when writing to the WAL after Shutdown.
+var errShutdown = errors.New("exporter is shut down")
+
 const (
 	// The specific unit that needs to be present in an integer-valued metric so
 	// that it can be treated as a boolean.
@@ -146,11 +168,20 @@ type monitoringClient interface {
 	CreateServiceTimeSeries(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest, opts ...gax.CallOption) error
 	Close() error
 	CreateMetricDescriptor(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error)
+	GetMetricDescriptor(ctx context.Context, req *monitoringpb.GetMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error)
 }
 
 func (me *MetricsExporter) Shutdown(ctx context.Context) error {
+	if me.throttle != nil && me.client != nil {
+		// Write the points held by the throttle before the WAL is closed.
+		if err := me.writeThrottled(ctx, me.throttle.flush(true)); err != nil {
+			me.obs.log.Error("Failed to write throttled points on shutdown.", zap.Error(err))
+		}
+	}
 	// TODO: pass ctx to goroutines so that we can use its deadline
+	me.walPartitionsMutex.Lock()
 	close(me.shutdownC)
+	me.walPartitionsMutex.Unlock()
 	c := make(chan struct{})
 	go func() {
 		// Wait until all goroutines are done
@@ -162,6 +193,7 @@ func (me *MetricsExporter) Shutdown(ctx context.Context) error {
 		me.obs.log.Error("Error waiting for async tasks to finish.", zap.Error(ctx.Err()))
 	case <-c:
 	}
+	me.obs.shutdown()
 	if me.client != nil {
 		return me.client.Close()
 	}
@@ -174,23 +206,29 @@ func NewGoogleCloudMetricsExporter(
 	log *zap.Logger,
 	version string,
 	timeout time.Duration,
+	opts ...ExporterOption,
 ) (*MetricsExporter, error) {
-	// TODO: https://github.com/GoogleCloudPlatform/opentelemetry-operations-go/pull/537#discussion_r1038290097
-	//nolint:errcheck
-	view.Register(MetricViews()...)
-	//nolint:errcheck
-	view.Register(ocgrpc.DefaultClientViews...)
 	setVersionInUserAgent(&cfg, version)
 
-	obs := selfObservability{log: log}
+	o := newExporterOptions(log, opts)
+	obs, err := newSelfObservability(o.log, o.meterProvider, metricsObservabilityPrefix)
+	if err != nil {
+		return nil, err
+	}
 	normalizer := normalization.NewDisabledNormalizer()
+	rules, err := newMetricRules(cfg.MetricConfig.Rules)
+	if err != nil {
+		return nil, err
+	}
 	mExp := &MetricsExporter{
 		cfg: cfg,
 		obs: obs,
 		mapper: metricMapper{
-			obs:        obs,
-			cfg:        cfg,
-			normalizer: normalizer,
+			obs:              obs,
+			cfg:              cfg,
+			normalizer:       normalizer,
+			deltaAccumulator: normalization.NewDisabledDeltaAccumulator(),
+			rules:            rules,
 		},
 		// We create a buffered channel for metric descriptors.
 		// MetricDescritpors are asychronously sent and optimistic.
@@ -202,6 +240,13 @@ func NewGoogleCloudMetricsExporter(
 		timeout:           timeout,
 	}
 	mExp.exportFunc = mExp.exportToTimeSeries
+	mExp.requestSem = make(chan struct{}, maxConcurrentRequests(cfg.MetricConfig))
+	if cfg.MetricConfig.WriteThrottle != nil {
+		mExp.throttle = newSeriesThrottle(*cfg.MetricConfig.WriteThrottle, obs)
+	}
+	if cfg.MetricConfig.MetricDescriptorCache != nil {
+		mExp.descriptorCache = descriptorcache.New(cfg.MetricConfig.MetricDescriptorCache.Directory, cfg.MetricConfig.MetricDescriptorCache.TTL)
+	}
 
 	mExp.requestOpts = make([]func(*context.Context, requestInfo), 0)
 	if cfg.DestinationProjectQuota {
@@ -216,9 +261,46 @@ func NewGoogleCloudMetricsExporter(
 func (me *MetricsExporter) Start(ctx context.Context, _ component.Host) error {
 	me.shutdownC = make(chan struct{})
 	if me.cfg.MetricConfig.CumulativeNormalization {
-		me.mapper.normalizer = normalization.NewStandardNormalizer(me.shutdownC, me.obs.log)
+		me.mapper.normalizer = normalization.NewStandardNormalizer(me.shutdownC, me.obs.log, datapointstorage.Config{
+			MaxPoints:   me.cfg.MetricConfig.CumulativeNormalizationCache.MaxPoints,
+			GCInterval:  me.cfg.MetricConfig.CumulativeNormalizationCache.GCInterval,
+			ObserveSize: me.obs.observeNormalizationCacheSize,
+			OnEvict:     me.obs.recordNormalizationCacheEviction,
+		})
+		if me.cfg.MetricConfig.CumulativeNormalizationState != nil {
+			// A missing or corrupt state only means the first point of each
+			// series is dropped, as if the state wasn't persisted.
+			if err := me.loadNormalizationState(); err != nil {
+				me.obs.log.Warn("Failed to load cumulative normalization state.", zap.Error(err))
+			}
+			me.goroutines.Add(1)
+			go me.runNormalizationStateFlusher()
+		}
+	}
+	if deltaCfg := me.cfg.MetricConfig.DeltaToCumulative; deltaCfg != nil {
+		me.mapper.deltaAccumulator = normalization.NewStandardDeltaAccumulator(me.shutdownC, me.obs.log, datapointstorage.Config{
+			// the accumulator caches one point per series.
+			MaxPoints:   deltaCfg.MaxSeries,
+			GCInterval:  deltaCfg.GCInterval,
+			ObserveSize: me.obs.observeNormalizationCacheSize,
+			OnEvict:     me.obs.recordNormalizationCacheEviction,
+		})
 	}
-	clientOpts, err := generateClientOptions(ctx, &me.cfg.MetricConfig.ClientConfig, &me.cfg, monitoring.DefaultAuthScopes())
+	if me.descriptorCache != nil {
+		// A missing or corrupt cache only means descriptors are created
+		// again, as if the cache wasn't persisted.
+		if err := me.descriptorCache.Load(); err != nil {
+			me.obs.log.Warn("Failed to load metric descriptor cache.", zap.Error(err))
+		}
+	}
+	if len(me.cfg.MetricConfig.Aggregations) > 0 {
+		var err error
+		me.labelAggregator, err = newLabelAggregator(me.shutdownC, me.obs, me.cfg.MetricConfig.Aggregations)
+		if err != nil {
+			return err
+		}
+	}
+	clientOpts, err := generateClientOptions(ctx, &me.cfg.MetricConfig.ClientConfig, &me.cfg, monitoring.DefaultAuthScopes(), me.obs.meterProvider)
 	if err != nil {
 		return err
 	}
@@ -245,6 +327,15 @@ func (me *MetricsExporter) Start(ctx context.Context, _ component.Host) error {
 		// start WAL popper routine
 		me.goroutines.Add(1)
 		go me.runWALReadAndExportLoop(ctx)
+		me.walCtx = ctx
+		if err = me.resumeWALPartitions(); err != nil {
+			return err
+		}
+	}
+
+	if me.throttle != nil {
+		me.goroutines.Add(1)
+		go me.runThrottleFlusher()
 	}
 
 	// Fire up the metric descriptor exporter.
@@ -253,69 +344,189 @@ func (me *MetricsExporter) Start(ctx context.Context, _ component.Host) error {
 	return nil
 }
 
-// setupWAL creates the WAL.
+// setupWAL creates the WAL for the default project.
 // This function is also used to re-sync after writes, so it closes the existing WAL if present.
 // It returns the FirstIndex, LastIndex, and any error.
 func (me *MetricsExporter) setupWAL() (uint64, uint64, error) {
-	err := me.closeWAL()
-	if err != nil {
-		return 0, 0, err
-	}
-
 	if me.wal == nil {
 		me.wal = &exporterWAL{}
 	}
+	me.configureWAL(me.wal)
+	return me.wal.setup(me.cfg.MetricConfig.WALConfig, metricsWALName)
+}
 
-	walPath := filepath.Join(me.cfg.MetricConfig.WALConfig.Directory, "gcp_metrics_wal")
-	me.wal.path = walPath
-	metricWal, err := wal.Open(walPath, &wal.Options{LogFormat: 1})
-	if err != nil {
-		return 0, 0, err
+// configureWAL sets the logger and the functions used to read requests from a metrics WAL.
+func (me *MetricsExporter) configureWAL(w *exporterWAL) {
+	w.obs = me.obs
+	if w.obs.log == nil {
+		w.obs.log = zap.NewNop()
+	}
+	w.totalSize = me.walTotalSize
+	w.export = func(ctx context.Context, bytes []byte) error {
+		req := new(monitoringpb.CreateTimeSeriesRequest)
+		if err := proto.Unmarshal(bytes, req); err != nil {
+			return err
+		}
+		return me.export(ctx, req)
+	}
+	w.failed = func(bytes []byte, err error) ([]byte, bool) {
+		req := new(monitoringpb.CreateTimeSeriesRequest)
+		if unmarshalErr := proto.Unmarshal(bytes, req); unmarshalErr != nil {
+			return bytes, !isNotRecoverable(err)
+		}
+		failed, retryable := failedTimeSeries(req, err)
+		failedBytes, marshalErr := proto.Marshal(failed)
+		if marshalErr != nil {
+			return bytes, retryable
+		}
+		return failedBytes, retryable
 	}
-	me.wal.Log = metricWal
+	w.timestamp = func(bytes []byte) (time.Time, error) {
+		req := new(monitoringpb.CreateTimeSeriesRequest)
+		if err := proto.Unmarshal(bytes, req); err != nil {
+			return time.Time{}, err
+		}
+		// use the newest point, so the request is evicted once all of its points are too old.
+		var newest time.Time
+		for _, ts := range req.TimeSeries {
+			for _, point := range ts.Points {
+				if end := point.GetInterval().GetEndTime(); end != nil && end.AsTime().After(newest) {
+					newest = end.AsTime()
+				}
+			}
+		}
+		return newest, nil
+	}
+}
 
-	// default to 1 hour exponential backoff
-	me.wal.maxBackoff = defaultWalMaxBackoff
-	if me.cfg.MetricConfig.WALConfig.MaxBackoff != 0 {
-		me.wal.maxBackoff = me.cfg.MetricConfig.WALConfig.MaxBackoff
+// walForProject returns the WAL partition for requests sent to projectID.
+// Each destination project has its own WAL and reader goroutine, so that
+// retries for one project do not block exporting to other projects. Requests
+// for the default project use the default WAL. Partitions for other projects
+// are created on first use, and removed once they have been empty for
+// walPartitionIdleTimeout. The caller must hold walPartitionsMutex.
+func (me *MetricsExporter) walForProject(projectID string) (*exporterWAL, error) {
+	select {
+	case <-me.shutdownC:
+		return nil, errShutdown
+	default:
+	}
+	if projectID == me.cfg.ProjectID {
+		return me.wal, nil
+	}
+	if w, ok := me.walPartitions[projectID]; ok {
+		return w, nil
+	}
+	w := &exporterWAL{}
+	me.configureWAL(w)
+	if _, _, err := w.setup(me.cfg.MetricConfig.WALConfig, metricsWALPartitionPrefix+url.PathEscape(projectID)); err != nil {
+		return nil, err
+	}
+	w.idleTimeout = me.walPartitionIdleTimeout
+	if w.idleTimeout == 0 {
+		w.idleTimeout = defaultWALPartitionIdleTimeout
 	}
+	w.removeIfIdle = func() bool {
+		return me.removeWALPartition(projectID, w)
+	}
+	if me.walPartitions == nil {
+		me.walPartitions = make(map[string]*exporterWAL)
+	}
+	me.walPartitions[projectID] = w
 
-	// sync existing WAL indices
-	rIndex, err := me.wal.FirstIndex()
-	if err != nil {
-		return 0, 0, err
+	ctx := me.walCtx
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	me.goroutines.Add(1)
+	go func() {
+		defer me.goroutines.Done()
+		w.runReadAndExportLoop(ctx, me.shutdownC)
+	}()
+	return w, nil
+}
+
+// removeWALPartition closes the WAL partition for projectID and removes it
+// from disk, unless requests were written to it since it was last drained.
+// It returns whether the partition was removed.
+func (me *MetricsExporter) removeWALPartition(projectID string, w *exporterWAL) bool {
+	me.walPartitionsMutex.Lock()
+	defer me.walPartitionsMutex.Unlock()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if backlog, err := w.backlog(); err != nil || backlog > 0 {
+		return false
+	}
+	delete(me.walPartitions, projectID)
+	if err := w.closeLog(); err != nil {
+		me.obs.log.Warn("Failed to close idle WAL partition.", zap.String("path", w.path), zap.Error(err))
+	}
+	if err := os.RemoveAll(w.path); err != nil {
+		me.obs.log.Warn("Failed to remove idle WAL partition.", zap.String("path", w.path), zap.Error(err))
+	}
+	me.obs.forgetWALStats(w.name)
+	return true
+}
 
-	wIndex, err := me.wal.LastIndex()
+// walTotalSize returns the size on disk of the default WAL and of all WAL
+// partitions, which share the configured maximum size.
+func (me *MetricsExporter) walTotalSize() (int64, error) {
+	dirs, err := filepath.Glob(filepath.Join(me.cfg.MetricConfig.WALConfig.Directory, metricsWALName+"*"))
 	if err != nil {
-		return 0, 0, err
+		return 0, err
+	}
+	var total int64
+	for _, dir := range dirs {
+		size, err := dirSize(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			// the partition was removed concurrently.
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += size
 	}
-
-	return rIndex, wIndex, nil
+	return total, nil
 }
 
-func (me *MetricsExporter) closeWAL() error {
-	if me.wal != nil && me.wal.Log != nil {
-		err := me.wal.Log.Close()
-		me.wal.Log = nil
+// resumeWALPartitions starts the readers for WAL partitions left on disk by a
+// previous run, so that their pending requests are exported.
+func (me *MetricsExporter) resumeWALPartitions() error {
+	dirs, err := filepath.Glob(filepath.Join(me.cfg.MetricConfig.WALConfig.Directory, metricsWALPartitionPrefix+"*"))
+	if err != nil {
 		return err
 	}
+	me.walPartitionsMutex.Lock()
+	defer me.walPartitionsMutex.Unlock()
+	for _, dir := range dirs {
+		projectID, err := url.PathUnescape(strings.TrimPrefix(filepath.Base(dir), metricsWALPartitionPrefix))
+		if err != nil {
+			me.obs.log.Warn("Skipping WAL directory with invalid name.", zap.String("path", dir), zap.Error(err))
+			continue
+		}
+		if _, err := me.walForProject(projectID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (me *MetricsExporter) closeWAL() error {
+	return me.wal.close()
+}
+
 // PushMetrics calls pushes pdata metrics to GCM, creating metric descriptors if necessary.
 func (me *MetricsExporter) PushMetrics(ctx context.Context, m pmetric.Metrics) error {
 	if me.client == nil {
 		return errors.New("not started")
 	}
-	if me.wal != nil {
-		me.wal.mutex.Lock()
-		defer me.wal.mutex.Unlock()
-	}
 	// map from project -> []timeseries. This groups timeseries by the project
 	// they need to be sent to. Each project's timeseries are sent in a
 	// separate request later.
 	pendingTimeSeries := map[string][]*monitoringpb.TimeSeries{}
+	// throttleExempt holds the time series which are not throttled.
+	throttleExempt := map[*monitoringpb.TimeSeries]bool{}
 
 	// add extra metrics from the ExtraMetrics() extension point, combine into a new copy
 	if me.cfg.MetricConfig.ExtraMetrics != nil {
@@ -324,6 +535,9 @@ func (me *MetricsExporter) PushMetrics(ctx context.Context, m pmetric.Metrics) e
 		me.cfg.MetricConfig.ExtraMetrics(metricsCopy)
 		m = metricsCopy
 	}
+	if me.labelAggregator != nil {
+		m = me.labelAggregator.aggregate(m)
+	}
 	rms := m.ResourceMetrics()
 
 	for i := 0; i < rms.Len(); i++ {
@@ -345,7 +559,13 @@ func (me *MetricsExporter) PushMetrics(ctx context.Context, m pmetric.Metrics) e
 			mes := sm.Metrics()
 			for k := 0; k < mes.Len(); k++ {
 				metric := mes.At(k)
-				pendingTimeSeries[projectID] = append(pendingTimeSeries[projectID], me.mapper.metricToTimeSeries(monitoredResource, metricLabels, metric, projectID)...)
+				tss := me.mapper.metricToTimeSeries(monitoredResource, metricLabels, metric, projectID)
+				if me.throttle != nil && me.cfg.MetricConfig.DeltaToCumulative == nil && isDeltaMetric(metric) {
+					for _, ts := range tss {
+						throttleExempt[ts] = true
+					}
+				}
+				pendingTimeSeries[projectID] = append(pendingTimeSeries[projectID], tss...)
 
 				// We only send metric descriptors if we're configured *and* we're not sending service timeseries.
 				if me.cfg.MetricConfig.SkipCreateMetricDescriptor || me.cfg.MetricConfig.CreateServiceTimeSeries {
@@ -356,6 +576,7 @@ func (me *MetricsExporter) PushMetrics(ctx context.Context, m pmetric.Metrics) e
 					if md == nil {
 						continue
 					}
+					me.enforceDescriptorLabelLimits(md)
 					req := &monitoringpb.CreateMetricDescriptorRequest{
 						Name:             projectName(projectID),
 						MetricDescriptor: md,
@@ -370,54 +591,133 @@ func (me *MetricsExporter) PushMetrics(ctx context.Context, m pmetric.Metrics) e
 		}
 	}
 
-	var errs []error
 	// timeseries for each project are batched and exported separately
+	batchesByProject := make(map[string][][]*monitoringpb.TimeSeries, len(pendingTimeSeries))
 	for projectID, projectTS := range pendingTimeSeries {
-		// Batch and export
-		for len(projectTS) > 0 {
-			var sendSize int
-			if len(projectTS) < sendBatchSize {
-				sendSize = len(projectTS)
-			} else {
-				sendSize = sendBatchSize
-			}
-
-			var ts []*monitoringpb.TimeSeries
-			ts, projectTS = projectTS[:sendSize], projectTS[sendSize:]
+		for _, ts := range projectTS {
+			me.enforceLabelLimits(ctx, ts)
+		}
+		if me.throttle != nil {
+			projectTS = me.throttle.filter(ctx, projectID, projectTS, throttleExempt)
+		}
+		batchesByProject[projectID] = batchTimeSeries(ctx, me.obs, projectTS)
+	}
+	return me.writeBatches(ctx, batchesByProject)
+}
 
+// writeBatches sends the batches of time series for each project to GCM, or
+// writes them to the WAL if it is enabled.
+func (me *MetricsExporter) writeBatches(ctx context.Context, batchesByProject map[string][][]*monitoringpb.TimeSeries) error {
+	if me.wal == nil {
+		return me.exportBatches(ctx, batchesByProject)
+	}
+	var errs []error
+	for projectID, batches := range batchesByProject {
+		for _, ts := range batches {
 			req := &monitoringpb.CreateTimeSeriesRequest{
 				Name:       projectName(projectID),
 				TimeSeries: ts,
 			}
+			// push request onto the WAL for the destination project
+			err := me.writeWALRequest(ctx, projectID, req)
+			if err == nil && me.throttle != nil {
+				// the WAL retries the request until it is written.
+				me.throttle.written(projectID, ts)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
 
-			if me.wal != nil {
-				// push request onto the WAL
-				bytes, err := proto.Marshal(req)
-				if err != nil {
-					errs = append(errs, fmt.Errorf("failed to marshal protobuf to bytes: %+v", err))
-					continue
-				}
+// maxConcurrentRequests returns the maximum number of CreateTimeSeries
+// requests sent concurrently by the exporter.
+func maxConcurrentRequests(cfg MetricConfig) int {
+	if cfg.MaxConcurrentRequests > 0 {
+		return cfg.MaxConcurrentRequests
+	}
+	return 1
+}
 
-				writeIndex, err := me.wal.LastIndex()
-				if err != nil {
-					errs = append(errs, fmt.Errorf("failed to get LastIndex of WAL: %+v", err))
-					continue
-				}
+// exportBatches sends the batches of time series for each project to GCM.
+// Projects are exported concurrently, with at most
+// MaxConcurrentRequestsPerProject requests in flight for each project, and at
+// most MaxConcurrentRequests requests in flight for the exporter.
+func (me *MetricsExporter) exportBatches(ctx context.Context, batchesByProject map[string][][]*monitoringpb.TimeSeries) error {
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(batchesByProject))
+	var errsMutex sync.Mutex
+	for projectID, batches := range batchesByProject {
+		wg.Add(1)
+		go func(projectID string, batches [][]*monitoringpb.TimeSeries) {
+			defer wg.Done()
+			err := me.exportProjectBatches(ctx, projectID, batches)
+			errsMutex.Lock()
+			defer errsMutex.Unlock()
+			errs = append(errs, err)
+		}(projectID, batches)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
 
-				err = me.wal.Write(writeIndex+1, bytes)
-				if err != nil {
-					errs = append(errs, fmt.Errorf("failed to write to WAL: %+v", err))
-					continue
-				}
-			} else {
-				// otherwise export directly
-				errs = append(errs, me.export(ctx, req))
+// exportProjectBatches sends batches of time series to projectID. Batches
+// which contain a later point of a series than another batch are only sent
+// after the other batch, so points of each series are written in order.
+func (me *MetricsExporter) exportProjectBatches(ctx context.Context, projectID string, batches [][]*monitoringpb.TimeSeries) error {
+	perProject := me.cfg.MetricConfig.MaxConcurrentRequestsPerProject
+	if perProject <= 0 {
+		perProject = maxConcurrentRequests(me.cfg.MetricConfig)
+	}
+	projectSem := make(chan struct{}, perProject)
+	errs := make([]error, len(batches))
+	for _, wave := range sendOrder(batches) {
+		var wg sync.WaitGroup
+		for _, i := range wave {
+			projectSem <- struct{}{}
+			select {
+			case me.requestSem <- struct{}{}:
+			case <-ctx.Done():
+				<-projectSem
+				errs[i] = ctx.Err()
+				continue
 			}
+			wg.Add(1)
+			go func(i int) {
+				defer func() {
+					<-me.requestSem
+					<-projectSem
+					wg.Done()
+				}()
+				req := &monitoringpb.CreateTimeSeriesRequest{
+					Name:       projectName(projectID),
+					TimeSeries: batches[i],
+				}
+				errs[i] = me.export(ctx, req)
+				me.recordThrottleWrites(req, projectID, errs[i])
+			}(i)
 		}
+		wg.Wait()
 	}
 	return errors.Join(errs...)
 }
 
+// writeWALRequest appends a request to the WAL partition for projectID.
+func (me *MetricsExporter) writeWALRequest(ctx context.Context, projectID string, req *monitoringpb.CreateTimeSeriesRequest) error {
+	// Lock the WAL before releasing walPartitionsMutex, so that the partition
+	// can't be removed as idle before the request is written.
+	me.walPartitionsMutex.Lock()
+	w, err := me.walForProject(projectID)
+	if err != nil {
+		me.walPartitionsMutex.Unlock()
+		return fmt.Errorf("failed to open WAL for project %q: %w", projectID, err)
+	}
+	w.mutex.Lock()
+	me.walPartitionsMutex.Unlock()
+	defer w.mutex.Unlock()
+	return w.writeRequest(ctx, req)
+}
+
 // exportToTimeSeries is the default exporting call to GCM.
 // Broken into its own function for unit testing.
 func (me *MetricsExporter) exportToTimeSeries(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
@@ -452,199 +752,40 @@ func (me *MetricsExporter) export(ctx context.Context, req *monitoringpb.CreateT
 	}
 
 	// always record the number of successful points
-	recordPointCountDataPoint(ctx, succeededPoints, "OK")
+	me.obs.recordPointCountDataPoint(ctx, succeededPoints, "OK")
 	if failedPoints > 0 {
-		recordPointCountDataPoint(ctx, failedPoints, st)
+		me.obs.recordPointCountDataPoint(ctx, failedPoints, st)
 	}
 	return err
 }
 
 // readWALAndExport pops the next CreateTimeSeriesRequest from the WAL and tries exporting it.
-// If the export is successful (or fails for a non-retryable error), the read index is incremented
-// so the next entry in the WAL can be read by a subsequent call to readWALAndExport().
-// If the export fails for a (retryable) network error, it will keep trying to export the same entry
-// until success or the backoff max is reached.
+// See exporterWAL.readAndExport.
 func (me *MetricsExporter) readWALAndExport(ctx context.Context) error {
-	me.wal.mutex.Lock()
-	defer me.wal.mutex.Unlock()
-
-	// close and reopen the WAL to sync indices
-	readIndex, writeIndex, err := me.setupWAL()
-	if err != nil {
-		return err
-	}
-
-	bytes, err := me.wal.Read(readIndex)
-	if err == nil {
-		req := new(monitoringpb.CreateTimeSeriesRequest)
-		if err = proto.Unmarshal(bytes, req); err != nil {
-			return err
-		}
-
-		// on network failures, retry exponentially a max of 11 times (2^12s > 48 hours, older than allowed by GCM)
-		// or until user-configured max backoff is hit.
-		backoff := 0
-		for i := 0; i < 12; i++ {
-			err = me.export(ctx, req)
-			if err != nil {
-				me.obs.log.Warn(fmt.Sprintf("error exporting to GCM: %+v", err))
-			}
-			// retry at same read index if retryable (network) error
-			if isNotRecoverable(err) {
-				break
-			}
-			me.obs.log.Error("retryable error, retrying request")
-			backoff = 1 << i
-			if time.Duration(backoff)*time.Second >= me.wal.maxBackoff {
-				break
-			}
-			time.Sleep(time.Duration(backoff) * time.Second)
-		}
-
-		// If we are at the last index, and this last index is not an empty request
-		// (we use empty requests to fill out the end of a log, and if we didn't check for them
-		// this would loop constantly adding empty requests onto the end)
-		if readIndex == writeIndex && len(req.String()) > 0 {
-			// This indicates that we are trying to truncate the last item in the WAL.
-			// If that is the case, write an empty request so we can truncate the last real request
-			// (the WAL library requires at least 1 entry).
-			// Doing so prevents double-exporting in the event of a collector restart.
-			emptyReq := &monitoringpb.CreateTimeSeriesRequest{}
-			bytes, bytesErr := proto.Marshal(emptyReq)
-			if bytesErr != nil {
-				return bytesErr
-			}
-
-			writeIndex++
-			err = me.wal.Write(writeIndex, bytes)
-			if err != nil {
-				return err
-			}
-		}
-
-		// Truncate if readIndex < writeIndex.
-		// This only happens if there are more entries in the WAL
-		// OR, we are at the last real entry and added an "empty" entry above, in which we also increment writeIndex.
-		// otherwise, we've reached the end of the WAL and should be at an empty entry, which the export drops.
-		// If that's the case, and we try to truncate (ie, move readIndex+1), the library returns ErrOutOfRange.
-		if readIndex >= writeIndex {
-			// wal.ErrNotFound is used by wal.Read() to indicate the end of the WAL, but
-			// the wal library doesn't know about our hackery around empty entries.
-			// So it's used by us to indicate the same.
-			return wal.ErrNotFound
-		}
-		err = me.wal.TruncateFront(readIndex + 1)
-		if err != nil {
-			return err
-		}
-	}
-	return err
+	return me.wal.readAndExport(ctx)
 }
 
-// watchWAL watches the WAL directory for a write then returns to the
-// continuallyPopWAL() loop.
+// watchWALFile watches the WAL directory for a write then returns to the
+// runWALReadAndExportLoop() loop.
 func (me *MetricsExporter) watchWALFile(ctx context.Context) error {
 	me.goroutines.Add(1)
 	defer me.goroutines.Done()
-	walWatcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return err
-	}
-	err = walWatcher.Add(me.wal.path)
-
-	if err != nil {
-		return err
-	}
-	watchCh := make(chan error)
-	var wErr error
-	go func() {
-		defer func() {
-			watchCh <- wErr
-			close(watchCh)
-			walWatcher.Close()
-		}()
-
-		select {
-		case <-me.shutdownC:
-			return
-		case <-ctx.Done():
-			wErr = ctx.Err()
-			return
-
-		case event, ok := <-walWatcher.Events:
-			if !ok {
-				return
-			}
-			switch event.Op {
-			case fsnotify.Remove:
-				wErr = fmt.Errorf("WAL file deleted")
-			case fsnotify.Rename:
-				wErr = fmt.Errorf("WAL file renamed")
-			case fsnotify.Write:
-				wErr = nil
-			}
-
-		case watchErr, ok := <-walWatcher.Errors:
-			if ok {
-				wErr = watchErr
-			}
-		}
-	}()
-	err = <-watchCh
-	return err
+	return me.wal.watch(ctx, me.shutdownC)
 }
 
 func (me *MetricsExporter) runWALReadAndExportLoop(ctx context.Context) {
 	defer me.goroutines.Done()
-	defer func() {
-		if err := me.wal.Close(); err != nil {
-			me.obs.log.Error(fmt.Sprintf("error closing WAL: %+v\n", err))
-		}
-	}()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-me.shutdownC:
-			// do one last final read/export then return
-			// otherwise the runner goroutine could leave some hanging metrics unexported
-			for {
-				err := me.readWALAndExport(ctx)
-				if err != nil {
-					if !errors.Is(err, wal.ErrOutOfRange) {
-						me.obs.log.Error(fmt.Sprintf("error flushing remaining WAL entries: %+v", err))
-					}
-					break
-				}
-			}
-			return
-		default:
-			err := me.readWALAndExport(ctx)
-			if err == nil {
-				continue
-			}
-			// ErrNotFound from wal.Read() means the index is either 0 or out of
-			// bounds (indicating we're probably at the end of the WAL). That error
-			// will trigger a file watch for new writes (below this). For other
-			// errors, fail.
-			// ErrNotFound can be expected occasionally if we've reached the end of
-			// the WAL, so don't bother logging those.
-			if !errors.Is(err, wal.ErrNotFound) {
-				me.obs.log.Error(fmt.Sprintf("error reading WAL and exporting: %+v", err))
-			}
-
-			// Must have been ErrNotFound, start a file watch and block waiting for updates.
-			if err = me.watchWALFile(ctx); err != nil {
-				me.obs.log.Error(fmt.Sprintf("error watching WAL and exporting: %+v", err))
-			}
-		}
-	}
+	me.wal.runReadAndExportLoop(ctx, me.shutdownC)
 }
 
 // Reads metric descriptors from the md channel, and reports them (once) to GCM.
 func (me *MetricsExporter) exportMetricDescriptorRunner() {
 	defer me.goroutines.Done()
 
+	// Save the descriptors whose save was delayed to limit writes.
+	saveTicker := time.NewTicker(descriptorcache.SaveInterval)
+	defer saveTicker.Stop()
+
 	// We iterate over all metric descritpors until the channel is closed.
 	// Note: if we get terminated, this will still attempt to export all descriptors
 	// prior to shutdown.
@@ -659,12 +800,15 @@ func (me *MetricsExporter) exportMetricDescriptorRunner() {
 					me.exportMetricDescriptor(md)
 				default:
 					// Return and continue graceful shutdown.
+					me.saveDescriptorCache(true)
 					return
 				}
 			}
 
 		case md := <-me.metricDescriptorC:
 			me.exportMetricDescriptor(md)
+		case <-saveTicker.C:
+			me.saveDescriptorCache(false)
 		}
 	}
 }
@@ -675,14 +819,107 @@ func projectName(projectID string) string {
 
 // isNotRecoverable returns true if the error is permanent.
 func isNotRecoverable(err error) bool {
+	return !isRetryableCode(status.Convert(err).Code())
+}
+
+// isRetryableCode returns true for network errors, and for errors caused by
+// exhausted quota, which should be retried after a backoff.
+func isRetryableCode(code codes.Code) bool {
+	return code == codes.DeadlineExceeded || code == codes.Unavailable || code == codes.ResourceExhausted
+}
+
+// retryDelay returns the delay requested by the server in a RetryInfo error
+// detail, or 0 if there is none.
+func retryDelay(err error) time.Duration {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration()
+		}
+	}
+	return 0
+}
+
+// failedTimeSeriesPattern matches the indices of failed time series in a
+// CreateTimeSeries error message, e.g. "timeSeries[0-2,5]".
+var failedTimeSeriesPattern = regexp.MustCompile(`timeSeries\[([0-9,\- ]+)\]`)
+
+// failedTimeSeries returns a request containing only the time series of req
+// which failed to be written with err, and whether they can be retried.
+// GCM reports partial failures with a CreateTimeSeriesSummary, and lists the
+// indices of the failed time series in the error message. If the failed time
+// series can't be determined, the whole request is returned.
+func failedTimeSeries(req *monitoringpb.CreateTimeSeriesRequest, err error) (*monitoringpb.CreateTimeSeriesRequest, bool) {
 	s := status.Convert(err)
-	return !(s.Code() == codes.DeadlineExceeded || s.Code() == codes.Unavailable)
+	retryable := isRetryableCode(s.Code())
+	partial := false
+	for _, detail := range s.Details() {
+		summary, ok := detail.(*monitoringpb.CreateTimeSeriesSummary)
+		if !ok {
+			continue
+		}
+		partial = true
+		for _, summaryErr := range summary.GetErrors() {
+			if isRetryableCode(codes.Code(summaryErr.GetStatus().GetCode())) {
+				retryable = true
+			}
+		}
+	}
+	if !partial {
+		return req, retryable
+	}
+	indices := failedTimeSeriesIndices(s.Message(), len(req.TimeSeries))
+	if len(indices) == 0 {
+		return req, retryable
+	}
+	failed := &monitoringpb.CreateTimeSeriesRequest{Name: req.Name}
+	for i, ts := range req.TimeSeries {
+		if indices[i] {
+			failed.TimeSeries = append(failed.TimeSeries, ts)
+		}
+	}
+	return failed, retryable
+}
+
+// failedTimeSeriesIndices parses the indices of failed time series from a
+// CreateTimeSeries error message. Indices which are out of range are ignored.
+func failedTimeSeriesIndices(msg string, numTimeSeries int) map[int]bool {
+	indices := make(map[int]bool)
+	for _, match := range failedTimeSeriesPattern.FindAllStringSubmatch(msg, -1) {
+		for _, part := range strings.Split(match[1], ",") {
+			first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+			start, err := strconv.Atoi(first)
+			if err != nil {
+				continue
+			}
+			end := start
+			if isRange {
+				if end, err = strconv.Atoi(last); err != nil {
+					continue
+				}
+			}
+			for i := start; i <= end && i < numTimeSeries; i++ {
+				if i >= 0 {
+					indices[i] = true
+				}
+			}
+		}
+	}
+	return indices
 }
 
 // Helper method to send metric descriptors to GCM.
 func (me *MetricsExporter) exportMetricDescriptor(req *monitoringpb.CreateMetricDescriptorRequest) {
 	cacheKey := fmt.Sprintf("%s/%s", req.Name, req.MetricDescriptor.Type)
-	if _, exists := me.mdCache[cacheKey]; exists {
+	if cached, exists := me.mdCache[cacheKey]; exists {
+		if me.cfg.MetricConfig.DescriptorReconciliation == nil || !descriptorDrifted(cached.MetricDescriptor, req.MetricDescriptor) {
+			return
+		}
+		// Reconcile the labels of all the descriptors sent for the metric,
+		// since each only has the labels of the points in its batch.
+		req = withMergedLabels(req, cached.MetricDescriptor)
+	} else if me.descriptorCache != nil && me.descriptorCache.Contains(descriptorcache.Key(req.Name, req.MetricDescriptor)) {
+		// The descriptor was created before the exporter restarted.
+		me.mdCache[cacheKey] = req
 		return
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), me.timeout)
@@ -691,7 +928,12 @@ func (me *MetricsExporter) exportMetricDescriptor(req *monitoringpb.CreateMetric
 	for _, opt := range me.requestOpts {
 		opt(&ctx, requestInfo{projectName: req.Name})
 	}
-	_, err := me.client.CreateMetricDescriptor(ctx, req)
+	var err error
+	if me.cfg.MetricConfig.DescriptorReconciliation != nil {
+		err = me.reconcileMetricDescriptor(ctx, req)
+	} else {
+		_, err = me.client.CreateMetricDescriptor(ctx, req)
+	}
 	if err != nil {
 		if isNotRecoverable(err) {
 			// cache if the error is non-recoverable
@@ -704,6 +946,21 @@ func (me *MetricsExporter) exportMetricDescriptor(req *monitoringpb.CreateMetric
 
 	// cache if we are successful
 	me.mdCache[cacheKey] = req
+	if me.descriptorCache != nil {
+		me.descriptorCache.Add(descriptorcache.Key(req.Name, req.MetricDescriptor))
+		me.saveDescriptorCache(false)
+	}
+}
+
+// saveDescriptorCache saves the metric descriptor cache, if enabled. Unless
+// force is true, it is saved at most once per descriptorcache.SaveInterval.
+func (me *MetricsExporter) saveDescriptorCache(force bool) {
+	if me.descriptorCache == nil {
+		return
+	}
+	if err := me.descriptorCache.Save(force); err != nil {
+		me.obs.log.Warn("Failed to save metric descriptor cache.", zap.Error(err))
+	}
 }
 
 // Sends a user-custom-metric timeseries.
@@ -748,6 +1005,10 @@ func (m *metricMapper) metricToTimeSeries(
 	metric pmetric.Metric,
 	projectID string,
 ) []*monitoringpb.TimeSeries {
+	rule := m.rules.ruleFor(metric.Name())
+	if rule.excluded() {
+		return nil
+	}
 	timeSeries := []*monitoringpb.TimeSeries{}
 
 	switch metric.Type() {
@@ -755,41 +1016,44 @@ func (m *metricMapper) metricToTimeSeries(
 		sum := metric.Sum()
 		points := sum.DataPoints()
 		for i := 0; i < points.Len(); i++ {
-			ts := m.sumPointToTimeSeries(resource, extraLabels, metric, sum, points.At(i))
+			ts := m.sumPointToTimeSeries(resource, extraLabels, metric, sum, points.At(i), rule)
 			timeSeries = append(timeSeries, ts...)
 		}
 	case pmetric.MetricTypeGauge:
 		gauge := metric.Gauge()
 		points := gauge.DataPoints()
 		for i := 0; i < points.Len(); i++ {
-			ts := m.gaugePointToTimeSeries(resource, extraLabels, metric, gauge, points.At(i))
+			ts := m.gaugePointToTimeSeries(resource, extraLabels, metric, gauge, points.At(i), rule)
 			timeSeries = append(timeSeries, ts...)
 		}
 	case pmetric.MetricTypeSummary:
 		summary := metric.Summary()
 		points := summary.DataPoints()
 		for i := 0; i < points.Len(); i++ {
-			ts := m.summaryPointToTimeSeries(resource, extraLabels, metric, summary, points.At(i))
+			ts := m.summaryPointToTimeSeries(resource, extraLabels, metric, summary, points.At(i), rule)
 			timeSeries = append(timeSeries, ts...)
 		}
 	case pmetric.MetricTypeHistogram:
 		hist := metric.Histogram()
 		points := hist.DataPoints()
 		for i := 0; i < points.Len(); i++ {
-			ts := m.histogramToTimeSeries(resource, extraLabels, metric, hist, points.At(i), projectID)
+			ts := m.histogramToTimeSeries(resource, extraLabels, metric, hist, points.At(i), projectID, rule)
 			timeSeries = append(timeSeries, ts...)
 		}
 	case pmetric.MetricTypeExponentialHistogram:
 		eh := metric.ExponentialHistogram()
 		points := eh.DataPoints()
 		for i := 0; i < points.Len(); i++ {
-			ts := m.exponentialHistogramToTimeSeries(resource, extraLabels, metric, eh, points.At(i), projectID)
+			ts := m.exponentialHistogramToTimeSeries(resource, extraLabels, metric, eh, points.At(i), projectID, rule)
 			timeSeries = append(timeSeries, ts...)
 		}
 	default:
 		m.obs.log.Error("Unsupported metric data type", zap.Any("data_type", metric.Type()))
 	}
 
+	for _, ts := range timeSeries {
+		rule.applyToTimeSeries(ts)
+	}
 	return timeSeries
 }
 
@@ -799,6 +1063,7 @@ func (m *metricMapper) summaryPointToTimeSeries(
 	metric pmetric.Metric,
 	sum pmetric.Summary,
 	point pmetric.SummaryDataPoint,
+	rule *metricRule,
 ) []*monitoringpb.TimeSeries {
 	if point.Flags().NoRecordedValue() {
 		// Drop points without a value.
@@ -811,7 +1076,7 @@ func (m *metricMapper) summaryPointToTimeSeries(
 		return nil
 	}
 	point = normalizedPoint
-	sumType, countType, quantileType, err := m.summaryMetricTypes(metric)
+	sumType, countType, quantileType, err := m.summaryMetricTypes(metric, rule)
 	if err != nil {
 		m.obs.log.Debug("Failed to get metric type (i.e. name) for summary metric. Dropping the metric.", zap.Error(err), zap.Any("metric", metric))
 		return nil
@@ -899,30 +1164,35 @@ func (m *metricMapper) summaryPointToTimeSeries(
 func (m *metricMapper) exemplar(ex pmetric.Exemplar, projectID string) *distribution.Distribution_Exemplar {
 	ctx := context.TODO()
 	attachments := []*anypb.Any{}
-	// TODO: Look into still sending exemplars with no span.
+	droppedLabels := attributesToLabels(ex.FilteredAttributes())
 	if traceID, spanID := ex.TraceID(), ex.SpanID(); !traceID.IsEmpty() && !spanID.IsEmpty() {
+		traceProjectID, traceProjectKey := m.exemplarTraceProject(ex, projectID)
 		sctx, err := anypb.New(&monitoringpb.SpanContext{
-			// TODO - make sure project id is correct.
-			SpanName: fmt.Sprintf("projects/%s/traces/%s/spans/%s", projectID, hex.EncodeToString(traceID[:]), hex.EncodeToString(spanID[:])),
+			SpanName: fmt.Sprintf("projects/%s/traces/%s/spans/%s", traceProjectID, hex.EncodeToString(traceID[:]), hex.EncodeToString(spanID[:])),
 		})
 		if err == nil {
 			attachments = append(attachments, sctx)
+			// The trace project is part of the span name, so it doesn't
+			// need to be attached again.
+			if traceProjectKey != "" {
+				delete(droppedLabels, sanitizeKey(traceProjectKey))
+			}
 		} else {
 			// This happens in the event of logic error (e.g. missing required fields).
 			// As such we complaining loudly to fail our unit tests.
-			recordExemplarFailure(ctx, 1)
+			m.obs.recordExemplarFailure(ctx, 1)
 		}
 	}
-	if ex.FilteredAttributes().Len() > 0 {
+	if len(droppedLabels) > 0 {
 		attr, err := anypb.New(&monitoringpb.DroppedLabels{
-			Label: attributesToLabels(ex.FilteredAttributes()),
+			Label: droppedLabels,
 		})
 		if err == nil {
 			attachments = append(attachments, attr)
 		} else {
 			// This happens in the event of logic error (e.g. missing required fields).
 			// As such we complaining loudly to fail our unit tests.
-			recordExemplarFailure(ctx, 1)
+			m.obs.recordExemplarFailure(ctx, 1)
 		}
 	}
 	var val float64
@@ -939,6 +1209,22 @@ func (m *metricMapper) exemplar(ex pmetric.Exemplar, projectID string) *distribu
 	}
 }
 
+// exemplarTraceProject returns the project of the trace the exemplar was
+// recorded in. It is the value of the exemplar's filtered attribute configured
+// by ExemplarTraceProjectAttribute, if it has one, or the project the metric
+// is written to. It also returns the key of the attribute the project was
+// read from, or "" if it is the metric's project.
+func (m *metricMapper) exemplarTraceProject(ex pmetric.Exemplar, projectID string) (string, string) {
+	key := m.cfg.MetricConfig.ExemplarTraceProjectAttribute
+	if key == "" {
+		return projectID, ""
+	}
+	if traceProject, ok := ex.FilteredAttributes().Get(key); ok && traceProject.AsString() != "" {
+		return traceProject.AsString(), key
+	}
+	return projectID, ""
+}
+
 func (m *metricMapper) exemplars(exs pmetric.ExemplarSlice, projectID string) []*distribution.Distribution_Exemplar {
 	exemplars := make([]*distribution.Distribution_Exemplar, exs.Len())
 	for i := 0; i < exs.Len(); i++ {
@@ -986,6 +1272,7 @@ func (m *metricMapper) histogramPoint(point pmetric.HistogramDataPoint, projectI
 				Mean:                  mean,
 				BucketCounts:          counts,
 				SumOfSquaredDeviation: deviation,
+				Range:                 distributionRange(point.Count(), point.HasMin(), point.Min(), point.HasMax(), point.Max()),
 				BucketOptions: &distribution.Distribution_BucketOptions{
 					Options: &distribution.Distribution_BucketOptions_ExplicitBuckets{
 						ExplicitBuckets: &distribution.Distribution_BucketOptions_Explicit{
@@ -1001,42 +1288,52 @@ func (m *metricMapper) histogramPoint(point pmetric.HistogramDataPoint, projectI
 
 // Maps an exponential distribution into a GCM point.
 func (m *metricMapper) exponentialHistogramPoint(point pmetric.ExponentialHistogramDataPoint, projectID string) *monitoringpb.TypedValue {
-	// First calculate underflow bucket with all negatives + zeros.
-	underflow := point.ZeroCount()
-	negativeBuckets := point.Negative().BucketCounts()
-	for i := 0; i < negativeBuckets.Len(); i++ {
-		underflow += negativeBuckets.At(i)
-	}
-
-	// Next, pull in remaining buckets.
-	counts := make([]int64, point.Positive().BucketCounts().Len()+2)
+	point = downscaleToMaxBuckets(point, m.exponentialHistogramMaxBuckets())
+	var counts []int64
 	bucketOptions := &distribution.Distribution_BucketOptions{}
-	counts[0] = int64(underflow)
-	positiveBuckets := point.Positive().BucketCounts()
-	for i := 0; i < positiveBuckets.Len(); i++ {
-		counts[i+1] = int64(positiveBuckets.At(i))
-	}
-	// Overflow bucket is always empty
-	counts[len(counts)-1] = 0
-
-	if point.Positive().BucketCounts().Len() == 0 {
-		// We cannot send exponential distributions with no positive buckets,
-		// instead we send a simple overflow/underflow histogram.
+	if hasNegativeBuckets(point) {
+		// Exponential buckets can't represent negative values, so send
+		// explicit buckets mirroring the negative buckets instead.
+		var bounds []float64
+		bounds, counts = exponentialToExplicitBuckets(point)
 		bucketOptions.Options = &distribution.Distribution_BucketOptions_ExplicitBuckets{
 			ExplicitBuckets: &distribution.Distribution_BucketOptions_Explicit{
-				Bounds: []float64{0},
+				Bounds: bounds,
 			},
 		}
 	} else {
-		// Exponential histogram
-		growth := math.Exp2(math.Exp2(-float64(point.Scale())))
-		scale := math.Pow(growth, float64(point.Positive().Offset()))
-		bucketOptions.Options = &distribution.Distribution_BucketOptions_ExponentialBuckets{
-			ExponentialBuckets: &distribution.Distribution_BucketOptions_Exponential{
-				GrowthFactor:     growth,
-				Scale:            scale,
-				NumFiniteBuckets: int32(len(counts) - 2),
-			},
+		// First calculate underflow bucket with all (empty) negatives + zeros.
+		underflow := point.ZeroCount()
+
+		// Next, pull in remaining buckets.
+		counts = make([]int64, point.Positive().BucketCounts().Len()+2)
+		counts[0] = int64(underflow)
+		positiveBuckets := point.Positive().BucketCounts()
+		for i := 0; i < positiveBuckets.Len(); i++ {
+			counts[i+1] = int64(positiveBuckets.At(i))
+		}
+		// Overflow bucket is always empty
+		counts[len(counts)-1] = 0
+
+		if point.Positive().BucketCounts().Len() == 0 {
+			// We cannot send exponential distributions with no positive buckets,
+			// instead we send a simple overflow/underflow histogram.
+			bucketOptions.Options = &distribution.Distribution_BucketOptions_ExplicitBuckets{
+				ExplicitBuckets: &distribution.Distribution_BucketOptions_Explicit{
+					Bounds: []float64{0},
+				},
+			}
+		} else {
+			// Exponential histogram
+			growth := math.Exp2(math.Exp2(-float64(point.Scale())))
+			scale := math.Pow(growth, float64(point.Positive().Offset()))
+			bucketOptions.Options = &distribution.Distribution_BucketOptions_ExponentialBuckets{
+				ExponentialBuckets: &distribution.Distribution_BucketOptions_Exponential{
+					GrowthFactor:     growth,
+					Scale:            scale,
+					NumFiniteBuckets: int32(len(counts) - 2),
+				},
+			}
 		}
 	}
 
@@ -1052,12 +1349,113 @@ func (m *metricMapper) exponentialHistogramPoint(point pmetric.ExponentialHistog
 				Mean:          mean,
 				BucketCounts:  counts,
 				BucketOptions: bucketOptions,
+				Range:         distributionRange(point.Count(), point.HasMin(), point.Min(), point.HasMax(), point.Max()),
 				Exemplars:     m.exemplars(point.Exemplars(), projectID),
 			},
 		},
 	}
 }
 
+// distributionRange returns the range of a distribution from the min and max
+// of a histogram, or nil if either is missing. The range must not be set for
+// empty distributions.
+func distributionRange(count uint64, hasMin bool, minimum float64, hasMax bool, maximum float64) *distribution.Distribution_Range {
+	if count == 0 || !hasMin || !hasMax {
+		return nil
+	}
+	return &distribution.Distribution_Range{Min: minimum, Max: maximum}
+}
+
+// exponentialHistogramMaxBuckets returns the maximum number of buckets of the
+// distributions exponential histograms are mapped to.
+func (m *metricMapper) exponentialHistogramMaxBuckets() int {
+	if m.cfg.MetricConfig.ExponentialHistogramMaxBuckets > 0 {
+		return m.cfg.MetricConfig.ExponentialHistogramMaxBuckets
+	}
+	return defaultExponentialHistogramMaxBuckets
+}
+
+// hasNegativeBuckets returns true if the point counted negative values.
+func hasNegativeBuckets(point pmetric.ExponentialHistogramDataPoint) bool {
+	negativeBuckets := point.Negative().BucketCounts()
+	for i := 0; i < negativeBuckets.Len(); i++ {
+		if negativeBuckets.At(i) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// bucketSpan returns the number of buckets after reducing the scale of the
+// buckets by shift.
+func bucketSpan(buckets pmetric.ExponentialHistogramDataPointBuckets, shift int32) int {
+	if buckets.BucketCounts().Len() == 0 {
+		return 0
+	}
+	first := buckets.Offset() >> shift
+	last := (buckets.Offset() + int32(buckets.BucketCounts().Len()) - 1) >> shift
+	return int(last-first) + 1
+}
+
+// distributionBucketCount returns the number of buckets of the distribution
+// the point is mapped to, after reducing the scale of the point by shift.
+func distributionBucketCount(point pmetric.ExponentialHistogramDataPoint, shift int32) int {
+	// underflow and overflow buckets
+	count := bucketSpan(point.Positive(), shift) + 2
+	if hasNegativeBuckets(point) {
+		// negative buckets and the bucket of zeros
+		count += bucketSpan(point.Negative(), shift) + 1
+	}
+	return count
+}
+
+// downscaleToMaxBuckets reduces the scale of the point, merging adjacent
+// buckets, until it is mapped to a distribution with at most maxBuckets
+// buckets, or its buckets can't be merged further.
+func downscaleToMaxBuckets(point pmetric.ExponentialHistogramDataPoint, maxBuckets int) pmetric.ExponentialHistogramDataPoint {
+	shift := int32(0)
+	// Offsets are 32 bit, so shifting by more than 32 doesn't merge buckets.
+	for shift < 32 && distributionBucketCount(point, shift) > maxBuckets {
+		shift++
+	}
+	if shift == 0 {
+		return point
+	}
+	return normalization.DownscaleExponentialHistogramDataPoint(point, point.Scale()-shift)
+}
+
+// exponentialToExplicitBuckets returns explicit bounds and counts equivalent
+// to the buckets of the point: the negative buckets, from the lowest to the
+// highest bound, a bucket of the zero count, and the positive buckets.
+func exponentialToExplicitBuckets(point pmetric.ExponentialHistogramDataPoint) ([]float64, []int64) {
+	base := math.Exp2(math.Exp2(-float64(point.Scale())))
+	negative := point.Negative()
+	positive := point.Positive()
+	bounds := make([]float64, 0, negative.BucketCounts().Len()+positive.BucketCounts().Len()+2)
+	// The underflow bucket is always empty.
+	counts := make([]int64, 1, cap(bounds)+1)
+	// Negative bucket i counts values in (-base^(offset+i+1), -base^(offset+i)].
+	for i := negative.BucketCounts().Len() - 1; i >= 0; i-- {
+		bounds = append(bounds, -math.Pow(base, float64(negative.Offset()+int32(i)+1)))
+		counts = append(counts, int64(negative.BucketCounts().At(i)))
+	}
+	bounds = append(bounds, -math.Pow(base, float64(negative.Offset())))
+	counts = append(counts, int64(point.ZeroCount()))
+	if positive.BucketCounts().Len() == 0 {
+		// Zeros are counted in the overflow bucket.
+		return bounds, counts
+	}
+	// Positive bucket i counts values in (base^(offset+i), base^(offset+i+1)].
+	bounds = append(bounds, math.Pow(base, float64(positive.Offset())))
+	for i := 0; i < positive.BucketCounts().Len(); i++ {
+		bounds = append(bounds, math.Pow(base, float64(positive.Offset()+int32(i)+1)))
+		counts = append(counts, int64(positive.BucketCounts().At(i)))
+	}
+	// The overflow bucket is always empty.
+	counts = append(counts, 0)
+	return bounds, counts
+}
+
 func (m *metricMapper) histogramToTimeSeries(
 	resource *monitoredrespb.MonitoredResource,
 	extraLabels labels,
@@ -1065,13 +1463,14 @@ func (m *metricMapper) histogramToTimeSeries(
 	hist pmetric.Histogram,
 	point pmetric.HistogramDataPoint,
 	projectID string,
+	rule *metricRule,
 ) []*monitoringpb.TimeSeries {
 	if point.Flags().NoRecordedValue() || !point.HasSum() || point.ExplicitBounds().Len() == 0 {
 		// Drop points without a value or without a sum
 		m.obs.log.Debug("Metric has no value, sum, or explicit bounds. Dropping the metric.", zap.Any("metric", metric))
 		return nil
 	}
-	t, err := m.metricNameToType(metric.Name(), metric)
+	t, err := m.metricNameToType(metric.Name(), metric, rule)
 	if err != nil {
 		m.obs.log.Debug("Failed to get metric type (i.e. name) for histogram metric. Dropping the metric.", zap.Error(err), zap.Any("metric", metric))
 		return nil
@@ -1084,6 +1483,14 @@ func (m *metricMapper) histogramToTimeSeries(
 			return nil
 		}
 		point = normalizedPoint
+	} else if hist.AggregationTemporality() == pmetric.AggregationTemporalityDelta {
+		// Accumulate delta histogram points, if enabled.
+		metricIdentifier := datapointstorage.Identifier(resource, extraLabels, metric, point.Attributes())
+		accumulatedPoint, keep := m.deltaAccumulator.AccumulateHistogramDataPoint(point, metricIdentifier)
+		if !keep {
+			return nil
+		}
+		point = accumulatedPoint
 	}
 
 	// We treat deltas as cumulatives w/ resets.
@@ -1120,12 +1527,13 @@ func (m *metricMapper) exponentialHistogramToTimeSeries(
 	exponentialHist pmetric.ExponentialHistogram,
 	point pmetric.ExponentialHistogramDataPoint,
 	projectID string,
+	rule *metricRule,
 ) []*monitoringpb.TimeSeries {
 	if point.Flags().NoRecordedValue() {
 		// Drop points without a value.
 		return nil
 	}
-	t, err := m.metricNameToType(metric.Name(), metric)
+	t, err := m.metricNameToType(metric.Name(), metric, rule)
 	if err != nil {
 		m.obs.log.Debug("Failed to get metric type (i.e. name) for exponential histogram metric. Dropping the metric.", zap.Error(err), zap.Any("metric", metric))
 		return nil
@@ -1138,6 +1546,14 @@ func (m *metricMapper) exponentialHistogramToTimeSeries(
 			return nil
 		}
 		point = normalizedPoint
+	} else if exponentialHist.AggregationTemporality() == pmetric.AggregationTemporalityDelta {
+		// Accumulate delta exponential histogram points, if enabled.
+		metricIdentifier := datapointstorage.Identifier(resource, extraLabels, metric, point.Attributes())
+		accumulatedPoint, keep := m.deltaAccumulator.AccumulateExponentialHistogramDataPoint(point, metricIdentifier)
+		if !keep {
+			return nil
+		}
+		point = accumulatedPoint
 	}
 	// We treat deltas as cumulatives w/ resets.
 	metricKind := metricpb.MetricDescriptor_CUMULATIVE
@@ -1172,6 +1588,7 @@ func (m *metricMapper) sumPointToTimeSeries(
 	metric pmetric.Metric,
 	sum pmetric.Sum,
 	point pmetric.NumberDataPoint,
+	rule *metricRule,
 ) []*monitoringpb.TimeSeries {
 	metricKind := metricpb.MetricDescriptor_CUMULATIVE
 	var startTime *timestamppb.Timestamp
@@ -1180,11 +1597,20 @@ func (m *metricMapper) sumPointToTimeSeries(
 		// prometheus.
 		return nil
 	}
-	t, err := m.metricNameToType(metric.Name(), metric)
+	t, err := m.metricNameToType(metric.Name(), metric, rule)
 	if err != nil {
 		m.obs.log.Debug("Failed to get metric type (i.e. name) for sum metric. Dropping the metric.", zap.Error(err), zap.Any("metric", metric))
 		return nil
 	}
+	if sum.AggregationTemporality() == pmetric.AggregationTemporalityDelta {
+		// Accumulate delta sum points, if enabled.
+		metricIdentifier := datapointstorage.Identifier(resource, extraLabels, metric, point.Attributes())
+		accumulatedPoint, keep := m.deltaAccumulator.AccumulateNumberDataPoint(point, metricIdentifier)
+		if !keep {
+			return nil
+		}
+		point = accumulatedPoint
+	}
 	if sum.IsMonotonic() {
 		if sum.AggregationTemporality() == pmetric.AggregationTemporalityCumulative {
 			metricIdentifier := datapointstorage.Identifier(resource, extraLabels, metric, point.Attributes())
@@ -1195,6 +1621,10 @@ func (m *metricMapper) sumPointToTimeSeries(
 			point = normalizedPoint
 		}
 		startTime = timestamppb.New(point.StartTimestamp().AsTime())
+	} else if rule.metricKind() == MetricKindCumulative {
+		// Non-monotonic sums are written as cumulatives, without
+		// normalization, if a rule pins their kind.
+		startTime = timestamppb.New(point.StartTimestamp().AsTime())
 	} else {
 		metricKind = metricpb.MetricDescriptor_GAUGE
 		startTime = nil
@@ -1229,12 +1659,13 @@ func (m *metricMapper) gaugePointToTimeSeries(
 	metric pmetric.Metric,
 	gauge pmetric.Gauge,
 	point pmetric.NumberDataPoint,
+	rule *metricRule,
 ) []*monitoringpb.TimeSeries {
 	if point.Flags().NoRecordedValue() {
 		// Drop points without a value.
 		return nil
 	}
-	t, err := m.metricNameToType(metric.Name(), metric)
+	t, err := m.metricNameToType(metric.Name(), metric, rule)
 	if err != nil {
 		m.obs.log.Debug("Unable to get metric type (i.e. name) for gauge metric.", zap.Error(err), zap.Any("metric", metric))
 		return nil
@@ -1274,7 +1705,11 @@ func (m *metricMapper) getMetricNamePrefix(name string) string {
 }
 
 // metricNameToType maps OTLP metric name to GCM metric type (aka name).
-func (m *metricMapper) metricNameToType(name string, metric pmetric.Metric) (string, error) {
+// rule is the metric rule matching the metric, if any.
+func (m *metricMapper) metricNameToType(name string, metric pmetric.Metric, rule *metricRule) (string, error) {
+	if metricType, ok := rule.metricType(metric.Name(), strings.TrimPrefix(name, metric.Name())); ok {
+		return metricType, nil
+	}
 	metricName, err := m.cfg.MetricConfig.GetMetricName(name, metric)
 	if err != nil {
 		return "", err
@@ -1448,16 +1883,16 @@ func (m *metricMapper) labelDescriptors(
 }
 
 // Returns (sum, count, quantile) metric types (i.e. names) for a summary metric.
-func (m *metricMapper) summaryMetricTypes(pm pmetric.Metric) (string, string, string, error) {
-	sumType, err := m.metricNameToType(pm.Name()+SummarySumSuffix, pm)
+func (m *metricMapper) summaryMetricTypes(pm pmetric.Metric, rule *metricRule) (string, string, string, error) {
+	sumType, err := m.metricNameToType(pm.Name()+SummarySumSuffix, pm, rule)
 	if err != nil {
 		return "", "", "", err
 	}
-	countType, err := m.metricNameToType(pm.Name()+SummaryCountPrefix, pm)
+	countType, err := m.metricNameToType(pm.Name()+SummaryCountPrefix, pm, rule)
 	if err != nil {
 		return "", "", "", err
 	}
-	quantileType, err := m.metricNameToType(pm.Name(), pm)
+	quantileType, err := m.metricNameToType(pm.Name(), pm, rule)
 	if err != nil {
 		return "", "", "", err
 	}
@@ -1467,8 +1902,9 @@ func (m *metricMapper) summaryMetricTypes(pm pmetric.Metric) (string, string, st
 func (m *metricMapper) summaryMetricDescriptors(
 	pm pmetric.Metric,
 	extraLabels labels,
+	rule *metricRule,
 ) []*metricpb.MetricDescriptor {
-	sumType, countType, quantileType, err := m.summaryMetricTypes(pm)
+	sumType, countType, quantileType, err := m.summaryMetricTypes(pm, rule)
 	if err != nil {
 		m.obs.log.Debug("Failed to get metric types (i.e. names) for summary metric. Dropping the metric.", zap.Error(err), zap.Any("metric", pm))
 		return nil
@@ -1515,10 +1951,19 @@ func (m *metricMapper) metricDescriptor(
 	pm pmetric.Metric,
 	extraLabels labels,
 ) []*metricpb.MetricDescriptor {
+	rule := m.rules.ruleFor(pm.Name())
+	if rule.excluded() {
+		return nil
+	}
 	if pm.Type() == pmetric.MetricTypeSummary {
-		return m.summaryMetricDescriptors(pm, extraLabels)
+		mds := m.summaryMetricDescriptors(pm, extraLabels, rule)
+		for _, md := range mds {
+			// Summary display names are the metric name with a suffix.
+			rule.applyToDescriptor(md, strings.TrimPrefix(md.DisplayName, pm.Name()))
+		}
+		return mds
 	}
-	kind, typ := m.mapMetricPointKind(pm)
+	kind, typ := m.mapMetricPointKind(pm, rule)
 	if kind == metricpb.MetricDescriptor_METRIC_KIND_UNSPECIFIED {
 		m.obs.log.Debug("Failed to get metric kind (i.e. aggregation) for metric descriptor. Dropping the metric descriptor.", zap.Any("metric", pm))
 		return nil
@@ -1527,7 +1972,7 @@ func (m *metricMapper) metricDescriptor(
 		m.obs.log.Debug("Failed to get metric type (int / double) for metric descriptor. Dropping the metric descriptor.", zap.Any("metric", pm))
 		return nil
 	}
-	metricType, err := m.metricNameToType(pm.Name(), pm)
+	metricType, err := m.metricNameToType(pm.Name(), pm, rule)
 	if err != nil {
 		m.obs.log.Debug("Failed to get metric type (i.e. name) for metric descriptor. Dropping the metric descriptor.", zap.Error(err), zap.Any("metric", pm))
 		return nil
@@ -1537,18 +1982,18 @@ func (m *metricMapper) metricDescriptor(
 	if kind == metricpb.MetricDescriptor_METRIC_KIND_UNSPECIFIED {
 		return nil
 	}
-	return []*metricpb.MetricDescriptor{
-		{
-			Name:        pm.Name(),
-			DisplayName: m.metricTypeToDisplayName(metricType),
-			Type:        metricType,
-			MetricKind:  kind,
-			ValueType:   typ,
-			Unit:        pm.Unit(),
-			Description: pm.Description(),
-			Labels:      labels,
-		},
-	}
+	md := &metricpb.MetricDescriptor{
+		Name:        pm.Name(),
+		DisplayName: m.metricTypeToDisplayName(metricType),
+		Type:        metricType,
+		MetricKind:  kind,
+		ValueType:   typ,
+		Unit:        pm.Unit(),
+		Description: pm.Description(),
+		Labels:      labels,
+	}
+	rule.applyToDescriptor(md, "")
+	return []*metricpb.MetricDescriptor{md}
 }
 
 func metricPointValueType(pt pmetric.NumberDataPointValueType) metricpb.MetricDescriptor_ValueType {
@@ -1562,7 +2007,7 @@ func metricPointValueType(pt pmetric.NumberDataPointValueType) metricpb.MetricDe
 	}
 }
 
-func (me *metricMapper) mapMetricPointKind(m pmetric.Metric) (metricpb.MetricDescriptor_MetricKind, metricpb.MetricDescriptor_ValueType) {
+func (me *metricMapper) mapMetricPointKind(m pmetric.Metric, rule *metricRule) (metricpb.MetricDescriptor_MetricKind, metricpb.MetricDescriptor_ValueType) {
 	var kind metricpb.MetricDescriptor_MetricKind
 	var typ metricpb.MetricDescriptor_ValueType
 	switch m.Type() {
@@ -1577,7 +2022,7 @@ func (me *metricMapper) mapMetricPointKind(m pmetric.Metric) (metricpb.MetricDes
 			}
 		}
 	case pmetric.MetricTypeSum:
-		if !m.Sum().IsMonotonic() {
+		if !m.Sum().IsMonotonic() && rule.metricKind() != MetricKindCumulative {
 			kind = metricpb.MetricDescriptor_GAUGE
 		} else {
 			kind = metricpb.MetricDescriptor_CUMULATIVE
@@ -0,0 +1,305 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/datapointstorage"
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/normalization"
+)
+
+// Aggregations used to combine the points of gauges when labels are removed.
+const (
+	GaugeAggregationLast = "last"
+	GaugeAggregationMin  = "min"
+	GaugeAggregationMax  = "max"
+	GaugeAggregationMean = "mean"
+)
+
+// labelAggregation removes labels from the metrics matching metricRegex.
+type labelAggregation struct {
+	metricRegex      *regexp.Regexp
+	dropLabels       map[string]struct{}
+	gaugeAggregation string
+}
+
+// labelAggregator removes labels from metrics, and re-aggregates the points of
+// series which become the same series, before they are mapped to time series.
+type labelAggregator struct {
+	aggregator *normalization.Aggregator
+	rules      []labelAggregation
+}
+
+func newLabelAggregator(shutdown <-chan struct{}, obs selfObservability, cfgs []AggregationConfig) (*labelAggregator, error) {
+	rules := make([]labelAggregation, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		metricRegex, err := regexp.Compile(cfg.MetricRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric_regex %q: %w", cfg.MetricRegex, err)
+		}
+		dropLabels := make(map[string]struct{}, len(cfg.DropLabels))
+		for _, label := range cfg.DropLabels {
+			dropLabels[label] = struct{}{}
+		}
+		gaugeAggregation := cfg.GaugeAggregation
+		if gaugeAggregation == "" {
+			gaugeAggregation = GaugeAggregationLast
+		}
+		rules = append(rules, labelAggregation{
+			metricRegex:      metricRegex,
+			dropLabels:       dropLabels,
+			gaugeAggregation: gaugeAggregation,
+		})
+	}
+	return &labelAggregator{
+		aggregator: normalization.NewAggregator(shutdown, obs.log, datapointstorage.Config{
+			ObserveSize: obs.observeNormalizationCacheSize,
+			OnEvict:     obs.recordNormalizationCacheEviction,
+		}),
+		rules: rules,
+	}, nil
+}
+
+// ruleFor returns the first aggregation which matches the metric name, or nil.
+func (la *labelAggregator) ruleFor(name string) *labelAggregation {
+	for i := range la.rules {
+		if la.rules[i].metricRegex.MatchString(name) {
+			return &la.rules[i]
+		}
+	}
+	return nil
+}
+
+// aggregate returns a copy of m, in which labels are removed from the points
+// of matching metrics, and points of the same series are aggregated.
+// Summaries can't be aggregated, and are not modified.
+func (la *labelAggregator) aggregate(m pmetric.Metrics) pmetric.Metrics {
+	metricsCopy := pmetric.NewMetrics()
+	m.CopyTo(metricsCopy)
+	rms := metricsCopy.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		sms := rm.ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			sm := sms.At(j)
+			// Identify series by their resource and scope, in addition to
+			// their metric and attributes.
+			extraLabels := attributesToLabels(rm.Resource().Attributes())
+			extraLabels["instrumentation_source"] = sm.Scope().Name()
+			extraLabels["instrumentation_version"] = sm.Scope().Version()
+			mes := sm.Metrics()
+			for k := 0; k < mes.Len(); k++ {
+				metric := mes.At(k)
+				if rule := la.ruleFor(metric.Name()); rule != nil {
+					la.aggregateMetric(rule, metric, extraLabels)
+				}
+			}
+		}
+	}
+	return metricsCopy
+}
+
+// group removes the dropped labels from the attributes of n points, and
+// groups the indices of points with the same remaining attributes, in the
+// order they first appear. It returns the groups, the identifier of the
+// source series of each point, and the identifier of each group's series.
+func (r *labelAggregation) group(n int, attributes func(int) pcommon.Map, metric pmetric.Metric, extraLabels map[string]string) (groups [][]int, sourceIDs []string, ids []string) {
+	sourceIDs = make([]string, n)
+	groupIndex := make(map[string]int)
+	for i := 0; i < n; i++ {
+		attrs := attributes(i)
+		sourceIDs[i] = datapointstorage.Identifier(nil, extraLabels, metric, attrs)
+		attrs.RemoveIf(func(k string, _ pcommon.Value) bool {
+			_, drop := r.dropLabels[k]
+			return drop
+		})
+		id := datapointstorage.Identifier(nil, extraLabels, metric, attrs)
+		g, ok := groupIndex[id]
+		if !ok {
+			g = len(groups)
+			groupIndex[id] = g
+			groups = append(groups, nil)
+			ids = append(ids, id)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups, sourceIDs, ids
+}
+
+func (la *labelAggregator) aggregateMetric(rule *labelAggregation, metric pmetric.Metric, extraLabels map[string]string) {
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		dps := metric.Gauge().DataPoints()
+		groups, _, _ := rule.group(dps.Len(), func(i int) pcommon.Map { return dps.At(i).Attributes() }, metric, extraLabels)
+		newDps := pmetric.NewNumberDataPointSlice()
+		for _, group := range groups {
+			points := make([]pmetric.NumberDataPoint, len(group))
+			for i, index := range group {
+				points[i] = dps.At(index)
+			}
+			newPoint := newDps.AppendEmpty()
+			aggregateGaugeDataPoints(points, rule.gaugeAggregation).CopyTo(newPoint)
+			copyExemplars(newPoint.Exemplars(), len(points), func(i int) pmetric.ExemplarSlice { return points[i].Exemplars() })
+		}
+		newDps.CopyTo(dps)
+	case pmetric.MetricTypeSum:
+		sum := metric.Sum()
+		dps := sum.DataPoints()
+		cumulative := sum.AggregationTemporality() == pmetric.AggregationTemporalityCumulative
+		groups, sourceIDs, ids := rule.group(dps.Len(), func(i int) pcommon.Map { return dps.At(i).Attributes() }, metric, extraLabels)
+		newDps := pmetric.NewNumberDataPointSlice()
+		for g, group := range groups {
+			points := make([]pmetric.NumberDataPoint, len(group))
+			groupSourceIDs := make([]string, len(group))
+			for i, index := range group {
+				points[i] = dps.At(index)
+				groupSourceIDs[i] = sourceIDs[index]
+			}
+			point, ok := la.aggregator.AggregateNumberDataPoints(points, groupSourceIDs, ids[g], cumulative, sum.IsMonotonic())
+			if !ok {
+				continue
+			}
+			newPoint := newDps.AppendEmpty()
+			point.CopyTo(newPoint)
+			points[0].Attributes().CopyTo(newPoint.Attributes())
+			copyExemplars(newPoint.Exemplars(), len(points), func(i int) pmetric.ExemplarSlice { return points[i].Exemplars() })
+		}
+		// Replace the points without overwriting them, since the aggregator
+		// keeps the previous points of source series.
+		dps.RemoveIf(func(pmetric.NumberDataPoint) bool { return true })
+		newDps.MoveAndAppendTo(dps)
+	case pmetric.MetricTypeHistogram:
+		hist := metric.Histogram()
+		dps := hist.DataPoints()
+		cumulative := hist.AggregationTemporality() == pmetric.AggregationTemporalityCumulative
+		groups, sourceIDs, ids := rule.group(dps.Len(), func(i int) pcommon.Map { return dps.At(i).Attributes() }, metric, extraLabels)
+		newDps := pmetric.NewHistogramDataPointSlice()
+		for g, group := range groups {
+			points := make([]pmetric.HistogramDataPoint, len(group))
+			groupSourceIDs := make([]string, len(group))
+			for i, index := range group {
+				points[i] = dps.At(index)
+				groupSourceIDs[i] = sourceIDs[index]
+			}
+			point, ok := la.aggregator.AggregateHistogramDataPoints(points, groupSourceIDs, ids[g], cumulative)
+			if !ok {
+				continue
+			}
+			newPoint := newDps.AppendEmpty()
+			point.CopyTo(newPoint)
+			points[0].Attributes().CopyTo(newPoint.Attributes())
+			copyExemplars(newPoint.Exemplars(), len(points), func(i int) pmetric.ExemplarSlice { return points[i].Exemplars() })
+		}
+		// Replace the points without overwriting them, since the aggregator
+		// keeps the previous points of source series.
+		dps.RemoveIf(func(pmetric.HistogramDataPoint) bool { return true })
+		newDps.MoveAndAppendTo(dps)
+	case pmetric.MetricTypeExponentialHistogram:
+		hist := metric.ExponentialHistogram()
+		dps := hist.DataPoints()
+		cumulative := hist.AggregationTemporality() == pmetric.AggregationTemporalityCumulative
+		groups, sourceIDs, ids := rule.group(dps.Len(), func(i int) pcommon.Map { return dps.At(i).Attributes() }, metric, extraLabels)
+		newDps := pmetric.NewExponentialHistogramDataPointSlice()
+		for g, group := range groups {
+			points := make([]pmetric.ExponentialHistogramDataPoint, len(group))
+			groupSourceIDs := make([]string, len(group))
+			for i, index := range group {
+				points[i] = dps.At(index)
+				groupSourceIDs[i] = sourceIDs[index]
+			}
+			point, ok := la.aggregator.AggregateExponentialHistogramDataPoints(points, groupSourceIDs, ids[g], cumulative)
+			if !ok {
+				continue
+			}
+			newPoint := newDps.AppendEmpty()
+			point.CopyTo(newPoint)
+			points[0].Attributes().CopyTo(newPoint.Attributes())
+			copyExemplars(newPoint.Exemplars(), len(points), func(i int) pmetric.ExemplarSlice { return points[i].Exemplars() })
+		}
+		// Replace the points without overwriting them, since the aggregator
+		// keeps the previous points of source series.
+		dps.RemoveIf(func(pmetric.ExponentialHistogramDataPoint) bool { return true })
+		newDps.MoveAndAppendTo(dps)
+	case pmetric.MetricTypeSummary, pmetric.MetricTypeEmpty:
+	}
+}
+
+// aggregateGaugeDataPoints combines gauge points of the same series according
+// to the gauge aggregation. The aggregated point ends at the latest end time
+// of the points. The mean of int points is rounded, so that the value type of
+// the metric doesn't change.
+func aggregateGaugeDataPoints(points []pmetric.NumberDataPoint, aggregation string) pmetric.NumberDataPoint {
+	latest := points[0]
+	for _, point := range points[1:] {
+		if point.Timestamp() > latest.Timestamp() {
+			latest = point
+		}
+	}
+	// Make a copy so we don't mutate underlying data
+	newPoint := pmetric.NewNumberDataPoint()
+	switch aggregation {
+	case GaugeAggregationMin, GaugeAggregationMax:
+		selected := points[0]
+		for _, point := range points[1:] {
+			value, selectedValue := numberValue(point), numberValue(selected)
+			if (aggregation == GaugeAggregationMin && value < selectedValue) || (aggregation == GaugeAggregationMax && value > selectedValue) {
+				selected = point
+			}
+		}
+		selected.CopyTo(newPoint)
+	case GaugeAggregationMean:
+		latest.CopyTo(newPoint)
+		total := 0.0
+		for _, point := range points {
+			total += numberValue(point)
+		}
+		mean := total / float64(len(points))
+		if newPoint.ValueType() == pmetric.NumberDataPointValueTypeInt {
+			newPoint.SetIntValue(int64(math.Round(mean)))
+		} else {
+			newPoint.SetDoubleValue(mean)
+		}
+	default:
+		latest.CopyTo(newPoint)
+	}
+	newPoint.SetTimestamp(latest.Timestamp())
+	return newPoint
+}
+
+// numberValue returns the value of the point as a float64.
+func numberValue(point pmetric.NumberDataPoint) float64 {
+	if point.ValueType() == pmetric.NumberDataPointValueTypeInt {
+		return float64(point.IntValue())
+	}
+	return point.DoubleValue()
+}
+
+// copyExemplars replaces dest with the exemplars of n points.
+func copyExemplars(dest pmetric.ExemplarSlice, n int, exemplars func(int) pmetric.ExemplarSlice) {
+	newExemplars := pmetric.NewExemplarSlice()
+	for i := 0; i < n; i++ {
+		from := exemplars(i)
+		for j := 0; j < from.Len(); j++ {
+			from.At(j).CopyTo(newExemplars.AppendEmpty())
+		}
+	}
+	newExemplars.CopyTo(dest)
+}
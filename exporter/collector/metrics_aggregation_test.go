@@ -0,0 +1,312 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.uber.org/zap"
+)
+
+var aggregationStart = time.Unix(1000, 0)
+
+func aggregationTimestamp(seconds int) pcommon.Timestamp {
+	return pcommon.NewTimestampFromTime(aggregationStart.Add(time.Duration(seconds) * time.Second))
+}
+
+func newTestLabelAggregator(t *testing.T, cfgs ...AggregationConfig) *labelAggregator {
+	shutdown := make(chan struct{})
+	t.Cleanup(func() { close(shutdown) })
+	la, err := newLabelAggregator(shutdown, selfObservability{log: zap.NewNop()}, cfgs)
+	require.NoError(t, err)
+	return la
+}
+
+// newTestAggregationMetrics returns metrics with a single metric, and the
+// metric to add points to.
+func newTestAggregationMetrics(name string) (pmetric.Metrics, pmetric.Metric) {
+	metrics := pmetric.NewMetrics()
+	rm := metrics.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("service.name", "my-service")
+	metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName(name)
+	return metrics, metric
+}
+
+func aggregatedMetric(m pmetric.Metrics) pmetric.Metric {
+	return m.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+}
+
+func TestAggregateGauge(t *testing.T) {
+	for _, tc := range []struct {
+		aggregation string
+		expected    float64
+	}{
+		{aggregation: "", expected: 3},
+		{aggregation: GaugeAggregationLast, expected: 3},
+		{aggregation: GaugeAggregationMin, expected: 1},
+		{aggregation: GaugeAggregationMax, expected: 5},
+		{aggregation: GaugeAggregationMean, expected: 3},
+	} {
+		t.Run(tc.aggregation, func(t *testing.T) {
+			la := newTestLabelAggregator(t, AggregationConfig{
+				MetricRegex:      "^memory",
+				DropLabels:       []string{"pod"},
+				GaugeAggregation: tc.aggregation,
+			})
+			metrics, metric := newTestAggregationMetrics("memory")
+			dps := metric.SetEmptyGauge().DataPoints()
+			for i, value := range []float64{5, 1, 3} {
+				dp := dps.AppendEmpty()
+				dp.SetTimestamp(aggregationTimestamp(i))
+				dp.SetDoubleValue(value)
+				dp.Attributes().PutStr("pod", string(rune('a'+i)))
+				dp.Attributes().PutStr("zone", "us-east1")
+			}
+
+			result := aggregatedMetric(la.aggregate(metrics)).Gauge().DataPoints()
+			require.Equal(t, 1, result.Len())
+			assert.Equal(t, tc.expected, result.At(0).DoubleValue())
+			assert.Equal(t, aggregationTimestamp(2), result.At(0).Timestamp())
+			assert.Equal(t, map[string]any{"zone": "us-east1"}, result.At(0).Attributes().AsRaw())
+			// The input is not modified.
+			assert.Equal(t, 3, dps.Len())
+		})
+	}
+}
+
+func TestAggregateIntGaugeMean(t *testing.T) {
+	la := newTestLabelAggregator(t, AggregationConfig{
+		MetricRegex:      "^memory",
+		DropLabels:       []string{"pod"},
+		GaugeAggregation: GaugeAggregationMean,
+	})
+	metrics, metric := newTestAggregationMetrics("memory")
+	dps := metric.SetEmptyGauge().DataPoints()
+	for i, value := range []int64{5, 1, 2} {
+		dp := dps.AppendEmpty()
+		dp.SetTimestamp(aggregationTimestamp(i))
+		dp.SetIntValue(value)
+		dp.Attributes().PutStr("pod", string(rune('a'+i)))
+	}
+
+	result := aggregatedMetric(la.aggregate(metrics)).Gauge().DataPoints()
+	require.Equal(t, 1, result.Len())
+	assert.Equal(t, pmetric.NumberDataPointValueTypeInt, result.At(0).ValueType(), "int gauges stay int")
+	assert.Equal(t, int64(3), result.At(0).IntValue(), "mean of 8/3 is rounded")
+}
+
+func TestAggregateDeltaSum(t *testing.T) {
+	la := newTestLabelAggregator(t, AggregationConfig{MetricRegex: "requests", DropLabels: []string{"request_id"}})
+	metrics, metric := newTestAggregationMetrics("requests")
+	sum := metric.SetEmptySum()
+	sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	for i, code := range []string{"200", "200", "500"} {
+		dp := sum.DataPoints().AppendEmpty()
+		dp.SetStartTimestamp(aggregationTimestamp(i))
+		dp.SetTimestamp(aggregationTimestamp(10 + i))
+		dp.SetIntValue(int64(i + 1))
+		dp.Attributes().PutStr("request_id", string(rune('a'+i)))
+		dp.Attributes().PutStr("code", code)
+	}
+
+	result := aggregatedMetric(la.aggregate(metrics)).Sum().DataPoints()
+	require.Equal(t, 2, result.Len())
+	assert.Equal(t, int64(3), result.At(0).IntValue())
+	assert.Equal(t, aggregationTimestamp(0), result.At(0).StartTimestamp())
+	assert.Equal(t, aggregationTimestamp(11), result.At(0).Timestamp())
+	assert.Equal(t, map[string]any{"code": "200"}, result.At(0).Attributes().AsRaw())
+	assert.Equal(t, int64(3), result.At(1).IntValue())
+	assert.Equal(t, map[string]any{"code": "500"}, result.At(1).Attributes().AsRaw())
+}
+
+func TestAggregateCumulativeSum(t *testing.T) {
+	la := newTestLabelAggregator(t, AggregationConfig{MetricRegex: "requests", DropLabels: []string{"pod"}})
+	type podPoint struct {
+		pod   string
+		start int
+		value int64
+	}
+	collection := 0
+	for _, tc := range []struct {
+		desc     string
+		points   []podPoint
+		expected int64
+	}{
+		{
+			desc:     "first points are summed",
+			points:   []podPoint{{pod: "a", start: 0, value: 10}, {pod: "b", start: 5, value: 20}},
+			expected: 30,
+		},
+		{
+			desc:     "increases are added",
+			points:   []podPoint{{pod: "a", start: 0, value: 15}, {pod: "b", start: 5, value: 22}},
+			expected: 37,
+		},
+		{
+			desc:     "reset source series are added from zero",
+			points:   []podPoint{{pod: "a", start: 100, value: 4}, {pod: "b", start: 5, value: 23}},
+			expected: 42,
+		},
+		{
+			desc:     "new source series are added, stopped series keep their value",
+			points:   []podPoint{{pod: "c", start: 200, value: 8}},
+			expected: 50,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			metrics, metric := newTestAggregationMetrics("requests")
+			collection++
+			sum := metric.SetEmptySum()
+			sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+			sum.SetIsMonotonic(true)
+			for _, p := range tc.points {
+				dp := sum.DataPoints().AppendEmpty()
+				dp.SetStartTimestamp(aggregationTimestamp(p.start))
+				// Each test case is a new collection, 10 minutes after the previous one.
+				dp.SetTimestamp(aggregationTimestamp(600 * collection))
+				dp.SetIntValue(p.value)
+				dp.Attributes().PutStr("pod", p.pod)
+			}
+			result := aggregatedMetric(la.aggregate(metrics)).Sum().DataPoints()
+			require.Equal(t, 1, result.Len())
+			assert.Equal(t, tc.expected, result.At(0).IntValue())
+			// The aggregated series starts with its earliest source series.
+			assert.Equal(t, aggregationTimestamp(0), result.At(0).StartTimestamp())
+			assert.Empty(t, result.At(0).Attributes().AsRaw())
+		})
+	}
+}
+
+func TestAggregateCumulativeSumNewAndStalePoints(t *testing.T) {
+	la := newTestLabelAggregator(t, AggregationConfig{MetricRegex: "requests", DropLabels: []string{"pod"}})
+	newMetrics := func(end int, values map[string]int64) pmetric.Metrics {
+		metrics, metric := newTestAggregationMetrics("requests")
+		sum := metric.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		sum.SetIsMonotonic(true)
+		for _, pod := range []string{"a", "b"} {
+			if value, ok := values[pod]; ok {
+				dp := sum.DataPoints().AppendEmpty()
+				dp.SetStartTimestamp(aggregationTimestamp(0))
+				dp.SetTimestamp(aggregationTimestamp(end))
+				dp.SetIntValue(value)
+				dp.Attributes().PutStr("pod", pod)
+			}
+		}
+		return metrics
+	}
+	result := aggregatedMetric(la.aggregate(newMetrics(100, map[string]int64{"a": 10}))).Sum().DataPoints()
+	require.Equal(t, 1, result.Len())
+	assert.Equal(t, int64(10), result.At(0).IntValue())
+
+	// Pod b started at the same time as the aggregated series, so all of
+	// its value is added.
+	result = aggregatedMetric(la.aggregate(newMetrics(200, map[string]int64{"a": 11, "b": 5}))).Sum().DataPoints()
+	require.Equal(t, 1, result.Len())
+	assert.Equal(t, int64(16), result.At(0).IntValue())
+
+	// A stale point is not counted twice, and no point is written.
+	result = aggregatedMetric(la.aggregate(newMetrics(200, map[string]int64{"a": 11}))).Sum().DataPoints()
+	assert.Equal(t, 0, result.Len())
+}
+
+func TestAggregateCumulativeHistogram(t *testing.T) {
+	la := newTestLabelAggregator(t, AggregationConfig{MetricRegex: "latency", DropLabels: []string{"pod"}})
+	newMetrics := func(end int, counts map[string][]uint64) pmetric.Metrics {
+		metrics, metric := newTestAggregationMetrics("latency")
+		hist := metric.SetEmptyHistogram()
+		hist.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		for _, pod := range []string{"a", "b"} {
+			dp := hist.DataPoints().AppendEmpty()
+			dp.SetStartTimestamp(aggregationTimestamp(0))
+			dp.SetTimestamp(aggregationTimestamp(end))
+			dp.ExplicitBounds().FromRaw([]float64{10, 100})
+			dp.BucketCounts().FromRaw(counts[pod])
+			var count uint64
+			for _, c := range counts[pod] {
+				count += c
+			}
+			dp.SetCount(count)
+			dp.SetSum(float64(count))
+			dp.Attributes().PutStr("pod", pod)
+		}
+		return metrics
+	}
+	result := aggregatedMetric(la.aggregate(newMetrics(10, map[string][]uint64{"a": {1, 2, 3}, "b": {0, 1, 0}}))).Histogram().DataPoints()
+	require.Equal(t, 1, result.Len())
+	assert.Equal(t, []uint64{1, 3, 3}, result.At(0).BucketCounts().AsRaw())
+	assert.Equal(t, uint64(7), result.At(0).Count())
+
+	result = aggregatedMetric(la.aggregate(newMetrics(20, map[string][]uint64{"a": {2, 2, 3}, "b": {0, 1, 5}}))).Histogram().DataPoints()
+	require.Equal(t, 1, result.Len())
+	assert.Equal(t, []uint64{2, 3, 8}, result.At(0).BucketCounts().AsRaw())
+	assert.Equal(t, uint64(13), result.At(0).Count())
+	assert.Equal(t, float64(13), result.At(0).Sum())
+	assert.Equal(t, aggregationTimestamp(0), result.At(0).StartTimestamp())
+	assert.Equal(t, aggregationTimestamp(20), result.At(0).Timestamp())
+}
+
+func TestAggregateDeltaExponentialHistogram(t *testing.T) {
+	la := newTestLabelAggregator(t, AggregationConfig{MetricRegex: "latency", DropLabels: []string{"pod"}})
+	metrics, metric := newTestAggregationMetrics("latency")
+	hist := metric.SetEmptyExponentialHistogram()
+	hist.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	a := hist.DataPoints().AppendEmpty()
+	a.Attributes().PutStr("pod", "a")
+	a.SetScale(1)
+	a.SetCount(4)
+	a.SetZeroCount(1)
+	a.Positive().SetOffset(0)
+	// Buckets 0-3 at scale 1 become buckets 0-1 at scale 0.
+	a.Positive().BucketCounts().FromRaw([]uint64{1, 1, 0, 1})
+	b := hist.DataPoints().AppendEmpty()
+	b.Attributes().PutStr("pod", "b")
+	b.SetScale(0)
+	b.SetCount(2)
+	b.Positive().SetOffset(1)
+	b.Positive().BucketCounts().FromRaw([]uint64{1, 1})
+
+	result := aggregatedMetric(la.aggregate(metrics)).ExponentialHistogram().DataPoints()
+	require.Equal(t, 1, result.Len())
+	assert.Equal(t, int32(0), result.At(0).Scale())
+	assert.Equal(t, uint64(6), result.At(0).Count())
+	assert.Equal(t, uint64(1), result.At(0).ZeroCount())
+	assert.Equal(t, int32(0), result.At(0).Positive().Offset())
+	assert.Equal(t, []uint64{2, 2, 1}, result.At(0).Positive().BucketCounts().AsRaw())
+}
+
+func TestAggregateSkipsOtherMetrics(t *testing.T) {
+	la := newTestLabelAggregator(t, AggregationConfig{MetricRegex: "^requests$", DropLabels: []string{"pod"}})
+	metrics, metric := newTestAggregationMetrics("other")
+	dps := metric.SetEmptyGauge().DataPoints()
+	for _, pod := range []string{"a", "b"} {
+		dp := dps.AppendEmpty()
+		dp.SetIntValue(1)
+		dp.Attributes().PutStr("pod", pod)
+	}
+	summary := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().AppendEmpty()
+	summary.SetName("requests")
+	for _, pod := range []string{"a", "b"} {
+		summary.SetEmptySummary().DataPoints().AppendEmpty().Attributes().PutStr("pod", pod)
+	}
+
+	assert.Equal(t, metrics, la.aggregate(metrics))
+}
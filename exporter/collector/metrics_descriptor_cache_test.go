@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/api/label"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/descriptorcache"
+)
+
+// newTestDescriptorCacheExporter returns an exporter which persists its
+// metric descriptor cache in dir, and counts the descriptors it creates.
+func newTestDescriptorCacheExporter(t *testing.T, dir string, now time.Time, created *int) *MetricsExporter {
+	cfg := DefaultConfig()
+	cfg.MetricConfig.MetricDescriptorCache = &MetricDescriptorCacheConfig{Directory: dir, TTL: time.Hour}
+	me := &MetricsExporter{
+		cfg:             cfg,
+		mdCache:         make(map[string]*monitoringpb.CreateMetricDescriptorRequest),
+		obs:             selfObservability{log: zap.NewNop()},
+		descriptorCache: descriptorcache.New(dir, time.Hour),
+		client: &mock{
+			createMetricDescriptor: func(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error) {
+				*created++
+				return req.MetricDescriptor, nil
+			},
+		},
+	}
+	me.descriptorCache.Now = func() time.Time { return now }
+	require.NoError(t, me.descriptorCache.Load())
+	return me
+}
+
+func TestMetricDescriptorCachePersistsAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	req := &monitoringpb.CreateMetricDescriptorRequest{
+		Name:             "projects/myproject",
+		MetricDescriptor: &metricpb.MetricDescriptor{Type: "workload.googleapis.com/requests"},
+	}
+	otherProject := &monitoringpb.CreateMetricDescriptorRequest{
+		Name:             "projects/otherproject",
+		MetricDescriptor: &metricpb.MetricDescriptor{Type: "workload.googleapis.com/requests"},
+	}
+
+	created := 0
+	me := newTestDescriptorCacheExporter(t, dir, now, &created)
+	me.exportMetricDescriptor(req)
+	require.Equal(t, 1, created)
+
+	created = 0
+	restarted := newTestDescriptorCacheExporter(t, dir, now.Add(30*time.Minute), &created)
+	restarted.exportMetricDescriptor(req)
+	assert.Equal(t, 0, created, "descriptor created before the restart should not be created again")
+	restarted.exportMetricDescriptor(otherProject)
+	assert.Equal(t, 1, created, "descriptor is cached by project")
+
+	created = 0
+	expired := newTestDescriptorCacheExporter(t, dir, now.Add(2*time.Hour), &created)
+	expired.exportMetricDescriptor(req)
+	assert.Equal(t, 1, created, "descriptor should be created again once the TTL expires")
+}
+
+func TestMetricDescriptorCacheChangedDescriptor(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	req := &monitoringpb.CreateMetricDescriptorRequest{
+		Name:             "projects/myproject",
+		MetricDescriptor: &metricpb.MetricDescriptor{Type: "workload.googleapis.com/requests"},
+	}
+	withLabel := &monitoringpb.CreateMetricDescriptorRequest{
+		Name: "projects/myproject",
+		MetricDescriptor: &metricpb.MetricDescriptor{
+			Type:   "workload.googleapis.com/requests",
+			Labels: []*label.LabelDescriptor{{Key: "method"}},
+		},
+	}
+
+	created := 0
+	me := newTestDescriptorCacheExporter(t, dir, now, &created)
+	me.exportMetricDescriptor(req)
+	require.Equal(t, 1, created)
+
+	created = 0
+	restarted := newTestDescriptorCacheExporter(t, dir, now.Add(time.Minute), &created)
+	restarted.exportMetricDescriptor(withLabel)
+	assert.Equal(t, 1, created, "descriptor with new labels should be created again")
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/api/label"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Conflicts between existing metric descriptors and the descriptors of the
+// metrics written, reported by the metric_descriptor_conflicts metric.
+const (
+	descriptorConflictLabels     = "labels"
+	descriptorConflictMetricKind = "metric_kind"
+	descriptorConflictValueType  = "value_type"
+)
+
+// descriptorConflicts returns the conflicts of the existing descriptor with
+// the desired descriptor, and the labels of desired missing from existing.
+// Labels of existing which desired doesn't have are not conflicts, since
+// time series may omit labels.
+func descriptorConflicts(existing, desired *metricpb.MetricDescriptor) ([]string, []*label.LabelDescriptor) {
+	var conflicts []string
+	if existing.GetMetricKind() != desired.GetMetricKind() {
+		conflicts = append(conflicts, descriptorConflictMetricKind)
+	}
+	if existing.GetValueType() != desired.GetValueType() {
+		conflicts = append(conflicts, descriptorConflictValueType)
+	}
+	missingLabels := missingLabelDescriptors(existing.GetLabels(), desired.GetLabels())
+	if len(missingLabels) > 0 {
+		conflicts = append(conflicts, descriptorConflictLabels)
+	}
+	return conflicts, missingLabels
+}
+
+// descriptorDrifted returns true if the desired descriptor conflicts with the
+// descriptor previously sent for the same metric.
+func descriptorDrifted(previous, desired *metricpb.MetricDescriptor) bool {
+	conflicts, _ := descriptorConflicts(previous, desired)
+	return len(conflicts) > 0
+}
+
+// missingLabelDescriptors returns the labels of desired whose keys are not in
+// existing.
+func missingLabelDescriptors(existing, desired []*label.LabelDescriptor) []*label.LabelDescriptor {
+	keys := make(map[string]struct{}, len(existing))
+	for _, l := range existing {
+		keys[l.GetKey()] = struct{}{}
+	}
+	var missing []*label.LabelDescriptor
+	for _, l := range desired {
+		if _, ok := keys[l.GetKey()]; !ok {
+			missing = append(missing, l)
+			keys[l.GetKey()] = struct{}{}
+		}
+	}
+	return missing
+}
+
+// withMergedLabels returns a copy of req whose descriptor also has the labels
+// of previous which it is missing.
+func withMergedLabels(req *monitoringpb.CreateMetricDescriptorRequest, previous *metricpb.MetricDescriptor) *monitoringpb.CreateMetricDescriptorRequest {
+	merged := proto.Clone(req).(*monitoringpb.CreateMetricDescriptorRequest)
+	merged.MetricDescriptor.Labels = append(merged.MetricDescriptor.Labels, missingLabelDescriptors(merged.MetricDescriptor.Labels, previous.GetLabels())...)
+	return merged
+}
+
+// reconcileMetricDescriptor compares the existing descriptor of the metric
+// with the descriptor of req, and creates it if it doesn't exist. Conflicts are
+// logged and counted. If UpdateLabels is enabled, and only labels conflict,
+// the missing labels are added to the existing descriptor.
+func (me *MetricsExporter) reconcileMetricDescriptor(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest) error {
+	existing, err := me.client.GetMetricDescriptor(ctx, &monitoringpb.GetMetricDescriptorRequest{
+		Name: fmt.Sprintf("%s/metricDescriptors/%s", req.Name, req.MetricDescriptor.Type),
+	})
+	if status.Code(err) == codes.NotFound {
+		_, err = me.client.CreateMetricDescriptor(ctx, req)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	conflicts, missingLabels := descriptorConflicts(existing, req.MetricDescriptor)
+	if len(conflicts) == 0 {
+		return nil
+	}
+	for _, conflict := range conflicts {
+		me.obs.recordDescriptorConflict(ctx, conflict)
+	}
+	if !me.cfg.MetricConfig.DescriptorReconciliation.UpdateLabels || len(conflicts) > 1 || conflicts[0] != descriptorConflictLabels {
+		me.obs.log.Error("Metric descriptor conflicts with the metric written. Writes of the metric may fail.", zap.Strings("conflicts", conflicts), zap.Any("existing_metric_descriptor", existing), zap.Any("metric_descriptor", req.MetricDescriptor))
+		return nil
+	}
+	updated := proto.Clone(existing).(*metricpb.MetricDescriptor)
+	updated.Labels = append(updated.Labels, missingLabels...)
+	me.obs.log.Info("Adding missing labels to metric descriptor.", zap.String("metric_type", updated.Type), zap.Any("labels", missingLabels))
+	_, err = me.client.CreateMetricDescriptor(ctx, &monitoringpb.CreateMetricDescriptorRequest{
+		Name:             req.Name,
+		MetricDescriptor: updated,
+	})
+	return err
+}
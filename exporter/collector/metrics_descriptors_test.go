@@ -0,0 +1,176 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/genproto/googleapis/api/label"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testMetricDescriptor(kind metricpb.MetricDescriptor_MetricKind, valueType metricpb.MetricDescriptor_ValueType, keys ...string) *metricpb.MetricDescriptor {
+	md := &metricpb.MetricDescriptor{
+		Type:       "workload.googleapis.com/requests",
+		MetricKind: kind,
+		ValueType:  valueType,
+	}
+	for _, key := range keys {
+		md.Labels = append(md.Labels, &label.LabelDescriptor{Key: key})
+	}
+	return md
+}
+
+func labelKeys(md *metricpb.MetricDescriptor) []string {
+	var keys []string
+	for _, l := range md.GetLabels() {
+		keys = append(keys, l.GetKey())
+	}
+	return keys
+}
+
+func TestDescriptorConflicts(t *testing.T) {
+	for _, tc := range []struct {
+		desc              string
+		existing          *metricpb.MetricDescriptor
+		desired           *metricpb.MetricDescriptor
+		expectedConflicts []string
+		expectedMissing   []string
+	}{
+		{
+			desc:     "same descriptor",
+			existing: testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "a", "b"),
+			desired:  testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "b", "a"),
+		},
+		{
+			desc:     "fewer labels",
+			existing: testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "a", "b"),
+			desired:  testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "a"),
+		},
+		{
+			desc:              "new labels",
+			existing:          testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "a"),
+			desired:           testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "a", "b", "c"),
+			expectedConflicts: []string{descriptorConflictLabels},
+			expectedMissing:   []string{"b", "c"},
+		},
+		{
+			desc:              "kind and value type",
+			existing:          testMetricDescriptor(metricpb.MetricDescriptor_GAUGE, metricpb.MetricDescriptor_DOUBLE, "a"),
+			desired:           testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "a"),
+			expectedConflicts: []string{descriptorConflictMetricKind, descriptorConflictValueType},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			conflicts, missing := descriptorConflicts(tc.existing, tc.desired)
+			assert.Equal(t, tc.expectedConflicts, conflicts)
+			assert.Equal(t, tc.expectedMissing, labelKeys(&metricpb.MetricDescriptor{Labels: missing}))
+		})
+	}
+}
+
+// newTestReconcilingExporter returns an exporter which reconciles metric
+// descriptors against existing, and the descriptors it creates.
+func newTestReconcilingExporter(t *testing.T, updateLabels bool, existing *metricpb.MetricDescriptor) (*MetricsExporter, *observer.ObservedLogs, *[]*metricpb.MetricDescriptor) {
+	logger, observed := observer.New(zap.DebugLevel)
+	var created []*metricpb.MetricDescriptor
+	cfg := DefaultConfig()
+	cfg.MetricConfig.DescriptorReconciliation = &DescriptorReconciliationConfig{UpdateLabels: updateLabels}
+	me := &MetricsExporter{
+		cfg:     cfg,
+		mdCache: make(map[string]*monitoringpb.CreateMetricDescriptorRequest),
+		obs:     selfObservability{log: zap.New(logger)},
+		client: &mock{
+			getMetricDescriptor: func(ctx context.Context, req *monitoringpb.GetMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error) {
+				assert.Equal(t, "projects/myproject/metricDescriptors/workload.googleapis.com/requests", req.Name)
+				if existing == nil {
+					return nil, status.Error(codes.NotFound, "not found")
+				}
+				return existing, nil
+			},
+			createMetricDescriptor: func(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error) {
+				created = append(created, req.MetricDescriptor)
+				existing = req.MetricDescriptor
+				return req.MetricDescriptor, nil
+			},
+		},
+	}
+	return me, observed, &created
+}
+
+func testCreateMetricDescriptorRequest(md *metricpb.MetricDescriptor) *monitoringpb.CreateMetricDescriptorRequest {
+	return &monitoringpb.CreateMetricDescriptorRequest{Name: "projects/myproject", MetricDescriptor: md}
+}
+
+func TestReconcileMetricDescriptorCreatesMissingDescriptor(t *testing.T) {
+	me, _, created := newTestReconcilingExporter(t, false, nil)
+	me.exportMetricDescriptor(testCreateMetricDescriptorRequest(testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "a")))
+	require.Len(t, *created, 1)
+	assert.Equal(t, []string{"a"}, labelKeys((*created)[0]))
+}
+
+func TestReconcileMetricDescriptorConflicts(t *testing.T) {
+	existing := testMetricDescriptor(metricpb.MetricDescriptor_GAUGE, metricpb.MetricDescriptor_INT64, "a")
+	me, observed, created := newTestReconcilingExporter(t, true, existing)
+	me.exportMetricDescriptor(testCreateMetricDescriptorRequest(testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "a", "b")))
+	assert.Empty(t, *created, "descriptors with conflicting kinds should not be updated")
+	require.Len(t, observed.FilterLevelExact(zap.ErrorLevel).All(), 1)
+}
+
+func TestReconcileMetricDescriptorUpdatesLabels(t *testing.T) {
+	for _, tc := range []struct {
+		desc            string
+		updateLabels    bool
+		expectedCreated [][]string
+	}{
+		{
+			desc:            "update labels",
+			updateLabels:    true,
+			expectedCreated: [][]string{{"a", "b"}, {"a", "b", "c"}},
+		},
+		{
+			desc: "detect only",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			existing := testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, "a")
+			me, _, created := newTestReconcilingExporter(t, tc.updateLabels, existing)
+			for _, keys := range [][]string{
+				{"a", "b"},
+				// Already reconciled.
+				{"a", "b"},
+				{"a"},
+				// Only c is new, but the descriptor keeps b.
+				{"a", "c"},
+			} {
+				me.exportMetricDescriptor(testCreateMetricDescriptorRequest(testMetricDescriptor(metricpb.MetricDescriptor_CUMULATIVE, metricpb.MetricDescriptor_INT64, keys...)))
+			}
+			var createdKeys [][]string
+			for _, md := range *created {
+				createdKeys = append(createdKeys, labelKeys(md))
+			}
+			assert.Equal(t, tc.expectedCreated, createdKeys)
+		})
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"google.golang.org/genproto/googleapis/api/label"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+// Limits enforced by Cloud Monitoring on CreateTimeSeries requests.
+// See https://cloud.google.com/monitoring/quotas#custom_metrics_quotas.
+const (
+	maxLabelKeyLength   = 100
+	maxLabelValueLength = 1024
+	maxLabelsPerMetric  = 30
+)
+
+// Policies for metric labels which exceed Cloud Monitoring's limits.
+const (
+	LabelLimitPolicyTruncate = "truncate"
+	LabelLimitPolicyDrop     = "drop"
+)
+
+// Corrections made to time series before sending them, used in self-observability.
+const (
+	correctionDuplicateSeries = "duplicate_series"
+	correctionLabelTruncated  = "label_truncated"
+	correctionLabelDropped    = "label_dropped"
+)
+
+// enforceLabelLimits truncates or drops metric labels of the time series which
+// exceed Cloud Monitoring's limits, according to the configured policy.
+// Labels beyond the maximum number of labels are dropped, keeping the labels
+// with the lowest keys.
+func (me *MetricsExporter) enforceLabelLimits(ctx context.Context, ts *monitoringpb.TimeSeries) {
+	labels := ts.GetMetric().GetLabels()
+	if len(labels) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	needsCorrection := len(labels) > maxLabelsPerMetric
+	for k, v := range labels {
+		keys = append(keys, k)
+		if len(k) > maxLabelKeyLength || len(v) > maxLabelValueLength {
+			needsCorrection = true
+		}
+	}
+	if !needsCorrection {
+		return
+	}
+	sort.Strings(keys)
+
+	truncated, dropped := 0, 0
+	newLabels := make(map[string]string, len(labels))
+	for _, k := range keys {
+		v := labels[k]
+		if len(k) > maxLabelKeyLength || len(v) > maxLabelValueLength {
+			if me.cfg.MetricConfig.LabelLimitPolicy == LabelLimitPolicyDrop {
+				dropped++
+				continue
+			}
+			k = truncateUTF8(k, maxLabelKeyLength)
+			v = truncateUTF8(v, maxLabelValueLength)
+			if _, exists := newLabels[k]; exists {
+				// The truncated key collides with another label.
+				dropped++
+				continue
+			}
+			truncated++
+		}
+		if len(newLabels) >= maxLabelsPerMetric {
+			dropped++
+			continue
+		}
+		newLabels[k] = v
+	}
+	ts.Metric.Labels = newLabels
+	if truncated > 0 {
+		me.obs.recordRequestCorrection(ctx, truncated, correctionLabelTruncated)
+	}
+	if dropped > 0 {
+		me.obs.recordRequestCorrection(ctx, dropped, correctionLabelDropped)
+	}
+}
+
+// enforceDescriptorLabelLimits truncates or drops the labels of a metric
+// descriptor like enforceLabelLimits does for the labels of its time series,
+// so that the descriptor has the labels which are written. Label values
+// aren't known, so only labels with keys which are too long are truncated or
+// dropped.
+func (me *MetricsExporter) enforceDescriptorLabelLimits(md *metricpb.MetricDescriptor) {
+	labels := md.GetLabels()
+	needsCorrection := len(labels) > maxLabelsPerMetric
+	for _, l := range labels {
+		if len(l.GetKey()) > maxLabelKeyLength {
+			needsCorrection = true
+		}
+	}
+	if !needsCorrection {
+		return
+	}
+	sorted := make([]*label.LabelDescriptor, len(labels))
+	copy(sorted, labels)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetKey() < sorted[j].GetKey() })
+
+	seen := make(map[string]bool, len(sorted))
+	newLabels := make([]*label.LabelDescriptor, 0, len(sorted))
+	for _, l := range sorted {
+		if len(l.GetKey()) > maxLabelKeyLength {
+			if me.cfg.MetricConfig.LabelLimitPolicy == LabelLimitPolicyDrop {
+				continue
+			}
+			key := truncateUTF8(l.GetKey(), maxLabelKeyLength)
+			if seen[key] {
+				// The truncated key collides with another label.
+				continue
+			}
+			l.Key = key
+		}
+		if len(newLabels) >= maxLabelsPerMetric {
+			break
+		}
+		seen[l.GetKey()] = true
+		newLabels = append(newLabels, l)
+	}
+	md.Labels = newLabels
+}
+
+// truncateUTF8 truncates s to at most n bytes, without splitting a UTF-8
+// encoded character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// seriesKey identifies the series of a time series. Cloud Monitoring rejects
+// requests which contain more than one point for the same series.
+func seriesKey(ts *monitoringpb.TimeSeries) string {
+	var b strings.Builder
+	b.WriteString(ts.GetMetric().GetType())
+	writeSortedLabels(&b, ts.GetMetric().GetLabels())
+	b.WriteString(" - ")
+	b.WriteString(ts.GetResource().GetType())
+	writeSortedLabels(&b, ts.GetResource().GetLabels())
+	return b.String()
+}
+
+func writeSortedLabels(b *strings.Builder, labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, " %q=%q", k, labels[k])
+	}
+}
+
+// batchTimeSeries splits time series into batches of at most sendBatchSize
+// time series, such that no batch contains the same series twice. Points for
+// the same series are placed in consecutive batches in their original order,
+// so they are written in order.
+func batchTimeSeries(ctx context.Context, obs selfObservability, tss []*monitoringpb.TimeSeries) [][]*monitoringpb.TimeSeries {
+	var batches [][]*monitoringpb.TimeSeries
+	var batchKeys []map[string]bool
+	// lastBatch is the index of the last batch each series was added to.
+	lastBatch := make(map[string]int)
+	// firstOpen is the index of the first batch which isn't full.
+	firstOpen := 0
+	duplicates := 0
+	for _, ts := range tss {
+		key := seriesKey(ts)
+		i := firstOpen
+		if last, ok := lastBatch[key]; ok {
+			duplicates++
+			if last+1 > i {
+				i = last + 1
+			}
+		}
+		for ; i < len(batches); i++ {
+			if len(batches[i]) < sendBatchSize && !batchKeys[i][key] {
+				break
+			}
+		}
+		if i == len(batches) {
+			batches = append(batches, nil)
+			batchKeys = append(batchKeys, make(map[string]bool))
+		}
+		batches[i] = append(batches[i], ts)
+		batchKeys[i][key] = true
+		lastBatch[key] = i
+		for firstOpen < len(batches) && len(batches[firstOpen]) >= sendBatchSize {
+			firstOpen++
+		}
+	}
+	if duplicates > 0 {
+		obs.recordRequestCorrection(ctx, duplicates, correctionDuplicateSeries)
+	}
+	return batches
+}
+
+// sendOrder groups the indices of batches, as returned by batchTimeSeries,
+// into waves. The batches of a wave can be sent concurrently, once the batches
+// of the previous waves were sent, since they contain no series which has a
+// point in a batch of a later wave.
+func sendOrder(batches [][]*monitoringpb.TimeSeries) [][]int {
+	var waves [][]int
+	// seriesWave is the wave of the last batch containing each series.
+	seriesWave := make(map[string]int)
+	for i, batch := range batches {
+		wave := 0
+		keys := make([]string, len(batch))
+		for j, ts := range batch {
+			keys[j] = seriesKey(ts)
+			if last, ok := seriesWave[keys[j]]; ok && last+1 > wave {
+				wave = last + 1
+			}
+		}
+		for _, key := range keys {
+			seriesWave[key] = wave
+		}
+		for len(waves) <= wave {
+			waves = append(waves, nil)
+		}
+		waves[wave] = append(waves[wave], i)
+	}
+	return waves
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+func testLimitsTimeSeries(metricType string, labels map[string]string) *monitoringpb.TimeSeries {
+	return &monitoringpb.TimeSeries{
+		Metric:   &metricpb.Metric{Type: metricType, Labels: labels},
+		Resource: &monitoredrespb.MonitoredResource{Type: "generic_node", Labels: map[string]string{"node_id": "foo"}},
+	}
+}
+
+func TestEnforceLabelLimits(t *testing.T) {
+	longKey := strings.Repeat("k", maxLabelKeyLength+10)
+	longValue := strings.Repeat("v", maxLabelValueLength+10)
+	manyLabels := make(map[string]string)
+	for i := 0; i < maxLabelsPerMetric+5; i++ {
+		manyLabels[fmt.Sprintf("label_%02d", i)] = "value"
+	}
+	for _, tc := range []struct {
+		labels   map[string]string
+		expected map[string]string
+		desc     string
+		policy   string
+	}{
+		{
+			desc:     "within limits",
+			labels:   map[string]string{"foo": "bar"},
+			expected: map[string]string{"foo": "bar"},
+		},
+		{
+			desc:   "truncate long key and value",
+			labels: map[string]string{longKey: "bar", "foo": longValue},
+			expected: map[string]string{
+				longKey[:maxLabelKeyLength]: "bar",
+				"foo":                       longValue[:maxLabelValueLength],
+			},
+		},
+		{
+			desc:     "drop long key and value",
+			policy:   LabelLimitPolicyDrop,
+			labels:   map[string]string{longKey: "bar", "foo": longValue, "baz": "qux"},
+			expected: map[string]string{"baz": "qux"},
+		},
+		{
+			desc:   "truncation collides with another label",
+			labels: map[string]string{longKey[:maxLabelKeyLength]: "first", longKey: "second"},
+			expected: map[string]string{
+				longKey[:maxLabelKeyLength]: "first",
+			},
+		},
+		{
+			desc:   "too many labels",
+			labels: manyLabels,
+			expected: func() map[string]string {
+				expected := make(map[string]string)
+				for i := 0; i < maxLabelsPerMetric; i++ {
+					expected[fmt.Sprintf("label_%02d", i)] = "value"
+				}
+				return expected
+			}(),
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			me := &MetricsExporter{cfg: DefaultConfig()}
+			me.cfg.MetricConfig.LabelLimitPolicy = tc.policy
+			ts := testLimitsTimeSeries("custom.googleapis.com/foo", tc.labels)
+			me.enforceLabelLimits(context.Background(), ts)
+			assert.Equal(t, tc.expected, ts.Metric.Labels)
+		})
+	}
+}
+
+func TestEnforceDescriptorLabelLimitsMatchesTimeSeries(t *testing.T) {
+	// the long key sorts before the other labels, so it is kept if truncated.
+	longKey := strings.Repeat("a", maxLabelKeyLength+10)
+	for _, policy := range []string{LabelLimitPolicyTruncate, LabelLimitPolicyDrop} {
+		t.Run(policy, func(t *testing.T) {
+			mapper, shutdown := newTestMetricMapper()
+			defer shutdown()
+			me := &MetricsExporter{cfg: mapper.cfg, mapper: mapper}
+			me.cfg.MetricConfig.LabelLimitPolicy = policy
+
+			metric := pmetric.NewMetric()
+			metric.SetName("foo")
+			point := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+			point.SetIntValue(1)
+			for i := 0; i < maxLabelsPerMetric+5; i++ {
+				point.Attributes().PutStr(fmt.Sprintf("label_%02d", i), "value")
+			}
+			point.Attributes().PutStr(longKey, "value")
+
+			tss := me.mapper.metricToTimeSeries(&monitoredrespb.MonitoredResource{}, labels{}, metric, me.cfg.ProjectID)
+			require.Len(t, tss, 1)
+			me.enforceLabelLimits(context.Background(), tss[0])
+			mds := me.mapper.metricDescriptor(metric, labels{})
+			require.Len(t, mds, 1)
+			me.enforceDescriptorLabelLimits(mds[0])
+
+			var descriptorKeys []string
+			for _, l := range mds[0].Labels {
+				descriptorKeys = append(descriptorKeys, l.Key)
+			}
+			var seriesKeys []string
+			for k := range tss[0].Metric.Labels {
+				seriesKeys = append(seriesKeys, k)
+			}
+			assert.Len(t, descriptorKeys, maxLabelsPerMetric)
+			assert.ElementsMatch(t, seriesKeys, descriptorKeys)
+		})
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	assert.Equal(t, "abc", truncateUTF8("abc", 5))
+	assert.Equal(t, "ab", truncateUTF8("abc", 2))
+	// "é" is 2 bytes, so truncating in the middle of it drops it.
+	assert.Equal(t, "a", truncateUTF8("aé", 2))
+}
+
+func TestBatchTimeSeries(t *testing.T) {
+	foo := testLimitsTimeSeries("custom.googleapis.com/foo", map[string]string{"a": "b"})
+	fooAgain := testLimitsTimeSeries("custom.googleapis.com/foo", map[string]string{"a": "b"})
+	fooOtherLabels := testLimitsTimeSeries("custom.googleapis.com/foo", map[string]string{"a": "c"})
+	bar := testLimitsTimeSeries("custom.googleapis.com/bar", nil)
+
+	batches := batchTimeSeries(context.Background(), selfObservability{}, []*monitoringpb.TimeSeries{foo, fooOtherLabels, fooAgain, bar})
+	require.Len(t, batches, 2)
+	assert.Equal(t, []*monitoringpb.TimeSeries{foo, fooOtherLabels, bar}, batches[0])
+	assert.Equal(t, []*monitoringpb.TimeSeries{fooAgain}, batches[1])
+}
+
+func TestBatchTimeSeriesMaxBatchSize(t *testing.T) {
+	var tss []*monitoringpb.TimeSeries
+	for i := 0; i < sendBatchSize+10; i++ {
+		tss = append(tss, testLimitsTimeSeries("custom.googleapis.com/foo", map[string]string{"i": fmt.Sprint(i)}))
+	}
+	// a duplicate of the first series goes in the next batch.
+	tss = append(tss, testLimitsTimeSeries("custom.googleapis.com/foo", map[string]string{"i": "0"}))
+
+	batches := batchTimeSeries(context.Background(), selfObservability{}, tss)
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0], sendBatchSize)
+	assert.Len(t, batches[1], 11)
+	assert.Equal(t, "0", batches[1][10].Metric.Labels["i"])
+}
+
+func TestSendOrder(t *testing.T) {
+	foo := testLimitsTimeSeries("custom.googleapis.com/foo", nil)
+	bar := testLimitsTimeSeries("custom.googleapis.com/bar", nil)
+	baz := testLimitsTimeSeries("custom.googleapis.com/baz", nil)
+
+	batches := [][]*monitoringpb.TimeSeries{
+		{foo, bar},
+		{baz},
+		{foo},
+		{bar, baz},
+		{foo},
+	}
+	assert.Equal(t, [][]int{{0, 1}, {2, 3}, {4}}, sendOrder(batches))
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"regexp"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+// Actions of metric rules.
+const (
+	MetricRuleActionInclude = "include"
+	MetricRuleActionExclude = "exclude"
+)
+
+// Metric kinds which metric rules can pin.
+const (
+	MetricKindGauge      = "gauge"
+	MetricKindCumulative = "cumulative"
+)
+
+// metricRule is a compiled MetricRuleConfig.
+type metricRule struct {
+	metricRegex *regexp.Regexp
+	cfg         MetricRuleConfig
+}
+
+// metricRules determines which metrics are written, and overrides how they
+// are written, according to the first rule matching their name.
+type metricRules struct {
+	rules []metricRule
+}
+
+// newMetricRules compiles the rules, or returns nil if there are none.
+func newMetricRules(cfgs []MetricRuleConfig) (*metricRules, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	rules := make([]metricRule, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		metricRegex, err := regexp.Compile(cfg.MetricRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric_regex %q: %w", cfg.MetricRegex, err)
+		}
+		rules = append(rules, metricRule{metricRegex: metricRegex, cfg: cfg})
+	}
+	return &metricRules{rules: rules}, nil
+}
+
+// ruleFor returns the first rule which matches the metric name, or nil.
+func (mr *metricRules) ruleFor(name string) *metricRule {
+	if mr == nil {
+		return nil
+	}
+	for i := range mr.rules {
+		if mr.rules[i].metricRegex.MatchString(name) {
+			return &mr.rules[i]
+		}
+	}
+	return nil
+}
+
+// excluded returns true if metrics matching the rule are not written.
+func (r *metricRule) excluded() bool {
+	return r != nil && r.cfg.Action == MetricRuleActionExclude
+}
+
+// metricKind returns the kind pinned by the rule, or "" if there is none.
+func (r *metricRule) metricKind() string {
+	if r == nil {
+		return ""
+	}
+	return r.cfg.MetricKind
+}
+
+// metricType returns the metric type the rule renames the metric named name
+// to, and whether it renames it. suffix is appended to the type, for the
+// additional metrics written for summaries.
+func (r *metricRule) metricType(name, suffix string) (string, bool) {
+	if r == nil || r.cfg.MetricType == "" {
+		return "", false
+	}
+	match := r.metricRegex.FindStringSubmatchIndex(name)
+	return string(r.metricRegex.ExpandString(nil, r.cfg.MetricType, name, match)) + suffix, true
+}
+
+// applyToTimeSeries applies the unit and kind overrides of the rule to ts.
+func (r *metricRule) applyToTimeSeries(ts *monitoringpb.TimeSeries) {
+	if r == nil {
+		return
+	}
+	if r.cfg.Unit != "" {
+		ts.Unit = r.cfg.Unit
+	}
+	if r.cfg.MetricKind == MetricKindGauge && ts.MetricKind != metricpb.MetricDescriptor_GAUGE {
+		ts.MetricKind = metricpb.MetricDescriptor_GAUGE
+		// Gauge points are written without a start time.
+		for _, point := range ts.Points {
+			point.Interval.StartTime = nil
+		}
+	}
+}
+
+// applyToDescriptor applies the overrides of the rule to md. suffix is
+// appended to the display name, for the additional metrics written for
+// summaries.
+func (r *metricRule) applyToDescriptor(md *metricpb.MetricDescriptor, suffix string) {
+	if r == nil {
+		return
+	}
+	if r.cfg.Unit != "" {
+		md.Unit = r.cfg.Unit
+	}
+	if r.cfg.Description != "" {
+		md.Description = r.cfg.Description
+	}
+	if r.cfg.DisplayName != "" {
+		md.DisplayName = r.cfg.DisplayName + suffix
+	}
+	if r.cfg.MetricKind == MetricKindGauge {
+		md.MetricKind = metricpb.MetricDescriptor_GAUGE
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+func newTestRulesMetricMapper(t *testing.T, cfgs ...MetricRuleConfig) metricMapper {
+	mapper, shutdown := newTestMetricMapper()
+	t.Cleanup(shutdown)
+	rules, err := newMetricRules(cfgs)
+	require.NoError(t, err)
+	mapper.rules = rules
+	return mapper
+}
+
+func newTestRulesSum(name string, monotonic bool) pmetric.Metric {
+	metric := pmetric.NewMetric()
+	metric.SetName(name)
+	metric.SetUnit("1")
+	metric.SetDescription("original description")
+	sum := metric.SetEmptySum()
+	sum.SetIsMonotonic(monotonic)
+	sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	point := sum.DataPoints().AppendEmpty()
+	point.SetIntValue(10)
+	point.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	point.SetTimestamp(pcommon.NewTimestampFromTime(start.Add(time.Second)))
+	return metric
+}
+
+func TestMetricRulesExclude(t *testing.T) {
+	mapper := newTestRulesMetricMapper(t,
+		MetricRuleConfig{MetricRegex: "^keep\\.", Action: MetricRuleActionInclude},
+		MetricRuleConfig{MetricRegex: ".*", Action: MetricRuleActionExclude},
+	)
+	mr := &monitoredrespb.MonitoredResource{}
+
+	kept := newTestRulesSum("keep.requests", true)
+	assert.Len(t, mapper.metricToTimeSeries(mr, labels{}, kept, mapper.cfg.ProjectID), 1)
+	assert.Len(t, mapper.metricDescriptor(kept, labels{}), 1)
+
+	dropped := newTestRulesSum("other.requests", true)
+	assert.Empty(t, mapper.metricToTimeSeries(mr, labels{}, dropped, mapper.cfg.ProjectID))
+	assert.Empty(t, mapper.metricDescriptor(dropped, labels{}))
+}
+
+func TestMetricRulesUnmatchedMetricsUnchanged(t *testing.T) {
+	mapper := newTestRulesMetricMapper(t, MetricRuleConfig{
+		MetricRegex: "^other$",
+		MetricType:  "custom.googleapis.com/renamed",
+		Unit:        "By",
+	})
+	metric := newTestRulesSum("requests", true)
+	tss := mapper.metricToTimeSeries(&monitoredrespb.MonitoredResource{}, labels{}, metric, mapper.cfg.ProjectID)
+	require.Len(t, tss, 1)
+	assert.Equal(t, "workload.googleapis.com/requests", tss[0].Metric.Type)
+	assert.Equal(t, "1", tss[0].Unit)
+}
+
+func TestMetricRulesOverrides(t *testing.T) {
+	mapper := newTestRulesMetricMapper(t, MetricRuleConfig{
+		MetricRegex: "^app\\.(.*)$",
+		MetricType:  "custom.googleapis.com/app/$1",
+		Unit:        "{request}",
+		Description: "Requests served",
+		DisplayName: "Requests",
+	})
+	metric := newTestRulesSum("app.requests", true)
+
+	tss := mapper.metricToTimeSeries(&monitoredrespb.MonitoredResource{}, labels{}, metric, mapper.cfg.ProjectID)
+	require.Len(t, tss, 1)
+	assert.Equal(t, "custom.googleapis.com/app/requests", tss[0].Metric.Type)
+	assert.Equal(t, "{request}", tss[0].Unit)
+	assert.Equal(t, metricpb.MetricDescriptor_CUMULATIVE, tss[0].MetricKind)
+
+	mds := mapper.metricDescriptor(metric, labels{})
+	require.Len(t, mds, 1)
+	assert.Equal(t, "custom.googleapis.com/app/requests", mds[0].Type)
+	assert.Equal(t, "{request}", mds[0].Unit)
+	assert.Equal(t, "Requests served", mds[0].Description)
+	assert.Equal(t, "Requests", mds[0].DisplayName)
+}
+
+func TestMetricRulesSummaryOverrides(t *testing.T) {
+	mapper := newTestRulesMetricMapper(t, MetricRuleConfig{
+		MetricRegex: "^latency$",
+		MetricType:  "custom.googleapis.com/rpc_latency",
+		DisplayName: "RPC latency",
+	})
+	metric := pmetric.NewMetric()
+	metric.SetName("latency")
+	point := metric.SetEmptySummary().DataPoints().AppendEmpty()
+	point.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	point.SetTimestamp(pcommon.NewTimestampFromTime(start.Add(time.Second)))
+	point.SetCount(2)
+	point.SetSum(3)
+
+	var types []string
+	for _, ts := range mapper.metricToTimeSeries(&monitoredrespb.MonitoredResource{}, labels{}, metric, mapper.cfg.ProjectID) {
+		types = append(types, ts.Metric.Type)
+	}
+	assert.Equal(t, []string{
+		"custom.googleapis.com/rpc_latency" + SummarySumSuffix,
+		"custom.googleapis.com/rpc_latency" + SummaryCountPrefix,
+	}, types)
+
+	var displayNames []string
+	for _, md := range mapper.metricDescriptor(metric, labels{}) {
+		displayNames = append(displayNames, md.DisplayName)
+	}
+	assert.Equal(t, []string{
+		"RPC latency" + SummarySumSuffix,
+		"RPC latency" + SummaryCountPrefix,
+		"RPC latency",
+	}, displayNames)
+}
+
+func TestMetricRulesMetricKind(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		metricKind   string
+		monotonic    bool
+		expectedKind metricpb.MetricDescriptor_MetricKind
+		hasStartTime bool
+	}{
+		{
+			desc:         "monotonic sum pinned to gauge",
+			metricKind:   MetricKindGauge,
+			monotonic:    true,
+			expectedKind: metricpb.MetricDescriptor_GAUGE,
+		},
+		{
+			desc:         "non-monotonic sum pinned to cumulative",
+			metricKind:   MetricKindCumulative,
+			expectedKind: metricpb.MetricDescriptor_CUMULATIVE,
+			hasStartTime: true,
+		},
+		{
+			desc:         "non-monotonic sum without pinned kind",
+			expectedKind: metricpb.MetricDescriptor_GAUGE,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			mapper := newTestRulesMetricMapper(t, MetricRuleConfig{
+				MetricRegex: "^queue_size$",
+				MetricKind:  tc.metricKind,
+			})
+			metric := newTestRulesSum("queue_size", tc.monotonic)
+
+			tss := mapper.metricToTimeSeries(&monitoredrespb.MonitoredResource{}, labels{}, metric, mapper.cfg.ProjectID)
+			require.Len(t, tss, 1)
+			assert.Equal(t, tc.expectedKind, tss[0].MetricKind)
+			assert.Equal(t, tc.hasStartTime, tss[0].Points[0].Interval.StartTime != nil)
+
+			mds := mapper.metricDescriptor(metric, labels{})
+			require.Len(t, mds, 1)
+			assert.Equal(t, tc.expectedKind, mds[0].MetricKind)
+		})
+	}
+}
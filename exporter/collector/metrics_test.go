@@ -16,9 +16,13 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -32,16 +36,21 @@ import (
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/genproto/googleapis/api/distribution"
 	"google.golang.org/genproto/googleapis/api/label"
 	metricpb "google.golang.org/genproto/googleapis/api/metric"
 	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/datapointstorage"
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/normalization"
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/resourcemapping"
 )
 
 var (
@@ -54,21 +63,31 @@ func newTestMetricMapper() (metricMapper, func()) {
 	cfg := DefaultConfig()
 	cfg.MetricConfig.EnableSumOfSquaredDeviation = true
 	return metricMapper{
-		obs:        obs,
-		cfg:        cfg,
-		normalizer: normalization.NewStandardNormalizer(s, zap.NewNop()),
+		obs:              obs,
+		cfg:              cfg,
+		normalizer:       normalization.NewStandardNormalizer(s, zap.NewNop(), datapointstorage.Config{}),
+		deltaAccumulator: normalization.NewDisabledDeltaAccumulator(),
 	}, func() { close(s) }
 }
 
 type mock struct {
 	monitoringClient
 	createMetricDescriptor func(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error)
+	getMetricDescriptor    func(ctx context.Context, req *monitoringpb.GetMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error)
 }
 
 func (m *mock) CreateMetricDescriptor(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error) {
 	return m.createMetricDescriptor(ctx, req)
 }
 
+func (m *mock) GetMetricDescriptor(ctx context.Context, req *monitoringpb.GetMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error) {
+	return m.getMetricDescriptor(ctx, req)
+}
+
+func (m *mock) Close() error {
+	return nil
+}
+
 func TestExportCreateMetricDescriptorCache(t *testing.T) {
 	for _, tc := range []struct {
 		reqs                            []*monitoringpb.CreateMetricDescriptorRequest
@@ -409,7 +428,7 @@ func TestHistogramPointToTimeSeries(t *testing.T) {
 	floatExemplar.SetSpanID([8]byte{0, 1, 2, 3, 4, 5, 6, 7})
 	floatExemplar.FilteredAttributes().PutStr("test", "extra")
 
-	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID)
+	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID, nil)
 	assert.Len(t, tsl, 1)
 	ts := tsl[0]
 	// Verify aspects
@@ -602,6 +621,99 @@ func TestHistogramPointWithoutTimestampToTimeSeries(t *testing.T) {
 	assert.Equal(t, map[string]string{"test": "extra"}, dropped.Label)
 }
 
+func TestExemplarAttachments(t *testing.T) {
+	traceID := [16]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 1, 2, 3, 4, 5, 6}
+	spanID := [8]byte{0, 1, 2, 3, 4, 5, 6, 7}
+	for _, tc := range []struct {
+		desc                  string
+		traceProjectAttribute string
+		withSpanContext       bool
+		attributes            map[string]string
+		expectedSpanName      string
+		expectedDroppedLabels map[string]string
+	}{
+		{
+			desc:                  "without span context",
+			attributes:            map[string]string{"test": "extra"},
+			expectedDroppedLabels: map[string]string{"test": "extra"},
+		},
+		{
+			desc:             "trace in metric project",
+			withSpanContext:  true,
+			expectedSpanName: "projects/myproject/traces/00010203040506070809010203040506/spans/0001020304050607",
+		},
+		{
+			desc:                  "trace project attribute not configured",
+			withSpanContext:       true,
+			attributes:            map[string]string{"gcp.project.id": "traceproject"},
+			expectedSpanName:      "projects/myproject/traces/00010203040506070809010203040506/spans/0001020304050607",
+			expectedDroppedLabels: map[string]string{"gcp_project_id": "traceproject"},
+		},
+		{
+			desc:                  "trace in other project",
+			traceProjectAttribute: "gcp.project.id",
+			withSpanContext:       true,
+			attributes:            map[string]string{"gcp.project.id": "traceproject"},
+			expectedSpanName:      "projects/traceproject/traces/00010203040506070809010203040506/spans/0001020304050607",
+		},
+		{
+			desc:                  "trace project attribute removed from other attributes",
+			traceProjectAttribute: "gcp.project.id",
+			withSpanContext:       true,
+			attributes:            map[string]string{"gcp.project.id": "traceproject", "test": "extra"},
+			expectedSpanName:      "projects/traceproject/traces/00010203040506070809010203040506/spans/0001020304050607",
+			expectedDroppedLabels: map[string]string{"test": "extra"},
+		},
+		{
+			desc:                  "trace project attribute kept without span context",
+			traceProjectAttribute: "gcp.project.id",
+			attributes:            map[string]string{"gcp.project.id": "traceproject"},
+			expectedDroppedLabels: map[string]string{"gcp_project_id": "traceproject"},
+		},
+		{
+			desc:                  "trace project attribute missing",
+			traceProjectAttribute: "gcp.project.id",
+			withSpanContext:       true,
+			expectedSpanName:      "projects/myproject/traces/00010203040506070809010203040506/spans/0001020304050607",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			mapper, shutdown := newTestMetricMapper()
+			defer shutdown()
+			mapper.cfg.MetricConfig.ExemplarTraceProjectAttribute = tc.traceProjectAttribute
+			exemplar := pmetric.NewExemplar()
+			exemplar.SetDoubleValue(2)
+			exemplar.SetTimestamp(pcommon.NewTimestampFromTime(start))
+			if tc.withSpanContext {
+				exemplar.SetTraceID(traceID)
+				exemplar.SetSpanID(spanID)
+			}
+			for k, v := range tc.attributes {
+				exemplar.FilteredAttributes().PutStr(k, v)
+			}
+
+			ex := mapper.exemplar(exemplar, "myproject")
+			assert.Equal(t, float64(2), ex.Value)
+			var spanName string
+			var droppedLabels map[string]string
+			for _, attachment := range ex.Attachments {
+				spanctx := &monitoringpb.SpanContext{}
+				dropped := &monitoringpb.DroppedLabels{}
+				switch {
+				case attachment.UnmarshalTo(spanctx) == nil:
+					spanName = spanctx.SpanName
+				case attachment.UnmarshalTo(dropped) == nil:
+					droppedLabels = dropped.Label
+				default:
+					t.Errorf("unexpected attachment %v", attachment)
+				}
+			}
+			assert.Equal(t, tc.expectedSpanName, spanName)
+			assert.Equal(t, tc.expectedDroppedLabels, droppedLabels)
+		})
+	}
+}
+
 func TestNoValueHistogramPointToTimeSeries(t *testing.T) {
 	mapper, shutdown := newTestMetricMapper()
 	defer shutdown()
@@ -622,7 +734,7 @@ func TestNoValueHistogramPointToTimeSeries(t *testing.T) {
 	point.SetSum(42)
 	point.ExplicitBounds().FromRaw([]float64{10, 20, 30, 40})
 
-	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID)
+	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID, nil)
 	// Points without a value are dropped
 	assert.Len(t, tsl, 0)
 }
@@ -646,7 +758,7 @@ func TestNoSumHistogramPointToTimeSeries(t *testing.T) {
 	// Leave the sum unset
 	point.ExplicitBounds().FromRaw([]float64{10, 20, 30, 40})
 
-	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID)
+	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID, nil)
 	// Points without a sum are dropped
 	assert.Len(t, tsl, 0)
 }
@@ -670,7 +782,7 @@ func TestEmptyHistogramPointToTimeSeries(t *testing.T) {
 	point.SetSum(0)
 	point.ExplicitBounds().FromRaw([]float64{10, 20, 30, 40})
 
-	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID)
+	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID, nil)
 	assert.Len(t, tsl, 1)
 	ts := tsl[0]
 	// Verify aspects
@@ -716,7 +828,7 @@ func TestNaNSumHistogramPointToTimeSeries(t *testing.T) {
 	point.SetSum(math.NaN())
 	point.ExplicitBounds().FromRaw([]float64{10, 20, 30, 40})
 
-	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID)
+	tsl := mapper.histogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID, nil)
 	assert.Len(t, tsl, 1)
 	ts := tsl[0]
 	// Verify aspects
@@ -794,11 +906,10 @@ func TestExponentialHistogramPointToTimeSeries(t *testing.T) {
 	}, ts.Points[0].Interval)
 	hdp := ts.Points[0].Value.GetDistributionValue()
 	assert.Equal(t, int64(21), hdp.Count)
-	assert.ElementsMatch(t, []int64{15, 1, 2, 3, 0}, hdp.BucketCounts)
+	// Negative buckets are sent as explicit buckets, mirroring the positive buckets.
+	assert.Equal(t, []int64{0, 5, 4, 6, 1, 2, 3, 0}, hdp.BucketCounts)
 	assert.Equal(t, float64(2), hdp.Mean)
-	assert.Equal(t, float64(4), hdp.BucketOptions.GetExponentialBuckets().GrowthFactor)
-	assert.Equal(t, float64(1), hdp.BucketOptions.GetExponentialBuckets().Scale)
-	assert.Equal(t, int32(3), hdp.BucketOptions.GetExponentialBuckets().NumFiniteBuckets)
+	assert.Equal(t, []float64{-16, -4, -1, 1, 4, 16, 64}, hdp.BucketOptions.GetExplicitBuckets().Bounds)
 	assert.Len(t, hdp.Exemplars, 1)
 	ex := hdp.Exemplars[0]
 	assert.Equal(t, float64(2), ex.Value)
@@ -908,11 +1019,9 @@ func TestExponentialHistogramPointWithoutStartTimeToTimeSeries(t *testing.T) {
 	}, ts.Points[0].Interval)
 	hdp := ts.Points[0].Value.GetDistributionValue()
 	assert.Equal(t, int64(23), hdp.Count)
-	assert.ElementsMatch(t, []int64{16, 1, 1, 2, 3, 0}, hdp.BucketCounts)
+	assert.Equal(t, []int64{0, 5, 4, 1, 6, 1, 1, 2, 3, 0}, hdp.BucketCounts)
 	assert.Equal(t, float64(2), hdp.Mean)
-	assert.Equal(t, float64(4), hdp.BucketOptions.GetExponentialBuckets().GrowthFactor)
-	assert.Equal(t, float64(4), hdp.BucketOptions.GetExponentialBuckets().Scale)
-	assert.Equal(t, int32(4), hdp.BucketOptions.GetExponentialBuckets().NumFiniteBuckets)
+	assert.Equal(t, []float64{-64, -16, -4, -1, 4, 16, 64, 256, 1024}, hdp.BucketOptions.GetExplicitBuckets().Bounds)
 	assert.Len(t, hdp.Exemplars, 1)
 	ex := hdp.Exemplars[0]
 	assert.Equal(t, float64(2), ex.Value)
@@ -948,11 +1057,9 @@ func TestExponentialHistogramPointWithoutStartTimeToTimeSeries(t *testing.T) {
 	}, ts.Points[0].Interval)
 	hdp = ts.Points[0].Value.GetDistributionValue()
 	assert.Equal(t, int64(31), hdp.Count)
-	assert.ElementsMatch(t, []int64{20, 1, 1, 2, 3, 4, 0}, hdp.BucketCounts)
+	assert.Equal(t, []int64{0, 6, 5, 1, 8, 1, 1, 2, 3, 4, 0}, hdp.BucketCounts)
 	assert.Equal(t, float64(2), hdp.Mean)
-	assert.Equal(t, float64(4), hdp.BucketOptions.GetExponentialBuckets().GrowthFactor)
-	assert.Equal(t, float64(1), hdp.BucketOptions.GetExponentialBuckets().Scale)
-	assert.Equal(t, int32(5), hdp.BucketOptions.GetExponentialBuckets().NumFiniteBuckets)
+	assert.Equal(t, []float64{-64, -16, -4, -1, 1, 4, 16, 64, 256, 1024}, hdp.BucketOptions.GetExplicitBuckets().Bounds)
 	assert.Len(t, hdp.Exemplars, 1)
 	ex = hdp.Exemplars[0]
 	assert.Equal(t, float64(2), ex.Value)
@@ -969,6 +1076,134 @@ func TestExponentialHistogramPointWithoutStartTimeToTimeSeries(t *testing.T) {
 	assert.Equal(t, map[string]string{"test": "extra"}, dropped.Label)
 }
 
+func TestExponentialHistogramPointWithoutStartTimeScaleChange(t *testing.T) {
+	mapper, shutdown := newTestMetricMapper()
+	defer shutdown()
+	newPoint := func(ts time.Time, scale int32, posOffset int32, pos []uint64, negOffset int32, neg []uint64, zeroCount, count uint64, sum float64) pmetric.ExponentialHistogramDataPoint {
+		point := pmetric.NewExponentialHistogramDataPoint()
+		// Omit start timestamp
+		point.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+		point.SetScale(scale)
+		point.Positive().SetOffset(posOffset)
+		point.Positive().BucketCounts().FromRaw(pos)
+		point.Negative().SetOffset(negOffset)
+		point.Negative().BucketCounts().FromRaw(neg)
+		point.SetZeroCount(zeroCount)
+		point.SetCount(count)
+		point.SetSum(sum)
+		return point
+	}
+
+	// First point will be dropped, since it has no start time.
+	_, keep := mapper.normalizer.NormalizeExponentialHistogramDataPoint(
+		newPoint(start, 1, 1, []uint64{1, 2, 3, 4}, -3, []uint64{1, 1}, 2, 14, 20), "id")
+	require.False(t, keep)
+
+	// The SDK downscaled the histogram. The start point is downscaled to
+	// match: positive [0:1, 1:5, 2:4], negative [-2:1, -1:1].
+	end := start.Add(time.Hour)
+	point, keep := mapper.normalizer.NormalizeExponentialHistogramDataPoint(
+		newPoint(end, 0, 0, []uint64{2, 7, 6}, -2, []uint64{2, 3}, 5, 25, 50), "id")
+	require.True(t, keep)
+	assert.Equal(t, pcommon.NewTimestampFromTime(start), point.StartTimestamp())
+	assert.Equal(t, int32(0), point.Scale())
+	assert.Equal(t, int32(0), point.Positive().Offset())
+	assert.Equal(t, []uint64{1, 2, 2}, point.Positive().BucketCounts().AsRaw())
+	assert.Equal(t, int32(-2), point.Negative().Offset())
+	assert.Equal(t, []uint64{1, 2}, point.Negative().BucketCounts().AsRaw())
+	assert.Equal(t, uint64(3), point.ZeroCount())
+	assert.Equal(t, uint64(11), point.Count())
+	assert.Equal(t, float64(30), point.Sum())
+
+	// A point with a higher scale than the start point is downscaled to the
+	// scale of the start point: positive [0:2, 1:8, 2:7], negative [-2:2, -1:4].
+	end2 := end.Add(time.Hour)
+	point, keep = mapper.normalizer.NormalizeExponentialHistogramDataPoint(
+		newPoint(end2, 1, 0, []uint64{1, 1, 4, 4, 3, 4}, -4, []uint64{1, 1, 2, 2}, 6, 32, 60), "id")
+	require.True(t, keep)
+	assert.Equal(t, pcommon.NewTimestampFromTime(start), point.StartTimestamp())
+	assert.Equal(t, int32(0), point.Scale())
+	assert.Equal(t, int32(0), point.Positive().Offset())
+	assert.Equal(t, []uint64{1, 3, 3}, point.Positive().BucketCounts().AsRaw())
+	assert.Equal(t, int32(-2), point.Negative().Offset())
+	assert.Equal(t, []uint64{1, 3}, point.Negative().BucketCounts().AsRaw())
+	assert.Equal(t, uint64(4), point.ZeroCount())
+	assert.Equal(t, uint64(18), point.Count())
+	assert.Equal(t, float64(40), point.Sum())
+}
+
+func TestExponentialHistogramPointDownscaledToMaxBuckets(t *testing.T) {
+	mapper, shutdown := newTestMetricMapper()
+	defer shutdown()
+	mapper.cfg.MetricConfig.ExponentialHistogramMaxBuckets = 5
+	point := pmetric.NewExponentialHistogramDataPoint()
+	point.SetScale(2)
+	point.SetCount(10)
+	point.SetSum(10)
+	point.Positive().SetOffset(1)
+	// Buckets 1-6 at scale 2 become buckets 0-1 at scale 0.
+	point.Positive().BucketCounts().FromRaw([]uint64{1, 1, 1, 2, 2, 3})
+
+	hdp := mapper.exponentialHistogramPoint(point, "myproject").GetDistributionValue()
+	assert.Equal(t, []int64{0, 3, 7, 0}, hdp.BucketCounts)
+	assert.Equal(t, float64(2), hdp.BucketOptions.GetExponentialBuckets().GrowthFactor)
+	assert.Equal(t, float64(1), hdp.BucketOptions.GetExponentialBuckets().Scale)
+	assert.Equal(t, int32(2), hdp.BucketOptions.GetExponentialBuckets().NumFiniteBuckets)
+	// The point is not modified.
+	assert.Equal(t, int32(2), point.Scale())
+
+	// Histograms with fewer buckets are not downscaled.
+	mapper.cfg.MetricConfig.ExponentialHistogramMaxBuckets = 0
+	hdp = mapper.exponentialHistogramPoint(point, "myproject").GetDistributionValue()
+	assert.Equal(t, []int64{0, 1, 1, 1, 2, 2, 3, 0}, hdp.BucketCounts)
+	assert.Equal(t, math.Exp2(0.25), hdp.BucketOptions.GetExponentialBuckets().GrowthFactor)
+}
+
+func TestExponentialHistogramPointWithNegativeBucketsDownscaled(t *testing.T) {
+	mapper, shutdown := newTestMetricMapper()
+	defer shutdown()
+	mapper.cfg.MetricConfig.ExponentialHistogramMaxBuckets = 7
+	point := pmetric.NewExponentialHistogramDataPoint()
+	point.SetScale(1)
+	point.SetCount(9)
+	point.SetZeroCount(1)
+	point.Negative().BucketCounts().FromRaw([]uint64{1, 1, 1, 1})
+	point.Positive().BucketCounts().FromRaw([]uint64{1, 1, 2})
+
+	hdp := mapper.exponentialHistogramPoint(point, "myproject").GetDistributionValue()
+	// At scale 0, there are 2 negative and 2 positive buckets, in addition
+	// to the underflow, zero, and overflow buckets.
+	assert.Equal(t, []int64{0, 2, 2, 1, 2, 2, 0}, hdp.BucketCounts)
+	assert.Equal(t, []float64{-4, -2, -1, 1, 2, 4}, hdp.BucketOptions.GetExplicitBuckets().Bounds)
+}
+
+func TestHistogramPointRange(t *testing.T) {
+	mapper, shutdown := newTestMetricMapper()
+	defer shutdown()
+
+	hist := pmetric.NewHistogramDataPoint()
+	hist.SetCount(2)
+	hist.SetSum(3)
+	hist.ExplicitBounds().FromRaw([]float64{1})
+	hist.BucketCounts().FromRaw([]uint64{1, 1})
+	assert.Nil(t, mapper.histogramPoint(hist, "myproject").GetDistributionValue().Range)
+	hist.SetMin(0.5)
+	hist.SetMax(2.5)
+	assert.Equal(t, &distribution.Distribution_Range{Min: 0.5, Max: 2.5}, mapper.histogramPoint(hist, "myproject").GetDistributionValue().Range)
+
+	expHist := pmetric.NewExponentialHistogramDataPoint()
+	expHist.SetCount(2)
+	expHist.SetSum(3)
+	expHist.Positive().BucketCounts().FromRaw([]uint64{1, 1})
+	expHist.SetMin(1.5)
+	expHist.SetMax(2.5)
+	assert.Equal(t, &distribution.Distribution_Range{Min: 1.5, Max: 2.5}, mapper.exponentialHistogramPoint(expHist, "myproject").GetDistributionValue().Range)
+
+	// The range must not be set for empty distributions.
+	expHist.SetCount(0)
+	assert.Nil(t, mapper.exponentialHistogramPoint(expHist, "myproject").GetDistributionValue().Range)
+}
+
 func TestNaNSumExponentialHistogramPointToTimeSeries(t *testing.T) {
 	mapper, shutdown := newTestMetricMapper()
 	defer shutdown()
@@ -990,7 +1225,7 @@ func TestNaNSumExponentialHistogramPointToTimeSeries(t *testing.T) {
 	point.SetScale(-1)
 	point.SetSum(math.NaN())
 
-	tsl := mapper.exponentialHistogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID)
+	tsl := mapper.exponentialHistogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID, nil)
 	assert.Len(t, tsl, 1)
 	ts := tsl[0]
 	// Verify aspects
@@ -1011,11 +1246,9 @@ func TestNaNSumExponentialHistogramPointToTimeSeries(t *testing.T) {
 	}, ts.Points[0].Interval)
 	hdp := ts.Points[0].Value.GetDistributionValue()
 	assert.Equal(t, int64(21), hdp.Count)
-	assert.ElementsMatch(t, []int64{15, 1, 2, 3, 0}, hdp.BucketCounts)
+	assert.Equal(t, []int64{0, 5, 4, 6, 1, 2, 3, 0}, hdp.BucketCounts)
 	assert.Equal(t, float64(0), hdp.Mean)
-	assert.Equal(t, float64(4), hdp.BucketOptions.GetExponentialBuckets().GrowthFactor)
-	assert.Equal(t, float64(1), hdp.BucketOptions.GetExponentialBuckets().Scale)
-	assert.Equal(t, int32(3), hdp.BucketOptions.GetExponentialBuckets().NumFiniteBuckets)
+	assert.Equal(t, []float64{-16, -4, -1, 1, 4, 16, 64}, hdp.BucketOptions.GetExplicitBuckets().Bounds)
 }
 
 func TestZeroCountExponentialHistogramPointToTimeSeries(t *testing.T) {
@@ -1039,7 +1272,7 @@ func TestZeroCountExponentialHistogramPointToTimeSeries(t *testing.T) {
 	point.SetScale(-1)
 	point.SetSum(0)
 
-	tsl := mapper.exponentialHistogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID)
+	tsl := mapper.exponentialHistogramToTimeSeries(mr, labels{}, metric, hist, point, mapper.cfg.ProjectID, nil)
 	assert.Len(t, tsl, 1)
 	ts := tsl[0]
 	// Verify aspects
@@ -1176,7 +1409,7 @@ func TestSumPointToTimeSeries(t *testing.T) {
 		point.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
 		point.SetTimestamp(pcommon.NewTimestampFromTime(end))
 
-		tsl := mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point)
+		tsl := mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point, nil)
 		assert.Equal(t, 1, len(tsl))
 		ts := tsl[0]
 		assert.Equal(t, ts.MetricKind, metricpb.MetricDescriptor_CUMULATIVE)
@@ -1198,7 +1431,7 @@ func TestSumPointToTimeSeries(t *testing.T) {
 
 		// Test double as well
 		point.SetDoubleValue(float64(value))
-		tsl = mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point)
+		tsl = mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point, nil)
 		assert.Equal(t, 1, len(tsl))
 		ts = tsl[0]
 		assert.Equal(t, ts.MetricKind, metricpb.MetricDescriptor_CUMULATIVE)
@@ -1217,7 +1450,7 @@ func TestSumPointToTimeSeries(t *testing.T) {
 		point.SetTimestamp(pcommon.NewTimestampFromTime(end))
 
 		// Should output a "pseudo-cumulative" with same interval as the delta
-		tsl := mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point)
+		tsl := mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point, nil)
 		assert.Equal(t, 1, len(tsl))
 		ts := tsl[0]
 		assert.Equal(t, ts.MetricKind, metricpb.MetricDescriptor_CUMULATIVE)
@@ -1238,7 +1471,7 @@ func TestSumPointToTimeSeries(t *testing.T) {
 		point.SetTimestamp(pcommon.NewTimestampFromTime(end))
 
 		// Should output a gauge regardless of temporality, only setting end time
-		tsl := mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point)
+		tsl := mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point, nil)
 		assert.Equal(t, 1, len(tsl))
 		ts := tsl[0]
 		assert.Equal(t, ts.MetricKind, metricpb.MetricDescriptor_GAUGE)
@@ -1247,7 +1480,7 @@ func TestSumPointToTimeSeries(t *testing.T) {
 		})
 
 		sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
-		tsl = mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point)
+		tsl = mapper.sumPointToTimeSeries(mr, labels{}, metric, sum, point, nil)
 		assert.Equal(t, 1, len(tsl))
 		ts = tsl[0]
 		assert.Equal(t, ts.MetricKind, metricpb.MetricDescriptor_GAUGE)
@@ -1262,14 +1495,14 @@ func TestSumPointToTimeSeries(t *testing.T) {
 		point.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
 		point.SetTimestamp(pcommon.NewTimestampFromTime(end))
 		extraLabels := map[string]string{"foo": "bar"}
-		tsl := mapper.sumPointToTimeSeries(mr, extraLabels, metric, sum, point)
+		tsl := mapper.sumPointToTimeSeries(mr, extraLabels, metric, sum, point, nil)
 		assert.Equal(t, 1, len(tsl))
 		ts := tsl[0]
 		assert.Equal(t, ts.Metric.Labels, extraLabels)
 
 		// Full set of labels
 		point.Attributes().PutStr("baz", "bar")
-		tsl = mapper.sumPointToTimeSeries(mr, extraLabels, metric, sum, point)
+		tsl = mapper.sumPointToTimeSeries(mr, extraLabels, metric, sum, point, nil)
 		assert.Equal(t, 1, len(tsl))
 		ts = tsl[0]
 		assert.Equal(t, ts.Metric.Labels, map[string]string{"foo": "bar", "baz": "bar"})
@@ -1299,7 +1532,7 @@ func TestGaugePointToTimeSeries(t *testing.T) {
 	end := start.Add(time.Hour)
 	point.SetTimestamp(pcommon.NewTimestampFromTime(end))
 
-	tsl := mapper.gaugePointToTimeSeries(mr, labels{}, metric, gauge, point)
+	tsl := mapper.gaugePointToTimeSeries(mr, labels{}, metric, gauge, point, nil)
 	assert.Len(t, tsl, 1)
 	ts := tsl[0]
 	assert.Equal(t, ts.MetricKind, metricpb.MetricDescriptor_GAUGE)
@@ -1320,7 +1553,7 @@ func TestGaugePointToTimeSeries(t *testing.T) {
 
 	// Test double as well
 	point.SetDoubleValue(float64(value))
-	tsl = mapper.gaugePointToTimeSeries(mr, labels{}, metric, gauge, point)
+	tsl = mapper.gaugePointToTimeSeries(mr, labels{}, metric, gauge, point, nil)
 	assert.Len(t, tsl, 1)
 	ts = tsl[0]
 	assert.Equal(t, ts.MetricKind, metricpb.MetricDescriptor_GAUGE)
@@ -1329,14 +1562,14 @@ func TestGaugePointToTimeSeries(t *testing.T) {
 
 	// Add extra labels
 	extraLabels := map[string]string{"foo": "bar"}
-	tsl = mapper.gaugePointToTimeSeries(mr, extraLabels, metric, gauge, point)
+	tsl = mapper.gaugePointToTimeSeries(mr, extraLabels, metric, gauge, point, nil)
 	assert.Len(t, tsl, 1)
 	ts = tsl[0]
 	assert.Equal(t, ts.Metric.Labels, extraLabels)
 
 	// Full set of labels
 	point.Attributes().PutStr("baz", "bar")
-	tsl = mapper.gaugePointToTimeSeries(mr, extraLabels, metric, gauge, point)
+	tsl = mapper.gaugePointToTimeSeries(mr, extraLabels, metric, gauge, point, nil)
 	assert.Len(t, tsl, 1)
 	ts = tsl[0]
 	assert.Equal(t, ts.Metric.Labels, map[string]string{"foo": "bar", "baz": "bar"})
@@ -1565,7 +1798,7 @@ func TestMetricNameToType(t *testing.T) {
 	mapper, shutdown := newTestMetricMapper()
 	defer shutdown()
 	metric := pmetric.NewMetric()
-	got, err := mapper.metricNameToType("foo", metric)
+	got, err := mapper.metricNameToType("foo", metric, nil)
 	assert.NoError(t, err)
 	assert.Equal(
 		t,
@@ -2229,7 +2462,7 @@ func TestKnownDomains(t *testing.T) {
 				mapper.cfg.MetricConfig.KnownDomains = test.knownDomains
 			}
 			mapper.cfg.MetricConfig.Prefix = "prefix"
-			metricType, err := mapper.metricNameToType(test.name, metric)
+			metricType, err := mapper.metricNameToType(test.name, metric, nil)
 			assert.NoError(t, err)
 			assert.Equal(t, test.metricType, metricType)
 		})
@@ -2423,7 +2656,7 @@ func TestReadWALAndExport(t *testing.T) {
 func TestReadWALAndExportRetry(t *testing.T) {
 	tmpDir, _ := os.MkdirTemp("", "wal-test-")
 	mExp := &MetricsExporter{
-		obs: selfObservability{zap.NewNop()},
+		obs: selfObservability{log: zap.NewNop()},
 		cfg: Config{
 			MetricConfig: MetricConfig{
 				WALConfig: &WALConfig{
@@ -2461,10 +2694,54 @@ func TestReadWALAndExportRetry(t *testing.T) {
 	require.GreaterOrEqual(t, endTime.Sub(startTime), time.Duration(2*time.Second))
 }
 
+func TestReadWALAndExportMaxAge(t *testing.T) {
+	tmpDir, _ := os.MkdirTemp("", "wal-test-")
+	var exported []string
+	mExp := &MetricsExporter{
+		obs: selfObservability{log: zap.NewNop()},
+		cfg: Config{
+			MetricConfig: MetricConfig{
+				WALConfig: &WALConfig{
+					Directory: tmpDir,
+					MaxAge:    time.Hour,
+				},
+			},
+		},
+		exportFunc: func(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
+			exported = append(exported, req.Name)
+			return nil
+		},
+	}
+
+	_, _, err := mExp.setupWAL()
+	require.NoError(t, err)
+
+	for i, endTime := range []time.Time{time.Now().Add(-2 * time.Hour), time.Now()} {
+		req := &monitoringpb.CreateTimeSeriesRequest{
+			Name: fmt.Sprintf("request-%d", i),
+			TimeSeries: []*monitoringpb.TimeSeries{{
+				Points: []*monitoringpb.Point{{
+					Interval: &monitoringpb.TimeInterval{EndTime: timestamppb.New(endTime)},
+				}},
+			}},
+		}
+		bytes, err := proto.Marshal(req)
+		require.NoError(t, err)
+		err = mExp.wal.Write(uint64(i+1), bytes)
+		require.NoError(t, err)
+	}
+
+	// the first request is older than max_age, so it is dropped.
+	require.NoError(t, mExp.readWALAndExport(context.Background()))
+	require.NoError(t, mExp.readWALAndExport(context.Background()))
+	require.ErrorIs(t, mExp.readWALAndExport(context.Background()), wal.ErrNotFound)
+	require.Equal(t, []string{"request-1"}, exported)
+}
+
 func TestWatchWALFile(t *testing.T) {
 	tmpDir, _ := os.MkdirTemp("", "wal-test-")
 	mExp := &MetricsExporter{
-		obs: selfObservability{zap.NewExample()},
+		obs: selfObservability{log: zap.NewExample()},
 		cfg: Config{
 			MetricConfig: MetricConfig{
 				WALConfig: &WALConfig{
@@ -2505,7 +2782,7 @@ func TestRunWALReadAndExportLoop(t *testing.T) {
 	tmpDir, _ := os.MkdirTemp("", "wal-test-")
 	shutdown := make(chan struct{})
 	mExp := &MetricsExporter{
-		obs:       selfObservability{zap.NewNop()},
+		obs:       selfObservability{log: zap.NewNop()},
 		shutdownC: shutdown,
 		cfg: Config{
 			MetricConfig: MetricConfig{
@@ -2559,7 +2836,7 @@ func TestRunWALReadAndExportLoop(t *testing.T) {
 func TestPushMetricsOntoWAL(t *testing.T) {
 	tmpDir, _ := os.MkdirTemp("", "wal-test-")
 	shutdown := make(chan struct{})
-	obs := selfObservability{zap.NewNop()}
+	obs := selfObservability{log: zap.NewNop()}
 	cfg := Config{
 		MetricConfig: MetricConfig{
 			MapMonitoredResource: defaultResourceToMonitoringMonitoredResource,
@@ -2575,9 +2852,10 @@ func TestPushMetricsOntoWAL(t *testing.T) {
 		cfg:       cfg,
 		client:    &mock{},
 		mapper: metricMapper{
-			obs:        obs,
-			cfg:        cfg,
-			normalizer: normalization.NewDisabledNormalizer(),
+			obs:              obs,
+			cfg:              cfg,
+			normalizer:       normalization.NewDisabledNormalizer(),
+			deltaAccumulator: normalization.NewDisabledDeltaAccumulator(),
 		},
 	}
 
@@ -2605,3 +2883,477 @@ func TestPushMetricsOntoWAL(t *testing.T) {
 	err = proto.Unmarshal(bytes, req)
 	require.NoError(t, err)
 }
+
+func newTestWALPartitionsExporter(t *testing.T, walConfig *WALConfig, exportFunc func(context.Context, *monitoringpb.CreateTimeSeriesRequest) error) *MetricsExporter {
+	obs := selfObservability{log: zap.NewNop()}
+	cfg := Config{
+		ProjectID: "default-project",
+		MetricConfig: MetricConfig{
+			MapMonitoredResource: defaultResourceToMonitoringMonitoredResource,
+			GetMetricName:        defaultGetMetricName,
+			WALConfig:            walConfig,
+		},
+	}
+	mExp := &MetricsExporter{
+		obs:        obs,
+		shutdownC:  make(chan struct{}),
+		cfg:        cfg,
+		client:     &mock{},
+		exportFunc: exportFunc,
+		mapper: metricMapper{
+			obs:              obs,
+			cfg:              cfg,
+			normalizer:       normalization.NewDisabledNormalizer(),
+			deltaAccumulator: normalization.NewDisabledDeltaAccumulator(),
+		},
+	}
+	_, _, err := mExp.setupWAL()
+	require.NoError(t, err)
+	return mExp
+}
+
+// newTestProjectMetrics creates a gauge for each of the given destination projects.
+func newTestProjectMetrics(projects ...string) pmetric.Metrics {
+	metrics := pmetric.NewMetrics()
+	for _, project := range projects {
+		rm := metrics.ResourceMetrics().AppendEmpty()
+		if project != "" {
+			rm.Resource().Attributes().PutStr(resourcemapping.ProjectIDAttributeKey, project)
+		}
+		metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("baz-metric")
+		metric.SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(2112)
+		metric.Gauge().DataPoints().At(0).SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	}
+	return metrics
+}
+
+func TestPushMetricsOntoWALPartitions(t *testing.T) {
+	tmpDir := t.TempDir()
+	mExp := newTestWALPartitionsExporter(t, &WALConfig{Directory: tmpDir}, func(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
+		return nil
+	})
+
+	err := mExp.PushMetrics(context.Background(), newTestProjectMetrics("", "other-project"))
+	require.NoError(t, err)
+	close(mExp.shutdownC)
+	mExp.goroutines.Wait()
+
+	// requests for the default project are written to the default WAL
+	bytes, err := mExp.wal.Read(1)
+	require.NoError(t, err)
+	req := new(monitoringpb.CreateTimeSeriesRequest)
+	require.NoError(t, proto.Unmarshal(bytes, req))
+	assert.Equal(t, "projects/default-project", req.Name)
+
+	// requests for other projects are written to their own WAL
+	require.Contains(t, mExp.walPartitions, "other-project")
+	assert.Equal(t, filepath.Join(tmpDir, "gcp_metrics_wal_other-project"), mExp.walPartitions["other-project"].path)
+}
+
+func TestWALPartitionsExportIndependently(t *testing.T) {
+	goodExported := make(chan struct{})
+	var badAttempts atomic.Int32
+	mExp := newTestWALPartitionsExporter(t,
+		&WALConfig{Directory: t.TempDir(), MaxBackoff: 3 * time.Second},
+		func(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
+			if req.Name == "projects/unavailable-project" {
+				badAttempts.Add(1)
+				return status.Error(codes.Unavailable, "unavailable")
+			}
+			close(goodExported)
+			return nil
+		},
+	)
+	ctx := context.Background()
+	mExp.walCtx = ctx
+	mExp.goroutines.Add(1)
+	go mExp.runWALReadAndExportLoop(ctx)
+
+	// the unavailable project is written first, and is retried with backoff.
+	require.NoError(t, mExp.PushMetrics(ctx, newTestProjectMetrics("unavailable-project")))
+	require.NoError(t, mExp.PushMetrics(ctx, newTestProjectMetrics("")))
+
+	select {
+	case <-goodExported:
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "export to the default project was blocked by retries for another project")
+	}
+	assert.Eventually(t, func() bool { return badAttempts.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	close(mExp.shutdownC)
+	mExp.goroutines.Wait()
+}
+
+func TestWALPartitionRemovedWhenIdle(t *testing.T) {
+	tmpDir := t.TempDir()
+	exported := make(chan struct{}, 2)
+	mExp := newTestWALPartitionsExporter(t, &WALConfig{Directory: tmpDir}, func(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
+		exported <- struct{}{}
+		return nil
+	})
+	mExp.walPartitionIdleTimeout = 100 * time.Millisecond
+	ctx := context.Background()
+	partitionPath := filepath.Join(tmpDir, "gcp_metrics_wal_other-project")
+	partitionRemoved := func() bool {
+		mExp.walPartitionsMutex.Lock()
+		defer mExp.walPartitionsMutex.Unlock()
+		_, err := os.Stat(partitionPath)
+		return mExp.walPartitions["other-project"] == nil && errors.Is(err, os.ErrNotExist)
+	}
+
+	require.NoError(t, mExp.PushMetrics(ctx, newTestProjectMetrics("other-project")))
+	<-exported
+	assert.Eventually(t, partitionRemoved, 5*time.Second, 10*time.Millisecond)
+
+	// the partition is created again when it is written to.
+	require.NoError(t, mExp.PushMetrics(ctx, newTestProjectMetrics("other-project")))
+	assert.DirExists(t, partitionPath)
+	<-exported
+	assert.Eventually(t, partitionRemoved, 5*time.Second, 10*time.Millisecond)
+
+	close(mExp.shutdownC)
+	mExp.goroutines.Wait()
+}
+
+func TestWALPartitionsNotCreatedAfterShutdown(t *testing.T) {
+	mExp := newTestWALPartitionsExporter(t, &WALConfig{Directory: t.TempDir()}, func(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
+		return nil
+	})
+	close(mExp.shutdownC)
+
+	err := mExp.writeWALRequest(context.Background(), "other-project", &monitoringpb.CreateTimeSeriesRequest{Name: "projects/other-project"})
+	assert.ErrorIs(t, err, errShutdown)
+	assert.Empty(t, mExp.walPartitions)
+}
+
+func TestResumeWALPartitions(t *testing.T) {
+	tmpDir := t.TempDir()
+	// Leave a pending request in a WAL partition, as if the collector had
+	// stopped before it could be exported.
+	prevWAL := &exporterWAL{obs: selfObservability{log: zap.NewNop()}}
+	_, _, err := prevWAL.setup(&WALConfig{Directory: tmpDir}, metricsWALPartitionPrefix+"other-project")
+	require.NoError(t, err)
+	require.NoError(t, prevWAL.writeRequest(context.Background(), &monitoringpb.CreateTimeSeriesRequest{Name: "projects/other-project"}))
+	require.NoError(t, prevWAL.close())
+
+	exported := make(chan *monitoringpb.CreateTimeSeriesRequest, 1)
+	mExp := newTestWALPartitionsExporter(t, &WALConfig{Directory: tmpDir}, func(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
+		exported <- req
+		return nil
+	})
+	require.NoError(t, mExp.resumeWALPartitions())
+
+	select {
+	case req := <-exported:
+		assert.Equal(t, "projects/other-project", req.Name)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "pending request in WAL partition was not exported")
+	}
+	close(mExp.shutdownC)
+	mExp.goroutines.Wait()
+}
+
+func TestFailedTimeSeries(t *testing.T) {
+	req := &monitoringpb.CreateTimeSeriesRequest{Name: "projects/my-project"}
+	for i := 0; i < 6; i++ {
+		req.TimeSeries = append(req.TimeSeries, &monitoringpb.TimeSeries{
+			Metric: &metricpb.Metric{Type: fmt.Sprintf("custom.googleapis.com/metric_%d", i)},
+		})
+	}
+	partialFailure := func(code codes.Code, msg string, summaryErrs ...codes.Code) error {
+		summary := &monitoringpb.CreateTimeSeriesSummary{TotalPointCount: 6}
+		for _, c := range summaryErrs {
+			summary.Errors = append(summary.Errors, &monitoringpb.CreateTimeSeriesSummary_Error{
+				Status: status.New(c, "").Proto(), PointCount: 1,
+			})
+		}
+		st, err := status.New(code, msg).WithDetails(summary)
+		require.NoError(t, err)
+		return st.Err()
+	}
+	for _, tc := range []struct {
+		desc              string
+		err               error
+		expectedIndices   []int
+		expectedRetryable bool
+	}{
+		{
+			desc:              "unavailable",
+			err:               status.Error(codes.Unavailable, "unavailable"),
+			expectedIndices:   []int{0, 1, 2, 3, 4, 5},
+			expectedRetryable: true,
+		},
+		{
+			desc:              "resource exhausted",
+			err:               status.Error(codes.ResourceExhausted, "quota exceeded"),
+			expectedIndices:   []int{0, 1, 2, 3, 4, 5},
+			expectedRetryable: true,
+		},
+		{
+			desc:            "invalid argument",
+			err:             status.Error(codes.InvalidArgument, "invalid"),
+			expectedIndices: []int{0, 1, 2, 3, 4, 5},
+		},
+		{
+			desc: "partial failure",
+			err: partialFailure(codes.InvalidArgument,
+				"One or more TimeSeries could not be written: Points must be written in order.: timeSeries[0,2-3]",
+				codes.InvalidArgument),
+			expectedIndices: []int{0, 2, 3},
+		},
+		{
+			desc: "partial failure with retryable errors",
+			err: partialFailure(codes.InvalidArgument,
+				"One or more TimeSeries could not be written: Internal error encountered.: timeSeries[1]; Points must be written in order.: timeSeries[4-10]",
+				codes.InvalidArgument, codes.Unavailable),
+			expectedIndices:   []int{1, 4, 5},
+			expectedRetryable: true,
+		},
+		{
+			desc:            "partial failure without indices",
+			err:             partialFailure(codes.InvalidArgument, "One or more TimeSeries could not be written", codes.InvalidArgument),
+			expectedIndices: []int{0, 1, 2, 3, 4, 5},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			failed, retryable := failedTimeSeries(req, tc.err)
+			assert.Equal(t, tc.expectedRetryable, retryable)
+			assert.Equal(t, req.Name, failed.Name)
+			var expected []*monitoringpb.TimeSeries
+			for _, i := range tc.expectedIndices {
+				expected = append(expected, req.TimeSeries[i])
+			}
+			assert.Empty(t, cmp.Diff(expected, failed.TimeSeries, protocmp.Transform()))
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), retryDelay(status.Error(codes.ResourceExhausted, "quota exceeded")))
+	st, err := status.New(codes.ResourceExhausted, "quota exceeded").WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(30 * time.Second)})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, retryDelay(st.Err()))
+}
+
+func newTestDeltaToCumulativeMapper() (metricMapper, func()) {
+	mapper, shutdown := newTestMetricMapper()
+	s := make(chan struct{})
+	mapper.deltaAccumulator = normalization.NewStandardDeltaAccumulator(s, zap.NewNop(), datapointstorage.Config{})
+	return mapper, func() {
+		close(s)
+		shutdown()
+	}
+}
+
+func TestDeltaSumToCumulative(t *testing.T) {
+	mapper, shutdown := newTestDeltaToCumulativeMapper()
+	defer shutdown()
+	mr := &monitoredrespb.MonitoredResource{}
+	metric := pmetric.NewMetric()
+	metric.SetName("mysum")
+	sum := metric.SetEmptySum()
+	sum.SetIsMonotonic(true)
+	sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	addPoint := func(value int64, startTime, endTime time.Time) {
+		point := sum.DataPoints().AppendEmpty()
+		point.SetIntValue(value)
+		point.SetStartTimestamp(pcommon.NewTimestampFromTime(startTime))
+		point.SetTimestamp(pcommon.NewTimestampFromTime(endTime))
+	}
+	addPoint(3, start, start.Add(time.Minute))
+	addPoint(4, start.Add(time.Minute), start.Add(2*time.Minute))
+	// overlaps with the previous point, so it is dropped.
+	addPoint(100, start.Add(time.Minute), start.Add(3*time.Minute))
+	// a gap between points is accumulated.
+	addPoint(5, start.Add(5*time.Minute), start.Add(6*time.Minute))
+
+	tsl := mapper.metricToTimeSeries(mr, labels{}, metric, mapper.cfg.ProjectID)
+	require.Len(t, tsl, 3)
+	expected := []struct {
+		end   time.Time
+		value int64
+	}{
+		{end: start.Add(time.Minute), value: 3},
+		{end: start.Add(2 * time.Minute), value: 7},
+		{end: start.Add(6 * time.Minute), value: 12},
+	}
+	for i, ts := range tsl {
+		assert.Equal(t, metricpb.MetricDescriptor_CUMULATIVE, ts.MetricKind)
+		require.Len(t, ts.Points, 1)
+		assert.Equal(t, &monitoringpb.TimeInterval{
+			StartTime: timestamppb.New(start),
+			EndTime:   timestamppb.New(expected[i].end),
+		}, ts.Points[0].Interval)
+		assert.Equal(t, expected[i].value, ts.Points[0].Value.GetInt64Value())
+	}
+}
+
+func TestDeltaHistogramToCumulative(t *testing.T) {
+	mapper, shutdown := newTestDeltaToCumulativeMapper()
+	defer shutdown()
+	newPoint := func(startTime, endTime time.Time, bounds []float64, buckets []uint64, sum float64) pmetric.HistogramDataPoint {
+		point := pmetric.NewHistogramDataPoint()
+		point.SetStartTimestamp(pcommon.NewTimestampFromTime(startTime))
+		point.SetTimestamp(pcommon.NewTimestampFromTime(endTime))
+		point.ExplicitBounds().FromRaw(bounds)
+		point.BucketCounts().FromRaw(buckets)
+		var count uint64
+		for _, b := range buckets {
+			count += b
+		}
+		point.SetCount(count)
+		point.SetSum(sum)
+		return point
+	}
+	end := start.Add(time.Minute)
+	point, keep := mapper.deltaAccumulator.AccumulateHistogramDataPoint(newPoint(start, end, []float64{1, 2}, []uint64{1, 2, 3}, 10), "id")
+	require.True(t, keep)
+	assert.Equal(t, []uint64{1, 2, 3}, point.BucketCounts().AsRaw())
+
+	end2 := end.Add(time.Minute)
+	point, keep = mapper.deltaAccumulator.AccumulateHistogramDataPoint(newPoint(end, end2, []float64{1, 2}, []uint64{4, 0, 1}, 5), "id")
+	require.True(t, keep)
+	assert.Equal(t, pcommon.NewTimestampFromTime(start), point.StartTimestamp())
+	assert.Equal(t, pcommon.NewTimestampFromTime(end2), point.Timestamp())
+	assert.Equal(t, []uint64{5, 2, 4}, point.BucketCounts().AsRaw())
+	assert.Equal(t, uint64(11), point.Count())
+	assert.Equal(t, float64(15), point.Sum())
+
+	// changing the bucket boundaries starts a new cumulative series.
+	end3 := end2.Add(time.Minute)
+	point, keep = mapper.deltaAccumulator.AccumulateHistogramDataPoint(newPoint(end2, end3, []float64{1, 2, 3}, []uint64{1, 1, 1, 1}, 5), "id")
+	require.True(t, keep)
+	assert.Equal(t, pcommon.NewTimestampFromTime(end2), point.StartTimestamp())
+	assert.Equal(t, []uint64{1, 1, 1, 1}, point.BucketCounts().AsRaw())
+}
+
+func TestDeltaExponentialHistogramToCumulative(t *testing.T) {
+	mapper, shutdown := newTestDeltaToCumulativeMapper()
+	defer shutdown()
+	newPoint := func(startTime, endTime time.Time, scale int32, offset int32, buckets []uint64) pmetric.ExponentialHistogramDataPoint {
+		point := pmetric.NewExponentialHistogramDataPoint()
+		point.SetStartTimestamp(pcommon.NewTimestampFromTime(startTime))
+		point.SetTimestamp(pcommon.NewTimestampFromTime(endTime))
+		point.SetScale(scale)
+		point.Positive().SetOffset(offset)
+		point.Positive().BucketCounts().FromRaw(buckets)
+		point.SetZeroCount(1)
+		var count uint64 = 1
+		for _, b := range buckets {
+			count += b
+		}
+		point.SetCount(count)
+		point.SetSum(float64(count))
+		return point
+	}
+	end := start.Add(time.Minute)
+	_, keep := mapper.deltaAccumulator.AccumulateExponentialHistogramDataPoint(newPoint(start, end, 1, 2, []uint64{1, 2}), "id")
+	require.True(t, keep)
+
+	// the second point has a lower scale: the first point's buckets [2:1, 3:2]
+	// become [1:3] at scale 0.
+	end2 := end.Add(time.Minute)
+	point, keep := mapper.deltaAccumulator.AccumulateExponentialHistogramDataPoint(newPoint(end, end2, 0, 0, []uint64{1, 1, 1}), "id")
+	require.True(t, keep)
+	assert.Equal(t, pcommon.NewTimestampFromTime(start), point.StartTimestamp())
+	assert.Equal(t, int32(0), point.Scale())
+	assert.Equal(t, int32(0), point.Positive().Offset())
+	assert.Equal(t, []uint64{1, 4, 1}, point.Positive().BucketCounts().AsRaw())
+	assert.Equal(t, uint64(2), point.ZeroCount())
+	assert.Equal(t, uint64(8), point.Count())
+	assert.Equal(t, float64(8), point.Sum())
+}
+
+func newTestConcurrentExporter(cfg MetricConfig, exportFunc func(context.Context, *monitoringpb.CreateTimeSeriesRequest) error) *MetricsExporter {
+	return &MetricsExporter{
+		cfg:        Config{MetricConfig: cfg},
+		exportFunc: exportFunc,
+		requestSem: make(chan struct{}, maxConcurrentRequests(cfg)),
+	}
+}
+
+func TestExportBatchesConcurrently(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	var projectMutex sync.Mutex
+	projectInFlight := make(map[string]int)
+	maxProjectInFlight := make(map[string]int)
+	mExp := newTestConcurrentExporter(
+		MetricConfig{MaxConcurrentRequests: 3, MaxConcurrentRequestsPerProject: 2},
+		func(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			projectMutex.Lock()
+			projectInFlight[req.Name]++
+			if projectInFlight[req.Name] > maxProjectInFlight[req.Name] {
+				maxProjectInFlight[req.Name] = projectInFlight[req.Name]
+			}
+			projectMutex.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			projectMutex.Lock()
+			projectInFlight[req.Name]--
+			projectMutex.Unlock()
+			if req.Name == "projects/bad-project" {
+				return errors.New("bad project")
+			}
+			return nil
+		},
+	)
+
+	batchesByProject := make(map[string][][]*monitoringpb.TimeSeries)
+	for _, project := range []string{"project-a", "project-b", "bad-project"} {
+		for i := 0; i < 4; i++ {
+			ts := testLimitsTimeSeries(fmt.Sprintf("custom.googleapis.com/metric-%d", i), nil)
+			batchesByProject[project] = append(batchesByProject[project], []*monitoringpb.TimeSeries{ts})
+		}
+	}
+	err := mExp.exportBatches(context.Background(), batchesByProject)
+	require.Error(t, err)
+	assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 1, "errors of a project are joined")
+
+	assert.Equal(t, int32(3), maxInFlight.Load())
+	for project, max := range maxProjectInFlight {
+		assert.LessOrEqual(t, max, 2, project)
+	}
+}
+
+func TestExportBatchesPreservesSeriesOrder(t *testing.T) {
+	var mutex sync.Mutex
+	var exported []string
+	mExp := newTestConcurrentExporter(
+		MetricConfig{MaxConcurrentRequests: 4},
+		func(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
+			// Slow down the first batch, so later batches would overtake it
+			// if they were sent concurrently.
+			if req.TimeSeries[0].Metric.Labels["batch"] == "0" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			exported = append(exported, req.TimeSeries[0].Metric.Labels["batch"])
+			return nil
+		},
+	)
+	newTS := func(batch string) *monitoringpb.TimeSeries {
+		return testLimitsTimeSeries("custom.googleapis.com/foo", map[string]string{"batch": batch})
+	}
+	foo := testLimitsTimeSeries("custom.googleapis.com/foo", nil)
+	batches := [][]*monitoringpb.TimeSeries{
+		{newTS("0"), foo},
+		{newTS("1")},
+		{newTS("2"), foo},
+	}
+	require.NoError(t, mExp.exportBatches(context.Background(), map[string][][]*monitoringpb.TimeSeries{"my-project": batches}))
+	require.Len(t, exported, 3)
+	// batch 2 contains a later point for foo than batch 0, so it is sent
+	// after batch 0, while batch 1 is sent concurrently with batch 0.
+	assert.Equal(t, "1", exported[0])
+	assert.Equal(t, []string{"0", "2"}, exported[1:])
+}
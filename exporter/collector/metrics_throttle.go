@@ -0,0 +1,361 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.uber.org/zap"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Policies for points which are written more often than the minimum write
+// interval of their series.
+const (
+	WriteThrottlePolicyCoalesce = "coalesce"
+	WriteThrottlePolicyDrop     = "drop"
+)
+
+const (
+	// defaultMinWriteInterval is the minimum interval between points of a
+	// series accepted by Cloud Monitoring.
+	// See https://cloud.google.com/monitoring/quotas#custom_metrics_quotas.
+	defaultMinWriteInterval = 5 * time.Second
+	// seriesThrottleGCInterval is how often series which were not written
+	// since the previous interval are forgotten by the throttle.
+	seriesThrottleGCInterval = 10 * time.Minute
+	correctionThrottled      = "throttled"
+)
+
+// seriesThrottle limits how often points are written for each series. It
+// remembers the end time of the last point written for each series, and
+// removes points which end less than minInterval after the previous point of
+// their series.
+type seriesThrottle struct {
+	// lastWrite is the end time of the last point written for each series.
+	lastWrite map[string]time.Time
+	// held is the latest point of each series which ended too soon after the
+	// last write with the coalesce policy. It is written once minInterval has
+	// passed since the last write, unless a later point of its series is
+	// written first.
+	held map[string]heldPoint
+	// lastGC is when series were last removed from lastWrite.
+	lastGC time.Time
+	now    func() time.Time
+	policy string
+	// minInterval is the minimum interval between the end times of points
+	// written for a series.
+	minInterval time.Duration
+	obs         selfObservability
+	mutex       sync.Mutex
+}
+
+type heldPoint struct {
+	ts        *monitoringpb.TimeSeries
+	projectID string
+}
+
+func newSeriesThrottle(cfg WriteThrottleConfig, obs selfObservability) *seriesThrottle {
+	minInterval := cfg.MinInterval
+	if minInterval == 0 {
+		minInterval = defaultMinWriteInterval
+	}
+	policy := cfg.Policy
+	if policy == "" {
+		policy = WriteThrottlePolicyCoalesce
+	}
+	return &seriesThrottle{
+		lastWrite:   make(map[string]time.Time),
+		held:        make(map[string]heldPoint),
+		lastGC:      time.Now(),
+		now:         time.Now,
+		policy:      policy,
+		minInterval: minInterval,
+		obs:         obs,
+	}
+}
+
+// filter returns the time series of tss which can be written for projectID,
+// in their original order. Points which end less than minInterval after the
+// previous point of their series are removed. With the drop policy, the
+// earliest points of each interval are kept. With the coalesce policy, the
+// latest points are kept, so the most recent value of each series is written:
+// the latest point which ends too soon after the last write is held, and
+// returned by a later call once minInterval has passed, with its end time
+// moved to the end of the interval. Time series in exempt are not throttled.
+// The last write of each series is only updated by written, once the points
+// returned were sent.
+func (t *seriesThrottle) filter(ctx context.Context, projectID string, tss []*monitoringpb.TimeSeries, exempt map[*monitoringpb.TimeSeries]bool) []*monitoringpb.TimeSeries {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.gc()
+
+	// Group the time series by series, keeping the order of the groups.
+	var keys []string
+	series := make(map[string][]int)
+	keep := make([]bool, len(tss))
+	for i, ts := range tss {
+		if exempt[ts] {
+			keep[i] = true
+			continue
+		}
+		key := t.key(projectID, ts)
+		if _, ok := series[key]; !ok {
+			keys = append(keys, key)
+		}
+		series[key] = append(series[key], i)
+	}
+
+	throttled := 0
+	for _, key := range keys {
+		indices := series[key]
+		sort.SliceStable(indices, func(i, j int) bool {
+			return pointEndTime(tss[indices[i]]).Before(pointEndTime(tss[indices[j]]))
+		})
+		last, written := t.lastWrite[key]
+		if t.policy == WriteThrottlePolicyDrop {
+			for _, i := range indices {
+				end := pointEndTime(tss[i])
+				if written && end.Sub(last) < t.minInterval {
+					throttled++
+					continue
+				}
+				keep[i] = true
+				last, written = end, true
+			}
+			continue
+		}
+		var next time.Time
+		for j := len(indices) - 1; j >= 0; j-- {
+			i := indices[j]
+			end := pointEndTime(tss[i])
+			if written && end.Sub(last) < t.minInterval {
+				// Earlier points are also too close to the last write. Hold
+				// the latest of them, unless a later point is written.
+				if next.IsZero() {
+					if _, ok := t.held[key]; ok {
+						throttled++
+					}
+					t.held[key] = heldPoint{ts: tss[i], projectID: projectID}
+					j--
+				}
+				throttled += j + 1
+				break
+			}
+			if !next.IsZero() && next.Sub(end) < t.minInterval {
+				throttled++
+				continue
+			}
+			keep[i] = true
+			next = end
+		}
+		if _, ok := t.held[key]; ok && !next.IsZero() {
+			// The held point is superseded by a later point.
+			delete(t.held, key)
+			throttled++
+		}
+	}
+
+	result := make([]*monitoringpb.TimeSeries, 0, len(tss))
+	for i, ts := range tss {
+		if keep[i] {
+			result = append(result, ts)
+		}
+	}
+	result = append(result, t.release(projectID)...)
+	if throttled > 0 {
+		t.obs.recordRequestCorrection(ctx, throttled, correctionThrottled)
+	}
+	return result
+}
+
+// release returns the held points of projectID whose series were last written
+// at least minInterval ago. Their end time is moved to minInterval after the
+// last write, so they can be written.
+func (t *seriesThrottle) release(projectID string) []*monitoringpb.TimeSeries {
+	var released []*monitoringpb.TimeSeries
+	now := t.now()
+	for key, held := range t.held {
+		if held.projectID != projectID {
+			continue
+		}
+		if ts, ok := t.releaseHeld(key, held, now, false); ok {
+			released = append(released, ts)
+		}
+	}
+	return released
+}
+
+// flush returns the held points of all projects which can be written, by
+// project, so that they are written even if their project stops being
+// exported. If force is true, all held points are returned, even if
+// minInterval hasn't passed since the last write of their series, e.g. when
+// the exporter shuts down.
+func (t *seriesThrottle) flush(force bool) map[string][]*monitoringpb.TimeSeries {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	released := make(map[string][]*monitoringpb.TimeSeries)
+	now := t.now()
+	for key, held := range t.held {
+		if ts, ok := t.releaseHeld(key, held, now, force); ok {
+			released[held.projectID] = append(released[held.projectID], ts)
+		}
+	}
+	return released
+}
+
+// releaseHeld removes the held point of the series with key and returns it,
+// if its series was last written at least minInterval before now, or force is
+// true. Its end time is moved to minInterval after the last write.
+func (t *seriesThrottle) releaseHeld(key string, held heldPoint, now time.Time, force bool) (*monitoringpb.TimeSeries, bool) {
+	last, written := t.lastWrite[key]
+	if !written {
+		delete(t.held, key)
+		return held.ts, true
+	}
+	end := last.Add(t.minInterval)
+	if !force && now.Before(end) {
+		return nil, false
+	}
+	ts := proto.Clone(held.ts).(*monitoringpb.TimeSeries)
+	for _, point := range ts.GetPoints() {
+		if point.GetInterval() == nil {
+			continue
+		}
+		if ts.GetMetricKind() == metricpb.MetricDescriptor_GAUGE {
+			point.Interval.StartTime = timestamppb.New(end)
+		}
+		point.Interval.EndTime = timestamppb.New(end)
+	}
+	delete(t.held, key)
+	return ts, true
+}
+
+// runThrottleFlusher periodically writes the points held by the throttle whose
+// interval has passed, so that the latest point of each series is written even
+// if its project stops being exported.
+func (me *MetricsExporter) runThrottleFlusher() {
+	defer me.goroutines.Done()
+	ticker := time.NewTicker(me.throttle.minInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-me.shutdownC:
+			return
+		case <-ticker.C:
+			if err := me.writeThrottled(context.Background(), me.throttle.flush(false)); err != nil {
+				me.obs.log.Error("Failed to write throttled points.", zap.Error(err))
+			}
+		}
+	}
+}
+
+// writeThrottled writes the points released by the throttle.
+func (me *MetricsExporter) writeThrottled(ctx context.Context, released map[string][]*monitoringpb.TimeSeries) error {
+	batchesByProject := make(map[string][][]*monitoringpb.TimeSeries, len(released))
+	for projectID, tss := range released {
+		batchesByProject[projectID] = batchTimeSeries(ctx, me.obs, tss)
+	}
+	return me.writeBatches(ctx, batchesByProject)
+}
+
+// written records the time series which were sent to projectID, so later
+// points of their series are throttled.
+func (t *seriesThrottle) written(projectID string, tss []*monitoringpb.TimeSeries) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, ts := range tss {
+		key := t.key(projectID, ts)
+		if end := pointEndTime(ts); end.After(t.lastWrite[key]) {
+			t.lastWrite[key] = end
+		}
+	}
+}
+
+func (t *seriesThrottle) key(projectID string, ts *monitoringpb.TimeSeries) string {
+	return projectID + " - " + seriesKey(ts)
+}
+
+// gc forgets series which were not written since the previous gc, so series
+// which stop being written don't use memory forever.
+func (t *seriesThrottle) gc() {
+	now := t.now()
+	if now.Sub(t.lastGC) < seriesThrottleGCInterval {
+		return
+	}
+	for key, last := range t.lastWrite {
+		if _, held := t.held[key]; !held && last.Before(t.lastGC) {
+			delete(t.lastWrite, key)
+		}
+	}
+	t.lastGC = now
+}
+
+// recordThrottleWrites records the time series of a request which were
+// written, so that later points of their series are throttled.
+func (me *MetricsExporter) recordThrottleWrites(req *monitoringpb.CreateTimeSeriesRequest, projectID string, err error) {
+	if me.throttle == nil {
+		return
+	}
+	tss := req.TimeSeries
+	if err != nil {
+		failed, _ := failedTimeSeries(req, err)
+		if len(failed.TimeSeries) == len(tss) {
+			return
+		}
+		isFailed := make(map[*monitoringpb.TimeSeries]bool, len(failed.TimeSeries))
+		for _, ts := range failed.TimeSeries {
+			isFailed[ts] = true
+		}
+		tss = nil
+		for _, ts := range req.TimeSeries {
+			if !isFailed[ts] {
+				tss = append(tss, ts)
+			}
+		}
+	}
+	me.throttle.written(projectID, tss)
+}
+
+// isDeltaMetric returns true if the points of the metric are deltas. Unless
+// they are accumulated into cumulative points, each delta point is exported
+// as a cumulative point with its own start time, so throttling them would
+// lose the values of the points which aren't written.
+func isDeltaMetric(metric pmetric.Metric) bool {
+	switch metric.Type() {
+	case pmetric.MetricTypeSum:
+		return metric.Sum().AggregationTemporality() == pmetric.AggregationTemporalityDelta
+	case pmetric.MetricTypeHistogram:
+		return metric.Histogram().AggregationTemporality() == pmetric.AggregationTemporalityDelta
+	case pmetric.MetricTypeExponentialHistogram:
+		return metric.ExponentialHistogram().AggregationTemporality() == pmetric.AggregationTemporalityDelta
+	}
+	return false
+}
+
+// pointEndTime returns the end time of the point of a time series.
+func pointEndTime(ts *monitoringpb.TimeSeries) time.Time {
+	if len(ts.GetPoints()) == 0 {
+		return time.Time{}
+	}
+	return ts.GetPoints()[0].GetInterval().GetEndTime().AsTime()
+}
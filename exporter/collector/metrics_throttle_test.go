@@ -0,0 +1,261 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func testThrottleTimeSeries(metricType string, end time.Time) *monitoringpb.TimeSeries {
+	ts := testLimitsTimeSeries(metricType, map[string]string{"foo": "bar"})
+	ts.Points = []*monitoringpb.Point{{
+		Interval: &monitoringpb.TimeInterval{EndTime: timestamppb.New(end)},
+		Value:    &monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_Int64Value{Int64Value: end.Unix()}},
+	}}
+	return ts
+}
+
+func endTimes(tss []*monitoringpb.TimeSeries) []time.Time {
+	var times []time.Time
+	for _, ts := range tss {
+		times = append(times, pointEndTime(ts))
+	}
+	return times
+}
+
+func TestSeriesThrottle(t *testing.T) {
+	start := time.Unix(1000, 0).UTC()
+	at := func(seconds ...int) []time.Time {
+		var times []time.Time
+		for _, s := range seconds {
+			times = append(times, start.Add(time.Duration(s)*time.Second))
+		}
+		return times
+	}
+	for _, tc := range []struct {
+		desc     string
+		policy   string
+		first    []time.Time
+		second   []time.Time
+		expected []time.Time
+	}{
+		{
+			desc:     "drop keeps the earliest points",
+			policy:   WriteThrottlePolicyDrop,
+			second:   at(0, 1, 2, 3, 4, 5, 6, 7, 8, 9),
+			expected: at(0, 5),
+		},
+		{
+			desc:     "coalesce keeps the latest points",
+			policy:   WriteThrottlePolicyCoalesce,
+			second:   at(0, 1, 2, 3, 4, 5, 6, 7, 8, 9),
+			expected: at(4, 9),
+		},
+		{
+			desc:     "default policy is coalesce",
+			second:   at(0, 3, 6),
+			expected: at(0, 6),
+		},
+		{
+			desc:     "drop throttles points close to the previous write",
+			policy:   WriteThrottlePolicyDrop,
+			first:    at(0),
+			second:   at(3, 6, 9),
+			expected: at(6),
+		},
+		{
+			desc:     "coalesce throttles points close to the previous write",
+			policy:   WriteThrottlePolicyCoalesce,
+			first:    at(8),
+			second:   at(3, 10, 12),
+			expected: nil,
+		},
+		{
+			desc:     "points are returned in their original order",
+			policy:   WriteThrottlePolicyCoalesce,
+			second:   at(10, 0, 20),
+			expected: at(10, 0, 20),
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			throttle := newSeriesThrottle(WriteThrottleConfig{Policy: tc.policy}, selfObservability{})
+			throttle.now = func() time.Time { return start }
+			var first []*monitoringpb.TimeSeries
+			for _, end := range tc.first {
+				first = append(first, testThrottleTimeSeries("custom.googleapis.com/foo", end))
+			}
+			throttle.written("my-project", throttle.filter(context.Background(), "my-project", first, nil))
+
+			var second []*monitoringpb.TimeSeries
+			for _, end := range tc.second {
+				second = append(second, testThrottleTimeSeries("custom.googleapis.com/foo", end))
+			}
+			assert.Equal(t, tc.expected, endTimes(throttle.filter(context.Background(), "my-project", second, nil)))
+		})
+	}
+}
+
+func TestSeriesThrottleSeparatesSeries(t *testing.T) {
+	throttle := newSeriesThrottle(WriteThrottleConfig{MinInterval: time.Minute}, selfObservability{})
+	end := time.Unix(1000, 0).UTC()
+	throttle.now = func() time.Time { return end }
+	tss := []*monitoringpb.TimeSeries{
+		testThrottleTimeSeries("custom.googleapis.com/foo", end),
+		testThrottleTimeSeries("custom.googleapis.com/bar", end),
+	}
+	assert.Len(t, throttle.filter(context.Background(), "my-project", tss, nil), 2)
+	throttle.written("my-project", tss)
+	// The same series in another project is a different series.
+	assert.Len(t, throttle.filter(context.Background(), "other-project", tss, nil), 2)
+	assert.Empty(t, throttle.filter(context.Background(), "my-project", tss, nil))
+}
+
+func TestSeriesThrottleGC(t *testing.T) {
+	throttle := newSeriesThrottle(WriteThrottleConfig{}, selfObservability{})
+	now := time.Unix(1000, 0).UTC()
+	throttle.now = func() time.Time { return now }
+	throttle.lastGC = now
+
+	throttle.written("my-project", []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", now)})
+	assert.Len(t, throttle.lastWrite, 1)
+
+	// The series was written after the previous GC, so it is kept.
+	now = now.Add(seriesThrottleGCInterval)
+	throttle.filter(context.Background(), "my-project", nil, nil)
+	assert.Len(t, throttle.lastWrite, 1)
+
+	// The series was not written since the previous GC, so it is removed.
+	now = now.Add(seriesThrottleGCInterval)
+	throttle.filter(context.Background(), "my-project", nil, nil)
+	assert.Empty(t, throttle.lastWrite)
+}
+
+func TestSeriesThrottleReleasesHeldPoint(t *testing.T) {
+	throttle := newSeriesThrottle(WriteThrottleConfig{}, selfObservability{})
+	start := time.Unix(1000, 0).UTC()
+	now := start
+	throttle.now = func() time.Time { return now }
+	throttle.written("my-project", []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", start)})
+
+	// The point is too close to the last write, so it is held.
+	tooEarly := testThrottleTimeSeries("custom.googleapis.com/foo", start.Add(2*time.Second))
+	assert.Empty(t, throttle.filter(context.Background(), "my-project", []*monitoringpb.TimeSeries{tooEarly}, nil))
+
+	// Once the interval has passed, it is written at the end of the interval.
+	now = start.Add(defaultMinWriteInterval)
+	released := throttle.filter(context.Background(), "my-project", nil, nil)
+	assert.Equal(t, []time.Time{start.Add(defaultMinWriteInterval)}, endTimes(released))
+	assert.Equal(t, tooEarly.Points[0].Value, released[0].Points[0].Value)
+	assert.Empty(t, throttle.held)
+}
+
+func TestSeriesThrottleFlush(t *testing.T) {
+	throttle := newSeriesThrottle(WriteThrottleConfig{}, selfObservability{})
+	start := time.Unix(1000, 0).UTC()
+	now := start
+	throttle.now = func() time.Time { return now }
+	throttle.written("my-project", []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", start)})
+	throttle.written("other-project", []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", start)})
+	assert.Empty(t, throttle.filter(context.Background(), "my-project", []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", start.Add(time.Second))}, nil))
+	assert.Empty(t, throttle.filter(context.Background(), "other-project", []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", start.Add(time.Second))}, nil))
+
+	// Held points are only flushed once the interval has passed.
+	assert.Empty(t, throttle.flush(false))
+	now = start.Add(defaultMinWriteInterval)
+	released := throttle.flush(false)
+	assert.Equal(t, []time.Time{start.Add(defaultMinWriteInterval)}, endTimes(released["my-project"]))
+	assert.Equal(t, []time.Time{start.Add(defaultMinWriteInterval)}, endTimes(released["other-project"]))
+	assert.Empty(t, throttle.held)
+
+	// Forced flushes release held points before the interval has passed.
+	throttle.written("my-project", released["my-project"])
+	assert.Empty(t, throttle.filter(context.Background(), "my-project", []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", now.Add(time.Second))}, nil))
+	assert.Empty(t, throttle.flush(false))
+	released = throttle.flush(true)
+	assert.Equal(t, []time.Time{now.Add(defaultMinWriteInterval)}, endTimes(released["my-project"]))
+	assert.Empty(t, throttle.held)
+}
+
+func TestShutdownWritesHeldPoints(t *testing.T) {
+	start := time.Unix(1000, 0).UTC()
+	throttle := newSeriesThrottle(WriteThrottleConfig{}, selfObservability{})
+	throttle.now = func() time.Time { return start }
+	var exported []*monitoringpb.TimeSeries
+	me := &MetricsExporter{
+		cfg:        DefaultConfig(),
+		obs:        selfObservability{log: zap.NewNop()},
+		client:     &mock{},
+		throttle:   throttle,
+		shutdownC:  make(chan struct{}),
+		requestSem: make(chan struct{}, 1),
+	}
+	me.exportFunc = func(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest) error {
+		assert.Equal(t, "projects/my-project", req.Name)
+		exported = append(exported, req.TimeSeries...)
+		return nil
+	}
+	throttle.written("my-project", []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", start)})
+	held := testThrottleTimeSeries("custom.googleapis.com/foo", start.Add(time.Second))
+	assert.Empty(t, throttle.filter(context.Background(), "my-project", []*monitoringpb.TimeSeries{held}, nil))
+
+	assert.NoError(t, me.Shutdown(context.Background()))
+	assert.Equal(t, []time.Time{start.Add(defaultMinWriteInterval)}, endTimes(exported))
+	assert.Equal(t, held.Points[0].GetValue().GetInt64Value(), exported[0].Points[0].GetValue().GetInt64Value())
+}
+
+func TestSeriesThrottleHeldPointSuperseded(t *testing.T) {
+	throttle := newSeriesThrottle(WriteThrottleConfig{}, selfObservability{})
+	start := time.Unix(1000, 0).UTC()
+	throttle.now = func() time.Time { return start }
+	throttle.written("my-project", []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", start)})
+
+	tooEarly := testThrottleTimeSeries("custom.googleapis.com/foo", start.Add(2*time.Second))
+	assert.Empty(t, throttle.filter(context.Background(), "my-project", []*monitoringpb.TimeSeries{tooEarly}, nil))
+	later := testThrottleTimeSeries("custom.googleapis.com/foo", start.Add(6*time.Second))
+	assert.Equal(t, []*monitoringpb.TimeSeries{later}, throttle.filter(context.Background(), "my-project", []*monitoringpb.TimeSeries{later}, nil))
+	assert.Empty(t, throttle.held)
+}
+
+func TestSeriesThrottleExempt(t *testing.T) {
+	throttle := newSeriesThrottle(WriteThrottleConfig{Policy: WriteThrottlePolicyDrop}, selfObservability{})
+	start := time.Unix(1000, 0).UTC()
+	tss := []*monitoringpb.TimeSeries{
+		testThrottleTimeSeries("custom.googleapis.com/foo", start),
+		testThrottleTimeSeries("custom.googleapis.com/foo", start.Add(time.Second)),
+	}
+	exempt := map[*monitoringpb.TimeSeries]bool{tss[0]: true, tss[1]: true}
+	assert.Equal(t, tss, throttle.filter(context.Background(), "my-project", tss, exempt))
+}
+
+func TestSeriesThrottleOnlyAfterWritten(t *testing.T) {
+	throttle := newSeriesThrottle(WriteThrottleConfig{Policy: WriteThrottlePolicyDrop}, selfObservability{})
+	start := time.Unix(1000, 0).UTC()
+	first := []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", start)}
+	second := []*monitoringpb.TimeSeries{testThrottleTimeSeries("custom.googleapis.com/foo", start.Add(time.Second))}
+
+	// The first point failed to be sent, so the second point is not throttled.
+	assert.Equal(t, first, throttle.filter(context.Background(), "my-project", first, nil))
+	assert.Equal(t, second, throttle.filter(context.Background(), "my-project", second, nil))
+
+	throttle.written("my-project", second)
+	assert.Empty(t, throttle.filter(context.Background(), "my-project", second, nil))
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/normalization"
+)
+
+const (
+	// normalizationStateFileName is the name of the file in the configured
+	// directory which stores the state of cumulative normalization.
+	normalizationStateFileName             = "gcp_metrics_normalization_state"
+	defaultNormalizationStateFlushInterval = time.Minute
+)
+
+func (me *MetricsExporter) normalizationStatePath() string {
+	return filepath.Join(me.cfg.MetricConfig.CumulativeNormalizationState.Directory, normalizationStateFileName)
+}
+
+// loadNormalizationState restores the points cached by the normalizer from
+// the state saved by a previous run, if any.
+func (me *MetricsExporter) loadNormalizationState() error {
+	normalizer, ok := me.mapper.normalizer.(normalization.StatefulNormalizer)
+	if !ok {
+		return nil
+	}
+	data, err := os.ReadFile(me.normalizationStatePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return normalizer.UnmarshalState(data)
+}
+
+// saveNormalizationState saves the points cached by the normalizer. The state
+// is written to a temporary file first, so a crash while saving doesn't
+// corrupt the previously saved state.
+func (me *MetricsExporter) saveNormalizationState() error {
+	normalizer, ok := me.mapper.normalizer.(normalization.StatefulNormalizer)
+	if !ok {
+		return nil
+	}
+	data, err := normalizer.MarshalState()
+	if err != nil {
+		return err
+	}
+	path := me.normalizationStatePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runNormalizationStateFlusher periodically saves the normalization state,
+// and saves it one last time on shutdown.
+func (me *MetricsExporter) runNormalizationStateFlusher() {
+	defer me.goroutines.Done()
+	interval := me.cfg.MetricConfig.CumulativeNormalizationState.FlushInterval
+	if interval == 0 {
+		interval = defaultNormalizationStateFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-me.shutdownC:
+			if err := me.saveNormalizationState(); err != nil {
+				me.obs.log.Error("Failed to save cumulative normalization state on shutdown.", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			if err := me.saveNormalizationState(); err != nil {
+				me.obs.log.Error("Failed to save cumulative normalization state.", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.uber.org/zap"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/datapointstorage"
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector/internal/normalization"
+)
+
+func newTestNormalizationStateExporter(dir string) *MetricsExporter {
+	cfg := DefaultConfig()
+	cfg.MetricConfig.CumulativeNormalizationState = &NormalizationStateConfig{Directory: dir, FlushInterval: time.Hour}
+	shutdownC := make(chan struct{})
+	return &MetricsExporter{
+		cfg:       cfg,
+		obs:       selfObservability{log: zap.NewNop()},
+		shutdownC: shutdownC,
+		mapper: metricMapper{
+			normalizer: normalization.NewStandardNormalizer(shutdownC, zap.NewNop(), datapointstorage.Config{}),
+		},
+	}
+}
+
+func testCumulativePoint(value int64, ts time.Time) pmetric.NumberDataPoint {
+	point := pmetric.NewNumberDataPoint()
+	point.SetIntValue(value)
+	point.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	return point
+}
+
+func TestNormalizationStatePersistsAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	me := newTestNormalizationStateExporter(dir)
+	// The first point without a start time is cached and dropped.
+	_, keep := me.mapper.normalizer.NormalizeNumberDataPoint(testCumulativePoint(10, now), "id")
+	require.False(t, keep)
+	require.NoError(t, me.saveNormalizationState())
+	close(me.shutdownC)
+
+	restarted := newTestNormalizationStateExporter(dir)
+	defer close(restarted.shutdownC)
+	require.NoError(t, restarted.loadNormalizationState())
+	// The next point is normalized against the start point from the previous run.
+	point, keep := restarted.mapper.normalizer.NormalizeNumberDataPoint(testCumulativePoint(15, now.Add(time.Minute)), "id")
+	require.True(t, keep)
+	assert.Equal(t, int64(5), point.IntValue())
+	assert.Equal(t, pcommon.NewTimestampFromTime(now), point.StartTimestamp())
+}
+
+func TestNormalizationStateMissing(t *testing.T) {
+	me := newTestNormalizationStateExporter(t.TempDir())
+	defer close(me.shutdownC)
+	assert.NoError(t, me.loadNormalizationState())
+}
+
+func TestNormalizationStateSavedOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+	me := newTestNormalizationStateExporter(dir)
+	_, keep := me.mapper.normalizer.NormalizeNumberDataPoint(testCumulativePoint(10, time.Now()), "id")
+	require.False(t, keep)
+
+	me.goroutines.Add(1)
+	go me.runNormalizationStateFlusher()
+	close(me.shutdownC)
+	me.goroutines.Wait()
+
+	_, err := os.Stat(filepath.Join(dir, normalizationStateFileName))
+	assert.NoError(t, err)
+}
@@ -16,45 +16,368 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"strconv"
+	"sync"
+	"time"
 
-	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
-	"go.opencensus.io/tag"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// scopeName is the instrumentation scope of the self-observability metrics.
+const scopeName = "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/collector"
+
 var (
-	pointCount                  = stats.Int64("googlecloudmonitoring/point_count", "Count of metric points written to Cloud Monitoring.", "1")
-	exemplarAttachmentDropCount = stats.Int64("googlecloudmonitoring/exemplar_attachments_dropped", "Count of exemplar attachments dropped.", "{attachments}")
-	statusKey                   = tag.MustNewKey("status")
+	statusKey     = attribute.Key("status")
+	walKey        = attribute.Key("wal")
+	reasonKey     = attribute.Key("reason")
+	cacheKey      = attribute.Key("cache")
+	correctionKey = attribute.Key("correction")
+	conflictKey   = attribute.Key("conflict")
+	projectKey    = attribute.Key("project")
 )
 
-var viewPointCount = &view.View{
-	Name:        pointCount.Name(),
-	Description: pointCount.Description(),
-	Measure:     pointCount,
-	Aggregation: view.Sum(),
-	TagKeys:     []tag.Key{statusKey},
-}
+// statusDropped is the status of log records which could not be converted to
+// log entries, and were dropped before being sent, and of spans which were
+// rejected with an error that can't be recovered by retrying.
+const statusDropped = "DROPPED"
 
 // MetricViews returns a slice of views for this exporter's metrics.
+//
+// Deprecated: The self-observability metrics are no longer recorded with
+// OpenCensus, so it returns no views. Use WithMeterProvider to record them
+// with OpenTelemetry instead.
 func MetricViews() []*view.View {
-	return []*view.View{viewPointCount}
+	return nil
+}
+
+// ExporterOption sets optional settings of the exporters created by
+// NewGoogleCloudMetricsExporter, NewGoogleCloudTracesExporter and
+// NewGoogleCloudLogsExporter.
+type ExporterOption func(*exporterOptions)
+
+type exporterOptions struct {
+	log           *zap.Logger
+	meterProvider metric.MeterProvider
+}
+
+// WithLogger sets the logger of the exporter. It overrides the logger passed
+// to NewGoogleCloudMetricsExporter and NewGoogleCloudLogsExporter. The traces
+// exporter doesn't log if it isn't set.
+func WithLogger(log *zap.Logger) ExporterOption {
+	return func(o *exporterOptions) {
+		o.log = log
+	}
+}
+
+// WithMeterProvider sets the MeterProvider used to record the exporter's
+// self-observability metrics, and the rpc.client.* metrics of its gRPC
+// clients. Nothing is recorded if it isn't set.
+func WithMeterProvider(meterProvider metric.MeterProvider) ExporterOption {
+	return func(o *exporterOptions) {
+		o.meterProvider = meterProvider
+	}
+}
+
+func newExporterOptions(log *zap.Logger, opts []ExporterOption) exporterOptions {
+	o := exporterOptions{log: log}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// self-observability reporting meters/tracers/loggers.
+type selfObservability struct {
+	// Logger to use for this exporter.
+	log *zap.Logger
+	// meterProvider is used to create the self-observability instruments,
+	// and to instrument the exporter's gRPC clients.
+	meterProvider metric.MeterProvider
+	// instruments records the self-observability metrics. Nothing is
+	// recorded when it is nil.
+	instruments *instruments
 }
 
-func recordExemplarFailure(ctx context.Context, point int) {
-	stats.Record(ctx, exemplarAttachmentDropCount.M(int64(point)))
+// instruments are the self-observability instruments of an exporter.
+type instruments struct {
+	pointCount                  metric.Int64Counter
+	exemplarAttachmentDropCount metric.Int64Counter
+	walEvictedCount             metric.Int64Counter
+	requestCorrectionCount      metric.Int64Counter
+	descriptorConflictCount     metric.Int64Counter
+	normalizationCacheEvicted   metric.Int64Counter
+	logEntryCount               metric.Int64Counter
+	splitLogEntryCount          metric.Int64Counter
+	logRequestSize              metric.Int64Histogram
+	logRequestLatency           metric.Float64Histogram
+	spanCount                   metric.Int64Counter
+	traceRequestSize            metric.Int64Histogram
+	traceRequestLatency         metric.Float64Histogram
+	walSize                     *lastValues
+	walBacklog                  *lastValues
+	normalizationCacheSize      *observedSizes
+	// registration of the callback observing the gauges above.
+	registration metric.Registration
 }
 
-func recordPointCountDataPoint(ctx context.Context, points int, statusValue string) {
-	ctx, err := tag.New(ctx, tag.Insert(statusKey, statusValue))
+// Prefixes of the self-observability metrics of each signal's exporter.
+const (
+	metricsObservabilityPrefix = "googlecloudmonitoring"
+	logsObservabilityPrefix    = "googlecloudlogging"
+	tracesObservabilityPrefix  = "googlecloudtrace"
+)
+
+// newSelfObservability creates the self-observability instruments of an
+// exporter with meterProvider. A nil meterProvider disables them. The metrics
+// which all exporters record, e.g. for the WAL, are named with signalPrefix.
+func newSelfObservability(log *zap.Logger, meterProvider metric.MeterProvider, signalPrefix string) (selfObservability, error) {
+	if meterProvider == nil {
+		meterProvider = noop.NewMeterProvider()
+	}
+	meter := meterProvider.Meter(scopeName)
+	var errs []error
+	counter := func(name, description, unit string) metric.Int64Counter {
+		c, err := meter.Int64Counter(name, metric.WithDescription(description), metric.WithUnit(unit))
+		errs = append(errs, err)
+		return c
+	}
+	sizeHistogram := func(name, description string) metric.Int64Histogram {
+		h, err := meter.Int64Histogram(name, metric.WithDescription(description), metric.WithUnit("By"))
+		errs = append(errs, err)
+		return h
+	}
+	latencyHistogram := func(name, description string) metric.Float64Histogram {
+		h, err := meter.Float64Histogram(name, metric.WithDescription(description), metric.WithUnit("ms"))
+		errs = append(errs, err)
+		return h
+	}
+	gauge := func(name, description, unit string) *lastValues {
+		g, err := meter.Int64ObservableGauge(name, metric.WithDescription(description), metric.WithUnit(unit))
+		errs = append(errs, err)
+		return &lastValues{gauge: g, values: make(map[attribute.Distinct]lastValue)}
+	}
+	inst := &instruments{
+		pointCount:                  counter("googlecloudmonitoring/point_count", "Count of metric points written to Cloud Monitoring.", "1"),
+		exemplarAttachmentDropCount: counter("googlecloudmonitoring/exemplar_attachments_dropped", "Count of exemplar attachments dropped.", "{attachments}"),
+		walEvictedCount:             counter(signalPrefix+"/wal_evicted_requests", "Count of requests evicted from the write ahead log without being exported.", "{requests}"),
+		requestCorrectionCount:      counter("googlecloudmonitoring/request_corrections", "Count of corrections made to time series to satisfy Cloud Monitoring's request limits.", "{corrections}"),
+		descriptorConflictCount:     counter("googlecloudmonitoring/metric_descriptor_conflicts", "Count of existing metric descriptors found to conflict with the metrics written.", "{conflicts}"),
+		normalizationCacheEvicted:   counter("googlecloudmonitoring/normalization_cache_evicted_points", "Count of points evicted from the cumulative normalization cache.", "{points}"),
+		logEntryCount:               counter("googlecloudlogging/log_entry_count", "Count of log entries written to Cloud Logging.", "{entries}"),
+		splitLogEntryCount:          counter("googlecloudlogging/split_log_entry_count", "Count of log entries created by splitting log records larger than the maximum entry size.", "{entries}"),
+		logRequestSize:              sizeHistogram("googlecloudlogging/request_size", "Size of the WriteLogEntries requests sent to Cloud Logging."),
+		logRequestLatency:           latencyHistogram("googlecloudlogging/request_latency", "Latency of the WriteLogEntries requests sent to Cloud Logging."),
+		spanCount:                   counter("googlecloudtrace/span_count", "Count of spans written to Cloud Trace.", "{spans}"),
+		traceRequestSize:            sizeHistogram("googlecloudtrace/request_size", "Size of the BatchWriteSpans requests sent to Cloud Trace."),
+		traceRequestLatency:         latencyHistogram("googlecloudtrace/request_latency", "Latency of the BatchWriteSpans requests sent to Cloud Trace."),
+		walSize:                     gauge(signalPrefix+"/wal_size", "Size of the write ahead log on disk.", "By"),
+		walBacklog:                  gauge(signalPrefix+"/wal_backlog", "Number of requests in the write ahead log waiting to be exported.", "{requests}"),
+	}
+	cacheSize, err := meter.Int64ObservableGauge("googlecloudmonitoring/normalization_cache_size", metric.WithDescription("Number of points cached for cumulative normalization."), metric.WithUnit("{points}"))
+	errs = append(errs, err)
+	inst.normalizationCacheSize = &observedSizes{gauge: cacheSize, sizes: make(map[string]func() int)}
+	if err := errors.Join(errs...); err != nil {
+		return selfObservability{}, err
+	}
+	registration, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		inst.walSize.observe(o)
+		inst.walBacklog.observe(o)
+		inst.normalizationCacheSize.observe(o)
+		return nil
+	}, inst.walSize.gauge, inst.walBacklog.gauge, inst.normalizationCacheSize.gauge)
 	if err != nil {
+		return selfObservability{}, err
+	}
+	inst.registration = registration
+	return selfObservability{log: log, meterProvider: meterProvider, instruments: inst}, nil
+}
+
+// shutdown stops observing the gauges of the exporter.
+func (o selfObservability) shutdown() {
+	if o.instruments == nil {
+		return
+	}
+	if err := o.instruments.registration.Unregister(); err != nil && o.log != nil {
+		o.log.Warn("Failed to unregister self-observability callback.", zap.Error(err))
+	}
+}
+
+// lastValues holds the last value recorded for each set of attributes of a
+// gauge, which are reported when the gauge is observed.
+type lastValues struct {
+	gauge  metric.Int64ObservableGauge
+	values map[attribute.Distinct]lastValue
+	mutex  sync.Mutex
+}
+
+type lastValue struct {
+	attributes attribute.Set
+	value      int64
+}
+
+func (lv *lastValues) record(value int64, attrs ...attribute.KeyValue) {
+	set := attribute.NewSet(attrs...)
+	lv.mutex.Lock()
+	defer lv.mutex.Unlock()
+	lv.values[set.Equivalent()] = lastValue{attributes: set, value: value}
+}
+
+func (lv *lastValues) remove(attrs ...attribute.KeyValue) {
+	set := attribute.NewSet(attrs...)
+	lv.mutex.Lock()
+	defer lv.mutex.Unlock()
+	delete(lv.values, set.Equivalent())
+}
+
+func (lv *lastValues) observe(o metric.Observer) {
+	lv.mutex.Lock()
+	defer lv.mutex.Unlock()
+	for _, v := range lv.values {
+		o.ObserveInt64(lv.gauge, v.value, metric.WithAttributeSet(v.attributes))
+	}
+}
+
+// observedSizes holds a function returning the current size of each named
+// cache, which are called when the gauge is observed.
+type observedSizes struct {
+	gauge metric.Int64ObservableGauge
+	sizes map[string]func() int
+	mutex sync.Mutex
+}
+
+func (s *observedSizes) register(name string, size func() int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sizes[name] = size
+}
+
+func (s *observedSizes) observe(o metric.Observer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for name, size := range s.sizes {
+		o.ObserveInt64(s.gauge, int64(size()), metric.WithAttributes(cacheKey.String(name)))
+	}
+}
+
+func (o selfObservability) recordExemplarFailure(ctx context.Context, point int) {
+	if o.instruments == nil {
 		return
 	}
+	o.instruments.exemplarAttachmentDropCount.Add(ctx, int64(point))
+}
+
+func (o selfObservability) recordPointCountDataPoint(ctx context.Context, points int, statusValue string) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.pointCount.Add(ctx, int64(points), metric.WithAttributes(statusKey.String(statusValue)))
+}
+
+func (o selfObservability) recordRequestCorrection(ctx context.Context, count int, correction string) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.requestCorrectionCount.Add(ctx, int64(count), metric.WithAttributes(correctionKey.String(correction)))
+}
+
+func (o selfObservability) recordDescriptorConflict(ctx context.Context, conflict string) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.descriptorConflictCount.Add(ctx, 1, metric.WithAttributes(conflictKey.String(conflict)))
+}
+
+func (o selfObservability) recordWALStats(walName string, sizeBytes int64, backlog int64) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.walSize.record(sizeBytes, walKey.String(walName))
+	o.instruments.walBacklog.record(backlog, walKey.String(walName))
+}
+
+// forgetWALStats stops reporting the size and backlog of a removed WAL.
+func (o selfObservability) forgetWALStats(walName string) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.walSize.remove(walKey.String(walName))
+	o.instruments.walBacklog.remove(walKey.String(walName))
+}
+
+func (o selfObservability) recordWALEviction(ctx context.Context, walName string, requests int, reason string) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.walEvictedCount.Add(ctx, int64(requests), metric.WithAttributes(walKey.String(walName), reasonKey.String(reason)))
+}
+
+// observeNormalizationCacheSize reports the size of a normalization cache
+// when the self-observability metrics are collected.
+func (o selfObservability) observeNormalizationCacheSize(cache string, size func() int) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.normalizationCacheSize.register(cache, size)
+}
+
+func (o selfObservability) recordNormalizationCacheEviction(cache string, points int, reason string) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.normalizationCacheEvicted.Add(context.Background(), int64(points), metric.WithAttributes(cacheKey.String(cache), reasonKey.String(reason)))
+}
+
+func (o selfObservability) recordLogEntryCount(ctx context.Context, entries int, project, statusValue string) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.logEntryCount.Add(ctx, int64(entries), metric.WithAttributes(projectKey.String(project), statusKey.String(statusValue)))
+}
+
+func (o selfObservability) recordDroppedLogRecord(project string) {
+	o.recordLogEntryCount(context.Background(), 1, project, statusDropped)
+}
+
+func (o selfObservability) recordSplitLogEntries(entries int, project string) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.splitLogEntryCount.Add(context.Background(), int64(entries), metric.WithAttributes(projectKey.String(project)))
+}
+
+// recordLogRequest records the size and latency of a request. project is ""
+// for requests with entries in several projects, which are recorded without a
+// project.
+func (o selfObservability) recordLogRequest(ctx context.Context, sizeBytes int, latency time.Duration, project, statusValue string) {
+	if o.instruments == nil {
+		return
+	}
+	var attrs []attribute.KeyValue
+	if project != "" {
+		attrs = append(attrs, projectKey.String(project))
+	}
+	o.instruments.logRequestSize.Record(ctx, int64(sizeBytes), metric.WithAttributes(attrs...))
+	o.instruments.logRequestLatency.Record(ctx, durationMillis(latency), metric.WithAttributes(append(attrs, statusKey.String(statusValue))...))
+}
+
+func (o selfObservability) recordTraceRequest(ctx context.Context, spans int, sizeBytes int, latency time.Duration, project, spanStatus, requestStatus string) {
+	if o.instruments == nil {
+		return
+	}
+	o.instruments.spanCount.Add(ctx, int64(spans), metric.WithAttributes(projectKey.String(project), statusKey.String(spanStatus)))
+	o.instruments.traceRequestSize.Record(ctx, int64(sizeBytes), metric.WithAttributes(projectKey.String(project)))
+	o.instruments.traceRequestLatency.Record(ctx, durationMillis(latency), metric.WithAttributes(projectKey.String(project), statusKey.String(requestStatus)))
+}
 
-	stats.Record(ctx, pointCount.M(int64(points)))
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
 
 func statusCodeToString(s *status.Status) string {
@@ -20,39 +20,82 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	traceapi "cloud.google.com/go/trace/apiv2"
-	"go.opencensus.io/plugin/ocgrpc"
-	"go.opencensus.io/stats/view"
+	"cloud.google.com/go/trace/apiv2/tracepb"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/otel/attribute"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
 )
 
+const (
+	// The name of the traces WAL in the user-configured WAL directory.
+	tracesWALName = "gcp_traces_wal"
+)
+
 // TraceExporter is a wrapper struct of OT cloud trace exporter.
 type TraceExporter struct {
+	// write ahead log handles exporter retries in-order to handle network outages
+	wal       *exporterWAL
+	obs       selfObservability
 	texporter *texporter.Exporter
+	// shutdownC is a channel for signaling a graceful shutdown
+	shutdownC chan struct{}
 	cfg       Config
-	timeout   time.Duration
+	// goroutines tracks the currently running child tasks
+	goroutines sync.WaitGroup
+	timeout    time.Duration
 }
 
 func (te *TraceExporter) Shutdown(ctx context.Context) error {
+	close(te.shutdownC)
+	c := make(chan struct{})
+	go func() {
+		// Wait until all goroutines are done
+		te.goroutines.Wait()
+		close(c)
+	}()
+	select {
+	case <-ctx.Done():
+		te.obs.log.Error("Error waiting for async tasks to finish.", zap.Error(ctx.Err()))
+	case <-c:
+	}
+	te.obs.shutdown()
 	if te.texporter != nil {
 		return te.texporter.Shutdown(ctx)
 	}
 	return nil
 }
 
-func NewGoogleCloudTracesExporter(ctx context.Context, cfg Config, version string, timeout time.Duration) (*TraceExporter, error) {
-	// TODO: https://github.com/GoogleCloudPlatform/opentelemetry-operations-go/pull/537#discussion_r1038290097
-	//nolint:errcheck
-	view.Register(ocgrpc.DefaultClientViews...)
+func NewGoogleCloudTracesExporter(
+	ctx context.Context,
+	cfg Config,
+	version string,
+	timeout time.Duration,
+	opts ...ExporterOption,
+) (*TraceExporter, error) {
 	setVersionInUserAgent(&cfg, version)
-	return &TraceExporter{cfg: cfg, timeout: timeout}, nil
+	o := newExporterOptions(zap.NewNop(), opts)
+	obs, err := newSelfObservability(o.log, o.meterProvider, tracesObservabilityPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &TraceExporter{
+		cfg:       cfg,
+		obs:       obs,
+		shutdownC: make(chan struct{}),
+		timeout:   timeout,
+	}, nil
 }
 
 func (te *TraceExporter) Start(ctx context.Context, _ component.Host) error {
@@ -69,7 +112,7 @@ func (te *TraceExporter) Start(ctx context.Context, _ component.Host) error {
 		topts = append(topts, texporter.WithAttributeMapping(mappingFuncFromAKM(te.cfg.TraceConfig.AttributeMappings)))
 	}
 
-	copts, err := generateClientOptions(ctx, &te.cfg.TraceConfig.ClientConfig, &te.cfg, traceapi.DefaultAuthScopes())
+	copts, err := generateClientOptions(ctx, &te.cfg.TraceConfig.ClientConfig, &te.cfg, traceapi.DefaultAuthScopes(), te.obs.meterProvider)
 	if err != nil {
 		return err
 	}
@@ -80,9 +123,87 @@ func (te *TraceExporter) Start(ctx context.Context, _ component.Host) error {
 		return fmt.Errorf("error creating GoogleCloud Trace exporter: %w", err)
 	}
 	te.texporter = exp
+
+	if te.cfg.TraceConfig.WALConfig != nil {
+		_, _, err = te.setupWAL()
+		if err != nil {
+			return err
+		}
+		// start WAL popper routine
+		te.goroutines.Add(1)
+		go te.runWALReadAndExportLoop(ctx)
+	}
 	return nil
 }
 
+// setupWAL creates the WAL.
+// This function is also used to re-sync after writes, so it closes the existing WAL if present.
+// It returns the FirstIndex, LastIndex, and any error.
+func (te *TraceExporter) setupWAL() (uint64, uint64, error) {
+	if te.wal == nil {
+		te.wal = &exporterWAL{}
+	}
+	te.wal.obs = te.obs
+	if te.wal.obs.log == nil {
+		te.wal.obs.log = zap.NewNop()
+	}
+	te.wal.export = te.exportFromWAL
+	te.wal.timestamp = func(bytes []byte) (time.Time, error) {
+		req := new(tracepb.BatchWriteSpansRequest)
+		if err := proto.Unmarshal(bytes, req); err != nil {
+			return time.Time{}, err
+		}
+		var newest time.Time
+		for _, span := range req.Spans {
+			if end := span.GetEndTime(); end != nil && end.AsTime().After(newest) {
+				newest = end.AsTime()
+			}
+		}
+		return newest, nil
+	}
+	return te.wal.setup(te.cfg.TraceConfig.WALConfig, tracesWALName)
+}
+
+// exportFromWAL sends a serialized BatchWriteSpansRequest read from the WAL.
+func (te *TraceExporter) exportFromWAL(ctx context.Context, bytes []byte) error {
+	req := new(tracepb.BatchWriteSpansRequest)
+	if err := proto.Unmarshal(bytes, req); err != nil {
+		return err
+	}
+	return te.uploadRequest(ctx, req)
+}
+
+// uploadRequest sends a BatchWriteSpansRequest to Cloud Trace, and records
+// the spans sent, and the size and latency of the request. Spans which failed
+// with an error that can't be recovered by retrying are dropped: they are
+// counted as dropped, and a permanent error is returned so that they aren't
+// retried.
+func (te *TraceExporter) uploadRequest(ctx context.Context, req *tracepb.BatchWriteSpansRequest) error {
+	start := time.Now()
+	err := te.texporter.UploadBatchWriteSpansRequest(ctx, req)
+	requestStatus := statusCodeToString(status.Convert(err))
+	spanStatus := requestStatus
+	if err != nil && isNotRecoverable(err) {
+		spanStatus = statusDropped
+		err = consumererror.NewPermanent(err)
+	}
+	te.obs.recordTraceRequest(
+		ctx,
+		len(req.Spans),
+		proto.Size(req),
+		time.Since(start),
+		strings.TrimPrefix(req.Name, "projects/"),
+		spanStatus,
+		requestStatus,
+	)
+	return err
+}
+
+func (te *TraceExporter) runWALReadAndExportLoop(ctx context.Context) {
+	defer te.goroutines.Done()
+	te.wal.runReadAndExportLoop(ctx, te.shutdownC)
+}
+
 func mappingFuncFromAKM(akm []AttributeMapping) func(attribute.Key) attribute.Key {
 	// convert list to map for easy lookups
 	mapFromConfig := make(map[string]string, len(akm))
@@ -111,5 +232,19 @@ func (te *TraceExporter) PushTraces(ctx context.Context, td ptrace.Traces) error
 		spans = append(spans, sd...)
 	}
 
-	return te.texporter.ExportSpans(ctx, spans)
+	if te.wal == nil {
+		var errs []error
+		for _, req := range te.texporter.BatchWriteSpansRequests(spans) {
+			errs = append(errs, te.uploadRequest(ctx, req))
+		}
+		return errors.Join(errs...)
+	}
+	// push requests onto the WAL
+	te.wal.mutex.Lock()
+	defer te.wal.mutex.Unlock()
+	var errs []error
+	for _, req := range te.texporter.BatchWriteSpansRequests(spans) {
+		errs = append(errs, te.wal.writeRequest(ctx, req))
+	}
+	return errors.Join(errs...)
 }
@@ -24,19 +24,30 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type testServer struct {
 	reqCh chan *tracepb.BatchWriteSpansRequest
+	err   error
 }
 
 func (ts *testServer) BatchWriteSpans(ctx context.Context, req *tracepb.BatchWriteSpansRequest) (*emptypb.Empty, error) {
 	go func() { ts.reqCh <- req }()
+	if ts.err != nil {
+		return nil, ts.err
+	}
 	return &emptypb.Empty{}, nil
 }
 
@@ -135,3 +146,144 @@ func TestGoogleCloudTraceExport(t *testing.T) {
 		})
 	}
 }
+
+func TestGoogleCloudTraceExportWithWAL(t *testing.T) {
+	ctx := context.Background()
+	srv := grpc.NewServer()
+	reqCh := make(chan *tracepb.BatchWriteSpansRequest)
+	tracepb.RegisterTraceServiceServer(srv, &testServer{reqCh: reqCh})
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	//nolint:errcheck
+	go srv.Serve(lis)
+	cfg := Config{
+		ProjectID: "idk",
+		TraceConfig: TraceConfig{
+			ClientConfig: ClientConfig{
+				Endpoint:    lis.Addr().String(),
+				UseInsecure: true,
+			},
+			WALConfig: &WALConfig{
+				Directory: t.TempDir(),
+			},
+		},
+	}
+	sde, err := NewGoogleCloudTracesExporter(ctx, cfg, "latest", DefaultTimeout)
+	require.NoError(t, err)
+	require.NoError(t, sde.Start(ctx, componenttest.NewNopHost()))
+	defer func() { require.NoError(t, sde.Shutdown(ctx)) }()
+
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("foobar")
+	require.NoError(t, sde.PushTraces(ctx, traces))
+
+	select {
+	case r := <-reqCh:
+		assert.Equal(t, "projects/idk", r.Name)
+		require.Len(t, r.Spans, 1)
+		assert.Equal(t, "foobar", r.Spans[0].GetDisplayName().Value)
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timed out waiting for BatchWriteSpans request")
+	}
+}
+
+func TestGoogleCloudTracesExporterWithLogger(t *testing.T) {
+	sde, err := NewGoogleCloudTracesExporter(context.Background(), DefaultConfig(), "latest", DefaultTimeout)
+	require.NoError(t, err)
+	assert.NotNil(t, sde.obs.log)
+
+	logger := zap.NewExample()
+	sde, err = NewGoogleCloudTracesExporter(context.Background(), DefaultConfig(), "latest", DefaultTimeout, WithLogger(logger))
+	require.NoError(t, err)
+	assert.Same(t, logger, sde.obs.log)
+}
+
+func TestGoogleCloudTraceExportSelfObservability(t *testing.T) {
+	ctx := context.Background()
+	srv := grpc.NewServer()
+	reqCh := make(chan *tracepb.BatchWriteSpansRequest)
+	tracepb.RegisterTraceServiceServer(srv, &testServer{reqCh: reqCh})
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	//nolint:errcheck
+	go srv.Serve(lis)
+	cfg := Config{
+		ProjectID: "idk",
+		TraceConfig: TraceConfig{
+			ClientConfig: ClientConfig{
+				Endpoint:    lis.Addr().String(),
+				UseInsecure: true,
+			},
+		},
+	}
+	reader := sdkmetric.NewManualReader()
+	sde, err := NewGoogleCloudTracesExporter(ctx, cfg, "latest", DefaultTimeout, WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	require.NoError(t, err)
+	require.NoError(t, sde.Start(ctx, componenttest.NewNopHost()))
+	defer func() { require.NoError(t, sde.Shutdown(ctx)) }()
+
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	spans.AppendEmpty().SetName("foo")
+	spans.AppendEmpty().SetName("bar")
+	require.NoError(t, sde.PushTraces(ctx, traces))
+	<-reqCh
+
+	spanCount := collectSelfObservabilityMetric(t, reader, "googlecloudtrace/span_count").(metricdata.Sum[int64])
+	require.Len(t, spanCount.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(projectKey.String("idk"), statusKey.String("OK")), spanCount.DataPoints[0].Attributes)
+	assert.Equal(t, int64(2), spanCount.DataPoints[0].Value)
+
+	latency := collectSelfObservabilityMetric(t, reader, "googlecloudtrace/request_latency").(metricdata.Histogram[float64])
+	require.Len(t, latency.DataPoints, 1)
+	assert.Equal(t, uint64(1), latency.DataPoints[0].Count)
+}
+
+func TestGoogleCloudTraceExportDroppedSpans(t *testing.T) {
+	ctx := context.Background()
+	srv := grpc.NewServer()
+	reqCh := make(chan *tracepb.BatchWriteSpansRequest)
+	tracepb.RegisterTraceServiceServer(srv, &testServer{reqCh: reqCh, err: status.Error(codes.InvalidArgument, "invalid span")})
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	//nolint:errcheck
+	go srv.Serve(lis)
+	cfg := Config{
+		ProjectID: "idk",
+		TraceConfig: TraceConfig{
+			ClientConfig: ClientConfig{
+				Endpoint:    lis.Addr().String(),
+				UseInsecure: true,
+			},
+		},
+	}
+	reader := sdkmetric.NewManualReader()
+	sde, err := NewGoogleCloudTracesExporter(ctx, cfg, "latest", DefaultTimeout, WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	require.NoError(t, err)
+	require.NoError(t, sde.Start(ctx, componenttest.NewNopHost()))
+	defer func() { require.NoError(t, sde.Shutdown(ctx)) }()
+
+	traces := ptrace.NewTraces()
+	traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty().SetName("foo")
+	err = sde.PushTraces(ctx, traces)
+	<-reqCh
+	assert.True(t, consumererror.IsPermanent(err), "spans rejected as invalid should not be retried")
+
+	spanCount := collectSelfObservabilityMetric(t, reader, "googlecloudtrace/span_count").(metricdata.Sum[int64])
+	require.Len(t, spanCount.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(projectKey.String("idk"), statusKey.String(statusDropped)), spanCount.DataPoints[0].Attributes)
+
+	latency := collectSelfObservabilityMetric(t, reader, "googlecloudtrace/request_latency").(metricdata.Histogram[float64])
+	require.Len(t, latency.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(projectKey.String("idk"), statusKey.String("INVALID_ARGUMENT")), latency.DataPoints[0].Attributes)
+}
@@ -0,0 +1,608 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/tidwall/wal"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// The default amount of time to retry a request on network outage when
+	// WAL is enabled before discarding. Users can override by setting WALConfig.MaxBackoff.
+	defaultWalMaxBackoff = time.Duration(3600 * time.Second)
+
+	// Reasons requests are evicted from the WAL, used in logs and metrics.
+	walEvictionReasonMaxSize        = "max_size"
+	walEvictionReasonMaxAge         = "max_age"
+	walEvictionReasonNotRecoverable = "not_recoverable"
+	walEvictionReasonMaxBackoff     = "max_backoff"
+
+	// walDeadLetterDirectory is the directory, relative to the configured WAL
+	// directory, which holds the dead-letter WALs.
+	walDeadLetterDirectory = "dead_letter"
+)
+
+// errWALIdle is returned by watch when nothing was written to the WAL within
+// its idle timeout.
+var errWALIdle = errors.New("WAL is idle")
+
+// exporterWAL is a write ahead log of serialized requests. Requests are
+// written to the end of the WAL by the exporter, and read from the front of
+// the WAL by runWALReadAndExportLoop, which exports them in-order.
+type exporterWAL struct {
+	*wal.Log
+	// export sends a serialized request read from the WAL.
+	export func(context.Context, []byte) error
+	// timestamp returns the time of the newest data in a serialized request,
+	// which is used to evict requests older than maxAge. Optional.
+	timestamp func([]byte) (time.Time, error)
+	// failed returns the part of a serialized request which failed to export
+	// with err, and whether it can be retried. Optional. By default, the
+	// whole request is retried if the error is recoverable.
+	failed func(bytes []byte, err error) ([]byte, bool)
+	// deadLetter stores requests which permanently failed to export, so that
+	// they can be inspected and replayed later. nil if disabled.
+	deadLetter *exporterWAL
+	obs        selfObservability
+	// the name of the WAL, used as the WAL directory name and in self-observability.
+	name string
+	// the full path of the WAL (user-configured directory + WAL name)
+	path       string
+	maxBackoff time.Duration
+	// maxSizeBytes is the maximum size of the WAL on disk. 0 means unlimited.
+	maxSizeBytes int64
+	// totalSize returns the size on disk of all the WALs which share
+	// maxSizeBytes with this WAL. Optional. By default, maxSizeBytes only
+	// bounds this WAL.
+	totalSize func() (int64, error)
+	// idleTimeout is how long the WAL may stay empty before removeIfIdle is
+	// called. 0 means the WAL is never considered idle.
+	idleTimeout time.Duration
+	// removeIfIdle removes the WAL if it is still empty, and returns whether
+	// it was removed, which stops the read and export loop. Optional.
+	removeIfIdle func() bool
+	// maxAge is the maximum age of a request before it is evicted. 0 means unlimited.
+	maxAge time.Duration
+	// mutex guards the WAL file. It is held by writers, and by the read and
+	// export loop while reading and truncating, but not while exporting.
+	mutex sync.Mutex
+}
+
+// setup creates the WAL in the configured directory.
+// This function is also used to re-sync after writes, so it closes the existing WAL if present.
+// It returns the FirstIndex, LastIndex, and any error.
+func (w *exporterWAL) setup(cfg *WALConfig, name string) (uint64, uint64, error) {
+	w.name = name
+	w.path = filepath.Join(cfg.Directory, name)
+	// default to 1 hour exponential backoff
+	w.maxBackoff = defaultWalMaxBackoff
+	if cfg.MaxBackoff != 0 {
+		w.maxBackoff = cfg.MaxBackoff
+	}
+	w.maxSizeBytes = cfg.MaxSizeBytes
+	w.maxAge = cfg.MaxAge
+	if cfg.DeadLetter && w.deadLetter == nil {
+		obs := w.obs
+		if obs.log == nil {
+			obs.log = zap.NewNop()
+		}
+		w.deadLetter = &exporterWAL{
+			obs:          obs,
+			name:         name + "_" + walDeadLetterDirectory,
+			path:         filepath.Join(cfg.Directory, walDeadLetterDirectory, name),
+			maxSizeBytes: cfg.MaxSizeBytes,
+		}
+		if _, _, err := w.deadLetter.reopen(); err != nil {
+			return 0, 0, fmt.Errorf("failed to open dead-letter WAL: %w", err)
+		}
+	}
+	return w.reopen()
+}
+
+// reopen closes and reopens the WAL to sync indices.
+func (w *exporterWAL) reopen() (uint64, uint64, error) {
+	err := w.closeLog()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	log, err := wal.Open(w.path, &wal.Options{LogFormat: 1})
+	if err != nil {
+		return 0, 0, err
+	}
+	w.Log = log
+
+	// sync existing WAL indices
+	rIndex, err := w.FirstIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	wIndex, err := w.LastIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rIndex, wIndex, nil
+}
+
+// close closes the WAL and its dead-letter WAL.
+func (w *exporterWAL) close() error {
+	if w == nil {
+		return nil
+	}
+	return errors.Join(w.closeLog(), w.deadLetter.close())
+}
+
+func (w *exporterWAL) closeLog() error {
+	if w != nil && w.Log != nil {
+		err := w.Log.Close()
+		w.Log = nil
+		return err
+	}
+	return nil
+}
+
+// writeRequest appends a request to the end of the WAL, evicting the oldest
+// entries if the WAL is over its maximum size. The caller must hold the mutex.
+func (w *exporterWAL) writeRequest(ctx context.Context, req proto.Message) error {
+	bytes, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal protobuf to bytes: %+v", err)
+	}
+	return w.write(ctx, bytes)
+}
+
+// write appends a serialized request to the end of the WAL. See writeRequest.
+func (w *exporterWAL) write(ctx context.Context, bytes []byte) error {
+	writeIndex, err := w.LastIndex()
+	if err != nil {
+		return fmt.Errorf("failed to get LastIndex of WAL: %+v", err)
+	}
+
+	err = w.Write(writeIndex+1, bytes)
+	if err != nil {
+		return fmt.Errorf("failed to write to WAL: %+v", err)
+	}
+	if err = w.enforceMaxSize(ctx); err != nil {
+		return fmt.Errorf("failed to evict entries from WAL: %+v", err)
+	}
+	w.recordStats()
+	return nil
+}
+
+// enforceMaxSize drops the oldest entries in the WAL until it is smaller
+// than maxSizeBytes. If the WAL shares maxSizeBytes with other WALs, entries
+// are dropped from this WAL until all of them together are smaller than
+// maxSizeBytes. The most recent entry is always kept.
+func (w *exporterWAL) enforceMaxSize(ctx context.Context) error {
+	if w.maxSizeBytes <= 0 {
+		return nil
+	}
+	for {
+		size, err := w.diskSize()
+		if err != nil {
+			return err
+		}
+		total := size
+		if w.totalSize != nil {
+			if total, err = w.totalSize(); err != nil {
+				return err
+			}
+		}
+		if total <= w.maxSizeBytes {
+			return nil
+		}
+		firstIndex, err := w.FirstIndex()
+		if err != nil {
+			return err
+		}
+		lastIndex, err := w.LastIndex()
+		if err != nil {
+			return err
+		}
+		if firstIndex >= lastIndex || size == 0 {
+			return nil
+		}
+		// Assume entries are roughly the same size, and drop enough of the
+		// oldest entries to get back under the limit.
+		overFraction := float64(total-w.maxSizeBytes) / float64(size)
+		drop := uint64(math.Ceil(overFraction * float64(lastIndex-firstIndex+1)))
+		if firstIndex+drop > lastIndex {
+			drop = lastIndex - firstIndex
+		}
+		w.obs.log.Warn("WAL is over its maximum size, dropping oldest entries.",
+			zap.String("path", w.path), zap.Int64("size_bytes", total), zap.Uint64("dropped_entries", drop))
+		if err := w.TruncateFront(firstIndex + drop); err != nil {
+			return err
+		}
+		w.obs.recordWALEviction(ctx, w.name, int(drop), walEvictionReasonMaxSize)
+	}
+}
+
+// expired returns true if the serialized request is older than maxAge.
+func (w *exporterWAL) expired(bytes []byte) bool {
+	if w.maxAge <= 0 || w.timestamp == nil {
+		return false
+	}
+	ts, err := w.timestamp(bytes)
+	if err != nil || ts.IsZero() {
+		return false
+	}
+	return time.Since(ts) > w.maxAge
+}
+
+// evictExpired drops a request that is older than maxAge instead of exporting it.
+func (w *exporterWAL) evictExpired(ctx context.Context, index uint64) {
+	w.obs.log.Warn("WAL entry is older than its maximum age, dropping it.",
+		zap.String("path", w.path), zap.Uint64("index", index), zap.Duration("max_age", w.maxAge))
+	w.obs.recordWALEviction(ctx, w.name, 1, walEvictionReasonMaxAge)
+}
+
+// recordStats records the current size and backlog of the WAL.
+func (w *exporterWAL) recordStats() {
+	size, err := w.diskSize()
+	if err != nil {
+		w.obs.log.Debug("failed to get WAL size", zap.Error(err))
+		return
+	}
+	backlog, err := w.backlog()
+	if err != nil {
+		w.obs.log.Debug("failed to get WAL backlog", zap.Error(err))
+		return
+	}
+	w.obs.recordWALStats(w.name, size, backlog)
+}
+
+// backlog returns the number of requests waiting to be exported. The empty
+// entry used to mark the end of the WAL is not counted.
+func (w *exporterWAL) backlog() (int64, error) {
+	firstIndex, err := w.FirstIndex()
+	if err != nil {
+		return 0, err
+	}
+	lastIndex, err := w.LastIndex()
+	if err != nil {
+		return 0, err
+	}
+	if firstIndex == 0 {
+		return 0, nil
+	}
+	backlog := int64(lastIndex - firstIndex + 1)
+	bytes, err := w.Read(firstIndex)
+	if err != nil {
+		return 0, err
+	}
+	if len(bytes) == 0 {
+		backlog--
+	}
+	return backlog, nil
+}
+
+// diskSize returns the total size of the WAL's segment files.
+func (w *exporterWAL) diskSize() (int64, error) {
+	return dirSize(w.path)
+}
+
+// dirSize returns the total size of the files in a directory.
+func dirSize(path string) (int64, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// readAndExport pops the next request from the WAL and tries exporting it.
+// If the export is successful (or fails for a non-retryable error), the read index is incremented
+// so the next entry in the WAL can be read by a subsequent call to readAndExport().
+// If the export fails for a (retryable) network error, it will keep trying to export the same entry
+// until success or the backoff max is reached.
+// The mutex is only held to read and truncate the WAL, so that writes aren't
+// blocked while exporting and backing off.
+func (w *exporterWAL) readAndExport(ctx context.Context) error {
+	readIndex, bytes, err := w.readNext()
+	if err != nil {
+		return err
+	}
+
+	// empty requests are used to signal the end of pending data, so skip them.
+	if len(bytes) > 0 {
+		if w.expired(bytes) {
+			w.evictExpired(ctx, readIndex)
+		} else {
+			w.exportWithRetry(ctx, readIndex, bytes)
+		}
+	}
+	return w.truncateRead(readIndex, len(bytes) > 0)
+}
+
+// readNext syncs the WAL indices and returns the request at the front of the WAL.
+func (w *exporterWAL) readNext() (uint64, []byte, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// close and reopen the WAL to sync indices
+	readIndex, _, err := w.reopen()
+	if err != nil {
+		return 0, nil, err
+	}
+	bytes, err := w.Read(readIndex)
+	if err != nil {
+		return 0, nil, err
+	}
+	return readIndex, bytes, nil
+}
+
+// truncateRead removes the request at readIndex, which has been read by
+// readNext, from the front of the WAL. nonEmpty is whether the request was a
+// real request, rather than the empty request marking the end of the WAL.
+func (w *exporterWAL) truncateRead(readIndex uint64, nonEmpty bool) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// Requests may have been written, and the oldest ones evicted, while exporting.
+	firstIndex, err := w.FirstIndex()
+	if err != nil {
+		return err
+	}
+	writeIndex, err := w.LastIndex()
+	if err != nil {
+		return err
+	}
+	if firstIndex > readIndex {
+		// The request was already evicted to keep the WAL under its maximum size.
+		w.recordStats()
+		return nil
+	}
+
+	// If we are at the last index, and this last index is not an empty request
+	// (we use empty requests to fill out the end of a log, and if we didn't check for them
+	// this would loop constantly adding empty requests onto the end)
+	if readIndex == writeIndex && nonEmpty {
+		// This indicates that we are trying to truncate the last item in the WAL.
+		// If that is the case, write an empty request so we can truncate the last real request
+		// (the WAL library requires at least 1 entry).
+		// Doing so prevents double-exporting in the event of a collector restart.
+		writeIndex++
+		err = w.Write(writeIndex, []byte{})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Truncate if readIndex < writeIndex.
+	// This only happens if there are more entries in the WAL
+	// OR, we are at the last real entry and added an "empty" entry above, in which we also increment writeIndex.
+	// otherwise, we've reached the end of the WAL and should be at an empty entry, which the export drops.
+	// If that's the case, and we try to truncate (ie, move readIndex+1), the library returns ErrOutOfRange.
+	if readIndex >= writeIndex {
+		// wal.ErrNotFound is used by wal.Read() to indicate the end of the WAL, but
+		// the wal library doesn't know about our hackery around empty entries.
+		// So it's used by us to indicate the same.
+		return wal.ErrNotFound
+	}
+	if err = w.TruncateFront(readIndex + 1); err != nil {
+		return err
+	}
+	w.recordStats()
+	return nil
+}
+
+// exportWithRetry exports a serialized request, retrying with exponential
+// backoff on retryable errors. If the server asks for a longer delay (e.g. when
+// quota is exhausted), that delay is used instead. When only part of the
+// request fails, only the failed part is retried. Requests which fail
+// permanently are moved to the dead-letter WAL, if enabled.
+func (w *exporterWAL) exportWithRetry(ctx context.Context, index uint64, bytes []byte) {
+	// on network failures, retry exponentially a max of 11 times (2^12s > 48 hours, older than allowed by GCM)
+	// or until user-configured max backoff is hit.
+	for i := 0; i < 12; i++ {
+		err := w.export(ctx, bytes)
+		if err == nil {
+			return
+		}
+		w.obs.log.Warn(fmt.Sprintf("error exporting from WAL: %+v", err))
+		failed, retryable := w.classify(bytes, err)
+		if !retryable {
+			w.moveToDeadLetter(ctx, index, failed, walEvictionReasonNotRecoverable)
+			return
+		}
+		// retry at same read index, with only the data which failed.
+		bytes = failed
+		// stop retrying requests which have become too old while retrying.
+		if w.expired(bytes) {
+			w.evictExpired(ctx, index)
+			return
+		}
+		backoff := time.Duration(1<<i) * time.Second
+		if delay := retryDelay(err); delay > backoff {
+			backoff = delay
+		}
+		if backoff >= w.maxBackoff {
+			w.moveToDeadLetter(ctx, index, bytes, walEvictionReasonMaxBackoff)
+			return
+		}
+		w.obs.log.Error("retryable error, retrying request", zap.Duration("backoff", backoff))
+		time.Sleep(backoff)
+	}
+	w.moveToDeadLetter(ctx, index, bytes, walEvictionReasonMaxBackoff)
+}
+
+// classify returns the part of a serialized request which failed to export
+// with err, and whether it can be retried.
+func (w *exporterWAL) classify(bytes []byte, err error) ([]byte, bool) {
+	if w.failed != nil {
+		return w.failed(bytes, err)
+	}
+	return bytes, !isNotRecoverable(err)
+}
+
+// moveToDeadLetter drops a request which could not be exported, and writes it
+// to the dead-letter WAL if enabled.
+func (w *exporterWAL) moveToDeadLetter(ctx context.Context, index uint64, bytes []byte, reason string) {
+	w.obs.recordWALEviction(ctx, w.name, 1, reason)
+	if w.deadLetter == nil {
+		w.obs.log.Error("Dropping WAL entry which could not be exported.",
+			zap.String("path", w.path), zap.Uint64("index", index), zap.String("reason", reason))
+		return
+	}
+	w.deadLetter.mutex.Lock()
+	defer w.deadLetter.mutex.Unlock()
+	if err := w.deadLetter.write(ctx, bytes); err != nil {
+		w.obs.log.Error("Failed to write WAL entry to the dead-letter WAL, dropping it.",
+			zap.String("path", w.deadLetter.path), zap.Uint64("index", index), zap.Error(err))
+		return
+	}
+	w.obs.log.Warn("Moved WAL entry which could not be exported to the dead-letter WAL.",
+		zap.String("path", w.deadLetter.path), zap.Uint64("index", index), zap.String("reason", reason))
+}
+
+// watch watches the WAL directory for a write then returns to the
+// runReadAndExportLoop() loop. It returns errWALIdle if nothing is written
+// within idleTimeout.
+func (w *exporterWAL) watch(ctx context.Context, shutdownC <-chan struct{}) error {
+	var idleC <-chan time.Time
+	if w.idleTimeout > 0 {
+		idleTimer := time.NewTimer(w.idleTimeout)
+		defer idleTimer.Stop()
+		idleC = idleTimer.C
+	}
+	walWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	err = walWatcher.Add(w.path)
+
+	if err != nil {
+		return err
+	}
+	watchCh := make(chan error)
+	var wErr error
+	go func() {
+		defer func() {
+			watchCh <- wErr
+			close(watchCh)
+			walWatcher.Close()
+		}()
+
+		select {
+		case <-shutdownC:
+			return
+		case <-ctx.Done():
+			wErr = ctx.Err()
+			return
+		case <-idleC:
+			wErr = errWALIdle
+			return
+
+		case event, ok := <-walWatcher.Events:
+			if !ok {
+				return
+			}
+			switch event.Op {
+			case fsnotify.Remove:
+				wErr = fmt.Errorf("WAL file deleted")
+			case fsnotify.Rename:
+				wErr = fmt.Errorf("WAL file renamed")
+			case fsnotify.Write:
+				wErr = nil
+			}
+
+		case watchErr, ok := <-walWatcher.Errors:
+			if ok {
+				wErr = watchErr
+			}
+		}
+	}()
+	err = <-watchCh
+	return err
+}
+
+// runReadAndExportLoop continuously reads and exports requests from the WAL
+// until ctx is done or shutdownC is closed. On shutdown, it exports all
+// remaining entries before returning, and closes the WAL.
+func (w *exporterWAL) runReadAndExportLoop(ctx context.Context, shutdownC <-chan struct{}) {
+	defer func() {
+		if err := w.close(); err != nil {
+			w.obs.log.Error(fmt.Sprintf("error closing WAL: %+v\n", err))
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-shutdownC:
+			// do one last final read/export then return
+			// otherwise the runner goroutine could leave some hanging entries unexported
+			for {
+				err := w.readAndExport(ctx)
+				if err != nil {
+					if !errors.Is(err, wal.ErrOutOfRange) && !errors.Is(err, wal.ErrNotFound) {
+						w.obs.log.Error(fmt.Sprintf("error flushing remaining WAL entries: %+v", err))
+					}
+					break
+				}
+			}
+			return
+		default:
+			err := w.readAndExport(ctx)
+			if err == nil {
+				continue
+			}
+			// ErrNotFound from wal.Read() means the index is either 0 or out of
+			// bounds (indicating we're probably at the end of the WAL). That error
+			// will trigger a file watch for new writes (below this). For other
+			// errors, fail.
+			// ErrNotFound can be expected occasionally if we've reached the end of
+			// the WAL, so don't bother logging those.
+			if !errors.Is(err, wal.ErrNotFound) {
+				w.obs.log.Error(fmt.Sprintf("error reading WAL and exporting: %+v", err))
+			}
+
+			// Must have been ErrNotFound, start a file watch and block waiting for updates.
+			err = w.watch(ctx, shutdownC)
+			if errors.Is(err, errWALIdle) {
+				if w.removeIfIdle != nil && w.removeIfIdle() {
+					return
+				}
+				continue
+			}
+			if err != nil {
+				w.obs.log.Error(fmt.Sprintf("error watching WAL and exporting: %+v", err))
+			}
+		}
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/wal"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func newTestWAL(t *testing.T, cfg *WALConfig) *exporterWAL {
+	w := &exporterWAL{obs: selfObservability{log: zap.NewNop()}}
+	_, _, err := w.setup(cfg, "test_wal")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, w.close()) })
+	return w
+}
+
+func testWALRequest(payload string) *logpb.WriteLogEntriesRequest {
+	return &logpb.WriteLogEntriesRequest{
+		Entries: []*logpb.LogEntry{{Payload: &logpb.LogEntry_TextPayload{TextPayload: payload}}},
+	}
+}
+
+func TestWALWriteRequestUnbounded(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir()})
+	for i := 0; i < 100; i++ {
+		require.NoError(t, w.writeRequest(context.Background(), testWALRequest(strings.Repeat("a", 100))))
+	}
+	firstIndex, err := w.FirstIndex()
+	require.NoError(t, err)
+	lastIndex, err := w.LastIndex()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), firstIndex)
+	assert.Equal(t, uint64(100), lastIndex)
+}
+
+func TestWALWriteRequestMaxSizeBytes(t *testing.T) {
+	maxSize := int64(4000)
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir(), MaxSizeBytes: maxSize})
+	for i := 0; i < 100; i++ {
+		require.NoError(t, w.writeRequest(context.Background(), testWALRequest(strings.Repeat("a", 100))))
+		size, err := w.diskSize()
+		require.NoError(t, err)
+		assert.LessOrEqual(t, size, maxSize)
+	}
+	firstIndex, err := w.FirstIndex()
+	require.NoError(t, err)
+	lastIndex, err := w.LastIndex()
+	require.NoError(t, err)
+	assert.Greater(t, firstIndex, uint64(1), "expected the oldest entries to be dropped")
+	assert.Equal(t, uint64(100), lastIndex, "expected the newest entry to be kept")
+}
+
+func TestWALWriteRequestMaxSizeBytesKeepsNewestEntry(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir(), MaxSizeBytes: 1})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.writeRequest(context.Background(), testWALRequest("foo")))
+	}
+	firstIndex, err := w.FirstIndex()
+	require.NoError(t, err)
+	lastIndex, err := w.LastIndex()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), firstIndex)
+	assert.Equal(t, uint64(3), lastIndex)
+}
+
+func TestWALWriteRequestSharedMaxSizeBytes(t *testing.T) {
+	maxSize := int64(4000)
+	cfg := &WALConfig{Directory: t.TempDir(), MaxSizeBytes: maxSize}
+	w1 := newTestWAL(t, cfg)
+	w2 := &exporterWAL{obs: selfObservability{log: zap.NewNop()}}
+	_, _, err := w2.setup(cfg, "other_test_wal")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, w2.close()) })
+	totalSize := func() (int64, error) {
+		size1, err := w1.diskSize()
+		if err != nil {
+			return 0, err
+		}
+		size2, err := w2.diskSize()
+		return size1 + size2, err
+	}
+	w1.totalSize = totalSize
+	w2.totalSize = totalSize
+
+	for i := 0; i < 100; i++ {
+		for _, w := range []*exporterWAL{w1, w2} {
+			require.NoError(t, w.writeRequest(context.Background(), testWALRequest(strings.Repeat("a", 100))))
+			size, err := totalSize()
+			require.NoError(t, err)
+			assert.LessOrEqual(t, size, maxSize)
+		}
+	}
+	for _, w := range []*exporterWAL{w1, w2} {
+		firstIndex, err := w.FirstIndex()
+		require.NoError(t, err)
+		assert.Greater(t, firstIndex, uint64(1), "expected the oldest entries of %v to be dropped", w.name)
+	}
+}
+
+func TestWALReadAndExport(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir()})
+	var exported []string
+	w.export = func(_ context.Context, bytes []byte) error {
+		req := new(logpb.WriteLogEntriesRequest)
+		require.NoError(t, proto.Unmarshal(bytes, req))
+		exported = append(exported, req.Entries[0].GetTextPayload())
+		return nil
+	}
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("foo")))
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("bar")))
+
+	require.NoError(t, w.readAndExport(context.Background()))
+	require.NoError(t, w.readAndExport(context.Background()))
+	// the end of the WAL is signaled with ErrNotFound
+	require.ErrorIs(t, w.readAndExport(context.Background()), wal.ErrNotFound)
+	assert.Equal(t, []string{"foo", "bar"}, exported)
+}
+
+func TestWALReadAndExportDoesNotBlockWrites(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir()})
+	var exported []string
+	w.export = func(ctx context.Context, bytes []byte) error {
+		req := new(logpb.WriteLogEntriesRequest)
+		require.NoError(t, proto.Unmarshal(bytes, req))
+		exported = append(exported, req.Entries[0].GetTextPayload())
+		if len(exported) == 1 {
+			// writes must not wait for the export to finish.
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+			return w.writeRequest(ctx, testWALRequest("bar"))
+		}
+		return nil
+	}
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("foo")))
+
+	require.NoError(t, w.readAndExport(context.Background()))
+	require.NoError(t, w.readAndExport(context.Background()))
+	require.ErrorIs(t, w.readAndExport(context.Background()), wal.ErrNotFound)
+	assert.Equal(t, []string{"foo", "bar"}, exported)
+}
+
+func TestWALReadAndExportEvictedWhileExporting(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir()})
+	var exported []string
+	w.export = func(_ context.Context, bytes []byte) error {
+		req := new(logpb.WriteLogEntriesRequest)
+		require.NoError(t, proto.Unmarshal(bytes, req))
+		exported = append(exported, req.Entries[0].GetTextPayload())
+		if len(exported) == 1 {
+			// simulate the request, and the next one, being evicted by a
+			// concurrent write.
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+			return w.TruncateFront(3)
+		}
+		return nil
+	}
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("foo")))
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("bar")))
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("baz")))
+
+	require.NoError(t, w.readAndExport(context.Background()))
+	require.NoError(t, w.readAndExport(context.Background()))
+	require.ErrorIs(t, w.readAndExport(context.Background()), wal.ErrNotFound)
+	assert.Equal(t, []string{"foo", "baz"}, exported)
+}
+
+func TestWALReadAndExportMaxAge(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir(), MaxAge: time.Hour})
+	var exported []string
+	w.export = func(_ context.Context, bytes []byte) error {
+		exported = append(exported, string(bytes))
+		return nil
+	}
+	// the test requests encode their timestamp directly.
+	w.timestamp = func(bytes []byte) (time.Time, error) {
+		return time.Parse(time.RFC3339, string(bytes))
+	}
+	old := time.Now().Add(-2 * time.Hour).Format(time.RFC3339)
+	recent := time.Now().Format(time.RFC3339)
+	require.NoError(t, w.Write(1, []byte(old)))
+	require.NoError(t, w.Write(2, []byte(recent)))
+
+	require.NoError(t, w.readAndExport(context.Background()))
+	require.NoError(t, w.readAndExport(context.Background()))
+	require.ErrorIs(t, w.readAndExport(context.Background()), wal.ErrNotFound)
+	assert.Equal(t, []string{recent}, exported)
+}
+
+func TestWALReadAndExportDeadLetter(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir(), DeadLetter: true})
+	w.export = func(context.Context, []byte) error {
+		return status.Error(codes.InvalidArgument, "invalid request")
+	}
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("foo")))
+
+	require.NoError(t, w.readAndExport(context.Background()))
+	require.ErrorIs(t, w.readAndExport(context.Background()), wal.ErrNotFound)
+
+	// the request is moved to the dead-letter WAL instead of being dropped.
+	lastIndex, err := w.deadLetter.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), lastIndex)
+	bytes, err := w.deadLetter.Read(lastIndex)
+	require.NoError(t, err)
+	req := new(logpb.WriteLogEntriesRequest)
+	require.NoError(t, proto.Unmarshal(bytes, req))
+	assert.Equal(t, "foo", req.Entries[0].GetTextPayload())
+}
+
+func TestWALReadAndExportRetriesFailedPart(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir()})
+	var exported []string
+	w.export = func(_ context.Context, bytes []byte) error {
+		exported = append(exported, string(bytes))
+		if len(exported) == 1 {
+			return status.Error(codes.Unavailable, "partially failed")
+		}
+		return nil
+	}
+	// only the second half of the request failed.
+	w.failed = func(bytes []byte, _ error) ([]byte, bool) {
+		return bytes[len(bytes)/2:], true
+	}
+	require.NoError(t, w.Write(1, []byte("foobar")))
+
+	require.NoError(t, w.readAndExport(context.Background()))
+	assert.Equal(t, []string{"foobar", "bar"}, exported)
+}
+
+func TestWALReadAndExportServerRetryDelay(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir(), MaxBackoff: time.Minute, DeadLetter: true})
+	exports := 0
+	w.export = func(context.Context, []byte) error {
+		exports++
+		st, err := status.New(codes.ResourceExhausted, "quota exceeded").WithDetails(
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Hour)})
+		require.NoError(t, err)
+		return st.Err()
+	}
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("foo")))
+
+	// the server asks to wait for longer than MaxBackoff, so the request is
+	// moved to the dead-letter WAL without waiting.
+	require.NoError(t, w.readAndExport(context.Background()))
+	assert.Equal(t, 1, exports)
+	lastIndex, err := w.deadLetter.LastIndex()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), lastIndex)
+}
+
+func TestWALBacklog(t *testing.T) {
+	w := newTestWAL(t, &WALConfig{Directory: t.TempDir()})
+	w.export = func(context.Context, []byte) error { return nil }
+
+	backlog, err := w.backlog()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), backlog)
+
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("foo")))
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("bar")))
+	backlog, err = w.backlog()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), backlog)
+
+	require.NoError(t, w.readAndExport(context.Background()))
+	require.NoError(t, w.readAndExport(context.Background()))
+	// only the empty entry marking the end of the WAL remains.
+	backlog, err = w.backlog()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), backlog)
+}
+
+func TestWALSelfObservability(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	obs, err := newSelfObservability(zap.NewNop(), sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), metricsObservabilityPrefix)
+	require.NoError(t, err)
+
+	w := &exporterWAL{obs: obs}
+	_, _, err = w.setup(&WALConfig{Directory: t.TempDir(), MaxSizeBytes: 1}, "self_obs_test_wal")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, w.close()) }()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.writeRequest(context.Background(), testWALRequest("foo")))
+	}
+
+	evicted := collectSelfObservabilityMetric(t, reader, "googlecloudmonitoring/wal_evicted_requests").(metricdata.Sum[int64])
+	require.Len(t, evicted.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(walKey.String("self_obs_test_wal"), reasonKey.String(walEvictionReasonMaxSize)), evicted.DataPoints[0].Attributes)
+	assert.Equal(t, int64(2), evicted.DataPoints[0].Value)
+
+	backlog := collectSelfObservabilityMetric(t, reader, "googlecloudmonitoring/wal_backlog").(metricdata.Gauge[int64])
+	require.Len(t, backlog.DataPoints, 1)
+	assert.Equal(t, attribute.NewSet(walKey.String("self_obs_test_wal")), backlog.DataPoints[0].Attributes)
+	assert.Equal(t, int64(1), backlog.DataPoints[0].Value)
+
+	size := collectSelfObservabilityMetric(t, reader, "googlecloudmonitoring/wal_size").(metricdata.Gauge[int64])
+	require.Len(t, size.DataPoints, 1)
+	assert.Greater(t, size.DataPoints[0].Value, int64(0))
+
+	// the gauges are no longer reported once the exporter shuts down.
+	obs.shutdown()
+	assert.Nil(t, collectSelfObservabilityMetric(t, reader, "googlecloudmonitoring/wal_size"))
+}
+
+// collectSelfObservabilityMetric returns the data of the self-observability
+// metric with the name collected by reader, or nil if it wasn't reported.
+func TestWALSelfObservabilitySignalPrefix(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	obs, err := newSelfObservability(zap.NewNop(), sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), logsObservabilityPrefix)
+	require.NoError(t, err)
+
+	w := &exporterWAL{obs: obs}
+	_, _, err = w.setup(&WALConfig{Directory: t.TempDir()}, logsWALName)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, w.close()) }()
+	require.NoError(t, w.writeRequest(context.Background(), testWALRequest("foo")))
+
+	assert.NotNil(t, collectSelfObservabilityMetric(t, reader, "googlecloudlogging/wal_backlog"))
+	assert.Nil(t, collectSelfObservabilityMetric(t, reader, "googlecloudmonitoring/wal_backlog"))
+}
+
+func collectSelfObservabilityMetric(t *testing.T, reader sdkmetric.Reader, name string) metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		if sm.Scope.Name != scopeName {
+			continue
+		}
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	loggingv2 "cloud.google.com/go/logging/apiv2"
+	"golang.org/x/oauth2/google"
+	apioption "google.golang.org/api/option"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/logmapping"
+)
+
+// Option is function type that is passed to the exporter initialization function.
+type Option func(*options)
+
+// options contains options for configuring the exporter.
+type options struct {
+	// context allows you to provide a custom context for creating the Cloud
+	// Logging client, including finding the default credentials. It is only
+	// used to create the client: uploads use the context passed to Export.
+	//
+	// If unset, context.Background() will be used.
+	context context.Context
+	// projectID is the identifier of the Cloud Logging project the user is
+	// uploading log entries to. It can be overridden per-record with the
+	// gcp.project.id resource attribute.
+	// If not set, this will default to your "Application Default Credentials".
+	// For details see: https://developers.google.com/accounts/docs/application-default-credentials.
+	projectID string
+	// defaultLogName sets the fallback log name to use when one isn't explicitly
+	// set for a log record with the gcp.log_name attribute. If unset, records
+	// without a log name are dropped and an error is returned from Export.
+	defaultLogName string
+	// compression enables gzip compression on gRPC calls.
+	compression string
+	// loggingClientOptions are additional options to be passed
+	// to the underlying Cloud Logging API client.
+	// Optional.
+	loggingClientOptions []apioption.ClientOption
+	// timeout for all API calls. If not set, defaults to 12 seconds.
+	timeout time.Duration
+	// maxEntrySize is the maximum size of an individual LogEntry in bytes.
+	// Entries with a larger text payload are split into multiple entries.
+	maxEntrySize int
+	// maxRequestSize is the maximum size of a WriteLogEntries request in
+	// bytes. Batches larger than this are split into multiple requests.
+	maxRequestSize int
+	// destinationProjectQuota sets whether the request should use quota from
+	// the destination project for the request.
+	destinationProjectQuota bool
+	// errorReportingType enables automatically formatting error logs for
+	// GCP Error Reporting.
+	errorReportingType bool
+}
+
+// WithProjectID sets Google Cloud Platform project as projectID.
+// Without using this option, it automatically detects the project ID
+// from the default credential detection process.
+// Please find the detailed order of the default credential detection process on the doc:
+// https://godoc.org/golang.org/x/oauth2/google#FindDefaultCredentials
+func WithProjectID(id string) func(o *options) {
+	return func(o *options) {
+		o.projectID = id
+	}
+}
+
+// WithDefaultLogName sets the log name used for records which do not have
+// the gcp.log_name attribute set.
+func WithDefaultLogName(name string) func(o *options) {
+	return func(o *options) {
+		o.defaultLogName = name
+	}
+}
+
+// WithDestinationProjectQuota enables per-request usage of the destination
+// project's quota. For example, when setting the gcp.project.id resource attribute.
+func WithDestinationProjectQuota() func(o *options) {
+	return func(o *options) {
+		o.destinationProjectQuota = true
+	}
+}
+
+// WithLoggingClientOptions adds the options for the Cloud Logging client instance.
+func WithLoggingClientOptions(opts ...apioption.ClientOption) func(o *options) {
+	return func(o *options) {
+		o.loggingClientOptions = append(o.loggingClientOptions, opts...)
+	}
+}
+
+// WithContext sets the context that the exporter relies on.
+func WithContext(ctx context.Context) func(o *options) {
+	return func(o *options) {
+		o.context = ctx
+	}
+}
+
+// WithTimeout sets the timeout for calls to Cloud Logging.
+// If unset, it defaults to a 12 second timeout.
+func WithTimeout(t time.Duration) func(o *options) {
+	return func(o *options) {
+		o.timeout = t
+	}
+}
+
+// WithCompression sets the compression to use for gRPC requests.
+func WithCompression(c string) func(o *options) {
+	return func(o *options) {
+		o.compression = c
+	}
+}
+
+// WithErrorReportingType formats records with a severity of ERROR or higher
+// so that they are picked up by GCP Error Reporting.
+// See https://cloud.google.com/error-reporting/docs/formatting-error-messages#log-text.
+func WithErrorReportingType() func(o *options) {
+	return func(o *options) {
+		o.errorReportingType = true
+	}
+}
+
+// WithMaxEntrySize sets the maximum size of an individual LogEntry in bytes.
+// Records with a larger text payload are split into multiple entries.
+// Defaults to 256 KB.
+func WithMaxEntrySize(size int) func(o *options) {
+	return func(o *options) {
+		o.maxEntrySize = size
+	}
+}
+
+// WithMaxRequestSize sets the maximum size of a single WriteLogEntries
+// request in bytes. Defaults to 10 MB.
+func WithMaxRequestSize(size int) func(o *options) {
+	return func(o *options) {
+		o.maxRequestSize = size
+	}
+}
+
+// New creates a new Exporter that implements log.Exporter.
+func New(opts ...Option) (*Exporter, error) {
+	o := options{
+		context:        context.Background(),
+		maxEntrySize:   logmapping.DefaultMaxEntrySize,
+		maxRequestSize: logmapping.DefaultMaxRequestSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.projectID == "" {
+		creds, err := google.FindDefaultCredentials(o.context, loggingv2.DefaultAuthScopes()...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find Google Cloud credentials: %v", err)
+		}
+		if creds.ProjectID == "" {
+			return nil, errors.New("google cloud logging: no project found with application default credentials")
+		}
+		o.projectID = creds.ProjectID
+	}
+	return newLogExporter(&o)
+}
@@ -0,0 +1,490 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package log contains an OpenTelemetry log exporter for Google Cloud Logging.
+package log
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+
+	loggingv2 "cloud.google.com/go/logging/apiv2"
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	logtypepb "google.golang.org/genproto/googleapis/logging/type"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/logmapping"
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/resourcemapping"
+)
+
+const (
+	// defaultTimeout is used when no timeout is set with WithTimeout.
+	defaultTimeout = 12 * time.Second
+
+	HTTPRequestAttributeKey    = "gcp.http_request"
+	LogNameAttributeKey        = "gcp.log_name"
+	SourceLocationAttributeKey = "gcp.source_location"
+	TraceSampledAttributeKey   = "gcp.trace_sampled"
+
+	GCPTypeKey                 = "@type"
+	GCPErrorReportingTypeValue = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+)
+
+var userAgent = fmt.Sprintf("opentelemetry-go %s; google-cloud-logging-exporter %s", otel.Version(), Version())
+
+var (
+	errNoLogName = errors.New("no log name provided.  Use the WithDefaultLogName option, or add the 'gcp.log_name' attribute to set a log name")
+	errShutdown  = errors.New("exporter is shut down")
+)
+
+type attributeProcessingError struct {
+	Err error
+	Key string
+}
+
+func (e *attributeProcessingError) Error() string {
+	return fmt.Sprintf("could not process attribute %s: %s", e.Key, e.Err.Error())
+}
+
+type unsupportedValueTypeError struct {
+	Kind otellog.Kind
+}
+
+func (e *unsupportedValueTypeError) Error() string {
+	return fmt.Sprintf("unsupported value type %v", e.Kind)
+}
+
+// Exporter is a log exporter that uploads log records to Google Cloud Logging.
+type Exporter struct {
+	o            *options
+	client       *loggingv2.Client
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+var _ sdklog.Exporter = (*Exporter)(nil)
+
+// newLogExporter returns an exporter that uploads OTel log records to Google Cloud Logging.
+func newLogExporter(o *options) (*Exporter, error) {
+	if strings.TrimSpace(o.projectID) == "" {
+		return nil, errors.New("expecting a non-blank ProjectID")
+	}
+	clientOpts := append([]option.ClientOption{option.WithUserAgent(userAgent)}, o.loggingClientOptions...)
+	ctx := o.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client, err := loggingv2.NewClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if o.compression == gzip.Name {
+		client.CallOptions.WriteLogEntries = append(client.CallOptions.WriteLogEntries,
+			gax.WithGRPCOptions(grpc.UseCompressor(gzip.Name)))
+	}
+	return &Exporter{
+		o:        o,
+		client:   client,
+		shutdown: make(chan struct{}),
+	}, nil
+}
+
+// Export converts the log records to LogEntries and writes them to Cloud
+// Logging, splitting them into multiple WriteLogEntries requests as needed.
+// It returns an error if the exporter is shut down.
+func (e *Exporter) Export(ctx context.Context, records []sdklog.Record) error {
+	select {
+	case <-e.shutdown:
+		return errShutdown
+	default:
+	}
+
+	projectEntries, err := e.createEntries(records)
+	errs := []error{err}
+	for project, entries := range projectEntries {
+		reqCtx := ctx
+		// override destination project quota for this write request, if applicable
+		if e.o.destinationProjectQuota {
+			reqCtx = metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{"x-goog-user-project": project}))
+		}
+		for _, batch := range e.batchEntries(entries) {
+			errs = append(errs, e.writeLogEntries(reqCtx, batch))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ForceFlush does nothing, the exporter holds no state.
+func (e *Exporter) ForceFlush(ctx context.Context) error { return ctx.Err() }
+
+// Shutdown shuts down the client connections.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	var err error
+	e.shutdownOnce.Do(func() {
+		close(e.shutdown)
+		err = errors.Join(ctx.Err(), e.client.Close())
+	})
+	return err
+}
+
+// createEntries maps records to LogEntries. If destination project quota is
+// enabled, entries are grouped by the project they are written to so that
+// each request can be billed to the right project. Otherwise, all entries
+// are stored under the same key for more efficient batching.
+func (e *Exporter) createEntries(records []sdklog.Record) (map[string][]*logpb.LogEntry, error) {
+	var errs []error
+	entries := make(map[string][]*logpb.LogEntry)
+	processTime := time.Now()
+	for i := range records {
+		projectID := e.projectID(&records[i])
+		logName, err := e.getLogName(&records[i])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		splitEntries, err := e.recordToSplitEntries(&records[i], processTime, logName, projectID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		projectMapKey := ""
+		if e.o.destinationProjectQuota {
+			projectMapKey = projectID
+		}
+		entries[projectMapKey] = append(entries[projectMapKey], splitEntries...)
+	}
+	return entries, errors.Join(errs...)
+}
+
+// batchEntries splits entries into batches which fit within maxRequestSize.
+func (e *Exporter) batchEntries(entries []*logpb.LogEntry) [][]*logpb.LogEntry {
+	var batches [][]*logpb.LogEntry
+	start := 0
+	currentBatchSize := 0
+	for i, entry := range entries {
+		entrySize := proto.Size(entry)
+		if i > start && currentBatchSize+entrySize >= e.o.maxRequestSize {
+			batches = append(batches, entries[start:i])
+			start = i
+			currentBatchSize = 0
+		}
+		currentBatchSize += entrySize
+	}
+	if start < len(entries) {
+		batches = append(batches, entries[start:])
+	}
+	return batches
+}
+
+func (e *Exporter) writeLogEntries(ctx context.Context, batch []*logpb.LogEntry) error {
+	timeout := e.o.timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, err := e.client.WriteLogEntries(ctx, &logpb.WriteLogEntriesRequest{
+		PartialSuccess: true,
+		Entries:        batch,
+	})
+	return err
+}
+
+// projectID returns the project a record is written to, which is the
+// gcp.project.id resource attribute if present, or the configured project.
+func (e *Exporter) projectID(r *sdklog.Record) string {
+	res := r.Resource()
+	if projectID, ok := res.Set().Value(resourcemapping.ProjectIDAttributeKey); ok {
+		return projectID.AsString()
+	}
+	return e.o.projectID
+}
+
+func (e *Exporter) getLogName(r *sdklog.Record) (string, error) {
+	var logName string
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		if kv.Key == LogNameAttributeKey {
+			logName = valueToString(kv.Value)
+			return false
+		}
+		return true
+	})
+	if logName != "" {
+		return logName, nil
+	}
+	if len(e.o.defaultLogName) > 0 {
+		return e.o.defaultLogName, nil
+	}
+	return "", errNoLogName
+}
+
+// Adapter for using resourcemapping library.
+type attributes struct {
+	attrs *attribute.Set
+}
+
+func (a *attributes) GetString(key string) (string, bool) {
+	value, ok := a.attrs.Value(attribute.Key(key))
+	return value.AsString(), ok
+}
+
+func resourceToMonitoredResource(r *sdklog.Record) *monitoredrespb.MonitoredResource {
+	res := r.Resource()
+	return resourcemapping.ResourceAttributesToLoggingMonitoredResource(&attributes{
+		attrs: res.Set(),
+	})
+}
+
+// recordLabels returns the instrumentation scope and service resource
+// attributes of a record, which are added to every LogEntry's labels.
+func recordLabels(r *sdklog.Record) map[string]string {
+	labels := make(map[string]string)
+	scope := r.InstrumentationScope()
+	if len(scope.Name) > 0 {
+		labels["instrumentation_source"] = scope.Name
+	}
+	if len(scope.Version) > 0 {
+		labels["instrumentation_version"] = scope.Version
+	}
+	res := r.Resource()
+	for _, key := range []attribute.Key{semconv.ServiceNameKey, semconv.ServiceNamespaceKey, semconv.ServiceInstanceIDKey} {
+		if v, ok := res.Set().Value(key); ok && len(v.AsString()) > 0 {
+			labels[string(key)] = strings.ToValidUTF8(v.AsString(), "�")
+		}
+	}
+	return labels
+}
+
+func (e *Exporter) recordToSplitEntries(
+	r *sdklog.Record,
+	processTime time.Time,
+	logName string,
+	projectID string,
+) ([]*logpb.LogEntry, error) {
+	ts := r.Timestamp()
+	if ts.IsZero() {
+		// if timestamp is unset, fall back to the observed timestamp as recommended
+		//   (see https://github.com/open-telemetry/opentelemetry-proto/blob/4abbb78/opentelemetry/proto/logs/v1/logs.proto#L176-L179)
+		if !r.ObservedTimestamp().IsZero() {
+			ts = r.ObservedTimestamp()
+		} else {
+			// if observed_time is 0, use the current time
+			ts = processTime
+		}
+	}
+
+	entry := &logpb.LogEntry{
+		Resource:  resourceToMonitoredResource(r),
+		Timestamp: timestamppb.New(ts),
+		Labels:    recordLabels(r),
+		LogName:   fmt.Sprintf("projects/%s/logs/%s", projectID, url.PathEscape(logName)),
+	}
+
+	// collect attributes in a map so each special case doesn't walk them again
+	attrsMap := make(map[string]otellog.Value, r.AttributesLen())
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrsMap[kv.Key] = kv.Value
+		return true
+	})
+
+	// parse LogEntrySourceLocation struct from OTel attribute
+	if sourceLocation, ok := attrsMap[SourceLocationAttributeKey]; ok {
+		var logEntrySourceLocation logpb.LogEntrySourceLocation
+		err := unmarshalAttribute(sourceLocation, &logEntrySourceLocation)
+		if err != nil {
+			return nil, &attributeProcessingError{Key: SourceLocationAttributeKey, Err: err}
+		}
+		entry.SourceLocation = &logEntrySourceLocation
+		delete(attrsMap, SourceLocationAttributeKey)
+	}
+
+	// parse TraceSampled boolean from OTel attribute or the sampled trace flag
+	if traceSampled, ok := attrsMap[TraceSampledAttributeKey]; ok || r.TraceFlags().IsSampled() {
+		entry.TraceSampled = (traceSampled.Kind() == otellog.KindBool && traceSampled.AsBool()) || r.TraceFlags().IsSampled()
+		delete(attrsMap, TraceSampledAttributeKey)
+	}
+
+	// parse TraceID and SpanID, if present
+	if traceID := r.TraceID(); traceID.IsValid() {
+		entry.Trace = fmt.Sprintf("projects/%s/traces/%s", projectID, hex.EncodeToString(traceID[:]))
+	}
+	if spanID := r.SpanID(); spanID.IsValid() {
+		entry.SpanId = hex.EncodeToString(spanID[:])
+	}
+
+	if httpRequestAttr, ok := attrsMap[HTTPRequestAttributeKey]; ok {
+		httpRequest, err := parseHTTPRequest(httpRequestAttr)
+		if err != nil {
+			otel.Handle(err)
+		}
+		entry.HttpRequest = httpRequest
+		delete(attrsMap, HTTPRequestAttributeKey)
+	}
+
+	severity := int(r.Severity())
+	if _, ok := logmapping.Severity(severity); !ok {
+		return nil, fmt.Errorf("unknown Severity %v", severity)
+	}
+	// If the SeverityText is one of the generic aliases and the Severity is
+	// unset, map the text to the matching Severity.
+	if severityForText, ok := logmapping.SeverityNumberForText(r.SeverityText()); ok && severity == int(otellog.SeverityUndefined) {
+		severity = severityForText
+	}
+	entry.Severity, _ = logmapping.Severity(severity)
+
+	body := r.Body()
+	// Format errors as a GCP Error Reporting entry if enabled
+	if severity >= logmapping.ErrorSeverityNumber && e.o.errorReportingType {
+		var kvs []otellog.KeyValue
+		if body.Kind() == otellog.KindMap {
+			kvs = append(kvs, body.AsMap()...)
+		} else {
+			kvs = append(kvs, otellog.String("message", valueToString(body)))
+		}
+		body = otellog.MapValue(append(kvs, otellog.String(GCPTypeKey, GCPErrorReportingTypeValue))...)
+	}
+
+	// parse remaining OTel attributes to GCP labels
+	for k, v := range attrsMap {
+		// skip "gcp.*" attributes since we process these to other fields
+		if strings.HasPrefix(k, "gcp.") {
+			continue
+		}
+		if _, ok := entry.Labels[k]; !ok {
+			entry.Labels[k] = valueToString(v)
+		}
+	}
+
+	// Handle map and bytes as JSON-structured logs if they are successfully converted.
+	switch body.Kind() {
+	case otellog.KindMap:
+		s, err := structpb.NewStruct(mapToRaw(body.AsMap()))
+		if err == nil {
+			entry.Payload = &logpb.LogEntry_JsonPayload{JsonPayload: s}
+			return []*logpb.LogEntry{entry}, nil
+		}
+	case otellog.KindBytes:
+		s := &structpb.Struct{}
+		if err := s.UnmarshalJSON(body.AsBytes()); err == nil {
+			entry.Payload = &logpb.LogEntry_JsonPayload{JsonPayload: s}
+			return []*logpb.LogEntry{entry}, nil
+		}
+	}
+	// For all other kinds, export as a string payload.
+	logBodyString := valueToString(body)
+	if len(logBodyString) == 0 {
+		return []*logpb.LogEntry{entry}, nil
+	}
+
+	return logmapping.SplitTextPayload(entry, logBodyString, logName, e.o.maxEntrySize), nil
+}
+
+func parseHTTPRequest(httpRequestAttr otellog.Value) (*logtypepb.HttpRequest, error) {
+	var parsedHTTPRequest logmapping.HTTPRequest
+	err := unmarshalAttribute(httpRequestAttr, &parsedHTTPRequest)
+	if err != nil {
+		return nil, &attributeProcessingError{Key: HTTPRequestAttributeKey, Err: err}
+	}
+	return parsedHTTPRequest.Proto(), nil
+}
+
+func unmarshalAttribute(v otellog.Value, out any) error {
+	var valueBytes []byte
+	switch v.Kind() {
+	case otellog.KindBytes:
+		valueBytes = v.AsBytes()
+	case otellog.KindMap, otellog.KindString:
+		valueBytes = []byte(valueToString(v))
+	default:
+		return &unsupportedValueTypeError{Kind: v.Kind()}
+	}
+	return json.Unmarshal(valueBytes, out)
+}
+
+// valueToString returns the string representation of a value. Strings are
+// returned as-is, bytes are base64 encoded, and maps and slices are encoded
+// as JSON, which matches pcommon.Value.AsString in the collector exporter.
+func valueToString(v otellog.Value) string {
+	switch v.Kind() {
+	case otellog.KindEmpty:
+		return ""
+	case otellog.KindString:
+		return strings.ToValidUTF8(v.AsString(), "�")
+	case otellog.KindBytes:
+		return base64.StdEncoding.EncodeToString(v.AsBytes())
+	case otellog.KindMap, otellog.KindSlice:
+		jsonStr, _ := json.Marshal(valueToRaw(v))
+		return string(jsonStr)
+	default:
+		return v.String()
+	}
+}
+
+// valueToRaw converts a value to the equivalent go type, as accepted by
+// structpb.NewValue.
+func valueToRaw(v otellog.Value) any {
+	switch v.Kind() {
+	case otellog.KindBool:
+		return v.AsBool()
+	case otellog.KindFloat64:
+		return v.AsFloat64()
+	case otellog.KindInt64:
+		return v.AsInt64()
+	case otellog.KindString:
+		return strings.ToValidUTF8(v.AsString(), "�")
+	case otellog.KindBytes:
+		return base64.StdEncoding.EncodeToString(v.AsBytes())
+	case otellog.KindSlice:
+		slice := v.AsSlice()
+		raw := make([]any, len(slice))
+		for i, item := range slice {
+			raw[i] = valueToRaw(item)
+		}
+		return raw
+	case otellog.KindMap:
+		return mapToRaw(v.AsMap())
+	default:
+		return nil
+	}
+}
+
+func mapToRaw(kvs []otellog.KeyValue) map[string]any {
+	raw := make(map[string]any, len(kvs))
+	for _, kv := range kvs {
+		raw[kv.Key] = valueToRaw(kv.Value)
+	}
+	return raw
+}
@@ -0,0 +1,302 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/log/logtest"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	logtypepb "google.golang.org/genproto/googleapis/logging/type"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/cloudmock"
+)
+
+func newTestExporter(t *testing.T, opts ...Option) (*Exporter, *cloudmock.LogsTestServer) {
+	testServer, err := cloudmock.NewLoggingTestServer()
+	require.NoError(t, err)
+	go testServer.Serve()
+	t.Cleanup(testServer.Shutdown)
+
+	opts = append([]Option{
+		WithProjectID("fakeprojectid"),
+		WithDefaultLogName("default-log"),
+		WithLoggingClientOptions(
+			option.WithEndpoint(testServer.Endpoint),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		),
+	}, opts...)
+	exporter, err := New(opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, exporter.Shutdown(context.Background())) })
+	return exporter, testServer
+}
+
+func TestExportLogs(t *testing.T) {
+	ctx := context.Background()
+	exporter, testServer := newTestExporter(t)
+
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewSimpleProcessor(exporter)),
+		sdklog.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("test-service"))),
+	)
+	logger := provider.Logger("test-scope")
+
+	var record otellog.Record
+	record.SetBody(otellog.StringValue("hello world"))
+	record.SetSeverity(otellog.SeverityWarn)
+	record.AddAttributes(otellog.String("foo", "bar"), otellog.String(LogNameAttributeKey, "my-log"))
+	logger.Emit(ctx, record)
+	require.NoError(t, provider.Shutdown(ctx))
+
+	reqs := testServer.CreateWriteLogEntriesRequests()
+	require.Len(t, reqs, 1)
+	require.Len(t, reqs[0].Entries, 1)
+	entry := reqs[0].Entries[0]
+	assert.Equal(t, "projects/fakeprojectid/logs/my-log", entry.LogName)
+	assert.Equal(t, &logpb.LogEntry_TextPayload{TextPayload: "hello world"}, entry.Payload)
+	assert.Equal(t, logtypepb.LogSeverity_WARNING, entry.Severity)
+	assert.Equal(t, map[string]string{
+		"foo":                    "bar",
+		"instrumentation_source": "test-scope",
+		"service.name":           "test-service",
+	}, entry.Labels)
+	assert.True(t, reqs[0].PartialSuccess)
+	assert.True(t, strings.HasPrefix(testServer.UserAgent(), "opentelemetry-go"))
+}
+
+func TestExportAfterShutdown(t *testing.T) {
+	exporter, testServer := newTestExporter(t)
+	require.NoError(t, exporter.Shutdown(context.Background()))
+	record := logtest.RecordFactory{Body: otellog.StringValue("dropped")}.NewRecord()
+	assert.ErrorIs(t, exporter.Export(context.Background(), []sdklog.Record{record}), errShutdown)
+	assert.Empty(t, testServer.CreateWriteLogEntriesRequests())
+}
+
+func TestExportBatchesByRequestSize(t *testing.T) {
+	exporter, testServer := newTestExporter(t, WithMaxRequestSize(300))
+	records := make([]sdklog.Record, 10)
+	for i := range records {
+		records[i] = logtest.RecordFactory{
+			Timestamp: time.Unix(1000, 0),
+			Body:      otellog.StringValue(fmt.Sprintf("message %d", i)),
+		}.NewRecord()
+	}
+	require.NoError(t, exporter.Export(context.Background(), records))
+
+	reqs := testServer.CreateWriteLogEntriesRequests()
+	assert.Greater(t, len(reqs), 1)
+	total := 0
+	for _, req := range reqs {
+		assert.LessOrEqual(t, proto.Size(req), 300+len(reqs[0].Entries))
+		total += len(req.Entries)
+	}
+	assert.Equal(t, len(records), total)
+}
+
+func TestRecordToSplitEntries(t *testing.T) {
+	testTime := time.Unix(1649721600, 0)
+	traceID := trace.TraceID{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	spanID := trace.SpanID{0, 0, 0, 0, 0, 0, 0, 1}
+
+	testCases := []struct {
+		name     string
+		record   logtest.RecordFactory
+		opts     []Option
+		validate func(t *testing.T, entries []*logpb.LogEntry)
+	}{
+		{
+			name:   "observed timestamp used when timestamp is unset",
+			record: logtest.RecordFactory{ObservedTimestamp: testTime},
+			validate: func(t *testing.T, entries []*logpb.LogEntry) {
+				require.Len(t, entries, 1)
+				assert.True(t, testTime.Equal(entries[0].Timestamp.AsTime()))
+				assert.Nil(t, entries[0].Payload)
+			},
+		},
+		{
+			name: "map body is a json payload",
+			record: logtest.RecordFactory{
+				Body: otellog.MapValue(otellog.String("this", "is json"), otellog.Int("count", 2)),
+			},
+			validate: func(t *testing.T, entries []*logpb.LogEntry) {
+				require.Len(t, entries, 1)
+				assert.True(t, proto.Equal(&structpb.Struct{Fields: map[string]*structpb.Value{
+					"this":  structpb.NewStringValue("is json"),
+					"count": structpb.NewNumberValue(2),
+				}}, entries[0].GetJsonPayload()))
+			},
+		},
+		{
+			name:   "bytes body with json is a json payload",
+			record: logtest.RecordFactory{Body: otellog.BytesValue([]byte(`{"this": "is json"}`))},
+			validate: func(t *testing.T, entries []*logpb.LogEntry) {
+				require.Len(t, entries, 1)
+				assert.Equal(t, "is json", entries[0].GetJsonPayload().Fields["this"].GetStringValue())
+			},
+		},
+		{
+			name: "trace and span ids",
+			record: logtest.RecordFactory{
+				TraceID:    traceID,
+				SpanID:     spanID,
+				TraceFlags: trace.FlagsSampled,
+			},
+			validate: func(t *testing.T, entries []*logpb.LogEntry) {
+				require.Len(t, entries, 1)
+				assert.Equal(t, "projects/fakeprojectid/traces/00000000000000000000000000000001", entries[0].Trace)
+				assert.Equal(t, "0000000000000001", entries[0].SpanId)
+				assert.True(t, entries[0].TraceSampled)
+			},
+		},
+		{
+			name: "gcp attributes",
+			record: logtest.RecordFactory{
+				Attributes: []otellog.KeyValue{
+					otellog.String(SourceLocationAttributeKey, `{"file": "test.go", "line": 12, "function": "foo"}`),
+					otellog.String(HTTPRequestAttributeKey, `{"requestMethod": "GET", "status": "200", "latency": "5s"}`),
+					otellog.Bool(TraceSampledAttributeKey, true),
+					otellog.String("gcp.other", "skipped"),
+				},
+			},
+			validate: func(t *testing.T, entries []*logpb.LogEntry) {
+				require.Len(t, entries, 1)
+				assert.Equal(t, "test.go", entries[0].SourceLocation.File)
+				assert.Equal(t, int64(12), entries[0].SourceLocation.Line)
+				assert.Equal(t, "GET", entries[0].HttpRequest.RequestMethod)
+				assert.Equal(t, int32(200), entries[0].HttpRequest.Status)
+				assert.Equal(t, 5*time.Second, entries[0].HttpRequest.Latency.AsDuration())
+				assert.True(t, entries[0].TraceSampled)
+				assert.Empty(t, entries[0].Labels)
+			},
+		},
+		{
+			name: "severity text without severity",
+			record: logtest.RecordFactory{
+				SeverityText: "fatal",
+			},
+			validate: func(t *testing.T, entries []*logpb.LogEntry) {
+				require.Len(t, entries, 1)
+				assert.Equal(t, logtypepb.LogSeverity_CRITICAL, entries[0].Severity)
+			},
+		},
+		{
+			name: "error reporting type",
+			record: logtest.RecordFactory{
+				Severity: otellog.SeverityError,
+				Body:     otellog.StringValue("something broke"),
+			},
+			opts: []Option{WithErrorReportingType()},
+			validate: func(t *testing.T, entries []*logpb.LogEntry) {
+				require.Len(t, entries, 1)
+				assert.Equal(t, logtypepb.LogSeverity_ERROR, entries[0].Severity)
+				fields := entries[0].GetJsonPayload().Fields
+				assert.Equal(t, "something broke", fields["message"].GetStringValue())
+				assert.Equal(t, GCPErrorReportingTypeValue, fields[GCPTypeKey].GetStringValue())
+			},
+		},
+		{
+			name: "service resource labels",
+			record: logtest.RecordFactory{
+				Resource: resource.NewSchemaless(semconv.ServiceName("svc")),
+			},
+			validate: func(t *testing.T, entries []*logpb.LogEntry) {
+				require.Len(t, entries, 1)
+				assert.Equal(t, map[string]string{"service.name": "svc"}, entries[0].Labels)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exporter, _ := newTestExporter(t, tc.opts...)
+			r := tc.record.NewRecord()
+			entries, err := exporter.recordToSplitEntries(&r, time.Now(), "default-log", "fakeprojectid")
+			require.NoError(t, err)
+			tc.validate(t, entries)
+		})
+	}
+}
+
+func TestSplitEntries(t *testing.T) {
+	exporter, _ := newTestExporter(t)
+	r := logtest.RecordFactory{Timestamp: time.Unix(1000, 0)}.NewRecord()
+	entries, err := exporter.recordToSplitEntries(&r, time.Now(), "default-log", "fakeprojectid")
+	require.NoError(t, err)
+	overhead := proto.Size(entries[0])
+
+	exporter.o.maxEntrySize = overhead + 3
+	r.SetBody(otellog.StringValue("abcxyz"))
+	entries, err = exporter.recordToSplitEntries(&r, time.Now(), "default-log", "fakeprojectid")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for i, want := range []string{"abc", "xyz"} {
+		assert.Equal(t, want, entries[i].GetTextPayload())
+		assert.Equal(t, int32(i), entries[i].Split.Index)
+		assert.Equal(t, int32(2), entries[i].Split.TotalSplits)
+	}
+}
+
+func TestProjectIDFromResource(t *testing.T) {
+	exporter, _ := newTestExporter(t)
+	r := logtest.RecordFactory{
+		Resource: resource.NewSchemaless(semconv.CloudAccountID("other")),
+	}.NewRecord()
+	assert.Equal(t, "fakeprojectid", exporter.projectID(&r))
+
+	r = logtest.RecordFactory{
+		Resource: resource.NewSchemaless(semconv.CloudAccountID("other"), semconv.ServiceName("svc"),
+			attribute.String("gcp.project.id", "override")),
+	}.NewRecord()
+	assert.Equal(t, "override", exporter.projectID(&r))
+}
+
+func TestGetLogName(t *testing.T) {
+	exporter, _ := newTestExporter(t)
+	r := logtest.RecordFactory{}.NewRecord()
+	name, err := exporter.getLogName(&r)
+	require.NoError(t, err)
+	assert.Equal(t, "default-log", name)
+
+	r = logtest.RecordFactory{
+		Attributes: []otellog.KeyValue{otellog.String(LogNameAttributeKey, "custom")},
+	}.NewRecord()
+	name, err = exporter.getLogName(&r)
+	require.NoError(t, err)
+	assert.Equal(t, "custom", name)
+
+	exporter.o.defaultLogName = ""
+	r = logtest.RecordFactory{}.NewRecord()
+	_, err = exporter.getLogName(&r)
+	assert.ErrorIs(t, err, errNoLogName)
+}
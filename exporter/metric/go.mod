@@ -7,6 +7,7 @@ toolchain go1.22.0
 require (
 	cloud.google.com/go/monitoring v1.15.1
 	github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/cloudmock v0.47.0
+	github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/descriptorcache v0.47.0
 	github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/resourcemapping v0.47.0
 	github.com/googleapis/gax-go/v2 v2.11.0
 	github.com/stretchr/testify v1.9.0
@@ -59,4 +60,6 @@ replace github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/clou
 
 replace github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/resourcemapping => ../../internal/resourcemapping
 
+replace github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/descriptorcache => ../../internal/descriptorcache
+
 retract v1.0.0-RC1
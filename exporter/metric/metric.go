@@ -29,6 +29,7 @@ import (
 	"time"
 	"unicode"
 
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/sdk/instrumentation"
 	"go.opentelemetry.io/otel/sdk/metric"
@@ -50,6 +51,7 @@ import (
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/descriptorcache"
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/resourcemapping"
 )
 
@@ -80,10 +82,13 @@ type metricExporter struct {
 	o        *options
 	shutdown chan struct{}
 	// mdCache is the cache to hold MetricDescriptor to avoid creating duplicate MD.
-	mdCache      map[key]*googlemetricpb.MetricDescriptor
-	client       *monitoring.MetricClient
-	mdLock       sync.RWMutex
-	shutdownOnce sync.Once
+	mdCache map[key]*googlemetricpb.MetricDescriptor
+	// descriptorCache persists the metric descriptors created across
+	// restarts. It is nil unless WithMetricDescriptorCache is used.
+	descriptorCache *descriptorcache.Cache
+	client          *monitoring.MetricClient
+	mdLock          sync.RWMutex
+	shutdownOnce    sync.Once
 }
 
 // ForceFlush does nothing, the exporter holds no state.
@@ -94,7 +99,7 @@ func (e *metricExporter) Shutdown(ctx context.Context) error {
 	err := errShutdown
 	e.shutdownOnce.Do(func() {
 		close(e.shutdown)
-		err = errors.Join(ctx.Err(), e.client.Close())
+		err = errors.Join(ctx.Err(), e.saveDescriptorCache(true), e.client.Close())
 	})
 	return err
 }
@@ -133,6 +138,14 @@ func newMetricExporter(o *options) (*metricExporter, error) {
 		client:   client,
 		shutdown: make(chan struct{}),
 	}
+	if o.metricDescriptorCacheDirectory != "" {
+		e.descriptorCache = descriptorcache.New(o.metricDescriptorCacheDirectory, o.metricDescriptorCacheTTL)
+		// A missing or corrupt cache only means descriptors are created
+		// again, as if the cache wasn't persisted.
+		if err := e.descriptorCache.Load(); err != nil {
+			otel.Handle(fmt.Errorf("failed to load metric descriptor cache: %w", err))
+		}
+	}
 	return e, nil
 }
 
@@ -199,15 +212,42 @@ func (me *metricExporter) exportMetricDescriptor(ctx context.Context, rm *metric
 	// See details in #26.
 	var errs []error
 	for kmd, md := range mds {
+		if me.descriptorCache != nil && me.descriptorCache.Contains(descriptorcache.Key("projects/"+me.o.projectID, md)) {
+			// The descriptor was created before the application restarted.
+			me.mdCache[kmd] = md
+			continue
+		}
 		err := me.createMetricDescriptorIfNeeded(ctx, md)
 		if err == nil {
 			me.mdCache[kmd] = md
+			if me.descriptorCache != nil {
+				me.descriptorCache.Add(descriptorcache.Key("projects/"+me.o.projectID, md))
+			}
 		}
 		errs = append(errs, err)
 	}
+	if me.descriptorCache != nil {
+		if err := me.descriptorCache.Save(false); err != nil {
+			otel.Handle(fmt.Errorf("failed to save metric descriptor cache: %w", err))
+		}
+	}
 	return errors.Join(errs...)
 }
 
+// saveDescriptorCache saves the metric descriptor cache, if enabled. Unless
+// force is true, it is saved at most once per descriptorcache.SaveInterval.
+func (me *metricExporter) saveDescriptorCache(force bool) error {
+	if me.descriptorCache == nil {
+		return nil
+	}
+	me.mdLock.Lock()
+	defer me.mdLock.Unlock()
+	if err := me.descriptorCache.Save(force); err != nil {
+		return fmt.Errorf("failed to save metric descriptor cache: %w", err)
+	}
+	return nil
+}
+
 func (me *metricExporter) createMetricDescriptorIfNeeded(ctx context.Context, md *googlemetricpb.MetricDescriptor) error {
 	mdReq := &monitoringpb.GetMetricDescriptorRequest{
 		Name: fmt.Sprintf("projects/%s/metricDescriptors/%s", me.o.projectID, md.Type),
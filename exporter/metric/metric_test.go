@@ -1315,3 +1315,46 @@ func TestBatchingExport(t *testing.T) {
 		})
 	}
 }
+
+func TestExportWithMetricDescriptorCache(t *testing.T) {
+	testServer, err := cloudmock.NewMetricTestServer()
+	//nolint:errcheck
+	go testServer.Serve()
+	defer testServer.Shutdown()
+	assert.NoError(t, err)
+
+	clientOpts := []option.ClientOption{
+		option.WithEndpoint(testServer.Endpoint),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// export starts an exporter which records a counter, and shuts it down.
+	export := func(ttl time.Duration) {
+		exporter, err := New(
+			WithProjectID("PROJECT_ID_NOT_REAL"),
+			WithMonitoringClientOptions(clientOpts...),
+			WithMetricDescriptorTypeFormatter(formatter),
+			WithMetricDescriptorCache(dir, ttl),
+		)
+		require.NoError(t, err)
+		provider := metric.NewMeterProvider(metric.WithReader(metric.NewPeriodicReader(exporter)))
+		counter, err := provider.Meter("test").Int64Counter("counter-a")
+		require.NoError(t, err)
+		counter.Add(ctx, 1)
+		require.NoError(t, provider.Shutdown(ctx))
+	}
+
+	export(time.Hour)
+	require.Len(t, testServer.CreateMetricDescriptorRequests(), 1)
+
+	// The descriptor created before the restart is not created again.
+	export(time.Hour)
+	assert.Empty(t, testServer.CreateMetricDescriptorRequests())
+
+	// The descriptor is created again once the TTL expires.
+	export(time.Nanosecond)
+	assert.Len(t, testServer.CreateMetricDescriptorRequests(), 1)
+}
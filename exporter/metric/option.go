@@ -17,6 +17,7 @@ package metric
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -76,6 +77,14 @@ type options struct {
 	// createServiceTimeSeries sets whether to create timeseries using `CreateServiceTimeSeries`.
 	// Implicitly, this sets `disableCreateMetricDescriptors` to true.
 	createServiceTimeSeries bool
+
+	// metricDescriptorCacheDirectory, if set, is the directory in which the
+	// metric descriptors created are saved, so they are not created again
+	// after restarts.
+	metricDescriptorCacheDirectory string
+	// metricDescriptorCacheTTL is how long metric descriptors are cached
+	// after they are created.
+	metricDescriptorCacheTTL time.Duration
 }
 
 // WithProjectID sets Google Cloud Platform project as projectID.
@@ -172,3 +181,16 @@ func WithCreateServiceTimeSeries() func(o *options) {
 		o.disableCreateMetricDescriptors = true
 	}
 }
+
+// WithMetricDescriptorCache saves the metric descriptors created by the
+// exporter in directory, by project, metric type, labels, kind, value type and
+// unit, so that they are not created again when the application restarts.
+// Descriptors are created again once ttl has passed since they were created.
+// If ttl is not positive, it defaults to 24 hours. The cache is saved at most
+// every 10 seconds, and when the exporter shuts down.
+func WithMetricDescriptorCache(directory string, ttl time.Duration) func(o *options) {
+	return func(o *options) {
+		o.metricDescriptorCacheDirectory = directory
+		o.metricDescriptorCacheTTL = ttl
+	}
+}
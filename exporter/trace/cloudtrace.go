@@ -26,6 +26,7 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	traceapi "cloud.google.com/go/trace/apiv2"
+	"cloud.google.com/go/trace/apiv2/tracepb"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 )
@@ -201,6 +202,20 @@ func (e *Exporter) ExportSpans(ctx context.Context, spanData []sdktrace.ReadOnly
 	return e.traceExporter.ExportSpans(ctx, spanData)
 }
 
+// BatchWriteSpansRequests converts spans to the BatchWriteSpansRequests that
+// ExportSpans would send, with one request for each destination project.
+// Together with UploadBatchWriteSpansRequest, it allows callers to buffer
+// requests before they are sent, such as in a write-ahead log.
+func (e *Exporter) BatchWriteSpansRequests(spanData []sdktrace.ReadOnlySpan) []*tracepb.BatchWriteSpansRequest {
+	return e.traceExporter.batchWriteSpansRequests(spanData)
+}
+
+// UploadBatchWriteSpansRequest sends a single BatchWriteSpansRequest to
+// Stackdriver Trace.
+func (e *Exporter) UploadBatchWriteSpansRequest(ctx context.Context, req *tracepb.BatchWriteSpansRequest) error {
+	return e.traceExporter.uploadFn(ctx, req)
+}
+
 // Shutdown waits for exported data to be uploaded.
 //
 // For our purposes it closed down the client.
@@ -19,12 +19,16 @@ import (
 	"context"
 	"net"
 	"regexp"
+	"sort"
 	"testing"
 	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.opentelemetry.io/otel/trace"
 
 	"cloud.google.com/go/trace/apiv2/tracepb"
@@ -314,3 +318,45 @@ func TestExporter_ExportWithUserAgent(t *testing.T) {
 	ua := <-ch
 	require.Regexp(t, "opentelemetry-go .*; google-cloud-trace-exporter .*", ua[0])
 }
+
+func TestExporter_BatchWriteSpansRequests(t *testing.T) {
+	// Initialize the mock server
+	testServer, err := cloudmock.NewTracesTestServer()
+	require.NoError(t, err)
+	go testServer.Serve()
+	defer testServer.Shutdown()
+	clientOpt := []option.ClientOption{
+		option.WithEndpoint(testServer.Endpoint),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+
+	exporter, err := New(
+		WithProjectID("PROJECT_ID_NOT_REAL"),
+		WithTraceClientOptions(clientOpt))
+	require.NoError(t, err)
+	//nolint:errcheck
+	defer exporter.Shutdown(context.Background())
+
+	spans := tracetest.SpanStubs{
+		{Name: "default-project-span"},
+		{
+			Name:     "other-project-span",
+			Resource: resource.NewSchemaless(attribute.String("gcp.project.id", "OTHER_PROJECT")),
+		},
+	}.Snapshots()
+	reqs := exporter.BatchWriteSpansRequests(spans)
+	require.Len(t, reqs, 2)
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Name < reqs[j].Name })
+	assert.Equal(t, "projects/OTHER_PROJECT", reqs[0].GetName())
+	require.Len(t, reqs[0].GetSpans(), 1)
+	assert.Equal(t, "other-project-span", reqs[0].GetSpans()[0].GetDisplayName().GetValue())
+	assert.Equal(t, "projects/PROJECT_ID_NOT_REAL", reqs[1].GetName())
+	require.Len(t, reqs[1].GetSpans(), 1)
+	assert.Equal(t, "default-project-span", reqs[1].GetSpans()[0].GetDisplayName().GetValue())
+
+	for _, req := range reqs {
+		require.NoError(t, exporter.UploadBatchWriteSpansRequest(context.Background(), req))
+	}
+	assert.Len(t, testServer.CreateBatchWriteSpansRequests(), 2)
+}
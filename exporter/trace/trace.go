@@ -60,20 +60,29 @@ func newTraceExporter(o *options) (*traceExporter, error) {
 
 func (e *traceExporter) ExportSpans(ctx context.Context, spanData []sdktrace.ReadOnlySpan) error {
 	// Ship the whole bundle o data.
+	var errs []error
+	for _, req := range e.batchWriteSpansRequests(spanData) {
+		errs = append(errs, e.uploadFn(ctx, req))
+	}
+	return errors.Join(errs...)
+}
+
+// batchWriteSpansRequests converts spans to BatchWriteSpansRequests, with one
+// request for each destination project.
+func (e *traceExporter) batchWriteSpansRequests(spanData []sdktrace.ReadOnlySpan) []*tracepb.BatchWriteSpansRequest {
 	results := make(map[string][]*tracepb.Span)
 	for _, sd := range spanData {
 		span, project := e.protoFromReadOnlySpan(sd)
 		results[project] = append(results[project], span)
 	}
-	var errs []error
+	reqs := make([]*tracepb.BatchWriteSpansRequest, 0, len(results))
 	for projectID, spans := range results {
-		req := &tracepb.BatchWriteSpansRequest{
+		reqs = append(reqs, &tracepb.BatchWriteSpansRequest{
 			Name:  "projects/" + projectID,
 			Spans: spans,
-		}
-		errs = append(errs, e.uploadFn(ctx, req))
+		})
 	}
-	return errors.Join(errs...)
+	return reqs
 }
 
 // ConvertSpan converts a ReadOnlySpan to Stackdriver Trace.
@@ -0,0 +1,163 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package descriptorcache contains the cache of created metric descriptors
+// which is preserved across restarts, shared by the collector and SDK metric
+// exporters.
+package descriptorcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+const (
+	// FileName is the name of the file in the configured directory which
+	// stores the metric descriptors created.
+	FileName = "gcp_metric_descriptor_cache"
+	// DefaultTTL is how long descriptors are cached when no TTL is set.
+	DefaultTTL = 24 * time.Hour
+	// SaveInterval is the minimum interval between writes of the cache file,
+	// so that creating many descriptors doesn't rewrite the file for each of
+	// them.
+	SaveInterval = 10 * time.Second
+)
+
+// Cache records when metric descriptors were created, by project, metric type
+// and descriptor hash, in a file which is preserved across restarts. It is not
+// safe for concurrent use.
+type Cache struct {
+	created map[string]time.Time
+	// Now returns the current time. It is replaced in tests.
+	Now func() time.Time
+	// lastSave is when the cache file was last written.
+	lastSave time.Time
+	path     string
+	ttl      time.Duration
+	// dirty is true if descriptors were added since the cache was last saved.
+	dirty bool
+}
+
+// New returns a cache saved in directory, which keeps descriptors for ttl
+// after they are created. If ttl is not positive, DefaultTTL is used.
+func New(directory string, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Cache{
+		created: make(map[string]time.Time),
+		Now:     time.Now,
+		path:    filepath.Join(directory, FileName),
+		ttl:     ttl,
+	}
+}
+
+// Key returns the key of a descriptor created in the project with the
+// resource name projectName, e.g. "projects/my-project". It includes a hash
+// of the descriptor's labels, kind, value type and unit, so that a descriptor
+// which changed isn't found in the cache.
+func Key(projectName string, md *metricpb.MetricDescriptor) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s|%s", md.GetMetricKind(), md.GetValueType(), md.GetUnit())
+	keys := make([]string, 0, len(md.GetLabels()))
+	for _, l := range md.GetLabels() {
+		keys = append(keys, l.GetKey())
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "|%s", k)
+	}
+	return fmt.Sprintf("%s/%s#%x", projectName, md.GetType(), h.Sum64())
+}
+
+// Load reads the descriptors saved by a previous run, if any. Descriptors
+// created longer than the TTL ago are dropped.
+func (c *Cache) Load() error {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var created map[string]time.Time
+	if err := json.Unmarshal(data, &created); err != nil {
+		return err
+	}
+	for key, t := range created {
+		if c.fresh(t) {
+			c.created[key] = t
+		}
+	}
+	return nil
+}
+
+// Contains returns true if the descriptor with the key was created less than
+// the TTL ago.
+func (c *Cache) Contains(key string) bool {
+	t, ok := c.created[key]
+	return ok && c.fresh(t)
+}
+
+func (c *Cache) fresh(created time.Time) bool {
+	return c.Now().Sub(created) < c.ttl
+}
+
+// Add records that the descriptor with the key was created. It is saved by
+// the next call to Save.
+func (c *Cache) Add(key string) {
+	c.created[key] = c.Now()
+	c.dirty = true
+}
+
+// Save writes the cache file if descriptors were added since it was last
+// saved, and it was last saved at least SaveInterval ago or force is true.
+// Expired descriptors are removed when saving. The cache is written to a
+// temporary file first, so a crash while saving doesn't corrupt the previously
+// saved cache.
+func (c *Cache) Save(force bool) error {
+	if !c.dirty || (!force && c.Now().Sub(c.lastSave) < SaveInterval) {
+		return nil
+	}
+	for key, t := range c.created {
+		if !c.fresh(t) {
+			delete(c.created, key)
+		}
+	}
+	data, err := json.Marshal(c.created)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	c.lastSave = c.Now()
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package descriptorcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/label"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+func TestCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte("not json"), 0o600))
+	cache := New(dir, time.Hour)
+	assert.Error(t, cache.Load())
+	assert.False(t, cache.Contains("projects/myproject/workload.googleapis.com/requests"))
+}
+
+func TestKeyIncludesDescriptor(t *testing.T) {
+	descriptor := func(unit string, labelKeys ...string) *metricpb.MetricDescriptor {
+		md := &metricpb.MetricDescriptor{
+			Type:       "workload.googleapis.com/requests",
+			MetricKind: metricpb.MetricDescriptor_CUMULATIVE,
+			ValueType:  metricpb.MetricDescriptor_INT64,
+			Unit:       unit,
+		}
+		for _, k := range labelKeys {
+			md.Labels = append(md.Labels, &label.LabelDescriptor{Key: k})
+		}
+		return md
+	}
+	key := Key("projects/myproject", descriptor("", "a", "b"))
+	assert.Equal(t, key, Key("projects/myproject", descriptor("", "b", "a")))
+	assert.NotEqual(t, key, Key("projects/otherproject", descriptor("", "a", "b")))
+	assert.NotEqual(t, key, Key("projects/myproject", descriptor("", "a", "b", "c")))
+	assert.NotEqual(t, key, Key("projects/myproject", descriptor("ms", "a", "b")))
+}
+
+func TestExpired(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	cache := New(dir, time.Hour)
+	cache.Now = func() time.Time { return now }
+	cache.Add("key")
+	require.NoError(t, cache.Save(false))
+
+	loaded := New(dir, time.Hour)
+	loaded.Now = func() time.Time { return now.Add(2 * time.Hour) }
+	require.NoError(t, loaded.Load())
+	assert.False(t, loaded.Contains("key"), "descriptors created before the TTL are not loaded")
+}
+
+func TestSaveInterval(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	cache := New(dir, 0)
+	cache.Now = func() time.Time { return now }
+	load := func() *Cache {
+		loaded := New(dir, 0)
+		loaded.Now = cache.Now
+		require.NoError(t, loaded.Load())
+		return loaded
+	}
+
+	cache.Add("first")
+	require.NoError(t, cache.Save(false))
+	assert.True(t, load().Contains("first"), "first descriptor is saved immediately")
+
+	cache.Add("second")
+	require.NoError(t, cache.Save(false))
+	assert.False(t, load().Contains("second"), "save is delayed until the save interval passes")
+
+	now = now.Add(SaveInterval)
+	require.NoError(t, cache.Save(false))
+	assert.True(t, load().Contains("second"))
+
+	cache.Add("third")
+	require.NoError(t, cache.Save(true))
+	assert.True(t, load().Contains("third"), "forced save is not delayed")
+}
@@ -0,0 +1,17 @@
+module github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/descriptorcache
+
+go 1.21
+
+toolchain go1.22.0
+
+require (
+	github.com/stretchr/testify v1.9.0
+	google.golang.org/genproto/googleapis/api v0.0.0-20230726155614-23370e0ffb3e
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
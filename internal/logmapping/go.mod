@@ -0,0 +1,21 @@
+module github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/logmapping
+
+go 1.21
+
+toolchain go1.22.0
+
+require (
+	cloud.google.com/go/logging v1.9.0
+	google.golang.org/genproto v0.0.0-20240227224415-6ceb2ff114de
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	cloud.google.com/go/longrunning v0.5.5 // indirect
+	golang.org/x/net v0.23.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240227224415-6ceb2ff114de // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240227224415-6ceb2ff114de // indirect
+	google.golang.org/grpc v1.63.2 // indirect
+)
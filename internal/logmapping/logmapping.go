@@ -0,0 +1,235 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logmapping contains the mapping of OpenTelemetry log records to
+// Cloud Logging LogEntries which is shared by the collector and SDK log
+// exporters.
+package logmapping
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
+	logtypepb "google.golang.org/genproto/googleapis/logging/type"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	DefaultMaxEntrySize   = 256000   // 256 KB
+	DefaultMaxRequestSize = 10000000 // 10 MB
+
+	// ErrorSeverityNumber is the lowest OTel severity number of errors.
+	ErrorSeverityNumber = 17
+)
+
+// severityMapping maps the integer severity level values from OTel [0-24]
+// to matching Cloud Logging severity levels.
+var severityMapping = []logtypepb.LogSeverity{
+	logtypepb.LogSeverity_DEFAULT,   // Default, 0
+	logtypepb.LogSeverity_DEBUG,     //
+	logtypepb.LogSeverity_DEBUG,     //
+	logtypepb.LogSeverity_DEBUG,     //
+	logtypepb.LogSeverity_DEBUG,     //
+	logtypepb.LogSeverity_DEBUG,     //
+	logtypepb.LogSeverity_DEBUG,     //
+	logtypepb.LogSeverity_DEBUG,     //
+	logtypepb.LogSeverity_DEBUG,     // 1-8 -> Debug
+	logtypepb.LogSeverity_INFO,      //
+	logtypepb.LogSeverity_INFO,      // 9-10 -> Info
+	logtypepb.LogSeverity_NOTICE,    //
+	logtypepb.LogSeverity_NOTICE,    // 11-12 -> Notice
+	logtypepb.LogSeverity_WARNING,   //
+	logtypepb.LogSeverity_WARNING,   //
+	logtypepb.LogSeverity_WARNING,   //
+	logtypepb.LogSeverity_WARNING,   // 13-16 -> Warning
+	logtypepb.LogSeverity_ERROR,     //
+	logtypepb.LogSeverity_ERROR,     //
+	logtypepb.LogSeverity_ERROR,     //
+	logtypepb.LogSeverity_ERROR,     // 17-20 -> Error
+	logtypepb.LogSeverity_CRITICAL,  //
+	logtypepb.LogSeverity_CRITICAL,  // 21-22 -> Critical
+	logtypepb.LogSeverity_ALERT,     // 23 -> Alert
+	logtypepb.LogSeverity_EMERGENCY, // 24 -> Emergency
+}
+
+// otelSeverityForText maps the generic aliases of SeverityTexts to SeverityNumbers.
+// This can be useful if SeverityText is manually set to one of the values from the data
+// model in a way that doesn't automatically parse the SeverityNumber as well
+// (see https://github.com/GoogleCloudPlatform/opentelemetry-operations-go/issues/442)
+// Otherwise, this is the mapping that is automatically used by the Stanza log severity parser
+// (https://github.com/open-telemetry/opentelemetry-collector-contrib/blob/v0.54.0/pkg/stanza/operator/helper/severity_builder.go#L34-L57)
+var otelSeverityForText = map[string]int{
+	"trace":  1,
+	"trace2": 2,
+	"trace3": 3,
+	"trace4": 4,
+	"debug":  5,
+	"debug2": 6,
+	"debug3": 7,
+	"debug4": 8,
+	"info":   9,
+	"info2":  10,
+	"info3":  11,
+	"info4":  12,
+	"warn":   13,
+	"warn2":  14,
+	"warn3":  15,
+	"warn4":  16,
+	"error":  17,
+	"error2": 18,
+	"error3": 19,
+	"error4": 20,
+	"fatal":  21,
+	"fatal2": 22,
+	"fatal3": 23,
+	"fatal4": 24,
+}
+
+// Severity returns the Cloud Logging severity for an OTel severity number.
+// It returns false if the severity number is outside of [0-24].
+func Severity(severityNumber int) (logtypepb.LogSeverity, bool) {
+	if severityNumber < 0 || severityNumber > len(severityMapping)-1 {
+		return logtypepb.LogSeverity_DEFAULT, false
+	}
+	return severityMapping[severityNumber], true
+}
+
+// SeverityNumberForText returns the OTel severity number for one of the
+// generic aliases of severity texts (e.g. "warn"), ignoring case.
+func SeverityNumberForText(text string) (int, bool) {
+	severityNumber, ok := otelSeverityForText[strings.ToLower(text)]
+	return severityNumber, ok
+}
+
+// HTTPRequest is the JSON representation of a LogEntry HttpRequest, as set in
+// the gcp.http_request attribute.
+// JSON keys derived from:
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#httprequest
+type HTTPRequest struct {
+	RemoteIP                       string `json:"remoteIp"`
+	RequestURL                     string `json:"requestUrl"`
+	Latency                        string `json:"latency"`
+	Referer                        string `json:"referer"`
+	ServerIP                       string `json:"serverIp"`
+	UserAgent                      string `json:"userAgent"`
+	RequestMethod                  string `json:"requestMethod"`
+	Protocol                       string `json:"protocol"`
+	ResponseSize                   int64  `json:"responseSize,string"`
+	RequestSize                    int64  `json:"requestSize,string"`
+	CacheFillBytes                 int64  `json:"cacheFillBytes,string"`
+	Status                         int32  `json:"status,string"`
+	CacheLookup                    bool   `json:"cacheLookup"`
+	CacheHit                       bool   `json:"cacheHit"`
+	CacheValidatedWithOriginServer bool   `json:"cacheValidatedWithOriginServer"`
+}
+
+// Proto returns the LogEntry HttpRequest. The protocol is always reported as
+// HTTP/1.1, and latencies which can't be parsed are left unset.
+func (r *HTTPRequest) Proto() *logtypepb.HttpRequest {
+	pb := &logtypepb.HttpRequest{
+		RequestMethod:                  r.RequestMethod,
+		RequestUrl:                     FixUTF8(r.RequestURL),
+		RequestSize:                    r.RequestSize,
+		Status:                         r.Status,
+		ResponseSize:                   r.ResponseSize,
+		UserAgent:                      r.UserAgent,
+		ServerIp:                       r.ServerIP,
+		RemoteIp:                       r.RemoteIP,
+		Referer:                        r.Referer,
+		CacheHit:                       r.CacheHit,
+		CacheValidatedWithOriginServer: r.CacheValidatedWithOriginServer,
+		Protocol:                       "HTTP/1.1",
+		CacheFillBytes:                 r.CacheFillBytes,
+		CacheLookup:                    r.CacheLookup,
+	}
+	if r.Latency != "" {
+		latency, err := time.ParseDuration(r.Latency)
+		if err == nil && latency != 0 {
+			pb.Latency = durationpb.New(latency)
+		}
+	}
+	return pb
+}
+
+// SplitTextPayload sets payload as the text payload of entry. If the entry
+// would be larger than maxEntrySize, the payload is split across multiple
+// copies of entry, which share a split UID derived from logName and the entry
+// timestamp.
+func SplitTextPayload(entry *logpb.LogEntry, payload string, logName string, maxEntrySize int) []*logpb.LogEntry {
+	// Calculate the size of the internal log entry so this overhead can be accounted
+	// for when determining the need to split based on payload size
+	// TODO(damemi): Find an appropriate estimated buffer to account for the LogSplit struct as well
+	overheadBytes := proto.Size(entry)
+	// Split log entries with a string payload into fewer entries
+	splits := int(math.Ceil(float64(len([]byte(payload))) / float64(maxEntrySize-overheadBytes)))
+	if splits <= 1 {
+		entry.Payload = &logpb.LogEntry_TextPayload{TextPayload: payload}
+		return []*logpb.LogEntry{entry}
+	}
+	entries := make([]*logpb.LogEntry, splits)
+	// Start by assuming all splits will be even (this may not be the case)
+	startIndex := 0
+	endIndex := int(math.Floor((1.0 / float64(splits)) * float64(len(payload))))
+	for i := 0; i < splits; i++ {
+		newEntry := proto.Clone(entry).(*logpb.LogEntry)
+		currentSplit := payload[startIndex:endIndex]
+
+		// If the current split is larger than the entry size, iterate until it is within the max
+		// (This may happen since not all characters are exactly 1 byte)
+		for len([]byte(currentSplit)) > maxEntrySize {
+			endIndex--
+			currentSplit = payload[startIndex:endIndex]
+		}
+		newEntry.Payload = &logpb.LogEntry_TextPayload{TextPayload: currentSplit}
+		newEntry.Split = &logpb.LogSplit{
+			Uid:         fmt.Sprintf("%s-%s", logName, entry.Timestamp.AsTime().String()),
+			Index:       int32(i),
+			TotalSplits: int32(splits),
+		}
+		entries[i] = newEntry
+
+		// Update slice indices to the next chunk
+		startIndex = endIndex
+		endIndex = int(math.Floor((float64(i+2) / float64(splits)) * float64(len(payload))))
+	}
+	return entries
+}
+
+// FixUTF8 is a helper that fixes an invalid UTF-8 string by replacing
+// invalid UTF-8 runes with the Unicode replacement character (U+FFFD).
+// See Issue https://github.com/googleapis/google-cloud-go/issues/1383.
+// Coped from https://github.com/googleapis/google-cloud-go/blob/69705144832c715cf23832602ad9338b911dff9a/logging/logging.go#L557
+func FixUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+
+	// Otherwise time to build the sequence.
+	buf := new(bytes.Buffer)
+	buf.Grow(len(s))
+	for _, r := range s {
+		if utf8.ValidRune(r) {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteRune('�')
+		}
+	}
+	return buf.String()
+}